@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Access log formats
+const (
+	accessFormatCLF  = "clf"
+	accessFormatJSON = "json"
+)
+
+// AccessEntry is one line of the JSON access log
+type AccessEntry struct {
+	Time         time.Time `json:"time"`
+	RemoteAddr   string    `json:"remote_addr"`
+	APIKey       string    `json:"api_key,omitempty"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	Proto        string    `json:"proto"`
+	Status       int       `json:"status"`
+	Bytes        int       `json:"bytes"`
+	DurationMs   float64   `json:"duration_ms"`
+	SynthesisMs  float64   `json:"synthesis_ms,omitempty"`
+	AudioSeconds float64   `json:"audio_seconds,omitempty"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+}
+
+// accessRecord collects what handlers learn about a request for its access
+// log line: the API key and the time spent synthesizing how much audio
+type accessRecord struct {
+	apiKey    string
+	synthesis time.Duration
+	audio     float64 // seconds
+}
+
+type accessContextKey struct{}
+
+var (
+	accessMu  sync.Mutex
+	accessOut io.Writer
+)
+
+// openAccessLog opens the access log for appending ("-" writes to stdout)
+func openAccessLog(path string) error {
+	if path == "-" {
+		accessOut = os.Stdout
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	accessOut = f
+	return nil
+}
+
+// validateAccessLogFormat checks an access log format name
+func validateAccessLogFormat(format string) error {
+	if format != accessFormatCLF && format != accessFormatJSON {
+		return fmt.Errorf("access log format must be %s or %s", accessFormatCLF, accessFormatJSON)
+	}
+	return nil
+}
+
+// requestAccessRecord returns the access record of a request, or nil when
+// access logging is disabled
+func requestAccessRecord(r *http.Request) *accessRecord {
+	rec, _ := r.Context().Value(accessContextKey{}).(*accessRecord)
+	return rec
+}
+
+// recordSynthesis adds one synthesis to a request's access record
+func (rec *accessRecord) recordSynthesis(elapsed time.Duration, audioSeconds float64) {
+	if rec != nil {
+		rec.synthesis += elapsed
+		rec.audio += audioSeconds
+	}
+}
+
+// accessRecorder captures the status and size of a response
+type accessRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *accessRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *accessRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+func (rec *accessRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands WebSocket upgrades the connection; the request is logged as 101
+func (rec *accessRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("connection does not support hijacking")
+	}
+	rec.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the connection
+func (rec *accessRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// accessLogHandler writes one access log line per request when --access-log is set
+func accessLogHandler(next http.Handler) http.Handler {
+	if accessOut == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		record := &accessRecord{}
+		rec := &accessRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessContextKey{}, record)))
+
+		entry := AccessEntry{
+			Time:         start,
+			RemoteAddr:   clientAddr(r),
+			APIKey:       record.apiKey,
+			Method:       r.Method,
+			Path:         r.URL.RequestURI(),
+			Proto:        r.Proto,
+			Status:       rec.status,
+			Bytes:        rec.bytes,
+			DurationMs:   float64(time.Since(start).Microseconds()) / 1000,
+			SynthesisMs:  float64(record.synthesis.Microseconds()) / 1000,
+			AudioSeconds: record.audio,
+			UserAgent:    r.UserAgent(),
+		}
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		writeAccessEntry(entry)
+	})
+}
+
+// writeAccessEntry appends one line to the access log. The CLF line is the
+// Common Log Format (with the API key name as the user) followed by the
+// synthesis time in ms and the audio duration in seconds, "-" when there were none
+func writeAccessEntry(entry AccessEntry) {
+	var line []byte
+	if config.AccessLogFormat == accessFormatJSON {
+		var err error
+		if line, err = json.Marshal(entry); err != nil {
+			log.Printf("Access log: failed to encode entry: %v", err)
+			return
+		}
+	} else {
+		user, synthesis, audio := "-", "-", "-"
+		if entry.APIKey != "" {
+			user = entry.APIKey
+		}
+		if entry.SynthesisMs > 0 {
+			synthesis = strconv.FormatFloat(entry.SynthesisMs, 'f', 0, 64)
+			audio = strconv.FormatFloat(entry.AudioSeconds, 'f', 3, 64)
+		}
+		line = fmt.Appendf(nil, "%s - %s [%s] %q %d %d %s %s", entry.RemoteAddr, user,
+			entry.Time.Format("02/Jan/2006:15:04:05 -0700"), entry.Method+" "+entry.Path+" "+entry.Proto,
+			entry.Status, entry.Bytes, synthesis, audio)
+	}
+
+	accessMu.Lock()
+	defer accessMu.Unlock()
+	if _, err := accessOut.Write(append(line, '\n')); err != nil {
+		log.Printf("Access log: failed to write entry: %v", err)
+	}
+}
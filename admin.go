@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ModelLoadRequest asks the server to hot-swap a model pack
+type ModelLoadRequest struct {
+	Model   string   `json:"model"`
+	Aliases []string `json:"aliases"`
+}
+
+// requireAdmin wraps a handler so it only runs for requests carrying the admin token.
+// Admin endpoints are disabled entirely when no token is configured
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.AdminToken == "" {
+			sendError(w, "Admin API is disabled (start the server with --admin-token)", http.StatusNotFound)
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+			log.Printf("Rejected admin request to %s from %s", r.URL.Path, r.RemoteAddr)
+			sendError(w, "Invalid admin token", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// handleAdminModels lists loaded model packs and aliases
+func handleAdminModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	modelsMu.RLock()
+	aliases := make(map[string]string, len(modelAliases))
+	for alias, pack := range modelAliases {
+		aliases[alias] = pack
+	}
+	modelsMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"loaded":  loadedEngines(),
+		"aliases": aliases,
+		"models":  availableModels(),
+	})
+}
+
+// handleAdminModelLoad loads and warms a model pack, then switches traffic to it
+func handleAdminModelLoad(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if config.Stateless {
+		sendError(w, "Model hot-swap only affects one replica and is disabled in stateless mode; roll out a new deployment instead", http.StatusConflict)
+		return
+	}
+
+	var req ModelLoadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Model == "" {
+		sendError(w, "model is required", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Admin: loading model pack %s (aliases: %v)", req.Model, req.Aliases)
+	warmup, err := swapModelPack(req.Model, req.Aliases)
+	if err != nil {
+		log.Printf("Admin: model load failed: %v", err)
+		sendError(w, "Model load failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "switched",
+		"model":          req.Model,
+		"aliases":        req.Aliases,
+		"warmup_seconds": warmup.Seconds(),
+	})
+}
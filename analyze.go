@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"go-supertonic/tts"
+)
+
+// handleTextAnalyze returns the text front-end stages and predicted durations
+// for an input, without synthesizing audio. It accepts the same body as /v1/audio/speech
+func handleTextAnalyze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TTSRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.key = requestAPIKey(r)
+	if err := runPreValidateHooks(r, &req); err != nil {
+		sendError(w, err.Error(), validationStatus(w, err))
+		return
+	}
+	if err := validateRequest(&req); err != nil {
+		sendError(w, err.Error(), validationStatus(w, err))
+		return
+	}
+
+	chunks, err := analyzeText(&req)
+	if err != nil {
+		log.Printf("Analyze Error: %v", err)
+		sendError(w, "Text analysis failed: "+err.Error(), speechErrorStatus(w, err))
+		return
+	}
+
+	total := float32(0)
+	for i, chunk := range chunks {
+		total += chunk.Duration
+		if i > 0 && !chunk.JoinsPrevious {
+			total += float32(*req.SilenceDuration)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"input":            req.Input,
+		"input_type":       req.InputType,
+		"model":            req.Model,
+		"voice":            req.Voice,
+		"language":         req.Language,
+		"chunks":           chunks,
+		"duration_seconds": total,
+	})
+}
+
+// analyzeText runs tts.Analyze for a validated request
+func analyzeText(req *TTSRequest) ([]tts.ChunkAnalysis, error) {
+	pack, err := resolveModelPack(req.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	eng, err := acquireEngine(pack)
+	if err != nil {
+		return nil, err
+	}
+	defer eng.release()
+
+	voicePath, err := voiceStylePath(req, pack)
+	if err != nil {
+		return nil, err
+	}
+	style, err := tts.LoadVoiceStyle([]string{voicePath}, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load voice style: %w", err)
+	}
+	defer style.Destroy()
+
+	textToSpeech := eng.worker(0)
+	text, err := speechText(req, textToSpeech)
+	if err != nil {
+		return nil, err
+	}
+	return textToSpeech.Analyze(text, req.Language, style, float32(req.Speed))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiKey is one entry of the --api-keys file. Voices lists the voices the key
+// may use as names or path.Match patterns (e.g. "acme-*"); empty allows all.
+// The monthly quotas cap input characters and audio seconds (0 is unlimited);
+// weight is the key's share of the job workers when tenants queue (default 1)
+type apiKey struct {
+	Key            string   `json:"key"`
+	Name           string   `json:"name"`
+	Voices         []string `json:"voices,omitempty"`
+	MonthlyChars   int64    `json:"monthly_characters,omitempty"`
+	MonthlySeconds float64  `json:"monthly_seconds,omitempty"`
+	Weight         int      `json:"weight,omitempty"`
+}
+
+// apiKeys maps the SHA-256 of each key to its entry, so lookups do not
+// compare secrets byte by byte; nil when API keys are disabled
+var apiKeys map[[sha256.Size]byte]*apiKey
+
+type apiKeyContextKey struct{}
+
+// errVoiceForbidden is returned by validateRequest when the request's API key
+// may not use its voice
+var errVoiceForbidden = errors.New("voice not allowed for this API key")
+
+// loadAPIKeys reads the JSON list of API keys and their voice lists
+func loadAPIKeys(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read API keys: %w", err)
+	}
+	var keys []*apiKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("invalid API keys file: %w", err)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("API keys file %s is empty", file)
+	}
+
+	apiKeys = make(map[[sha256.Size]byte]*apiKey, len(keys))
+	for i, key := range keys {
+		if key.Key == "" {
+			return fmt.Errorf("API key %d has no key", i+1)
+		}
+		if key.Name == "" {
+			key.Name = fmt.Sprintf("key-%d", i+1)
+		}
+		if key.MonthlyChars < 0 || key.MonthlySeconds < 0 || key.Weight < 0 {
+			return fmt.Errorf("API key %s: quotas and weight must not be negative", key.Name)
+		}
+		for _, pattern := range key.Voices {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("API key %s: invalid voice pattern %q", key.Name, pattern)
+			}
+		}
+		apiKeys[sha256.Sum256([]byte(key.Key))] = key
+	}
+	return nil
+}
+
+// requireAPIKey wraps a handler so it only runs for requests carrying a key
+// from --api-keys, which validateRequest later checks the voice against.
+// Without --api-keys every request is let through
+func requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiKeys == nil {
+			next(w, r)
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		key := apiKeys[sha256.Sum256([]byte(token))]
+		if token == "" || key == nil {
+			log.Printf("Rejected request to %s from %s: invalid API key", r.URL.Path, clientAddr(r))
+			sendError(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		if entry, ok := r.Context().Value(auditContextKey{}).(*AuditEntry); ok {
+			entry.APIKey = key.Name
+		}
+		if record := requestAccessRecord(r); record != nil {
+			record.apiKey = key.Name
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	}
+}
+
+// apiKeyFromQuery lets clients that cannot set headers, such as Twilio's
+// <Stream> and podcast apps, pass their API key as ?api_key= to requireAPIKey
+func apiKeyFromQuery(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("api_key"); token != "" && r.Header.Get("Authorization") == "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next(w, r)
+	}
+}
+
+// requestAPIKey returns the API key a request was authorized with, or nil
+func requestAPIKey(r *http.Request) *apiKey {
+	key, _ := r.Context().Value(apiKeyContextKey{}).(*apiKey)
+	return key
+}
+
+// allowsVoice reports whether the key may synthesize with voice; a nil key
+// (API keys disabled, or a non-HTTP frontend) allows every built-in voice
+func (key *apiKey) allowsVoice(voice string) bool {
+	// Custom voices belong to the key they were uploaded with
+	if owner, _, namespaced := splitVoiceNamespace(voice); namespaced {
+		return key != nil && owner == key.Name
+	}
+	if key == nil || len(key.Voices) == 0 {
+		return true
+	}
+	for _, pattern := range key.Voices {
+		if ok, _ := path.Match(pattern, voice); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validationStatus is the HTTP status for a validateRequest error
+func validationStatus(w http.ResponseWriter, err error) int {
+	var quota *quotaError
+	var refused *HookError
+	switch {
+	case errors.Is(err, errVoiceForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, errModelUnavailable):
+		w.Header().Set("Retry-After", strconv.Itoa(int(packLoadRetry.Seconds())))
+		return http.StatusServiceUnavailable
+	case errors.As(err, &refused) && refused.Status != 0:
+		return refused.Status
+	case errors.As(err, &quota):
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(quota.Resets).Seconds())+1))
+		return http.StatusTooManyRequests
+	}
+	return http.StatusBadRequest
+}
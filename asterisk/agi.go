@@ -0,0 +1,89 @@
+package asterisk
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// AGI is a minimal Asterisk Gateway Interface session over stdin/stdout
+type AGI struct {
+	Env    map[string]string // agi_* variables sent by Asterisk, without the prefix
+	reader *bufio.Reader
+	writer io.Writer
+}
+
+// NewAGI reads the AGI environment from Asterisk on stdin
+func NewAGI() (*AGI, error) {
+	return NewAGIWith(os.Stdin, os.Stdout)
+}
+
+// NewAGIWith reads the AGI environment from r and sends commands to w
+// (useful for FastAGI, where both sides are a TCP connection)
+func NewAGIWith(r io.Reader, w io.Writer) (*AGI, error) {
+	agi := &AGI{Env: map[string]string{}, reader: bufio.NewReader(r), writer: w}
+	for {
+		line, err := agi.reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read AGI environment: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return agi, nil
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if ok {
+			agi.Env[strings.TrimPrefix(name, "agi_")] = strings.TrimSpace(value)
+		}
+	}
+}
+
+// Command sends one AGI command and returns its result code and the rest of the response line
+func (a *AGI) Command(command string) (int, string, error) {
+	if _, err := fmt.Fprintf(a.writer, "%s\n", command); err != nil {
+		return 0, "", err
+	}
+	line, err := a.reader.ReadString('\n')
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read AGI response: %w", err)
+	}
+	line = strings.TrimSpace(line)
+
+	// Responses look like "200 result=0 (extra)"
+	status, rest, _ := strings.Cut(line, " ")
+	if status != "200" {
+		return 0, line, fmt.Errorf("AGI command %q failed: %s", command, line)
+	}
+	value, extra, _ := strings.Cut(strings.TrimPrefix(rest, "result="), " ")
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, line, fmt.Errorf("unexpected AGI response: %s", line)
+	}
+	return result, extra, nil
+}
+
+// StreamFile plays a sound file (path without extension). It returns the
+// digit pressed to interrupt playback, or 0 if none
+func (a *AGI) StreamFile(path, escapeDigits string) (rune, error) {
+	result, _, err := a.Command(fmt.Sprintf("STREAM FILE %s %q", path, escapeDigits))
+	if err != nil {
+		return 0, err
+	}
+	if result < 0 {
+		return 0, fmt.Errorf("playback of %s failed", path)
+	}
+	return rune(result), nil
+}
+
+// Speak synthesizes text through the cache (if not cached yet) and plays it
+func (a *AGI) Speak(ctx context.Context, cache *PromptCache, text, escapeDigits string) (rune, error) {
+	path, err := cache.Path(ctx, text)
+	if err != nil {
+		return 0, err
+	}
+	return a.StreamFile(path, escapeDigits)
+}
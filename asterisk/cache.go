@@ -0,0 +1,155 @@
+// Package asterisk plays Supertonic prompts from Asterisk dialplans (AGI) and
+// ARI applications. Prompts are synthesized by a running Supertonic server as
+// 8 kHz µ-law and cached on disk by prompt text, so repeated prompts cost one
+// file lookup
+package asterisk
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PromptCache synthesizes prompts through a Supertonic server and keeps them
+// as .ulaw files in Dir. Point Dir inside Asterisk's sounds directory (e.g.
+// /var/lib/asterisk/sounds/supertonic) so the files can be played by name
+type PromptCache struct {
+	ServerURL string // e.g. http://localhost:8880
+	Dir       string
+	Voice     string
+	Speed     float64
+	Language  string
+	Client    *http.Client
+}
+
+// speechRequest is the subset of the server's speech request the cache sends
+type speechRequest struct {
+	Model          string  `json:"model"`
+	Input          string  `json:"input"`
+	Voice          string  `json:"voice,omitempty"`
+	Speed          float64 `json:"speed,omitempty"`
+	Language       string  `json:"language,omitempty"`
+	ResponseFormat string  `json:"response_format"`
+}
+
+// NewPromptCache returns a cache using the server's default voice
+func NewPromptCache(serverURL, dir string) *PromptCache {
+	return &PromptCache{
+		ServerURL: strings.TrimRight(serverURL, "/"),
+		Dir:       dir,
+		Client:    &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Path returns the path of the cached prompt without its extension, the form
+// Asterisk's Playback, STREAM FILE and ARI sound: URIs expect. The prompt is
+// synthesized on first use
+func (c *PromptCache) Path(ctx context.Context, text string) (string, error) {
+	base := filepath.Join(c.Dir, c.key(text))
+	if _, err := os.Stat(base + ".ulaw"); err == nil {
+		return base, nil
+	}
+
+	audio, err := c.synthesize(ctx, text)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	// Write to a temp file and rename so Asterisk never plays a partial prompt
+	tmp, err := os.CreateTemp(c.Dir, ".prompt-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create prompt file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(audio); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write prompt: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write prompt: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), base+".ulaw"); err != nil {
+		return "", fmt.Errorf("failed to store prompt: %w", err)
+	}
+	return base, nil
+}
+
+// SoundURI returns an ARI media URI ("sound:<path>") for a prompt
+func (c *PromptCache) SoundURI(ctx context.Context, text string) (string, error) {
+	path, err := c.Path(ctx, text)
+	if err != nil {
+		return "", err
+	}
+	return "sound:" + path, nil
+}
+
+// Open returns a reader over the raw µ-law prompt, for ARI external media or
+// other streaming consumers
+func (c *PromptCache) Open(ctx context.Context, text string) (io.ReadCloser, error) {
+	path, err := c.Path(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path + ".ulaw")
+}
+
+// key names the cache entry for a prompt and the voice settings
+func (c *PromptCache) key(text string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%g\x00%s", text, c.Voice, c.Speed, c.Language)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// synthesize requests a µ-law rendering of text from the server
+func (c *PromptCache) synthesize(ctx context.Context, text string) ([]byte, error) {
+	body, err := json.Marshal(speechRequest{
+		Model:          "tts-1",
+		Input:          text,
+		Voice:          c.Voice,
+		Speed:          c.Speed,
+		Language:       c.Language,
+		ResponseFormat: "ulaw",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.ServerURL+"/v1/audio/speech", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("speech request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read speech response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("speech request returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
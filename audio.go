@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Response formats
+const (
+	formatWAV  = "wav"
+	formatULaw = "ulaw"
+	formatALaw = "alaw"
+)
+
+// isG711 reports whether a response format is a raw 8 kHz G.711 encoding
+func isG711(format string) bool {
+	return format == formatULaw || format == formatALaw
+}
+
+// convertToFormat encodes synthesized samples as the request's response
+// format, applying telephony conditioning first when requested or implied
+// by a G.711 format
+func convertToFormat(samples []float32, sampleRate int, req *TTSRequest) ([]byte, error) {
+	if req.Telephony || isG711(req.ResponseFormat) {
+		samples, sampleRate = telephonyCondition(samples, sampleRate)
+	}
+	if req.QualityReport {
+		q := measureQuality(samples, sampleRate)
+		req.quality = &q
+	}
+
+	return requestEncoder(req).Encode(samples, sampleRate)
+}
+
+// requestEncoder returns the encoder of the request's response format, tuned
+// to its sample format, dither and seed
+func requestEncoder(req *TTSRequest) Encoder {
+	encoder := responseFormats[req.ResponseFormat].Encoder
+	if tunable, ok := encoder.(tunableEncoder); ok {
+		encoder = tunable.forRequest(wavOptionsFor(req))
+	}
+	return encoder
+}
+
+// encodeULaw encodes 16-bit samples as raw G.711 µ-law bytes
+func encodeULaw(samples []int) []byte {
+	const bias, clip = 0x84, 32635
+
+	out := make([]byte, len(samples))
+	for i, s := range samples {
+		sign := 0
+		if s < 0 {
+			sign = 0x80
+			s = -s
+		}
+		s = min(s, clip) + bias
+
+		exponent := 7
+		for mask := 0x4000; s&mask == 0 && exponent > 0; mask >>= 1 {
+			exponent--
+		}
+		mantissa := (s >> (exponent + 3)) & 0x0F
+		out[i] = ^byte(sign | exponent<<4 | mantissa)
+	}
+	return out
+}
+
+// encodeALaw encodes 16-bit samples as raw G.711 A-law bytes
+func encodeALaw(samples []int) []byte {
+	out := make([]byte, len(samples))
+	for i, s := range samples {
+		s >>= 3 // A-law works on 13-bit magnitudes
+		mask := byte(0xD5)
+		if s < 0 {
+			mask = 0x55
+			s = -s - 1
+		}
+
+		segment := 0
+		for limit := 0x1F; s > limit && segment < 8; limit = limit<<1 | 1 {
+			segment++
+		}
+		if segment >= 8 {
+			out[i] = 0x7F ^ mask
+			continue
+		}
+
+		value := segment << 4
+		if segment < 2 {
+			value |= (s >> 1) & 0x0F
+		} else {
+			value |= (s >> segment) & 0x0F
+		}
+		out[i] = byte(value) ^ mask
+	}
+	return out
+}
+
+// WAV sample formats
+const (
+	sampleFormatS16 = "s16"
+	sampleFormatS24 = "s24"
+	sampleFormatF32 = "f32"
+)
+
+// Dither modes for integer sample formats
+const (
+	ditherNone = "none"
+	ditherTPDF = "tpdf"
+)
+
+// ditherModes lists the supported dither modes
+var ditherModes = []string{ditherNone, ditherTPDF}
+
+// wavOptions controls how float samples are encoded
+type wavOptions struct {
+	SampleFormat string
+	Dither       string
+	Seed         int64 // seeds the dither noise so seeded requests stay byte-identical
+}
+
+// sampleFormats lists the supported WAV sample formats
+var sampleFormats = []string{sampleFormatS16, sampleFormatS24, sampleFormatF32}
+
+// validateSampleFormat checks a sample format name
+func validateSampleFormat(format string) error {
+	for _, f := range sampleFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported sample_format: %s. Available: %v", format, sampleFormats)
+}
+
+// validateDither checks a dither mode name
+func validateDither(mode string) error {
+	for _, m := range ditherModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported dither: %s. Available: %v", mode, ditherModes)
+}
+
+// quantizeBlock is how many samples one goroutine quantizes at a time
+const quantizeBlock = 1 << 16
+
+// quantize converts float samples to rounded integers at the given full
+// scale, adding triangular (TPDF) noise of ±1 LSB before rounding when
+// dithering. Blocks are converted in parallel; the dither of the block at
+// offset lo is seeded with seed+lo, like consecutive streamed chunks
+func quantize(audioData []float32, scale float64, dither string, seed int64) []int {
+	data := make([]int, len(audioData))
+	parallelBlocks(len(audioData), quantizeBlock, func(lo, hi int) {
+		var rng *rand.Rand
+		if dither == ditherTPDF {
+			rng = rand.New(rand.NewSource(seed + int64(lo)))
+		}
+		quantizeInto(data[lo:hi], audioData[lo:hi], scale, rng)
+	})
+	return data
+}
+
+// quantizeInto quantizes src into dst, drawing dither noise from rng when
+// it is not nil
+func quantizeInto(dst []int, src []float32, scale float64, rng *rand.Rand) {
+	for i, sample := range src {
+		v := float64(sample) * scale
+		if rng != nil {
+			v += rng.Float64() - rng.Float64()
+		}
+		v = math.Round(v)
+		if v > scale {
+			v = scale
+		} else if v < -scale-1 {
+			v = -scale - 1
+		}
+		dst[i] = int(v)
+	}
+}
+
+// WAV format tags
+const (
+	wavFormatPCM   = 1
+	wavFormatFloat = 3
+)
+
+// wavHeaderSize is the size of a canonical RIFF header with a 16-byte fmt chunk
+const wavHeaderSize = 44
+
+// putWAVHeader writes a canonical mono WAV header for dataBytes of samples
+func putWAVHeader(header []byte, sampleRate, bitDepth, format, dataBytes int) {
+	width := bitDepth / 8
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+dataBytes))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], uint16(format))
+	binary.LittleEndian.PutUint16(header[22:], 1) // mono
+	binary.LittleEndian.PutUint32(header[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(sampleRate*width))
+	binary.LittleEndian.PutUint16(header[32:], uint16(width))
+	binary.LittleEndian.PutUint16(header[34:], uint16(bitDepth))
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(dataBytes))
+}
+
+// packPCM writes quantized samples as little-endian 16- or 24-bit PCM
+func packPCM(dst []byte, samples []int, bitDepth int) {
+	if bitDepth == 16 {
+		for i, v := range samples {
+			binary.LittleEndian.PutUint16(dst[2*i:], uint16(int16(v)))
+		}
+		return
+	}
+	for i, v := range samples {
+		dst[3*i], dst[3*i+1], dst[3*i+2] = byte(v), byte(v>>8), byte(v>>16)
+	}
+}
+
+// packFloat writes samples as little-endian IEEE 32-bit floats
+func packFloat(dst []byte, samples []float32) {
+	for i, v := range samples {
+		binary.LittleEndian.PutUint32(dst[4*i:], math.Float32bits(v))
+	}
+}
+
+// wavLayout returns the bit depth, format tag and integer full scale of a
+// sample format (scale is 0 for float)
+func wavLayout(sampleFormat string) (bitDepth, format int, scale float64) {
+	switch sampleFormat {
+	case sampleFormatF32:
+		return 32, wavFormatFloat, 0
+	case sampleFormatS24:
+		return 24, wavFormatPCM, 8388607
+	}
+	return 16, wavFormatPCM, 32767
+}
+
+// wavToBytes converts float32 WAV data to WAV file bytes, packing blocks of
+// samples in parallel. s16 and s24 are integer PCM; f32 is IEEE float and
+// keeps the model's full range
+func wavToBytes(audioData []float32, sampleRate int, opts wavOptions) []byte {
+	bitDepth, format, scale := wavLayout(opts.SampleFormat)
+	width := bitDepth / 8
+	out := make([]byte, wavHeaderSize+width*len(audioData))
+	putWAVHeader(out, sampleRate, bitDepth, format, width*len(audioData))
+
+	data := out[wavHeaderSize:]
+	if format == wavFormatFloat {
+		parallelBlocks(len(audioData), quantizeBlock, func(lo, hi int) {
+			packFloat(data[lo*width:], audioData[lo:hi])
+		})
+		return out
+	}
+	pcm := quantize(audioData, scale, opts.Dither, opts.Seed)
+	parallelBlocks(len(pcm), quantizeBlock, func(lo, hi int) {
+		packPCM(data[lo*width:], pcm[lo:hi], bitDepth)
+	})
+	return out
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// audioCacheEntry is a finished speech response and what its headers report
+type audioCacheEntry struct {
+	key       string
+	data      []byte
+	etag      string
+	duration  float64
+	chunks    int
+	truncated bool
+	speed     float64
+	quality   *audioQuality
+}
+
+// size approximates the entry's memory use in bytes
+func (e *audioCacheEntry) size() int64 {
+	return int64(len(e.data) + len(e.key) + len(e.etag))
+}
+
+// restore copies the cached synthesis details into a request
+func (e *audioCacheEntry) restore(req *TTSRequest) {
+	req.duration, req.chunks, req.truncated, req.Speed, req.quality = e.duration, e.chunks, e.truncated, e.speed, e.quality
+}
+
+// audioCache keeps recent speech responses of seeded requests, which render
+// byte-identically, so repeats skip synthesis and clients can revalidate
+// them with If-None-Match (--audio-cache-mb)
+type audioCache struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+	order *list.List // most recently used first
+	items map[string]*list.Element
+}
+
+// renders is the server's audio cache, nil when disabled
+var renders *audioCache
+
+// newAudioCache returns a cache of limit bytes, or nil when limit is 0
+func newAudioCache(limit int64) *audioCache {
+	if limit <= 0 {
+		return nil
+	}
+	return &audioCache{limit: limit, order: list.New(), items: map[string]*list.Element{}}
+}
+
+// get returns the entry for key
+func (c *audioCache) get(key string) (*audioCacheEntry, bool) {
+	if c == nil || key == "" {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*audioCacheEntry), true
+}
+
+// put stores an entry and evicts the least recently used ones over the budget
+func (c *audioCache) put(entry *audioCacheEntry) {
+	if c == nil || entry.key == "" || entry.size() > c.limit {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[entry.key]; ok {
+		c.used -= elem.Value.(*audioCacheEntry).size()
+		c.order.Remove(elem)
+	}
+	c.items[entry.key] = c.order.PushFront(entry)
+	c.used += entry.size()
+
+	for c.used > c.limit {
+		oldest := c.order.Back()
+		evicted := oldest.Value.(*audioCacheEntry)
+		c.order.Remove(oldest)
+		delete(c.items, evicted.key)
+		c.used -= evicted.size()
+	}
+}
+
+// audioCacheKey identifies a validated request's output: its effective
+// settings, the model pack directory and the voice style file (with its
+// modification time, so re-uploaded custom voices are not served stale).
+// It is empty for requests that are not cached: unseeded ones, whose seed
+// was picked at random, and responses other than plain audio
+func audioCacheKey(req *TTSRequest, seeded bool) string {
+	if renders == nil || !seeded || req.Stream || req.Preview || req.ReturnURL || len(req.SpeechMarks) > 0 || req.Visemes != "" {
+		return ""
+	}
+	pack, err := resolveModelPack(req.Model)
+	if err != nil {
+		return ""
+	}
+	voicePath, err := voiceStylePath(req, pack)
+	if err != nil {
+		return ""
+	}
+	settings, err := json.Marshal(req)
+	if err != nil {
+		return ""
+	}
+
+	h := sha256.New()
+	h.Write(settings)
+	h.Write([]byte("\x00" + pack.Dir + "\x00" + voicePath))
+	if info, err := os.Stat(voicePath); err == nil {
+		h.Write([]byte(info.ModTime().String()))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheRender stores a freshly generated response under key, unless chunks
+// were skipped (a retry may succeed)
+func cacheRender(key string, req *TTSRequest, data []byte, etag string) {
+	if key == "" || len(req.skipped) > 0 {
+		return
+	}
+	renders.put(&audioCacheEntry{
+		key:       key,
+		data:      data,
+		etag:      etag,
+		duration:  req.duration,
+		chunks:    req.chunks,
+		truncated: req.truncated,
+		speed:     req.Speed,
+		quality:   req.quality,
+	})
+}
+
+// strongETag returns a strong entity tag for response bytes
+func strongETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag. Tags that
+// compressHandler suffixed with the content encoding match the plain tag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" {
+			return true
+		}
+		for _, encoding := range []string{encodingGzip, encodingZstd} {
+			if base, ok := strings.CutSuffix(candidate, "-"+encoding+`"`); ok {
+				candidate = base + `"`
+			}
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the response's ETag and answers 304 when a GET or HEAD
+// client already holds that render. A POST always gets the audio: 304 is
+// only defined for conditional GET and HEAD
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// status describes the cache for /health
+func (c *audioCache) status() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return map[string]interface{}{
+		"entries":  c.order.Len(),
+		"bytes":    c.used,
+		"limit_mb": c.limit >> 20,
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEntry is one line of the JSONL audit log
+type AuditEntry struct {
+	Time         time.Time   `json:"time"`
+	Method       string      `json:"method"`
+	Path         string      `json:"path"`
+	RemoteAddr   string      `json:"remote_addr"`
+	UserAgent    string      `json:"user_agent,omitempty"`
+	APIKey       string      `json:"api_key,omitempty"` // key name, never the secret
+	Request      *TTSRequest `json:"request,omitempty"`
+	Status       int         `json:"status"`
+	DurationMs   float64     `json:"duration_ms"`
+	ResultBytes  int         `json:"result_bytes"`
+	ResultSHA256 string      `json:"result_sha256"`
+}
+
+type auditContextKey struct{}
+
+var (
+	auditMu   sync.Mutex
+	auditFile *os.File
+)
+
+// openAuditLog opens the audit log for appending
+func openAuditLog(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	auditFile = f
+	return nil
+}
+
+// auditRecorder captures the status and a hash of the response body
+type auditRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	hash   hash.Hash
+}
+
+func (rec *auditRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *auditRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.hash.Write(b)
+	rec.bytes += len(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *auditRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to extend write deadlines
+func (rec *auditRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// auditHandler records every request to next in the audit log when one is configured
+func auditHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if auditFile == nil {
+			next(w, r)
+			return
+		}
+
+		entry := &AuditEntry{
+			Time:       time.Now().UTC(),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			RemoteAddr: clientAddr(r),
+			UserAgent:  r.UserAgent(),
+		}
+		rec := &auditRecorder{ResponseWriter: w, hash: sha256.New()}
+		next(rec, r.WithContext(context.WithValue(r.Context(), auditContextKey{}, entry)))
+
+		entry.Status = rec.status
+		entry.DurationMs = float64(time.Since(entry.Time).Microseconds()) / 1000
+		entry.ResultBytes = rec.bytes
+		entry.ResultSHA256 = hex.EncodeToString(rec.hash.Sum(nil))
+		writeAuditEntry(entry)
+	}
+}
+
+// auditRequest attaches the effective (validated, defaulted) request to the
+// audit entry so logged requests can be replayed with the same seed
+func auditRequest(r *http.Request, req *TTSRequest) {
+	entry, ok := r.Context().Value(auditContextKey{}).(*AuditEntry)
+	if !ok {
+		return
+	}
+	logged := *req
+	if config.AuditRedactInput {
+		logged.Input = fmt.Sprintf("[redacted %d chars]", len([]rune(req.Input)))
+	}
+	entry.Request = &logged
+}
+
+// trustedProxies are the networks whose X-Forwarded-For is believed
+// (--trusted-proxies); empty means the header is ignored
+var trustedProxies []*net.IPNet
+
+// setupTrustedProxies parses the --trusted-proxies list of IPs and CIDRs
+func setupTrustedProxies(list string) error {
+	trustedProxies = nil
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 8 * len(ip)
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			trustedProxies = append(trustedProxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return fmt.Errorf("invalid network %q", entry)
+		}
+		trustedProxies = append(trustedProxies, network)
+	}
+	return nil
+}
+
+// isTrustedProxy reports whether addr is inside a --trusted-proxies network
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the caller's address. X-Forwarded-For is only honoured
+// when the connection comes from a trusted proxy, and then the chain is walked
+// from the right past other trusted proxies, since anything further left was
+// written by the client and can be forged
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			break
+		}
+		host = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// writeAuditEntry appends one entry to the audit log
+func writeAuditEntry(entry *AuditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Audit: failed to encode entry: %v", err)
+		return
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if _, err := auditFile.Write(append(line, '\n')); err != nil {
+		log.Printf("Audit: failed to write entry: %v", err)
+	}
+}
+
+// handleAdminAudit queries the audit log. Filters: since/until (RFC 3339),
+// path, voice, model, status and limit (most recent entries, default 100)
+func handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if auditFile == nil {
+		sendError(w, "Audit log is disabled (start the server with --audit-log)", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	var since, until time.Time
+	var err error
+	if v := query.Get("since"); v != "" {
+		if since, err = time.Parse(time.RFC3339, v); err != nil {
+			sendError(w, "since must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("until"); v != "" {
+		if until, err = time.Parse(time.RFC3339, v); err != nil {
+			sendError(w, "until must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+	}
+	status := 0
+	if v := query.Get("status"); v != "" {
+		if status, err = strconv.Atoi(v); err != nil {
+			sendError(w, "status must be an HTTP status code", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 100
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			sendError(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	match := func(e *AuditEntry) bool {
+		switch {
+		case !since.IsZero() && e.Time.Before(since):
+			return false
+		case !until.IsZero() && e.Time.After(until):
+			return false
+		case query.Get("path") != "" && e.Path != query.Get("path"):
+			return false
+		case status != 0 && e.Status != status:
+			return false
+		case query.Get("voice") != "" && (e.Request == nil || e.Request.Voice != query.Get("voice")):
+			return false
+		case query.Get("model") != "" && (e.Request == nil || e.Request.Model != query.Get("model")):
+			return false
+		}
+		return true
+	}
+
+	entries, err := readAuditLog(match, limit)
+	if err != nil {
+		sendError(w, "Failed to read audit log: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// readAuditLog returns the last limit entries accepted by match
+func readAuditLog(match func(*AuditEntry) bool, limit int) ([]AuditEntry, error) {
+	f, err := os.Open(auditFile.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []AuditEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if !match(&entry) {
+			continue
+		}
+		entries = append(entries, entry)
+		if len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// memoryBudgetError reports a request whose output would need more audio
+// buffer memory than --request-memory-mb allows
+type memoryBudgetError struct {
+	Predicted float64 // seconds of audio
+	Needed    int64   // bytes
+	Budget    int64   // bytes
+}
+
+func (e *memoryBudgetError) Error() string {
+	return fmt.Sprintf("predicted duration %.0fs needs about %d MB of audio buffers, over the %d MB per-request limit; split the input into smaller requests or stream it",
+		e.Predicted, e.Needed>>20, e.Budget>>20)
+}
+
+// outputMemory estimates the bytes a request holds at its peak for seconds of
+// audio: the float32 render unless it is handed on block by block (streamed),
+// a second copy for telephony conditioning, and the encoded response unless
+// it is streamed to the client
+func outputMemory(req *TTSRequest, seconds float64, sampleRate int, streamed bool) int64 {
+	samples := seconds * float64(sampleRate)
+	floatCopies := 0.0
+	if !streamed {
+		floatCopies = 1
+	}
+	if req.Telephony || isG711(req.ResponseFormat) {
+		floatCopies++
+	}
+
+	encoded := 0.0
+	switch {
+	case req.Stream:
+	case isG711(req.ResponseFormat):
+		encoded = seconds * telephonySampleRate
+	case req.ResponseFormat == formatWAV:
+		bitDepth, _, _ := wavLayout(req.SampleFormat)
+		encoded = samples * float64(bitDepth/8)
+	default:
+		// Formats from RegisterEncoder are assumed no larger than 16-bit PCM
+		encoded = samples * 2
+	}
+	return int64(math.Ceil(samples*4*floatCopies + encoded))
+}
+
+// checkMemoryBudget rejects a request whose predicted output would exceed
+// --request-memory-mb, before any of it is synthesized. Spooled renders
+// hold no more than a block in memory and always pass
+func checkMemoryBudget(req *TTSRequest, seconds float64, sampleRate int, streamed bool) error {
+	if config.RequestMemoryMB <= 0 || spooled(req) {
+		return nil
+	}
+	budget := int64(config.RequestMemoryMB) << 20
+	if needed := outputMemory(req, seconds, sampleRate, streamed); needed > budget {
+		return &memoryBudgetError{Predicted: seconds, Needed: needed, Budget: budget}
+	}
+	return nil
+}
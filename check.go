@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// checkCanary is the phrase synthesized for every voice by `supertonic check`
+const checkCanary = "The quick brown fox jumps over the lazy dog."
+
+// checkResult is the measured output of one canary synthesis
+type checkResult struct {
+	Duration float64 // seconds
+	RMS      float64 // dBFS
+	Peak     float64 // dBFS
+}
+
+// runCheck implements `supertonic check`: load every model pack, synthesize a
+// canary phrase with each voice and verify the audio has a plausible duration
+// and level. It exits non-zero if any voice fails, for validating deployment
+// images and upgrades
+func runCheck(args []string) {
+	fs, opts := newCLIFlagSet("check")
+	text := fs.String("text", checkCanary, "Canary phrase to synthesize")
+	models := fs.String("models", "", "Comma-separated model packs to check (all if empty)")
+	voices := fs.String("voices", "", "Comma-separated voices to check (all if empty)")
+	minDuration := fs.Float64("min-duration", 1.0, "Shortest acceptable canary duration in seconds")
+	maxDuration := fs.Float64("max-duration", 10.0, "Longest acceptable canary duration in seconds")
+	minRMS := fs.Float64("min-rms", -45, "Quietest acceptable RMS level in dBFS")
+	fs.Parse(args)
+
+	cleanup := startCLI(opts)
+	defer cleanup()
+	config.SampleFormat = sampleFormatS16 // measured from 16-bit PCM
+
+	packNames := splitList(*models)
+	if len(packNames) == 0 {
+		for name := range modelPacks {
+			packNames = append(packNames, name)
+		}
+		sort.Strings(packNames)
+	}
+	voiceNames := splitList(*voices)
+	if len(voiceNames) == 0 {
+		voiceNames = sortedVoices()
+	}
+
+	failures := 0
+	for _, pack := range packNames {
+		for _, voice := range voiceNames {
+			result, err := checkVoice(pack, voice, *text, *opts.language)
+			if err == nil {
+				switch {
+				case result.Duration < *minDuration || result.Duration > *maxDuration:
+					err = fmt.Errorf("duration %.2fs outside [%.2f, %.2f]", result.Duration, *minDuration, *maxDuration)
+				case result.RMS < *minRMS:
+					err = fmt.Errorf("RMS %.1f dBFS below %.1f (silent output?)", result.RMS, *minRMS)
+				case result.Peak > -0.01:
+					err = fmt.Errorf("output clips (peak %.1f dBFS)", result.Peak)
+				}
+			}
+
+			if err != nil {
+				failures++
+				fmt.Fprintf(cliStdout, "FAIL %s/%s: %v\n", pack, voice, err)
+				continue
+			}
+			fmt.Fprintf(cliStdout, "ok   %s/%s: %.2fs, RMS %.1f dBFS, peak %.1f dBFS\n", pack, voice, result.Duration, result.RMS, result.Peak)
+		}
+	}
+
+	if failures > 0 {
+		cleanup()
+		log.Printf("%d of %d checks failed", failures, len(packNames)*len(voiceNames))
+		os.Exit(1)
+	}
+	log.Printf("All %d checks passed", len(packNames)*len(voiceNames))
+}
+
+// checkVoice synthesizes text with one pack and voice and measures the result
+func checkVoice(pack, voice, text, language string) (checkResult, error) {
+	req := TTSRequest{
+		Model:          pack,
+		Input:          text,
+		Voice:          voice,
+		Language:       language,
+		ResponseFormat: formatWAV,
+	}
+	if err := validateRequest(&req); err != nil {
+		return checkResult{}, err
+	}
+	audioData, err := generateSpeech(&req)
+	if err != nil {
+		return checkResult{}, err
+	}
+	rate, pcm, err := wavPCM(audioData)
+	if err != nil {
+		return checkResult{}, err
+	}
+	if len(pcm) < 2 {
+		return checkResult{}, fmt.Errorf("empty audio")
+	}
+
+	var sumSquares, peak float64
+	samples := len(pcm) / 2
+	for i := 0; i < samples; i++ {
+		v := math.Abs(float64(int16(binary.LittleEndian.Uint16(pcm[2*i:]))) / 32768)
+		sumSquares += v * v
+		peak = math.Max(peak, v)
+	}
+	return checkResult{
+		Duration: float64(samples) / float64(rate),
+		RMS:      decibels(math.Sqrt(sumSquares / float64(samples))),
+		Peak:     decibels(peak),
+	}, nil
+}
+
+// decibels converts a linear amplitude to dBFS
+func decibels(amplitude float64) float64 {
+	if amplitude <= 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(amplitude)
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// commands maps subcommand names to their entry points; without one the server runs
+var commands = map[string]func(args []string){
+	"say":     runSay,
+	"pipe":    runPipe,
+	"--pipe":  runPipe,
+	"watch":   runWatch,
+	"check":   runCheck,
+	"regress": runRegress,
+	"tune":    runTune,
+
+	"speechd-config": runSpeechdConfig,
+}
+
+// cliFlags are the speech options shared by the command-line modes
+type cliFlags struct {
+	assetsDir *string
+	voice     *string
+	language  *string
+	speed     *float64
+	wpm       *float64
+	format    *string
+}
+
+// newCLIFlagSet returns a flag set with the server configuration plus the per-utterance options
+func newCLIFlagSet(name string) (*flag.FlagSet, *cliFlags) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	opts := &cliFlags{assetsDir: registerFlags(fs)}
+	opts.voice = fs.String("voice", "", "Voice to speak with (defaults to --default-voice)")
+	opts.language = fs.String("lang", "en", "Language of the text (or auto)")
+	opts.speed = fs.Float64("speed", 0, "Speech speed (defaults to --default-speed)")
+	opts.wpm = fs.Float64("wpm", 0, "Target reading rate in words per minute (replaces --speed)")
+	opts.format = fs.String("format", "", "Audio format written with --output (defaults to --default-format)")
+	return fs, opts
+}
+
+// cliStdout is the process's real stdout; command-line modes point os.Stdout at
+// stderr so progress output from the engine never mixes with audio written to a pipe
+var cliStdout = os.Stdout
+
+// startCLI validates the configuration and initializes the runtime for a command-line mode.
+// The returned function releases the runtime
+func startCLI(opts *cliFlags) func() {
+	os.Stdout = os.Stderr
+	setupConfig()
+	initRuntime(*opts.assetsDir)
+	return func() {
+		destroyEngines()
+		ort.DestroyEnvironment()
+	}
+}
+
+// synthesizeCLI renders text with the command-line options
+func synthesizeCLI(opts *cliFlags, text string, format string) ([]byte, error) {
+	req := TTSRequest{
+		Input:          text,
+		Voice:          *opts.voice,
+		Language:       *opts.language,
+		Speed:          *opts.speed,
+		WPM:            *opts.wpm,
+		ResponseFormat: format,
+	}
+	if err := validateRequest(&req); err != nil {
+		return nil, err
+	}
+	return generateSpeech(&req)
+}
+
+// runSay implements `supertonic say [flags] "text"`: synthesize and play
+// through the default audio device, or write a file with --output
+func runSay(args []string) {
+	// say returns its error so the runtime is released before exiting
+	if err := say(args); err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
+// say runs the say command
+func say(args []string) error {
+	fs, opts := newCLIFlagSet("say")
+	output := fs.String("output", "", "Write the audio to this file instead of playing it (- for stdout)")
+	player := fs.String("player", os.Getenv("SUPERTONIC_PLAYER"), "Audio player command (auto-detected if empty)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s say [flags] \"text\"\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	text := strings.Join(fs.Args(), " ")
+	if text == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	format := formatWAV
+	if *output != "" {
+		format = *opts.format
+	}
+
+	cleanup := startCLI(opts)
+	defer cleanup()
+
+	audioData, err := synthesizeCLI(opts, text, format)
+	if err != nil {
+		return fmt.Errorf("speech generation failed: %w", err)
+	}
+
+	switch *output {
+	case "":
+		return playAudio(audioData, *player)
+	case "-":
+		_, err = cliStdout.Write(audioData)
+		return err
+	default:
+		return os.WriteFile(*output, audioData, 0o644)
+	}
+}
+
+// runPipe implements `supertonic pipe` (or `supertonic --pipe`): every line read
+// from stdin is synthesized as soon as it arrives and either played or streamed
+// to stdout. The stream is a WAV header with an open-ended length followed by
+// 16-bit PCM, so `llm | supertonic --pipe | aplay` needs no format flags;
+// --raw drops the header. When stdout is a file, the header's sizes are
+// patched once stdin ends so the file is an ordinary WAV
+func runPipe(args []string) {
+	// pipe returns its error so the runtime is released and buffered audio
+	// flushed before exiting
+	if err := pipe(args); err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
+// pipe runs the pipe command
+func pipe(args []string) error {
+	fs, opts := newCLIFlagSet("pipe")
+	play := fs.Bool("play", false, "Play each line on the default audio device instead of writing to stdout")
+	raw := fs.Bool("raw", false, "Write headerless s16le PCM (sample rate is logged to stderr)")
+	player := fs.String("player", os.Getenv("SUPERTONIC_PLAYER"), "Audio player command used with --play")
+	fs.Parse(args)
+
+	cleanup := startCLI(opts)
+	defer cleanup()
+	config.SampleFormat = sampleFormatS16 // the stream header is 16-bit
+
+	out := bufio.NewWriter(cliStdout)
+	defer out.Flush()
+	headerWritten := false
+	var dataBytes int64
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		audioData, err := synthesizeCLI(opts, line, formatWAV)
+		if err != nil {
+			log.Printf("Speech generation failed: %v", err)
+			continue
+		}
+
+		if *play {
+			if err := playAudio(audioData, *player); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rate, pcm, err := wavPCM(audioData)
+		if err != nil {
+			return err
+		}
+		if !headerWritten {
+			if *raw {
+				log.Printf("Streaming raw PCM: s16le, %d Hz, mono", rate)
+			} else {
+				out.Write(streamingWAVHeader(rate))
+			}
+			headerWritten = true
+		}
+		if _, err := out.Write(pcm); err != nil {
+			return nil // the reader went away
+		}
+		dataBytes += int64(len(pcm))
+		if err := out.Flush(); err != nil {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stdin: %w", err)
+	}
+
+	if headerWritten && !*raw && out.Flush() == nil {
+		if err := patchWAVSizes(cliStdout, dataBytes); err != nil {
+			log.Printf("%v", err)
+		}
+	}
+	return nil
+}
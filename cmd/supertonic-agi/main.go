@@ -0,0 +1,48 @@
+// Command supertonic-agi speaks its arguments on an Asterisk channel:
+//
+//	exten => 100,1,Answer()
+//	 same => n,AGI(supertonic-agi,Hello from Supertonic)
+//
+// Prompts are cached under --cache-dir (inside Asterisk's sounds directory)
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"strings"
+
+	"go-supertonic/asterisk"
+)
+
+func main() {
+	server := flag.String("server", "http://localhost:8880", "Supertonic server URL")
+	cacheDir := flag.String("cache-dir", "/var/lib/asterisk/sounds/supertonic", "Prompt cache directory")
+	voice := flag.String("voice", "", "Voice (server default if empty)")
+	speed := flag.Float64("speed", 0, "Speech speed (server default if 0)")
+	language := flag.String("language", "", "Prompt language (server default if empty)")
+	escape := flag.String("escape-digits", "", "DTMF digits that interrupt playback")
+	flag.Parse()
+
+	agi, err := asterisk.NewAGI()
+	if err != nil {
+		log.Fatalf("AGI error: %v", err)
+	}
+
+	cache := asterisk.NewPromptCache(*server, *cacheDir)
+	cache.Voice, cache.Speed, cache.Language = *voice, *speed, *language
+
+	text := strings.Join(flag.Args(), " ")
+	if text == "" {
+		// AGI arguments without flags arrive as agi_arg_N
+		text = agi.Env["arg_1"]
+	}
+	if text == "" {
+		log.Fatalf("no prompt text given")
+	}
+
+	if _, err := agi.Speak(context.Background(), cache, text, *escape); err != nil {
+		agi.Command("VERBOSE \"supertonic-agi: " + strings.ReplaceAll(err.Error(), "\"", "'") + "\" 1")
+		log.Fatalf("Speak error: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-supertonic/tts"
+)
+
+// compatTTSName is the engine name used in OpenTTS-style voice IDs ("supertonic:F1")
+const compatTTSName = "supertonic"
+
+// handleCompatTTS serves /api/tts for OpenTTS/Piper clients (text, voice, lang)
+// and Coqui TTS server clients (text, speaker_id, language_id, style_wav, also
+// accepted as text/speaker-id/language-id/style-wav headers). Parameters come
+// from the query string or a form body; a POST with a plain text body is read
+// as the text. The response is WAV
+func handleCompatTTS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	text := compatParam(r, "text", "text")
+	if text == "" && r.Method == http.MethodPost && !isFormRequest(r) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			sendError(w, "Failed to read body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		text = string(body)
+	}
+
+	voice := compatParam(r, "voice", "")
+	if speaker := compatParam(r, "speaker_id", "speaker-id"); speaker != "" {
+		voice = speaker
+	}
+	language := compatParam(r, "lang", "")
+	if lang := compatParam(r, "language_id", "language-id"); lang != "" {
+		language = lang
+	}
+
+	// Coqui's style_wav is reference audio for style transfer; voices are fixed
+	// style embeddings here, so only a voice name (or <voice>.json) is accepted
+	if styleWav := compatParam(r, "style_wav", "style-wav"); styleWav != "" {
+		name := strings.TrimSuffix(filepath.Base(styleWav), filepath.Ext(styleWav))
+		if _, ok := tts.VoiceMapping[name]; !ok {
+			sendError(w, "style_wav must name a voice ("+strings.Join(sortedVoices(), ", ")+"); reference audio is not supported", http.StatusBadRequest)
+			return
+		}
+		voice = name
+	}
+
+	req := TTSRequest{
+		Input:    strings.TrimSpace(text),
+		Voice:    compatVoice(voice),
+		Language: language,
+		key:      requestAPIKey(r),
+	}
+	if speed, err := strconv.ParseFloat(compatParam(r, "speed", ""), 64); err == nil {
+		req.Speed = speed
+	}
+
+	if err := runPreValidateHooks(r, &req); err != nil {
+		sendError(w, err.Error(), validationStatus(w, err))
+		return
+	}
+	if err := validateRequest(&req); err != nil {
+		sendError(w, err.Error(), validationStatus(w, err))
+		return
+	}
+
+	log.Printf("Compat TTS Request: voice=%s, text=\"%.50s\"", req.Voice, req.Input)
+	audioData, err := generateSpeech(&req)
+	if err != nil {
+		log.Printf("TTS Error: %v", err)
+		sendError(w, "Speech generation failed: "+err.Error(), speechErrorStatus(w, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeFor(req.ResponseFormat))
+	w.Write(audioData)
+}
+
+// compatParam returns a query or form parameter, falling back to a request header
+func compatParam(r *http.Request, name, header string) string {
+	if header != "" {
+		if v := r.Header.Get(header); v != "" {
+			return v
+		}
+	}
+	if isFormRequest(r) {
+		return r.FormValue(name)
+	}
+	return r.URL.Query().Get(name)
+}
+
+// isFormRequest reports whether the body is a URL-encoded or multipart form
+func isFormRequest(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	return strings.HasPrefix(contentType, "application/x-www-form-urlencoded") ||
+		strings.HasPrefix(contentType, "multipart/form-data")
+}
+
+// sortedVoices returns the voice names in order
+func sortedVoices() []string {
+	names := tts.GetAvailableVoices()
+	sort.Strings(names)
+	return names
+}
+
+// compatVoice strips the OpenTTS "engine:" prefix from a voice ID
+func compatVoice(voice string) string {
+	if _, name, ok := strings.Cut(voice, ":"); ok {
+		return name
+	}
+	return voice
+}
+
+// handleCompatVoices lists voices in the OpenTTS GET /api/voices format
+func handleCompatVoices(w http.ResponseWriter, r *http.Request) {
+	voices := map[string]interface{}{}
+	for _, name := range sortedVoices() {
+		gender := "F"
+		if strings.HasPrefix(name, "M") {
+			gender = "M"
+		}
+		voices[compatTTSName+":"+name] = map[string]interface{}{
+			"id":           name,
+			"name":         name,
+			"gender":       gender,
+			"language":     tts.AvailableLangs[0],
+			"languages":    tts.AvailableLangs,
+			"locale":       tts.AvailableLangs[0],
+			"tts_name":     compatTTSName,
+			"multispeaker": false,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(voices)
+}
+
+// handleCompatLanguages lists languages in the OpenTTS GET /api/languages format
+func handleCompatLanguages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tts.AvailableLangs)
+}
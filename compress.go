@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Response content encodings
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+)
+
+// compressibleTypes are the response types worth compressing: uncompressed
+// PCM. Encodings such as MP3 or Opus added with RegisterEncoder are sent as is
+var compressibleTypes = map[string]bool{
+	"audio/wav":          true,
+	"audio/basic":        true,
+	"audio/x-alaw-basic": true,
+}
+
+// compressionEncodings are the encodings offered to clients in order of
+// preference (--compression); empty disables compression
+var compressionEncodings []string
+
+// setupCompression parses the --compression list
+func setupCompression(list string) error {
+	compressionEncodings = nil
+	if list == "" || list == "none" {
+		return nil
+	}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name != encodingGzip && name != encodingZstd {
+			return fmt.Errorf("unsupported encoding %q (use %s, %s or none)", name, encodingZstd, encodingGzip)
+		}
+		compressionEncodings = append(compressionEncodings, name)
+	}
+	return nil
+}
+
+// negotiateEncoding picks the offered encoding the client accepts with the
+// highest q-value, preferring earlier --compression entries on ties; "" means
+// identity
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if name != "" {
+			accepted[strings.ToLower(name)] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, name := range compressionEncodings {
+		q, ok := accepted[name]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// Compressors are pooled: a zstd encoder in particular is costly to create
+var (
+	gzipWriters = sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+		return w
+	}}
+	zstdWriters = sync.Pool{New: func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		return w
+	}}
+)
+
+// compressor is the part of gzip.Writer and zstd.Encoder the recorder uses
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressRecorder compresses a response in the negotiated encoding once its
+// headers show a compressible type
+type compressRecorder struct {
+	http.ResponseWriter
+	encoding    string
+	wroteHeader bool
+	enc         compressor
+	release     func()
+}
+
+func (rec *compressRecorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.wroteHeader = true
+	h := rec.Header()
+	mediaType, _, _ := strings.Cut(h.Get("Content-Type"), ";")
+	if compressibleTypes[strings.TrimSpace(mediaType)] {
+		h.Add("Vary", "Accept-Encoding")
+		if status == http.StatusOK && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" {
+			h.Set("Content-Encoding", rec.encoding)
+			h.Del("Content-Length")
+			// A strong tag names exact bytes, so the encoded form gets its own
+			if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) && strings.HasSuffix(etag, `"`) {
+				h.Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+rec.encoding+`"`)
+			}
+			rec.startEncoder()
+		}
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// startEncoder takes a compressor for the negotiated encoding from its pool
+func (rec *compressRecorder) startEncoder() {
+	switch rec.encoding {
+	case encodingGzip:
+		gz := gzipWriters.Get().(*gzip.Writer)
+		gz.Reset(rec.ResponseWriter)
+		rec.enc, rec.release = gz, func() { gzipWriters.Put(gz) }
+	case encodingZstd:
+		zw := zstdWriters.Get().(*zstd.Encoder)
+		zw.Reset(rec.ResponseWriter)
+		rec.enc, rec.release = zw, func() { zstdWriters.Put(zw) }
+	}
+}
+
+func (rec *compressRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.enc != nil {
+		return rec.enc.Write(b)
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Flush pushes compressed data out with each streamed chunk
+func (rec *compressRecorder) Flush() {
+	if rec.enc != nil {
+		rec.enc.Flush()
+	}
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands WebSocket upgrades the connection
+func (rec *compressRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("connection does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the connection
+func (rec *compressRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// close finishes the compressed stream and returns the compressor to its pool
+func (rec *compressRecorder) close() {
+	if rec.enc != nil {
+		rec.enc.Close()
+		rec.release()
+	}
+}
+
+// compressHandler compresses PCM responses (WAV, G.711) for clients that send
+// Accept-Encoding: gzip or zstd. Range requests are served uncompressed so
+// byte offsets keep referring to the audio
+func compressHandler(next http.Handler) http.Handler {
+	if len(compressionEncodings) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &compressRecorder{ResponseWriter: w, encoding: encoding}
+		defer rec.close()
+		next.ServeHTTP(rec, r)
+	})
+}
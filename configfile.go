@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// configFlags is the flag set registerFlags filled, which --config is applied to
+var configFlags *flag.FlagSet
+
+// parseConfigLine splits a config file line into flag name and value; blank
+// lines and # comments have no name
+func parseConfigLine(line string) (string, string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	name, value, ok := strings.Cut(line, "=")
+	name = strings.TrimPrefix(strings.TrimSpace(name), "--")
+	return name, strings.TrimSpace(value), ok || name != ""
+}
+
+// applyConfigFile sets the flags listed in --config, one "flag = value" per
+// line, that were not given on the command line, so the command line always wins
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		name, value, ok := parseConfigLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("line %d: unknown flag %q", lineNo, name)
+		}
+		if given[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("line %d: %s: %w", lineNo, name, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// updateConfigFile writes settings into a config file, replacing the lines of
+// flags it already sets and appending the others, keeping everything else
+func updateConfigFile(path string, settings []configSetting, header string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	pending := map[string]configSetting{}
+	for _, s := range settings {
+		pending[s.Name] = s
+	}
+	var lines []string
+	if len(data) > 0 {
+		for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			if name, _, ok := parseConfigLine(line); ok {
+				if s, found := pending[name]; found {
+					line = s.Name + " = " + s.Value
+					delete(pending, name)
+				}
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(pending) > 0 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "# "+header)
+		for _, s := range settings {
+			if _, ok := pending[s.Name]; ok {
+				lines = append(lines, "# "+s.Reason, s.Name+" = "+s.Value)
+			}
+		}
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+}
+
+// configSetting is one flag value written to a config file, with why it was chosen
+type configSetting struct {
+	Name   string
+	Value  string
+	Reason string
+}
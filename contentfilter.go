@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"go-supertonic/tts"
+)
+
+// Content filter actions
+const (
+	filterReject = "reject"
+	filterBleep  = "bleep"
+	filterRedact = "redact"
+	filterAllow  = "allow"
+)
+
+// contentFilterPattern matches wordlist terms as whole words (nil when no wordlist is configured)
+var contentFilterPattern *regexp.Regexp
+
+// contentFilterClient calls the content filter webhook
+var contentFilterClient = &http.Client{Timeout: 5 * time.Second}
+
+// ContentFilterRequest is the body POSTed to the content filter webhook
+type ContentFilterRequest struct {
+	Input string `json:"input"`
+	Voice string `json:"voice"`
+	Model string `json:"model"`
+}
+
+// ContentFilterResponse is the webhook's verdict. Terms are handled with Action;
+// a non-empty Input replaces the request text entirely
+type ContentFilterResponse struct {
+	Action string   `json:"action"`
+	Terms  []string `json:"terms"`
+	Input  string   `json:"input"`
+}
+
+// loadContentFilter compiles the wordlist (one term per line, # comments) into a matcher
+func loadContentFilter(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open filter wordlist: %w", err)
+	}
+	defer file.Close()
+
+	var terms []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		term := strings.TrimSpace(scanner.Text())
+		if term == "" || strings.HasPrefix(term, "#") {
+			continue
+		}
+		terms = append(terms, regexp.QuoteMeta(term))
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read filter wordlist: %w", err)
+	}
+	if len(terms) == 0 {
+		return fmt.Errorf("filter wordlist %s is empty", path)
+	}
+
+	contentFilterPattern, err = regexp.Compile(`(?i)\b(?:` + strings.Join(terms, "|") + `)\b`)
+	return err
+}
+
+// validateFilterAction checks a content filter action name
+func validateFilterAction(action string) error {
+	switch action {
+	case filterReject, filterBleep, filterRedact:
+		return nil
+	}
+	return fmt.Errorf("unsupported filter action: %s (expected reject, bleep or redact)", action)
+}
+
+// filterContent applies the wordlist and webhook filters to a request's input.
+// It returns an error when the request must be rejected
+func filterContent(req *TTSRequest) error {
+	if contentFilterPattern != nil {
+		matches := contentFilterPattern.FindAllString(req.Input, -1)
+		if len(matches) > 0 {
+			filtered, err := applyFilterAction(req.Input, config.FilterAction, contentFilterPattern)
+			if err != nil {
+				return err
+			}
+			req.Input = filtered
+		}
+	}
+
+	if config.FilterWebhook != "" {
+		verdict, err := callFilterWebhook(req)
+		if err != nil {
+			// Fail closed: operators with compliance requirements must not synthesize unchecked text
+			return fmt.Errorf("content filter unavailable: %w", err)
+		}
+		if verdict.Input != "" {
+			req.Input = verdict.Input
+		}
+		if verdict.Action != "" && verdict.Action != filterAllow && len(verdict.Terms) > 0 {
+			quoted := make([]string, len(verdict.Terms))
+			for i, term := range verdict.Terms {
+				quoted[i] = regexp.QuoteMeta(term)
+			}
+			pattern := regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+			filtered, err := applyFilterAction(req.Input, verdict.Action, pattern)
+			if err != nil {
+				return err
+			}
+			req.Input = filtered
+		} else if verdict.Action == filterReject {
+			return fmt.Errorf("input rejected by content filter")
+		}
+	}
+
+	if strings.TrimSpace(req.Input) == "" {
+		return fmt.Errorf("input is empty after content filtering")
+	}
+	return nil
+}
+
+// applyFilterAction rejects the input or rewrites every match of pattern
+func applyFilterAction(input string, action string, pattern *regexp.Regexp) (string, error) {
+	switch action {
+	case filterReject:
+		return "", fmt.Errorf("input contains blocked terms")
+	case filterBleep:
+		return pattern.ReplaceAllString(input, " "+tts.BleepToken+" "), nil
+	case filterRedact:
+		return pattern.ReplaceAllString(input, ""), nil
+	}
+	return "", fmt.Errorf("unsupported filter action: %s", action)
+}
+
+// callFilterWebhook asks the external content filter for a verdict
+func callFilterWebhook(req *TTSRequest) (*ContentFilterResponse, error) {
+	body, err := json.Marshal(ContentFilterRequest{Input: req.Input, Voice: req.Voice, Model: req.Model})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := contentFilterClient.Post(config.FilterWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	var verdict ContentFilterResponse
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return nil, fmt.Errorf("invalid webhook response: %w", err)
+	}
+	if verdict.Action != "" && verdict.Action != filterAllow {
+		if err := validateFilterAction(verdict.Action); err != nil {
+			return nil, err
+		}
+	}
+	return &verdict, nil
+}
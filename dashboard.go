@@ -0,0 +1,339 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//go:embed dashboard
+var dashboardAssets embed.FS
+
+// dashboardHistory is how many one-second samples the dashboard charts
+const dashboardHistory = 300
+
+// dashboardErrorLimit is how many recent error responses the dashboard lists
+const dashboardErrorLimit = 50
+
+// gpuSampleInterval is how often nvidia-smi is asked for utilization
+const gpuSampleInterval = 5 * time.Second
+
+// dashboardSample is one second of the dashboard's charts
+type dashboardSample struct {
+	Time       int64   `json:"time"` // unix seconds
+	Requests   int64   `json:"requests"`
+	Queued     int     `json:"queued"`
+	CPU        float64 `json:"cpu_percent"`
+	ProcessCPU float64 `json:"process_cpu_percent"`
+	GPU        []int   `json:"gpu_percent,omitempty"` // by device, in --gpu-devices order
+}
+
+// dashboardError is an error response sent by sendError
+type dashboardError struct {
+	Time    time.Time `json:"time"`
+	Status  int       `json:"status"`
+	Message string    `json:"message"`
+}
+
+// voiceUsage counts the syntheses of one voice since startup
+type voiceUsage struct {
+	Voice    string  `json:"voice"`
+	Requests int64   `json:"requests"`
+	Seconds  float64 `json:"audio_seconds"`
+}
+
+// dashboardStats collects what the /admin dashboard shows. It is nil, and
+// records nothing, when the admin API is disabled
+type dashboardStats struct {
+	started  time.Time
+	requests atomic.Int64 // API requests since the last sample
+
+	mu      sync.Mutex
+	samples []dashboardSample // oldest first
+	errors  []dashboardError  // oldest first
+	voices  map[string]*voiceUsage
+	gpus    map[int]gpuUtilization
+
+	// /proc counters at the last sample, for CPU utilization
+	cpuTotal, cpuIdle, processTicks uint64
+	sampled                         time.Time
+}
+
+// dashboard holds the dashboard's statistics (nil without --admin-token)
+var dashboard *dashboardStats
+
+// newDashboardStats returns empty dashboard statistics
+func newDashboardStats() *dashboardStats {
+	return &dashboardStats{started: time.Now(), voices: map[string]*voiceUsage{}}
+}
+
+// dashboardHandler counts API requests for the dashboard's QPS chart; admin,
+// health and dashboard polling are not counted
+func dashboardHandler(next http.Handler) http.Handler {
+	if dashboard == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/admin") && !strings.HasPrefix(r.URL.Path, "/debug/") && r.URL.Path != "/health" {
+			dashboard.requests.Add(1)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recordError adds an error response to the recent errors
+func (d *dashboardStats) recordError(message string, status int) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.errors = append(d.errors, dashboardError{Time: time.Now().UTC(), Status: status, Message: message})
+	if len(d.errors) > dashboardErrorLimit {
+		d.errors = d.errors[1:]
+	}
+}
+
+// recordVoice counts one synthesis of a voice
+func (d *dashboardStats) recordVoice(voice string, seconds float64) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	usage := d.voices[voice]
+	if usage == nil {
+		usage = &voiceUsage{Voice: voice}
+		d.voices[voice] = usage
+	}
+	usage.Requests++
+	usage.Seconds += seconds
+}
+
+// run samples request rate, queue depth and utilization once a second
+func (d *dashboardStats) run() {
+	d.cpuTotal, d.cpuIdle, _ = readHostCPU()
+	d.processTicks, _ = readProcessCPU()
+	d.sampled = time.Now()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var lastGPU time.Time
+	for now := range ticker.C {
+		if len(gpuDevices) > 0 && now.Sub(lastGPU) >= gpuSampleInterval {
+			lastGPU = now
+			if gpus, err := queryGPUUtilization(); err == nil {
+				d.mu.Lock()
+				d.gpus = gpus
+				d.mu.Unlock()
+			}
+		}
+		d.sample(now)
+	}
+}
+
+// sample appends one second to the charts
+func (d *dashboardStats) sample(now time.Time) {
+	s := dashboardSample{Time: now.Unix(), Requests: d.requests.Swap(0), Queued: queueDepth().total()}
+
+	if total, idle, err := readHostCPU(); err == nil && total > d.cpuTotal {
+		s.CPU = 100 * (1 - float64(idle-d.cpuIdle)/float64(total-d.cpuTotal))
+		d.cpuTotal, d.cpuIdle = total, idle
+	}
+	if ticks, err := readProcessCPU(); err == nil {
+		// Ticks are 1/100 s (USER_HZ), so ticks per second is the percentage of one core
+		s.ProcessCPU = float64(ticks-d.processTicks) / now.Sub(d.sampled).Seconds()
+		d.processTicks = ticks
+	}
+	d.sampled = now
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, device := range gpuDevices {
+		s.GPU = append(s.GPU, d.gpus[device.id].Percent)
+	}
+	d.samples = append(d.samples, s)
+	if len(d.samples) > dashboardHistory {
+		d.samples = d.samples[1:]
+	}
+}
+
+// readHostCPU returns the total and idle jiffies of all CPUs from /proc/stat
+func readHostCPU() (total, idle uint64, err error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fs.ErrInvalid
+	}
+	for i, field := range fields[1:] {
+		n, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		total += n
+		if i == 3 || i == 4 { // idle, iowait
+			idle += n
+		}
+	}
+	return total, idle, nil
+}
+
+// readProcessCPU returns the user and system ticks this process has used from /proc/self/stat
+func readProcessCPU() (uint64, error) {
+	data, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, err
+	}
+	// Fields after the parenthesized command name, which may contain spaces
+	_, rest, ok := strings.Cut(string(data), ") ")
+	fields := strings.Fields(rest)
+	if !ok || len(fields) < 13 {
+		return 0, fs.ErrInvalid
+	}
+	utime, err1 := strconv.ParseUint(fields[11], 10, 64)
+	stime, err2 := strconv.ParseUint(fields[12], 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, fs.ErrInvalid
+	}
+	return utime + stime, nil
+}
+
+// queueStatus is the work waiting to run
+type queueStatus struct {
+	JobsQueued  int `json:"jobs_queued"`
+	JobsRunning int `json:"jobs_running"`
+	JobWaiters  int `json:"job_slot_waiters"`
+	GPUWaiters  int `json:"gpu_waiters"`
+}
+
+// total is the number of requests and jobs not yet synthesizing
+func (q queueStatus) total() int {
+	return q.JobsQueued + q.GPUWaiters
+}
+
+// queueDepth counts queued jobs and requests waiting for a GPU session
+func queueDepth() queueStatus {
+	q := queueStatus{GPUWaiters: int(interactiveWaiting.Load())}
+	if jobSlots != nil {
+		q.JobWaiters = jobSlots.waiting()
+	}
+	jobsMu.Lock()
+	for _, job := range jobs {
+		switch job.Status {
+		case jobQueued:
+			q.JobsQueued++
+		case jobRunning:
+			q.JobsRunning++
+		}
+	}
+	jobsMu.Unlock()
+	return q
+}
+
+// workerStatus describes a loaded engine and how long it has been idle
+type workerStatus struct {
+	engineStatus
+	IdleSeconds float64 `json:"idle_seconds"`
+}
+
+// gpuStatus describes a GPU's sessions in use and its latest utilization
+type gpuStatus struct {
+	gpuUtilization
+	SessionsBusy int `json:"sessions_busy"`
+	Sessions     int `json:"sessions"`
+}
+
+// dashboardWorkers returns the loaded engines with their idle time
+func dashboardWorkers() []workerStatus {
+	workers := []workerStatus{}
+	for _, status := range loadedEngines() {
+		worker := workerStatus{engineStatus: status}
+		modelsMu.RLock()
+		if e := engines[status.Model]; e != nil {
+			worker.IdleSeconds = time.Since(time.Unix(0, e.lastUsed.Load())).Seconds()
+		}
+		modelsMu.RUnlock()
+		workers = append(workers, worker)
+	}
+	return workers
+}
+
+// registerDashboard serves the embedded dashboard page at /admin and its
+// scripts under /admin/ui/. The page itself holds no data: it asks for the
+// admin token and polls /admin/stats with it
+func registerDashboard(mux *http.ServeMux) {
+	assets, _ := fs.Sub(dashboardAssets, "dashboard")
+	files := http.StripPrefix("/admin/ui/", http.FileServerFS(assets))
+	mux.HandleFunc("GET /admin", requireDashboard(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFileFS(w, r, assets, "index.html")
+	}))
+	mux.HandleFunc("GET /admin/ui/", requireDashboard(files.ServeHTTP))
+	mux.HandleFunc("/admin/stats", requireAdmin(handleAdminStats))
+}
+
+// requireDashboard hides the dashboard's assets when the admin API is disabled
+func requireDashboard(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if dashboard == nil {
+			sendError(w, "Admin API is disabled (start the server with --admin-token)", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		next(w, r)
+	}
+}
+
+// handleAdminStats returns the dashboard's live statistics
+func handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	gpus := []gpuStatus{}
+	dashboard.mu.Lock()
+	samples := append([]dashboardSample{}, dashboard.samples...)
+	errors := append([]dashboardError{}, dashboard.errors...)
+	voices := make([]voiceUsage, 0, len(dashboard.voices))
+	for _, usage := range dashboard.voices {
+		voices = append(voices, *usage)
+	}
+	for _, device := range gpuDevices {
+		status := gpuStatus{gpuUtilization: dashboard.gpus[device.id], SessionsBusy: len(device.slots), Sessions: cap(device.slots)}
+		status.ID = device.id
+		gpus = append(gpus, status)
+	}
+	dashboard.mu.Unlock()
+	sort.Slice(voices, func(i, j int) bool {
+		if voices[i].Requests != voices[j].Requests {
+			return voices[i].Requests > voices[j].Requests
+		}
+		return voices[i].Voice < voices[j].Voice
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"uptime_seconds":  time.Since(dashboard.started).Seconds(),
+		"degraded_reason": gpuDegraded,
+		"samples":         samples,
+		"queue":           queueDepth(),
+		"workers":         dashboardWorkers(),
+		"gpus":            gpus,
+		"runtime":         runtimeVars(),
+		"errors":          errors,
+		"voices":          voices,
+	})
+}
@@ -0,0 +1,226 @@
+// Supertonic admin dashboard: polls /admin/stats with the admin token kept
+// in sessionStorage and draws the charts on plain canvases
+(function () {
+  "use strict";
+
+  const pollInterval = 2000;
+  const tokenKey = "supertonic-admin-token";
+  const palette = ["#2563eb", "#16a34a", "#d97706", "#9333ea", "#0891b2", "#dc2626"];
+
+  const $ = (id) => document.getElementById(id);
+  let timer = null;
+
+  function token() {
+    return sessionStorage.getItem(tokenKey);
+  }
+
+  function showLogin(message) {
+    clearTimeout(timer);
+    sessionStorage.removeItem(tokenKey);
+    $("dashboard").hidden = true;
+    $("logout").hidden = true;
+    $("login").hidden = false;
+    $("login-error").textContent = message || "";
+  }
+
+  function showDashboard() {
+    $("login").hidden = true;
+    $("dashboard").hidden = false;
+    $("logout").hidden = false;
+    poll();
+  }
+
+  async function poll() {
+    clearTimeout(timer);
+    try {
+      const response = await fetch("/admin/stats", {
+        headers: { Authorization: "Bearer " + token() },
+        cache: "no-store",
+      });
+      if (response.status === 401) {
+        showLogin("Invalid admin token");
+        return;
+      }
+      if (!response.ok) {
+        throw new Error("HTTP " + response.status);
+      }
+      render(await response.json());
+    } catch (err) {
+      $("uptime").textContent = "Disconnected (" + err.message + ")";
+    }
+    timer = setTimeout(poll, pollInterval);
+  }
+
+  function formatDuration(seconds) {
+    seconds = Math.floor(seconds);
+    const d = Math.floor(seconds / 86400);
+    const h = Math.floor((seconds % 86400) / 3600);
+    const m = Math.floor((seconds % 3600) / 60);
+    if (d > 0) return d + "d " + h + "h";
+    if (h > 0) return h + "h " + m + "m";
+    if (m > 0) return m + "m " + (seconds % 60) + "s";
+    return seconds + "s";
+  }
+
+  function fillTable(id, rows) {
+    const body = $(id).tBodies[0];
+    body.replaceChildren(
+      ...rows.map((cells) => {
+        const tr = document.createElement("tr");
+        for (const cell of cells) {
+          const td = document.createElement("td");
+          if (cell && typeof cell === "object") {
+            td.textContent = cell.text;
+            td.className = cell.className || "";
+          } else {
+            td.textContent = cell;
+          }
+          tr.appendChild(td);
+        }
+        return tr;
+      })
+    );
+  }
+
+  // prepare sizes a canvas to its CSS box at the device pixel ratio
+  function prepare(canvas) {
+    const ratio = window.devicePixelRatio || 1;
+    const width = canvas.clientWidth;
+    const height = canvas.clientHeight;
+    canvas.width = width * ratio;
+    canvas.height = height * ratio;
+    const ctx = canvas.getContext("2d");
+    ctx.scale(ratio, ratio);
+    ctx.font = "11px system-ui, sans-serif";
+    ctx.fillStyle = getComputedStyle(document.body).color;
+    return { ctx, width, height };
+  }
+
+  // lineChart draws one or more series sharing a y axis starting at 0
+  function lineChart(canvas, series, fixedMax) {
+    const { ctx, width, height } = prepare(canvas);
+    const left = 36;
+    const bottom = height - 14;
+    let max = fixedMax || 0;
+    for (const s of series) for (const v of s.values) max = Math.max(max, v);
+    if (max === 0) max = 1;
+
+    ctx.globalAlpha = 0.6;
+    ctx.fillText(formatNumber(max), 0, 10);
+    ctx.fillText("0", 0, bottom);
+    ctx.globalAlpha = 0.2;
+    ctx.fillRect(left, bottom, width - left, 1);
+    ctx.globalAlpha = 1;
+
+    series.forEach((s, i) => {
+      const n = s.values.length;
+      if (n === 0) return;
+      ctx.strokeStyle = palette[i % palette.length];
+      ctx.lineWidth = 1.5;
+      ctx.beginPath();
+      s.values.forEach((v, j) => {
+        const x = left + ((width - left) * j) / Math.max(n - 1, 1);
+        const y = bottom - ((bottom - 4) * v) / max;
+        if (j === 0) ctx.moveTo(x, y);
+        else ctx.lineTo(x, y);
+      });
+      ctx.stroke();
+      ctx.fillStyle = palette[i % palette.length];
+      ctx.fillText(s.label, left + 4 + i * 90, height - 2);
+    });
+  }
+
+  // barChart draws horizontal bars, largest first
+  function barChart(canvas, bars) {
+    const { ctx, width, height } = prepare(canvas);
+    if (bars.length === 0) {
+      ctx.globalAlpha = 0.6;
+      ctx.fillText("No syntheses yet", 0, 12);
+      return;
+    }
+    const label = 90;
+    const rowHeight = Math.min(20, height / bars.length);
+    const max = Math.max(...bars.map((b) => b.value));
+    const color = ctx.fillStyle;
+    bars.forEach((b, i) => {
+      const y = i * rowHeight;
+      ctx.fillStyle = color;
+      ctx.fillText(b.label.slice(0, 14), 0, y + rowHeight * 0.7);
+      ctx.fillStyle = palette[0];
+      const w = ((width - label - 50) * b.value) / max;
+      ctx.fillRect(label, y + 2, Math.max(w, 1), rowHeight - 4);
+      ctx.fillStyle = color;
+      ctx.fillText(formatNumber(b.value), label + w + 4, y + rowHeight * 0.7);
+    });
+  }
+
+  function formatNumber(v) {
+    return Number.isInteger(v) ? String(v) : v.toFixed(1);
+  }
+
+  function render(stats) {
+    $("uptime").textContent = "up " + formatDuration(stats.uptime_seconds);
+    $("degraded").hidden = !stats.degraded_reason;
+    $("degraded").textContent = stats.degraded_reason ? "Degraded: " + stats.degraded_reason : "";
+
+    const samples = stats.samples;
+    const last = samples[samples.length - 1] || {};
+    $("qps").textContent = last.requests ?? "–";
+    $("queued").textContent = stats.queue.jobs_queued + stats.queue.gpu_waiters;
+    $("running").textContent = stats.queue.jobs_running;
+    $("cpu").textContent = last.cpu_percent !== undefined ? last.cpu_percent.toFixed(0) + "%" : "–";
+    $("process-cpu").textContent = last.process_cpu_percent !== undefined ? last.process_cpu_percent.toFixed(0) + "%" : "–";
+    $("rss").textContent = stats.runtime.rss_mb !== undefined ? stats.runtime.rss_mb + " MB" : stats.runtime.go_sys_mb + " MB (Go)";
+
+    lineChart($("chart-qps"), [{ label: "requests/s", values: samples.map((s) => s.requests) }]);
+    lineChart($("chart-queue"), [{ label: "queued", values: samples.map((s) => s.queued) }]);
+    const util = [
+      { label: "host CPU", values: samples.map((s) => s.cpu_percent) },
+      { label: "process CPU", values: samples.map((s) => s.process_cpu_percent) },
+    ];
+    stats.gpus.forEach((gpu, i) => {
+      util.push({ label: "GPU " + gpu.id, values: samples.map((s) => (s.gpu_percent || [])[i] || 0) });
+    });
+    lineChart($("chart-util"), util, 100);
+    barChart($("chart-voices"), stats.voices.slice(0, 8).map((v) => ({ label: v.voice, value: v.requests })));
+
+    fillTable(
+      "workers",
+      stats.workers.map((w) => [w.model, w.dir, (w.gpu_devices || []).join(", ") || "CPU", formatDuration(w.idle_seconds)])
+    );
+
+    $("gpu-section").hidden = stats.gpus.length === 0;
+    fillTable(
+      "gpus",
+      stats.gpus.map((g) => [
+        g.id,
+        g.sessions_busy + " / " + g.sessions,
+        g.utilization_percent + "%",
+        g.memory_total_mb ? g.memory_used_mb + " / " + g.memory_total_mb + " MB" : "–",
+      ])
+    );
+
+    fillTable(
+      "errors",
+      stats.errors
+        .slice()
+        .reverse()
+        .map((e) => [
+          new Date(e.time).toLocaleTimeString(),
+          { text: e.status, className: e.status >= 500 ? "status-5xx" : "" },
+          e.message,
+        ])
+    );
+  }
+
+  $("login").addEventListener("submit", (event) => {
+    event.preventDefault();
+    sessionStorage.setItem(tokenKey, $("token").value);
+    $("token").value = "";
+    showDashboard();
+  });
+  $("logout").addEventListener("click", () => showLogin());
+
+  if (token()) showDashboard();
+  else showLogin();
+})();
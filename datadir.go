@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// setupDataDir prepares --data-dir, the writable per-instance directory, and
+// points the writable paths that were not set explicitly into it: uploaded
+// voices (with --api-keys), saved audio and usage, none of which --stateless
+// keeps on the replica. The assets directory is only ever read, so it can
+// live on a read-only volume
+func setupDataDir() error {
+	if config.DataDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(config.DataDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	if config.Stateless {
+		return nil
+	}
+	if config.VoiceDir == "" && config.APIKeys != "" {
+		config.VoiceDir = filepath.Join(config.DataDir, "voices")
+	}
+	if config.SaveDir == "" {
+		config.SaveDir = filepath.Join(config.DataDir, "audio")
+	}
+	if config.UsageFile == "" {
+		config.UsageFile = filepath.Join(config.DataDir, "usage.json")
+	}
+	return nil
+}
+
+// checkWritablePaths warns about writable paths inside the assets directory,
+// which stop working when the assets are mounted read-only
+func checkWritablePaths() {
+	assets := filepath.Clean(config.AssetsDir) + string(filepath.Separator)
+	for flag, path := range map[string]string{
+		"--data-dir":   config.DataDir,
+		"--voice-dir":  config.VoiceDir,
+		"--save-dir":   config.SaveDir,
+		"--usage-file": config.UsageFile,
+		"--audit-log":  config.AuditLog,
+		"--access-log": config.AccessLog,
+	} {
+		if path == "" || path == "-" {
+			continue
+		}
+		if abs, err := filepath.Abs(path); err == nil && strings.HasPrefix(abs, assets) {
+			log.Printf("Warning: %s %s is inside the assets directory; keep writable data in --data-dir so the assets can be read-only", flag, path)
+		}
+	}
+}
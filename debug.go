@@ -0,0 +1,111 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"go-supertonic/tts"
+)
+
+// Access modes of the /debug endpoints (--debug-endpoints)
+const (
+	debugOff       = "off"
+	debugAdmin     = "admin"
+	debugLocalhost = "localhost"
+)
+
+// validateDebugEndpoints checks a --debug-endpoints mode
+func validateDebugEndpoints(mode string) error {
+	switch mode {
+	case debugOff, debugLocalhost:
+		return nil
+	case debugAdmin:
+		if config.AdminToken == "" {
+			return fmt.Errorf("%s requires --admin-token", debugAdmin)
+		}
+		return nil
+	}
+	return fmt.Errorf("must be %s, %s or %s", debugOff, debugAdmin, debugLocalhost)
+}
+
+// registerDebugHandlers adds /debug/pprof and /debug/vars when --debug-endpoints is enabled
+func registerDebugHandlers(mux *http.ServeMux) {
+	if config.DebugEndpoints == debugOff {
+		return
+	}
+	expvar.Publish("supertonic", expvar.Func(runtimeVars))
+
+	mux.HandleFunc("/debug/pprof/", requireDebug(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", requireDebug(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", requireDebug(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", requireDebug(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", requireDebug(pprof.Trace))
+	mux.HandleFunc("/debug/vars", requireDebug(expvar.Handler().ServeHTTP))
+	log.Printf("Debug endpoints enabled at /debug/pprof and /debug/vars (%s)", config.DebugEndpoints)
+}
+
+// requireDebug restricts a debug handler to the admin token or to loopback clients.
+// The connection's address is checked, not X-Forwarded-For, which clients can set
+func requireDebug(next http.HandlerFunc) http.HandlerFunc {
+	if config.DebugEndpoints == debugAdmin {
+		return requireAdmin(next)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			sendError(w, "Debug endpoints are only served to localhost", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// runtimeVars reports goroutines, Go heap and GC statistics, and the process
+// memory outside the Go heap, most of which is ONNX Runtime's: a native
+// figure that keeps growing while the Go heap does not points at leaked
+// tensors or sessions
+func runtimeVars() any {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	vars := map[string]any{
+		"goroutines":      runtime.NumGoroutine(),
+		"cgo_calls":       runtime.NumCgoCall(),
+		"heap_alloc_mb":   mem.HeapAlloc >> 20,
+		"heap_objects":    mem.HeapObjects,
+		"go_sys_mb":       mem.Sys >> 20,
+		"gc_cycles":       mem.NumGC,
+		"gc_pause_total":  mem.PauseTotalNs,
+		"gc_cpu_fraction": mem.GCCPUFraction,
+		"loaded_engines":  len(loadedEngines()),
+		"onnx":            tts.LiveResources(),
+		"onnx_expected":   tts.ResourceCounts{Sessions: loadedSessions()},
+	}
+	if rss := processRSSMB(); rss > 0 {
+		vars["rss_mb"] = rss
+		vars["native_mb"] = max(rss-int(mem.Sys>>20), 0)
+	}
+	return vars
+}
+
+// processRSSMB reads the resident set size from /proc/self/status, or 0 where there is none
+func processRSSMB() int {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "VmRSS:"); ok {
+			kb, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), " kB"))
+			return kb / 1024
+		}
+	}
+	return 0
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Telephony band edges and sample rate (G.711 narrowband)
+const (
+	telephonyLowHz      = 300.0
+	telephonyHighHz     = 3400.0
+	telephonySampleRate = 8000
+)
+
+// biquad is a second-order IIR filter section (RBJ audio EQ cookbook)
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// newBiquad returns a Butterworth (Q = 1/√2) high-pass or low-pass section
+func newBiquad(highPass bool, cutoffHz float64, sampleRate int) biquad {
+	w0 := 2 * math.Pi * cutoffHz / float64(sampleRate)
+	alpha := math.Sin(w0) / math.Sqrt2 // sin(w0) / 2Q
+	cos := math.Cos(w0)
+	a0 := 1 + alpha
+
+	var b0, b1 float64
+	if highPass {
+		b0, b1 = (1+cos)/2, -(1 + cos)
+	} else {
+		b0, b1 = (1-cos)/2, 1-cos
+	}
+	return biquad{
+		b0: b0 / a0,
+		b1: b1 / a0,
+		b2: b0 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+// apply filters samples in place
+func (f biquad) apply(samples []float32) {
+	var x1, x2, y1, y2 float64
+	for i, s := range samples {
+		x := float64(s)
+		y := f.b0*x + f.b1*x1 + f.b2*x2 - f.a1*y1 - f.a2*y2
+		x2, x1 = x1, x
+		y2, y1 = y1, y
+		samples[i] = float32(y)
+	}
+}
+
+// telephonyCondition band-limits audio to 300–3400 Hz (4th-order high- and
+// low-pass) and resamples it to 8 kHz
+func telephonyCondition(samples []float32, sampleRate int) ([]float32, int) {
+	out := make([]float32, len(samples))
+	copy(out, samples)
+	for i := 0; i < 2; i++ {
+		newBiquad(true, telephonyLowHz, sampleRate).apply(out)
+		newBiquad(false, telephonyHighHz, sampleRate).apply(out)
+	}
+	return resample(out, sampleRate, telephonySampleRate), telephonySampleRate
+}
+
+// resample converts audio between sample rates with a Hann-windowed sinc
+// interpolator, low-passing below the lower Nyquist frequency. The filter
+// taps of each output phase are computed once (polyphase) and blocks of the
+// output are filtered in parallel
+func resample(samples []float32, from, to int) []float32 {
+	if from == to || len(samples) == 0 {
+		return samples
+	}
+
+	ratio := float64(to) / float64(from)
+	cutoff := math.Min(1, ratio) * 0.95 // fraction of the input Nyquist
+	const zeroCrossings = 16
+	halfWidth := float64(zeroCrossings) / cutoff
+
+	// Output n sits at input position n*step/phases: phase (n*step)%phases
+	// past input sample (n*step)/phases
+	g := gcd(from, to)
+	phases, step := to/g, from/g
+	taps := func(phase int) sincTaps {
+		frac := float64(phase) / float64(phases)
+		t := sincTaps{first: int(math.Ceil(frac - halfWidth))}
+		for d := t.first; float64(d) <= frac+halfWidth; d++ {
+			x := frac - float64(d)
+			window := 0.5 + 0.5*math.Cos(math.Pi*x/halfWidth)
+			t.coeffs = append(t.coeffs, cutoff*sinc(cutoff*x)*window)
+		}
+		return t
+	}
+	var table []sincTaps
+	if phases <= maxResamplePhases {
+		table = make([]sincTaps, phases)
+		for p := range table {
+			table[p] = taps(p)
+		}
+	}
+
+	outLen := int(float64(len(samples)) * ratio)
+	out := make([]float32, outLen)
+	parallelBlocks(outLen, resampleBlock, func(lo, hi int) {
+		for n := lo; n < hi; n++ {
+			pos := int64(n) * int64(step)
+			base, phase := int(pos/int64(phases)), int(pos%int64(phases))
+			var t sincTaps
+			if table != nil {
+				t = table[phase]
+			} else {
+				t = taps(phase)
+			}
+
+			start := base + t.first
+			coeffs := t.coeffs
+			if start < 0 {
+				coeffs = coeffs[min(-start, len(coeffs)):]
+				start = 0
+			}
+			if end := start + len(coeffs); end > len(samples) {
+				coeffs = coeffs[:max(len(samples)-start, 0)]
+			}
+			var sum float64
+			for k, c := range coeffs {
+				sum += float64(samples[start+k]) * c
+			}
+			out[n] = float32(sum)
+		}
+	})
+	return out
+}
+
+// maxResamplePhases bounds the polyphase table; rate pairs with more output
+// phases than this (e.g. coprime odd rates) compute their taps per sample
+const maxResamplePhases = 4096
+
+// resampleBlock is how many output samples one goroutine filters at a time
+const resampleBlock = 16384
+
+// sincTaps is the filter of one resampler phase: coeffs[i] weights the input
+// sample first+i positions after the phase's base sample
+type sincTaps struct {
+	first  int
+	coeffs []float64
+}
+
+// gcd returns the greatest common divisor of two positive integers
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// parallelBlocks calls fn on consecutive [lo, hi) ranges of at most block
+// items covering [0, n), spreading them over GOMAXPROCS goroutines. The
+// ranges do not depend on the CPU count; a single block or CPU runs on the
+// calling goroutine
+func parallelBlocks(n, block int, fn func(lo, hi int)) {
+	blocks := (n + block - 1) / block
+	workers := min(runtime.GOMAXPROCS(0), blocks)
+	if workers <= 1 {
+		for lo := 0; lo < n; lo += block {
+			fn(lo, min(lo+block, n))
+		}
+		return
+	}
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := int(next.Add(1) - 1); b < blocks; b = int(next.Add(1) - 1) {
+				fn(b*block, min((b+1)*block, n))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// sinc is the normalized sinc function
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// logSpectrogram returns the Hann-windowed magnitude spectrum of each frame in
+// dB (floored at -100). frameSize must be a power of two
+func logSpectrogram(samples []float32, frameSize, hop int) [][]float64 {
+	window := make([]float64, frameSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frameSize))
+	}
+
+	var frames [][]float64
+	buf := make([]complex128, frameSize)
+	for start := 0; start+frameSize <= len(samples); start += hop {
+		for i := range buf {
+			buf[i] = complex(float64(samples[start+i])*window[i], 0)
+		}
+		fft(buf)
+
+		frame := make([]float64, frameSize/2+1)
+		for i := range frame {
+			magnitude := math.Hypot(real(buf[i]), imag(buf[i]))
+			frame[i] = math.Max(20*math.Log10(magnitude+1e-12), -100)
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// fft is an in-place iterative radix-2 Cooley-Tukey transform; len(x) must be a power of two
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := complex(math.Cos(-2*math.Pi/float64(size)), math.Sin(-2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even, odd := x[start+k], w*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = even+odd, even-odd
+				w *= step
+			}
+		}
+	}
+}
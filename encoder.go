@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Encoder turns synthesized mono samples into one response format's bytes.
+// Register additional formats (e.g. WebM or AMR) with RegisterEncoder from the
+// init function of a file added to this package, behind a build tag if the
+// encoder pulls in extra dependencies
+type Encoder interface {
+	Encode(samples []float32, sampleRate int) ([]byte, error)
+	MIME() string
+}
+
+// StreamEncoder is implemented by encoders that can encode a response while
+// it is synthesized, so a long render is never held as float samples and
+// encoded bytes at once. Formats added with RegisterEncoder may implement it
+type StreamEncoder interface {
+	Encoder
+	NewStream(sampleRate int) EncodeStream
+}
+
+// EncodeStream encodes one response incrementally: Write receives
+// consecutive blocks of samples, then Bytes returns the finished encoding
+type EncodeStream interface {
+	Write(samples []float32) error
+	Bytes() ([]byte, error)
+}
+
+// tunableEncoder is implemented by the built-in encoders whose output depends
+// on the request's sample_format, dither and seed
+type tunableEncoder interface {
+	forRequest(opts wavOptions) Encoder
+}
+
+// responseFormat is an encoding selectable with response_format
+type responseFormat struct {
+	Encoder   Encoder
+	Extension string
+}
+
+// responseFormats maps response_format names to their encodings
+var responseFormats = map[string]responseFormat{
+	formatWAV:  {Encoder: wavEncoder{}, Extension: "wav"},
+	formatULaw: {Encoder: g711Encoder{}, Extension: "ulaw"},
+	formatALaw: {Encoder: g711Encoder{aLaw: true}, Extension: "alaw"},
+}
+
+// responseFormatNames lists the supported response formats in display order
+var responseFormatNames = []string{formatWAV, formatULaw, formatALaw}
+
+// RegisterEncoder adds the response format name, saved with the given file
+// extension. It panics if the name is taken, like http.Handle
+func RegisterEncoder(name, extension string, encoder Encoder) {
+	if _, ok := responseFormats[name]; ok {
+		panic("supertonic: response format " + name + " registered twice")
+	}
+	responseFormats[name] = responseFormat{Encoder: encoder, Extension: extension}
+	responseFormatNames = append(responseFormatNames, name)
+}
+
+// validateResponseFormat checks a response format name
+func validateResponseFormat(format string) error {
+	if _, ok := responseFormats[format]; !ok {
+		return fmt.Errorf("unsupported response_format: %s. Available: %v", format, responseFormatNames)
+	}
+	return nil
+}
+
+// contentTypeFor returns the MIME type of a response format
+func contentTypeFor(format string) string {
+	return responseFormats[format].Encoder.MIME()
+}
+
+// contentTypeForFile returns the MIME type of a saved audio file from its extension
+func contentTypeForFile(name string) string {
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	for _, f := range responseFormats {
+		if f.Extension == ext {
+			return f.Encoder.MIME()
+		}
+	}
+	return "application/octet-stream"
+}
+
+// wavEncoder writes RIFF WAV in the request's sample format
+type wavEncoder struct {
+	opts wavOptions
+}
+
+func (e wavEncoder) Encode(samples []float32, sampleRate int) ([]byte, error) {
+	return wavToBytes(samples, sampleRate, e.opts), nil
+}
+
+func (e wavEncoder) NewStream(sampleRate int) EncodeStream {
+	return &wavStream{opts: e.opts, sampleRate: sampleRate, out: make([]byte, wavHeaderSize)}
+}
+
+func (wavEncoder) MIME() string { return "audio/wav" }
+
+func (wavEncoder) forRequest(opts wavOptions) Encoder { return wavEncoder{opts: opts} }
+
+// wavStream packs samples as they arrive behind a header whose sizes Bytes
+// fills in. The dither is reseeded every quantizeBlock samples, so the
+// output is byte-identical to wavToBytes
+type wavStream struct {
+	opts       wavOptions
+	sampleRate int
+	out        []byte
+	written    int // samples
+	rng        *rand.Rand
+	pcm        []int
+}
+
+func (s *wavStream) Write(samples []float32) error {
+	bitDepth, format, scale := wavLayout(s.opts.SampleFormat)
+	width := bitDepth / 8
+	at := len(s.out)
+	s.out = slices.Grow(s.out, width*len(samples))[:at+width*len(samples)]
+	if format == wavFormatFloat {
+		packFloat(s.out[at:], samples)
+		s.written += len(samples)
+		return nil
+	}
+
+	for len(samples) > 0 {
+		n := min(len(samples), quantizeBlock-s.written%quantizeBlock)
+		if s.opts.Dither == ditherTPDF && s.written%quantizeBlock == 0 {
+			s.rng = rand.New(rand.NewSource(s.opts.Seed + int64(s.written)))
+		}
+		s.pcm = slices.Grow(s.pcm[:0], n)[:n]
+		quantizeInto(s.pcm, samples[:n], scale, s.rng)
+		packPCM(s.out[at:], s.pcm, bitDepth)
+		at += n * width
+		s.written += n
+		samples = samples[n:]
+	}
+	return nil
+}
+
+func (s *wavStream) Bytes() ([]byte, error) {
+	bitDepth, format, _ := wavLayout(s.opts.SampleFormat)
+	putWAVHeader(s.out, s.sampleRate, bitDepth, format, len(s.out)-wavHeaderSize)
+	return s.out, nil
+}
+
+// encodesIncrementally reports whether a buffered request's audio can be
+// encoded as it is synthesized: telephony conditioning, quality reports and
+// post-synthesis hooks all need the whole signal
+func encodesIncrementally(req *TTSRequest) bool {
+	return !req.Telephony && !isG711(req.ResponseFormat) && !req.QualityReport && len(hooks) == 0
+}
+
+// g711Encoder writes headerless G.711 µ-law or A-law; convertToFormat has
+// already conditioned the samples to 8 kHz
+type g711Encoder struct {
+	aLaw bool
+	opts wavOptions
+}
+
+func (e g711Encoder) Encode(samples []float32, _ int) ([]byte, error) {
+	pcm := quantize(samples, 32767, e.opts.Dither, e.opts.Seed)
+	if e.aLaw {
+		return encodeALaw(pcm), nil
+	}
+	return encodeULaw(pcm), nil
+}
+
+func (e g711Encoder) MIME() string {
+	if e.aLaw {
+		return "audio/x-alaw-basic"
+	}
+	return "audio/basic"
+}
+
+func (e g711Encoder) forRequest(opts wavOptions) Encoder {
+	return g711Encoder{aLaw: e.aLaw, opts: opts}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-supertonic/tts"
+)
+
+// engine holds the loaded inference sessions for one model pack: one set per
+// GPU device (indexed like gpuDevices), or a single CPU set
+type engine struct {
+	pack     ModelPack
+	workers  []*tts.TextToSpeech
+	active   sync.WaitGroup
+	lastUsed atomic.Int64 // unix nanoseconds of the last acquire, for --idle-unload
+}
+
+// engines holds the engine currently serving each model pack (guarded by modelsMu)
+var engines = map[string]*engine{}
+
+// loadMu serializes model loading so a pack is never loaded twice concurrently
+var loadMu sync.Mutex
+
+// loadEngine loads the ONNX sessions of a model pack
+func loadEngine(pack ModelPack) (*engine, error) {
+	cfg, err := tts.LoadCfgs(pack.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	e := &engine{pack: pack}
+	for _, device := range engineDevices() {
+		textToSpeech, err := tts.LoadTextToSpeechOnDevice(pack.Dir, device, cfg)
+		if err != nil {
+			e.destroy()
+			return nil, fmt.Errorf("failed to load TTS: %w", err)
+		}
+		e.workers = append(e.workers, textToSpeech)
+	}
+	return e, nil
+}
+
+// worker returns the sessions for a device index handed out by admitGPU
+func (e *engine) worker(index int) *tts.TextToSpeech {
+	return e.workers[index]
+}
+
+// inferenceFailed reports whether a synthesis failed in the ONNX sessions (an
+// error or a chunk skipped after its retry), rather than on its input or a
+// plausibility check that reloading would not change
+func inferenceFailed(result *tts.SynthesisResult, err error) bool {
+	var failed *tts.InferenceError
+	if err != nil {
+		return errors.As(err, &failed) && tts.SessionFailure(failed.Err)
+	}
+	for _, span := range result.Skipped {
+		if tts.SessionFailure(span.Cause) {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadCooldown is the least time between two reloads of one worker's sessions
+const reloadCooldown = time.Minute
+
+var (
+	reloadMu sync.Mutex
+	reloads  = map[*tts.TextToSpeech]time.Time{} // when each worker's last reload started
+)
+
+// claimReload reports whether a worker may reload now: not while another
+// reload of it is running nor within reloadCooldown of the last one, so
+// concurrent or repeated failures never load several copies of the sessions
+func claimReload(worker *tts.TextToSpeech) bool {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if last, ok := reloads[worker]; ok && time.Since(last) < reloadCooldown {
+		return false
+	}
+	reloads[worker] = time.Now()
+	return true
+}
+
+// healWorker recreates a worker's ONNX sessions after a failed inference, so
+// one bad session does not need a restart, and reports whether it succeeded
+func healWorker(pack ModelPack, device int, worker *tts.TextToSpeech, result *tts.SynthesisResult, err error) bool {
+	if err == nil {
+		err = fmt.Errorf("%d chunks skipped: %s", len(result.Skipped), result.Skipped[0].Error)
+	}
+	if !claimReload(worker) {
+		log.Printf("Inference failed on model pack %s (worker %d): %v; its ONNX sessions were recreated less than %s ago", pack.Name, device, err, reloadCooldown)
+		return false
+	}
+	log.Printf("Inference failed on model pack %s (worker %d): %v; recreating its ONNX sessions", pack.Name, device, err)
+	start := time.Now()
+	if err := worker.Reload(); err != nil {
+		log.Printf("Recreating ONNX sessions of model pack %s (worker %d) failed: %v", pack.Name, device, err)
+		return false
+	}
+	log.Printf("Recreated ONNX sessions of model pack %s (worker %d) in %.2fs", pack.Name, device, time.Since(start).Seconds())
+	return true
+}
+
+// destroy releases the ONNX sessions on every device
+func (e *engine) destroy() {
+	reloadMu.Lock()
+	for _, worker := range e.workers {
+		delete(reloads, worker)
+	}
+	reloadMu.Unlock()
+	for _, worker := range e.workers {
+		worker.Destroy()
+	}
+}
+
+// warm runs a short synthesis so the first real request doesn't pay for lazy ONNX initialization
+func (e *engine) warm() error {
+	voicePath := ""
+	voices := tts.GetAvailableVoices()
+	sort.Strings(voices)
+	for _, voice := range voices {
+		if path, err := tts.GetVoicePath(voice, e.pack.Dir); err == nil {
+			voicePath = path
+			break
+		}
+	}
+	if voicePath == "" {
+		return fmt.Errorf("no voice styles available in model pack %s", e.pack.Name)
+	}
+
+	style, err := tts.LoadVoiceStyle([]string{voicePath}, false)
+	if err != nil {
+		return fmt.Errorf("failed to load voice style: %w", err)
+	}
+	defer style.Destroy()
+
+	for _, worker := range e.workers {
+		if _, _, err := worker.Call("Warm up.", "en", style, config.TotalStep, 1.0, 0.3); err != nil {
+			return fmt.Errorf("warm-up synthesis failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// release marks a request using the engine as finished
+func (e *engine) release() {
+	e.active.Done()
+}
+
+// drain waits for in-flight requests to finish and then destroys the ONNX sessions
+func (e *engine) drain() {
+	start := time.Now()
+	e.active.Wait()
+	e.destroy()
+	log.Printf("Drained model pack %s (%s) after %.2fs", e.pack.Name, e.pack.Dir, time.Since(start).Seconds())
+}
+
+// lookupEngine returns the loaded engine for a pack, marked as in use, or nil
+func lookupEngine(name string) *engine {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	e := engines[name]
+	if e != nil {
+		e.active.Add(1)
+		e.lastUsed.Store(time.Now().UnixNano())
+	}
+	return e
+}
+
+// acquireEngine returns the engine serving a model pack, loading it on first use.
+// The caller must call release when done
+func acquireEngine(pack ModelPack) (*engine, error) {
+	if e := lookupEngine(pack.Name); e != nil {
+		return e, nil
+	}
+
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
+	// Another request may have loaded it while we waited
+	if e := lookupEngine(pack.Name); e != nil {
+		return e, nil
+	}
+
+	e, err := loadEngine(pack)
+	recordPackLoad(pack.Name, err)
+	if err != nil {
+		return nil, err
+	}
+
+	modelsMu.Lock()
+	engines[pack.Name] = e
+	e.active.Add(1)
+	e.lastUsed.Store(time.Now().UnixNano())
+	modelsMu.Unlock()
+
+	log.Printf("Loaded model pack %s from %s", pack.Name, pack.Dir)
+	return e, nil
+}
+
+// swapModelPack loads and warms a model pack from disk, then atomically
+// switches new requests for the pack (and the given aliases) to it.
+// The engine it replaces is drained in the background
+func swapModelPack(name string, aliases []string) (time.Duration, error) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
+	// Rediscover packs so newly installed directories are picked up
+	packs, err := discoverModelPacks(config.AssetsDir)
+	if err != nil {
+		return 0, err
+	}
+	pack, exists := packs[name]
+	if !exists {
+		return 0, fmt.Errorf("model pack %s not found in %s", name, config.AssetsDir)
+	}
+	if err := verifyModelPack(pack); err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	e, err := loadEngine(pack)
+	if err != nil {
+		return 0, err
+	}
+	if err := e.warm(); err != nil {
+		e.destroy()
+		return 0, err
+	}
+	elapsed := time.Since(start)
+
+	modelsMu.Lock()
+	old := engines[name]
+	engines[name] = e
+	modelPacks[name] = pack
+	delete(packFailures, name)
+	for _, alias := range aliases {
+		modelAliases[alias] = name
+	}
+	modelsMu.Unlock()
+
+	log.Printf("Switched model pack %s to %s (aliases: %v, warm-up %.2fs)", name, pack.Dir, aliases, elapsed.Seconds())
+	if old != nil {
+		go old.drain()
+	}
+	return elapsed, nil
+}
+
+// preloadEngines loads and warms every pack referenced by an alias at startup
+func preloadEngines() error {
+	names := map[string]bool{}
+	for _, pack := range modelAliases {
+		names[pack] = true
+	}
+
+	for name := range names {
+		e, err := acquireEngine(modelPacks[name])
+		if err != nil {
+			return fmt.Errorf("model pack %s: %w", name, err)
+		}
+		err = e.warm()
+		e.release()
+		if err != nil {
+			return fmt.Errorf("model pack %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// runIdleUnloader periodically unloads engines unused for --idle-unload, freeing
+// their RAM/VRAM; the next request for a pack loads it again
+func runIdleUnloader() {
+	ticker := time.NewTicker(min(config.IdleUnload/4, time.Minute))
+	defer ticker.Stop()
+	for range ticker.C {
+		unloadIdleEngines(config.IdleUnload)
+	}
+}
+
+// unloadIdleEngines removes engines idle for longer than idle and drains them in the background
+func unloadIdleEngines(idle time.Duration) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+
+	modelsMu.Lock()
+	var idleEngines []*engine
+	for name, e := range engines {
+		if time.Since(time.Unix(0, e.lastUsed.Load())) > idle {
+			delete(engines, name)
+			idleEngines = append(idleEngines, e)
+		}
+	}
+	modelsMu.Unlock()
+
+	for _, e := range idleEngines {
+		log.Printf("Unloading model pack %s after %s idle", e.pack.Name, idle)
+		go e.drain()
+	}
+}
+
+// destroyEngines releases all loaded ONNX sessions on shutdown
+func destroyEngines() {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	for name, e := range engines {
+		e.destroy()
+		delete(engines, name)
+	}
+}
+
+// engineStatus describes a loaded engine for the admin API
+type engineStatus struct {
+	Model   string `json:"model"`
+	Dir     string `json:"dir"`
+	Devices []int  `json:"gpu_devices,omitempty"`
+}
+
+// loadedEngines returns the currently loaded engines sorted by pack name
+func loadedEngines() []engineStatus {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	status := make([]engineStatus, 0, len(engines))
+	for name, e := range engines {
+		entry := engineStatus{Model: name, Dir: e.pack.Dir}
+		if config.UseGPU {
+			entry.Devices = engineDevices()
+		}
+		status = append(status, entry)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Model < status[j].Model })
+	return status
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// docSection is a chapter of an uploaded document: a heading, if the document
+// has one there, and the prose under it
+type docSection struct {
+	Title string
+	Text  string
+}
+
+// chapterBreak separates chapters when a document is read as a single input
+const chapterBreak = "\n\n[pause:1s]\n\n"
+
+// extractDocument returns the readable text of an uploaded file of the given
+// kind, split into chapters at its headings
+func extractDocument(kind string, data []byte) ([]docSection, error) {
+	if kind == "pdf" {
+		return extractPDF(data)
+	}
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("file must be UTF-8 text")
+	}
+	switch kind {
+	case "html":
+		return htmlSections(string(data)), nil
+	case "markdown":
+		return markdownSections(string(data)), nil
+	}
+	return []docSection{{Text: strings.TrimSpace(string(data))}}, nil
+}
+
+// sectionsInput joins chapters into one input, each heading read as a sentence
+// and a pause between chapters
+func sectionsInput(sections []docSection) string {
+	parts := make([]string, 0, len(sections))
+	for _, s := range sections {
+		if text := sectionInput(s); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, chapterBreak)
+}
+
+// sectionInput is the text read for one chapter
+func sectionInput(s docSection) string {
+	if s.Title == "" {
+		return s.Text
+	}
+	return strings.TrimSpace(sentence(s.Title) + "\n\n" + s.Text)
+}
+
+// sectionItems turns chapters into the items of a packaged job, one file per
+// chapter named after its heading
+func sectionItems(sections []docSection) []JobItem {
+	items := make([]JobItem, 0, len(sections))
+	for _, s := range sections {
+		if s.Text == "" {
+			continue // a heading with nothing under it, such as a part title
+		}
+		items = append(items, JobItem{Name: s.Title, Input: sectionInput(s)})
+	}
+	return items
+}
+
+// markdownSections splits Markdown at its level 1-3 headings
+func markdownSections(md string) []docSection {
+	var sections []docSection
+	current := docSection{}
+	var body []string
+	finish := func() {
+		current.Text = strings.TrimSpace(markdownToText(strings.Join(body, "\n")))
+		if current.Title != "" || current.Text != "" {
+			sections = append(sections, current)
+		}
+		body = body[:0]
+	}
+
+	inFence := false
+	for _, line := range strings.Split(md, "\n") {
+		if mdFence.MatchString(line) {
+			inFence = !inFence
+		}
+		if m := mdChapterHeading.FindStringSubmatch(line); m != nil && !inFence {
+			finish()
+			current = docSection{Title: strings.TrimSpace(mdEmphasis.ReplaceAllString(m[1], "$1$2$3$4"))}
+			continue
+		}
+		body = append(body, line)
+	}
+	finish()
+	return sections
+}
+
+// mdChapterHeading matches the ATX headings that start a chapter
+var mdChapterHeading = regexp.MustCompile(`^\s{0,3}#{1,3}\s+(.*?)\s*#*\s*$`)
+
+// HTML constructs handled by htmlSections
+var (
+	htmlComment  = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlTitle    = regexp.MustCompile(`(?is)<title\b[^>]*>(.*?)</title\s*>`)
+	htmlArticle  = regexp.MustCompile(`(?is)<article\b[^>]*>(.*?)</article\s*>`)
+	htmlMain     = regexp.MustCompile(`(?is)<main\b[^>]*>(.*?)</main\s*>`)
+	htmlBody     = regexp.MustCompile(`(?is)<body\b[^>]*>(.*)</body\s*>`)
+	htmlHeading  = regexp.MustCompile(`(?is)<h([1-3])\b[^>]*>(.*?)</h[1-3]\s*>`)
+	htmlBlock    = regexp.MustCompile(`(?i)</?(p|div|br|li|ul|ol|dl|dt|dd|tr|table|blockquote|pre|section|h[4-6]|figcaption|hr)\b[^>]*>`)
+	htmlTag      = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlBlank    = regexp.MustCompile(`\n\s*\n\s*`)
+	htmlSpace    = regexp.MustCompile(`[ \t\r\f\v]+`)
+	htmlDropped  = map[string]*regexp.Regexp{}
+	htmlNotProse = []string{
+		// never text
+		"script", "style", "noscript", "template", "svg", "iframe", "object", "canvas",
+		// page furniture around the article
+		"nav", "header", "footer", "aside", "form", "button", "select", "menu", "dialog",
+	}
+)
+
+func init() {
+	for _, tag := range htmlNotProse {
+		htmlDropped[tag] = regexp.MustCompile(`(?is)<` + tag + `\b[^>]*>.*?</` + tag + `\s*>`)
+	}
+}
+
+// htmlHeadingMark brackets a heading in the flattened text
+const htmlHeadingMark = "\x00"
+
+// htmlSections extracts the article text of a web page: scripts, navigation,
+// headers, footers and sidebars are dropped, the <article> (or <main>) is kept
+// when the page marks one, and h1-h3 headings start chapters. The page title
+// names the first chapter when it has no heading of its own
+func htmlSections(page string) []docSection {
+	page = htmlComment.ReplaceAllString(page, "")
+	title := ""
+	if m := htmlTitle.FindStringSubmatch(page); m != nil {
+		title = htmlText(m[1])
+	}
+	for _, tag := range htmlNotProse {
+		page = htmlDropped[tag].ReplaceAllString(page, "\n")
+	}
+
+	var content string
+	if articles := htmlArticle.FindAllStringSubmatch(page, -1); articles != nil {
+		for _, m := range articles {
+			content += m[1] + "\n"
+		}
+	} else if m := htmlMain.FindStringSubmatch(page); m != nil {
+		content = m[1]
+	} else if m := htmlBody.FindStringSubmatch(page); m != nil {
+		content = m[1]
+	} else {
+		content = page
+	}
+
+	content = htmlHeading.ReplaceAllStringFunc(content, func(h string) string {
+		text := htmlText(htmlHeading.FindStringSubmatch(h)[2])
+		return "\n" + htmlHeadingMark + text + htmlHeadingMark + "\n"
+	})
+	content = htmlText(htmlBlock.ReplaceAllString(content, "\n"))
+
+	var sections []docSection
+	current := docSection{Title: title}
+	parts := strings.Split(content, htmlHeadingMark)
+	for i, part := range parts {
+		if i%2 == 1 {
+			if current.Text != "" || (current.Title != "" && current.Title != title) {
+				sections = append(sections, current)
+			}
+			current = docSection{Title: part}
+			continue
+		}
+		current.Text = strings.TrimSpace(current.Text + "\n\n" + part)
+	}
+	if current.Title != "" || current.Text != "" {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+// htmlText strips the tags of an HTML fragment, decodes its entities and
+// tidies whitespace, keeping paragraph breaks
+func htmlText(fragment string) string {
+	text := html.UnescapeString(htmlTag.ReplaceAllString(fragment, " "))
+	text = strings.ReplaceAll(text, "\u00a0", " ")
+	text = htmlSpace.ReplaceAllString(text, " ")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(htmlBlank.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxFeedEpisodes bounds the podcast feed to the newest saved files
+const maxFeedEpisodes = 200
+
+// episodeMeta is the sidecar saved next to an audio file for the podcast feed.
+// Owner is the name of the API key the audio was synthesized with
+type episodeMeta struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Voice       string    `json:"voice"`
+	Owner       string    `json:"owner,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// episodeMetaPath returns the sidecar path for a saved file. The leading dot
+// keeps it out of /v1/audio/files, which refuses hidden names
+func episodeMetaPath(name string) string {
+	return filepath.Join(config.SaveDir, "."+name+".json")
+}
+
+// saveEpisode records the title and text of saved audio for the podcast feed.
+// Failures are logged: the audio itself is already saved
+func saveEpisode(name string, req *TTSRequest) {
+	if config.PodcastTitle == "" {
+		return
+	}
+	// Inline tags and audio tokens are not for reading
+	text := markupPattern.ReplaceAllString(req.Input, " ")
+	meta := episodeMeta{
+		Title:       req.Title,
+		Description: excerpt(text, 500),
+		Voice:       req.Voice,
+		Owner:       requestTenant(req),
+		CreatedAt:   time.Now().UTC(),
+	}
+	if meta.Title == "" {
+		meta.Title = excerpt(text, 60)
+	}
+	data, err := json.Marshal(meta)
+	if err == nil {
+		err = os.WriteFile(episodeMetaPath(name), data, 0o644)
+	}
+	if err != nil {
+		log.Printf("Failed to save podcast metadata for %s: %v", name, err)
+	}
+}
+
+// excerpt shortens text to at most n runes at a word boundary
+func excerpt(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	cut := string(runes[:n])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, ",;:") + "…"
+}
+
+// RSS 2.0 feed documents
+type (
+	rssFeed struct {
+		XMLName xml.Name   `xml:"rss"`
+		Version string     `xml:"version,attr"`
+		Channel rssChannel `xml:"channel"`
+	}
+	rssChannel struct {
+		Title       string    `xml:"title"`
+		Link        string    `xml:"link"`
+		Description string    `xml:"description"`
+		Generator   string    `xml:"generator"`
+		PubDate     string    `xml:"lastBuildDate,omitempty"`
+		Items       []rssItem `xml:"item"`
+	}
+	rssItem struct {
+		Title       string       `xml:"title"`
+		Description string       `xml:"description,omitempty"`
+		GUID        rssGUID      `xml:"guid"`
+		PubDate     string       `xml:"pubDate"`
+		Enclosure   rssEnclosure `xml:"enclosure"`
+	}
+	rssGUID struct {
+		Value       string `xml:",chardata"`
+		IsPermaLink bool   `xml:"isPermaLink,attr"`
+	}
+	rssEnclosure struct {
+		URL    string `xml:"url,attr"`
+		Length int64  `xml:"length,attr"`
+		Type   string `xml:"type,attr"`
+	}
+)
+
+// savedEpisode is an audio file of SaveDir listed in the feed
+type savedEpisode struct {
+	name string
+	info os.FileInfo
+	meta episodeMeta
+}
+
+// handlePodcastFeed publishes the audio saved in SaveDir as an RSS feed,
+// newest first, with enclosures pointing at /v1/audio/files. With --api-keys
+// the feed only lists the audio synthesized with the caller's key
+func handlePodcastFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if config.PodcastTitle == "" {
+		sendError(w, "Podcast feed is disabled (start the server with --podcast-title and --save-dir)", http.StatusNotFound)
+		return
+	}
+
+	episodes, err := savedEpisodes(requestAPIKey(r))
+	if err != nil {
+		sendError(w, "Failed to list saved audio: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	baseURL := requestBaseURL(r)
+	feed := rssFeed{Version: "2.0", Channel: rssChannel{
+		Title:       config.PodcastTitle,
+		Link:        baseURL + "/",
+		Description: config.PodcastTitle + ": speech generated by Supertonic",
+		Generator:   "go-supertonic",
+	}}
+	for _, ep := range episodes {
+		published := ep.info.ModTime()
+		if !ep.meta.CreatedAt.IsZero() {
+			published = ep.meta.CreatedAt
+		}
+		title := ep.meta.Title
+		if title == "" {
+			title = ep.name
+		}
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       title,
+			Description: ep.meta.Description,
+			GUID:        rssGUID{Value: ep.name},
+			PubDate:     published.Format(time.RFC1123Z),
+			Enclosure: rssEnclosure{
+				URL:    baseURL + "/v1/audio/files/" + url.PathEscape(ep.name),
+				Length: ep.info.Size(),
+				Type:   contentTypeForFile(ep.name),
+			},
+		})
+	}
+	if len(feed.Channel.Items) > 0 {
+		feed.Channel.PubDate = feed.Channel.Items[0].PubDate
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		log.Printf("Failed to write podcast feed: %v", err)
+	}
+}
+
+// savedEpisodes lists the audio files of SaveDir, newest first, with their
+// sidecar metadata when present. Packaged job archives are not episodes. With
+// --api-keys only the files saved for key are listed
+func savedEpisodes(key *apiKey) ([]savedEpisode, error) {
+	entries, err := os.ReadDir(config.SaveDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var episodes []savedEpisode
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || !entry.Type().IsRegular() || contentTypeForFile(name) == "application/octet-stream" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		ep := savedEpisode{name: name, info: info}
+		if data, err := os.ReadFile(episodeMetaPath(name)); err == nil {
+			json.Unmarshal(data, &ep.meta)
+		}
+		if apiKeys != nil && (key == nil || ep.meta.Owner != key.Name) {
+			continue
+		}
+		episodes = append(episodes, ep)
+	}
+
+	sort.Slice(episodes, func(i, j int) bool {
+		return episodes[i].info.ModTime().After(episodes[j].info.ModTime())
+	})
+	if len(episodes) > maxFeedEpisodes {
+		episodes = episodes[:maxFeedEpisodes]
+	}
+	return episodes, nil
+}
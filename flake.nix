@@ -16,7 +16,7 @@
         pname = "go-supertonic";
         version = "0.1.0";
         src = ./.;  # Relative to flake root, works in pure evaluation
-        vendorHash = "sha256-U/JLHsijXjXZkyglMnFYX+Ezu/K3vJCusfMl7uC2NM0=";
+        vendorHash = "sha256-f0rDg1tCCt2Y+Ra5/6IuDx1agPK+DEvBbH/7vgX3RpM=";
         nativeBuildInputs = with pkgs; [ makeWrapper ];
         postInstall = ''
           wrapProgram $out/bin/go-supertonic \
@@ -5,7 +5,9 @@ go 1.25.5
 require (
 	github.com/go-audio/audio v1.0.0
 	github.com/go-audio/wav v1.1.0
+	github.com/klauspost/compress v1.20.1
 	github.com/yalue/onnxruntime_go v1.25.0
+	golang.org/x/sys v0.34.0
 	golang.org/x/text v0.27.0
 )
 
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-supertonic/tts"
+)
+
+// errGPUBusy is returned when admitting a request would oversubscribe the GPU
+var errGPUBusy = errors.New("GPU is at capacity, retry later")
+
+// gpuDevice is one CUDA device requests are sharded across
+type gpuDevice struct {
+	id    int
+	slots chan struct{} // sized from --gpu-sessions
+}
+
+// gpuDevices are the devices from --gpu-devices (empty on CPU)
+var gpuDevices []*gpuDevice
+
+// gpuDegraded explains why the server fell back to CPU when --use-gpu was set (empty if it didn't)
+var gpuDegraded string
+
+// gpuMemory caches the last free-VRAM reading so admission doesn't run nvidia-smi per request
+var gpuMemory struct {
+	sync.Mutex
+	freeMB  map[int]int
+	checked time.Time
+}
+
+// gpuMemoryTTL is how long a free-VRAM reading is trusted
+const gpuMemoryTTL = time.Second
+
+// setupGPU validates the GPU admission flags and creates the device slots
+func setupGPU() error {
+	if !config.UseGPU {
+		return nil
+	}
+	if config.GPUSessions < 1 {
+		return fmt.Errorf("--gpu-sessions must be at least 1")
+	}
+	if config.GPUMinFreeMB < 0 {
+		return fmt.Errorf("--gpu-min-free-mb must not be negative")
+	}
+
+	seen := map[int]bool{}
+	for _, field := range strings.Split(config.GPUDevices, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || id < 0 {
+			return fmt.Errorf("invalid --gpu-devices entry %q", field)
+		}
+		if seen[id] {
+			return fmt.Errorf("--gpu-devices lists device %d twice", id)
+		}
+		seen[id] = true
+		gpuDevices = append(gpuDevices, &gpuDevice{id: id, slots: make(chan struct{}, config.GPUSessions)})
+	}
+
+	if config.GPUMinFreeMB > 0 {
+		free, err := queryGPUFreeMB()
+		if err != nil {
+			return fmt.Errorf("--gpu-min-free-mb needs nvidia-smi: %w", err)
+		}
+		for _, device := range gpuDevices {
+			if _, ok := free[device.id]; !ok {
+				return fmt.Errorf("nvidia-smi does not report GPU %d", device.id)
+			}
+		}
+	}
+	return nil
+}
+
+// checkGPU verifies every --gpu-devices entry can load a model. On failure the
+// server falls back to CPU and reports itself degraded, unless --strict-gpu is set
+func checkGPU(pack ModelPack) error {
+	if !config.UseGPU {
+		return nil
+	}
+	for _, device := range gpuDevices {
+		err := tts.ProbeDevice(pack.Dir, device.id)
+		if err == nil {
+			continue
+		}
+		if config.StrictGPU {
+			return fmt.Errorf("GPU %d: %w", device.id, err)
+		}
+		gpuDegraded = fmt.Sprintf("GPU %d failed to initialize: %v", device.id, err)
+		log.Printf("WARNING: %s; falling back to CPU inference (use --strict-gpu to exit instead)", gpuDegraded)
+		config.UseGPU = false
+		gpuDevices = nil
+		return nil
+	}
+	return nil
+}
+
+// engineDevices returns the device each engine worker is loaded on, in gpuDevices order
+func engineDevices() []int {
+	if len(gpuDevices) == 0 {
+		return []int{tts.CPUDevice}
+	}
+	devices := make([]int, len(gpuDevices))
+	for i, device := range gpuDevices {
+		devices[i] = device.id
+	}
+	return devices
+}
+
+// interactiveGPUWait is how long an interactive request waits for a session
+// before it is refused; queued work stands back while one is waiting
+const interactiveGPUWait = time.Second
+
+// interactiveWaiting counts interactive requests waiting for a GPU session
+var interactiveWaiting atomic.Int32
+
+// admitGPU reserves a session on the least loaded GPU for one synthesis and
+// returns that device's worker index. Interactive requests wait up to
+// interactiveGPUWait for a session, taking precedence over queued work, and are
+// refused with errGPUBusy after that or when free VRAM is below
+// --gpu-min-free-mb; queued work (wait) blocks for a session instead. The
+// returned function frees the session
+func admitGPU(wait bool) (int, func(), error) {
+	if len(gpuDevices) == 0 {
+		return 0, func() {}, nil
+	}
+
+	var index int
+	var ok bool
+	if !wait || interactiveWaiting.Load() == 0 {
+		index, ok = reserveGPU()
+	}
+	if !ok && !wait {
+		interactiveWaiting.Add(1)
+		for deadline := time.Now().Add(interactiveGPUWait); !ok && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+			index, ok = reserveGPU()
+		}
+		interactiveWaiting.Add(-1)
+	}
+	for wait && !ok {
+		// Queued work polls rather than pinning itself to one device's queue
+		time.Sleep(50 * time.Millisecond)
+		if interactiveWaiting.Load() == 0 {
+			index, ok = reserveGPU()
+		}
+	}
+	if !ok {
+		return 0, nil, errGPUBusy
+	}
+	device := gpuDevices[index]
+	release := func() { <-device.slots }
+
+	if config.GPUMinFreeMB > 0 {
+		free, err := gpuFreeMB(device.id)
+		if err == nil && free < config.GPUMinFreeMB {
+			release()
+			return 0, nil, fmt.Errorf("%w (GPU %d has %d MB free, %d MB required)", errGPUBusy, device.id, free, config.GPUMinFreeMB)
+		}
+	}
+	return index, release, nil
+}
+
+// reserveGPU takes a session on the device with the most free sessions
+func reserveGPU() (int, bool) {
+	for {
+		best := -1
+		for i, device := range gpuDevices {
+			if len(device.slots) < cap(device.slots) && (best < 0 || len(device.slots) < len(gpuDevices[best].slots)) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return 0, false
+		}
+		select {
+		case gpuDevices[best].slots <- struct{}{}:
+			return best, true
+		default:
+			// Another request took the last session first; look again
+		}
+	}
+}
+
+// gpuFreeMB returns a device's free memory, cached for gpuMemoryTTL
+func gpuFreeMB(id int) (int, error) {
+	gpuMemory.Lock()
+	defer gpuMemory.Unlock()
+	if time.Since(gpuMemory.checked) >= gpuMemoryTTL {
+		free, err := queryGPUFreeMB()
+		if err != nil {
+			return 0, err
+		}
+		gpuMemory.freeMB, gpuMemory.checked = free, time.Now()
+	}
+	free, ok := gpuMemory.freeMB[id]
+	if !ok {
+		return 0, fmt.Errorf("nvidia-smi does not report GPU %d", id)
+	}
+	return free, nil
+}
+
+// queryGPUFreeMB asks nvidia-smi for the free memory of each GPU by index
+func queryGPUFreeMB() (map[int]int, error) {
+	out, err := exec.Command("nvidia-smi", "--query-gpu=index,memory.free", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return nil, err
+	}
+	free := map[int]int{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		index, memory, ok := strings.Cut(line, ",")
+		id, err1 := strconv.Atoi(strings.TrimSpace(index))
+		mb, err2 := strconv.Atoi(strings.TrimSpace(memory))
+		if !ok || err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("unexpected nvidia-smi output %q", line)
+		}
+		free[id] = mb
+	}
+	return free, nil
+}
+
+// gpuUtilization is one device's load as reported by nvidia-smi
+type gpuUtilization struct {
+	ID            int `json:"id"`
+	Percent       int `json:"utilization_percent"`
+	MemoryUsedMB  int `json:"memory_used_mb"`
+	MemoryTotalMB int `json:"memory_total_mb"`
+}
+
+// queryGPUUtilization asks nvidia-smi for the compute and memory load of every GPU
+func queryGPUUtilization() (map[int]gpuUtilization, error) {
+	out, err := exec.Command("nvidia-smi", "--query-gpu=index,utilization.gpu,memory.used,memory.total", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return nil, err
+	}
+	devices := map[int]gpuUtilization{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, ",")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("unexpected nvidia-smi output %q", line)
+		}
+		var values [4]int
+		for i, field := range fields {
+			if values[i], err = strconv.Atoi(strings.TrimSpace(field)); err != nil {
+				return nil, fmt.Errorf("unexpected nvidia-smi output %q", line)
+			}
+		}
+		devices[values[0]] = gpuUtilization{ID: values[0], Percent: values[1], MemoryUsedMB: values[2], MemoryTotalMB: values[3]}
+	}
+	return devices, nil
+}
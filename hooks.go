@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Hook lets operators who build their own binary customize request handling
+// without patching the handlers: add a file to this package that registers a
+// hook from init, embedding NopHook to implement only the stages it needs:
+//
+//	type houseStyle struct{ NopHook }
+//
+//	func (houseStyle) PreSynthesize(req *TTSRequest) error {
+//		req.Input = strings.ReplaceAll(req.Input, "ACME", "Acme")
+//		return nil
+//	}
+//
+//	func init() { RegisterHook(houseStyle{}) }
+//
+// Hooks run in registration order; the first error stops the request. Return a
+// *HookError to choose the HTTP status
+type Hook interface {
+	// PreValidate sees an HTTP request's decoded body before defaults and
+	// validation are applied, e.g. for custom authentication. Other frontends
+	// (Wyoming, MQTT, the command line) skip it
+	PreValidate(r *http.Request, req *TTSRequest) error
+	// PreSynthesize sees every validated request just before synthesis, e.g. to
+	// rewrite or filter its input
+	PreSynthesize(req *TTSRequest) error
+	// PostSynthesize may process or replace the rendered samples before they are
+	// encoded. Streamed responses call it once per block as it is sent
+	PostSynthesize(req *TTSRequest, samples []float32, sampleRate int) ([]float32, error)
+}
+
+// NopHook implements every Hook stage as a no-op, for embedding
+type NopHook struct{}
+
+func (NopHook) PreValidate(*http.Request, *TTSRequest) error { return nil }
+func (NopHook) PreSynthesize(*TTSRequest) error              { return nil }
+func (NopHook) PostSynthesize(_ *TTSRequest, samples []float32, _ int) ([]float32, error) {
+	return samples, nil
+}
+
+// HookError is a hook's refusal with the HTTP status to answer with
+type HookError struct {
+	Status  int
+	Message string
+}
+
+func (e *HookError) Error() string {
+	return e.Message
+}
+
+// hooks are the registered hooks in order. Registration happens from init, so
+// they are read without locking afterwards
+var hooks []Hook
+
+// RegisterHook adds a hook; call it from an init function
+func RegisterHook(h Hook) {
+	hooks = append(hooks, h)
+}
+
+// runPreValidateHooks runs the PreValidate stage for an HTTP request
+func runPreValidateHooks(r *http.Request, req *TTSRequest) error {
+	for _, h := range hooks {
+		if err := h.PreValidate(r, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPreSynthesizeHooks runs the PreSynthesize stage
+func runPreSynthesizeHooks(req *TTSRequest) error {
+	for _, h := range hooks {
+		if err := h.PreSynthesize(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPostSynthesizeHooks passes samples through each PostSynthesize stage
+func runPostSynthesizeHooks(req *TTSRequest, samples []float32, sampleRate int) ([]float32, error) {
+	for _, h := range hooks {
+		var err error
+		if samples, err = h.PostSynthesize(req, samples, sampleRate); err != nil {
+			return nil, fmt.Errorf("post-synthesis hook failed: %w", err)
+		}
+	}
+	return samples, nil
+}
@@ -0,0 +1,587 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go-supertonic/tts"
+)
+
+// Job statuses
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobCompleted = "completed"
+	jobFailed    = "failed"
+)
+
+// JobRequest is the body of POST /v1/audio/jobs: a speech request plus async options.
+// With items, each entry is rendered to its own file (instead of input) and the job's
+// audio is a zip or tar (package) of the files with a manifest.json
+type JobRequest struct {
+	TTSRequest
+	CallbackURL string    `json:"callback_url,omitempty"`
+	Items       []JobItem `json:"items,omitempty"`
+	Package     string    `json:"package,omitempty"`
+}
+
+// Job tracks one asynchronous synthesis
+type Job struct {
+	ID          string            `json:"id"`
+	Status      string            `json:"status"`
+	Error       string            `json:"error,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+	AudioURL    string            `json:"audio_url,omitempty"`
+	AudioBytes  int               `json:"audio_bytes,omitempty"`
+	Chunks      int               `json:"chunks,omitempty"`
+	Truncated   bool              `json:"truncated,omitempty"`
+	Skipped     []tts.SkippedSpan `json:"skipped,omitempty"`
+	Quality     *audioQuality     `json:"quality,omitempty"`
+	Format      string            `json:"response_format"`
+	Package     string            `json:"package,omitempty"`
+	Files       int               `json:"files,omitempty"`
+	CallbackURL string            `json:"callback_url,omitempty"`
+	Owner       string            `json:"owner,omitempty"` // name of the API key that created the job
+
+	request TTSRequest
+	items   []TTSRequest // per-file requests of a packaged job
+	names   []string
+	audio   []byte
+	baseURL string
+}
+
+var (
+	jobsMu sync.Mutex
+	jobs   = map[string]*Job{}
+
+	// Jobs admitted and not yet finished, in total and by tenant, for
+	// --max-queued-jobs and --max-queued-jobs-per-key
+	pendingJobs     int
+	pendingByTenant = map[string]int{}
+)
+
+// jobQueueRetry is the Retry-After sent when a job queue limit is reached
+const jobQueueRetry = 30 * time.Second
+
+// jobSlots bounds how many jobs synthesize at once (sized in main from
+// --job-workers), taking turns across API keys
+var jobSlots *fairScheduler
+
+// callbackClient delivers job callbacks. Every connection it makes is
+// checked by refusePrivateDial, so neither a redirect nor a changed DNS
+// answer can point a callback at the server's own network
+var callbackClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: refusePrivateDial}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+// errPrivateCallback is returned for callbacks to private, loopback or
+// link-local addresses
+var errPrivateCallback = errors.New("callback_url must not point at a private, loopback or link-local address")
+
+// publicAddress reports whether ip may receive callbacks
+func publicAddress(ip net.IP) bool {
+	return !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// refusePrivateDial is the callback dialer's Control hook: it runs on the
+// resolved address of every connection
+func refusePrivateDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+		return fmt.Errorf("%w (%s)", errPrivateCallback, host)
+	}
+	return nil
+}
+
+// checkCallbackURL validates a job's callback_url: an absolute http(s) URL
+// whose host resolves to public addresses only
+func checkCallbackURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callback_url must be an absolute http(s) URL")
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("callback_url host does not resolve: %w", err)
+	}
+	for _, addr := range addrs {
+		if !publicAddress(addr.IP) {
+			return errPrivateCallback
+		}
+	}
+	return nil
+}
+
+// newJobID returns a random job identifier
+func newJobID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "job_" + hex.EncodeToString(b)
+}
+
+// requestBaseURL reconstructs the externally visible base URL of the server from a request
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// handleCreateJob queues an asynchronous synthesis
+func handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req JobRequest
+	if isMultipartRequest(r) {
+		var err error
+		if req, err = decodeJobUpload(w, r); err != nil {
+			sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.key = requestAPIKey(r)
+	var items []TTSRequest
+	var names []string
+	err := runPreValidateHooks(r, &req.TTSRequest)
+	if err == nil {
+		items, names, err = prepareJobRequest(&req)
+	}
+	auditRequest(r, &req.TTSRequest)
+	if err != nil {
+		sendError(w, err.Error(), validationStatus(w, err))
+		return
+	}
+	if req.Preview {
+		sendError(w, "preview is not supported for jobs", http.StatusBadRequest)
+		return
+	}
+	if len(req.SpeechMarks) > 0 || req.Visemes != "" {
+		sendError(w, "speech_marks and visemes are not supported for jobs", http.StatusBadRequest)
+		return
+	}
+	if req.CallbackURL != "" {
+		if err := checkCallbackURL(r.Context(), req.CallbackURL); err != nil {
+			sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tenant := requestTenant(&req.TTSRequest)
+	if !admitJob(tenant) {
+		log.Printf("Rejected job from %s: queued job limit reached", clientAddr(r))
+		w.Header().Set("Retry-After", strconv.Itoa(int(jobQueueRetry.Seconds())))
+		sendError(w, "Too many queued jobs; retry later", http.StatusTooManyRequests)
+		return
+	}
+
+	job := &Job{
+		ID:          newJobID(),
+		Status:      jobQueued,
+		CreatedAt:   time.Now().UTC(),
+		Format:      req.ResponseFormat,
+		Package:     req.Package,
+		Files:       len(items),
+		CallbackURL: req.CallbackURL,
+		Owner:       tenant,
+		request:     req.TTSRequest,
+		items:       items,
+		names:       names,
+		baseURL:     requestBaseURL(r),
+	}
+	job.AudioURL = job.baseURL + "/v1/audio/jobs/" + job.ID + "/audio"
+
+	if config.Stateless {
+		if err := putJobRecord(jobSnapshot(job)); err != nil {
+			log.Printf("Job %s: failed to store job record: %v", job.ID, err)
+			finishJob(tenant)
+			sendError(w, "Failed to store job: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		jobsMu.Lock()
+		jobs[job.ID] = job
+		jobsMu.Unlock()
+	}
+
+	log.Printf("Job %s queued: voice=%s, text=\"%.50s\"", job.ID, req.Voice, req.Input)
+	go runJob(job)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(jobSnapshot(job))
+}
+
+// admitJob counts a new job against --max-queued-jobs and
+// --max-queued-jobs-per-key, reporting false when either limit is reached
+func admitJob(tenant string) bool {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if config.MaxQueuedJobs > 0 && pendingJobs >= config.MaxQueuedJobs {
+		return false
+	}
+	if config.MaxQueuedJobsKey > 0 && pendingByTenant[tenant] >= config.MaxQueuedJobsKey {
+		return false
+	}
+	pendingJobs++
+	pendingByTenant[tenant]++
+	return true
+}
+
+// finishJob releases a job's place in the queue limits once it has run
+func finishJob(tenant string) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	pendingJobs--
+	if pendingByTenant[tenant]--; pendingByTenant[tenant] <= 0 {
+		delete(pendingByTenant, tenant)
+	}
+}
+
+// prepareJobRequest validates a job's speech settings. A packaged job also
+// gets one validated request per file (a job without items packages its
+// input as the only file); req then carries the first item's settings with
+// all inputs joined, for logging and auditing
+func prepareJobRequest(req *JobRequest) ([]TTSRequest, []string, error) {
+	if req.Package == "" && len(req.Items) == 0 {
+		return nil, nil, validateRequest(&req.TTSRequest)
+	}
+	if req.Package == "" {
+		req.Package = packageZip
+	}
+	if err := validatePackage(req.Package); err != nil {
+		return nil, nil, err
+	}
+
+	if len(req.Items) == 0 {
+		if err := validateRequest(&req.TTSRequest); err != nil {
+			return nil, nil, err
+		}
+		return []TTSRequest{req.TTSRequest}, []string{""}, nil
+	}
+	if req.Input != "" {
+		return nil, nil, fmt.Errorf("input and items cannot be combined")
+	}
+
+	items, err := jobItemRequests(req.TTSRequest, req.Items)
+	if err != nil {
+		return nil, nil, err
+	}
+	inputs := make([]string, len(items))
+	names := make([]string, len(items))
+	for i, item := range items {
+		inputs[i], names[i] = item.Input, req.Items[i].Name
+	}
+	req.TTSRequest = items[0]
+	req.Input = strings.Join(inputs, "\n\n")
+	return items, names, nil
+}
+
+// handleGetJob returns the status of a job
+func handleGetJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, err := lookupOwnJob(r)
+	if err != nil {
+		sendError(w, "Job lookup failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		sendError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobSnapshot(job))
+}
+
+// handleGetJobAudio returns the audio of a completed job
+func handleGetJobAudio(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, err := lookupOwnJob(r)
+	if err != nil {
+		sendError(w, "Job lookup failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		sendError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	jobsMu.Lock()
+	status, audio, completedAt := job.Status, job.audio, job.CompletedAt
+	jobsMu.Unlock()
+	if status != jobCompleted {
+		sendError(w, "Job is "+status, http.StatusConflict)
+		return
+	}
+
+	// Stateless replicas never hold the audio; send the client to the bucket
+	if config.Stateless {
+		audioURL, err := s3PresignGet(config.S3.Prefix+jobAudioName(job), config.S3.URLExpiry, time.Now())
+		if err != nil {
+			sendError(w, "Failed to sign audio URL: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, audioURL, http.StatusFound)
+		return
+	}
+
+	// Range requests let players seek within long renders
+	var modTime time.Time
+	if completedAt != nil {
+		modTime = *completedAt
+	}
+	w.Header().Set("Content-Type", jobContentType(job))
+	http.ServeContent(w, r, jobAudioName(job), modTime, bytes.NewReader(audio))
+}
+
+// lookupJob returns a job by ID, or nil if it does not exist
+func lookupJob(id string) (*Job, error) {
+	if config.Stateless {
+		job, err := getJobRecord(id)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return job, err
+	}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	return jobs[id], nil
+}
+
+// lookupOwnJob returns the job named by the request path, or nil if it does
+// not exist or, with --api-keys, was created with another key
+func lookupOwnJob(r *http.Request) (*Job, error) {
+	job, err := lookupJob(r.PathValue("id"))
+	if err != nil || job == nil {
+		return nil, err
+	}
+	if key := requestAPIKey(r); apiKeys != nil && (key == nil || job.Owner != key.Name) {
+		return nil, nil
+	}
+	return job, nil
+}
+
+// jobSnapshot copies a job's public fields under the lock
+func jobSnapshot(job *Job) Job {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	snapshot := *job
+	snapshot.audio = nil
+	return snapshot
+}
+
+// runJob synthesizes a job once a worker slot is free, then fires its callback
+func runJob(job *Job) {
+	tenant := requestTenant(&job.request)
+	jobSlots.acquire(tenant)
+	setJobStatus(job, jobRunning, nil, "")
+
+	var audioData []byte
+	var err error
+	if job.Package != "" {
+		var archive bytes.Buffer
+		err = renderPackage(&archive, job, job.items, job.names)
+		audioData = archive.Bytes()
+	} else {
+		job.request.waitForGPU = true
+		audioData, err = generateSpeech(&job.request)
+	}
+	jobSlots.release()
+	finishJob(tenant)
+
+	if err == nil {
+		if storeErr := storeJobAudio(job, audioData); storeErr != nil {
+			log.Printf("Job %s: %v", job.ID, storeErr)
+			if config.Stateless {
+				// Other replicas can only serve audio that reached the bucket
+				err = storeErr
+			}
+		}
+	}
+
+	if err != nil {
+		log.Printf("Job %s failed: %v", job.ID, err)
+		setJobStatus(job, jobFailed, nil, err.Error())
+	} else {
+		log.Printf("Job %s completed: %d bytes", job.ID, len(audioData))
+		setJobStatus(job, jobCompleted, audioData, "")
+	}
+
+	if job.CallbackURL != "" {
+		deliverCallback(jobSnapshot(job))
+	}
+	time.AfterFunc(config.JobTTL, func() {
+		jobsMu.Lock()
+		delete(jobs, job.ID)
+		jobsMu.Unlock()
+	})
+}
+
+// jobAudioName returns the file name a job's audio is saved under
+func jobAudioName(job *Job) string {
+	if job.Package != "" {
+		return job.ID + "." + job.Package
+	}
+	return job.ID + "." + responseFormats[job.Format].Extension
+}
+
+// jobContentType returns the MIME type of a job's audio (or package)
+func jobContentType(job *Job) string {
+	if job.Package != "" {
+		return packageContentTypes[job.Package]
+	}
+	return contentTypeFor(job.Format)
+}
+
+// storeJobAudio persists a job's audio and, when uploaded to S3, points its
+// audio URL at the presigned object so callbacks can hand it straight on
+func storeJobAudio(job *Job, audio []byte) error {
+	if !storageEnabled() {
+		return nil
+	}
+	audioURL, err := storeAudio(jobAudioName(job), audio, jobContentType(job), job.baseURL)
+	if err != nil {
+		return err
+	}
+	if job.Package == "" {
+		saveEpisode(jobAudioName(job), &job.request)
+	}
+	if config.S3.Bucket != "" {
+		jobsMu.Lock()
+		job.AudioURL = audioURL
+		jobsMu.Unlock()
+	}
+	return nil
+}
+
+// setJobStatus updates a job's status under the lock, publishing it to the
+// shared store in stateless mode
+func setJobStatus(job *Job, status string, audio []byte, errMsg string) {
+	jobsMu.Lock()
+	updateJob(job, status, audio, errMsg)
+	jobsMu.Unlock()
+
+	if config.Stateless {
+		if err := putJobRecord(jobSnapshot(job)); err != nil {
+			log.Printf("Job %s: failed to store job record: %v", job.ID, err)
+		}
+	}
+}
+
+// updateJob applies a status change; the caller holds jobsMu
+func updateJob(job *Job, status string, audio []byte, errMsg string) {
+	job.Status = status
+	job.Error = errMsg
+	if audio != nil {
+		job.audio = audio
+		job.AudioBytes = len(audio)
+		job.Chunks = job.request.chunks
+		job.Truncated = job.request.truncated
+		job.Skipped = job.request.skipped
+		job.Quality = job.request.quality
+	}
+	if status == jobCompleted || status == jobFailed {
+		now := time.Now().UTC()
+		job.CompletedAt = &now
+	}
+}
+
+// signCallback returns the hex HMAC-SHA256 of "timestamp.body" with the callback secret
+func signCallback(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(config.CallbackSecret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverCallback POSTs the final job state to its callback URL, retrying with backoff.
+// Receivers verify X-Supertonic-Signature (sha256=HMAC of "timestamp.body") when a secret is configured
+func deliverCallback(job Job) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("Job %s: failed to encode callback: %v", job.ID, err)
+		return
+	}
+
+	backoff := time.Second
+	for attempt := 1; attempt <= 3; attempt++ {
+		err = postCallback(job.CallbackURL, body)
+		if err == nil {
+			log.Printf("Job %s: callback delivered to %s", job.ID, job.CallbackURL)
+			return
+		}
+		log.Printf("Job %s: callback attempt %d failed: %v", job.ID, attempt, err)
+		time.Sleep(backoff)
+		backoff *= 4
+	}
+}
+
+// postCallback sends one signed callback request
+func postCallback(callbackURL string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Supertonic-Timestamp", timestamp)
+	if config.CallbackSecret != "" {
+		req.Header.Set("X-Supertonic-Signature", "sha256="+signCallback(timestamp, body))
+	}
+
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+	return nil
+}
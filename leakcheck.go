@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"go-supertonic/tts"
+)
+
+// leakCheckSample is how often the live ONNX object counts are sampled
+const leakCheckSample = 5 * time.Second
+
+// runLeakCheck watches the live ONNX tensors and sessions. Every
+// --leak-check-interval it takes the lowest counts sampled in the interval
+// (between requests no tensor should be live outside the workers' scratch
+// pools, and only the loaded engines' sessions) and logs a warning when tensors stay above zero and grew, or when
+// sessions outnumber the loaded engines'
+func runLeakCheck() {
+	ticker := time.NewTicker(leakCheckSample)
+	defer ticker.Stop()
+
+	var lastFloor int64
+	var floor tts.ResourceCounts
+	var extraSessions int64
+	start := time.Now()
+	first := true
+	for range ticker.C {
+		live := tts.LiveResources()
+		live.Tensors -= live.Pooled
+		extra := live.Sessions - loadedSessions()
+		if first {
+			floor, extraSessions, first = live, extra, false
+		}
+		floor.Tensors = min(floor.Tensors, live.Tensors)
+		extraSessions = min(extraSessions, extra)
+
+		if time.Since(start) < config.LeakCheckInterval {
+			continue
+		}
+		if floor.Tensors > 0 && floor.Tensors > lastFloor {
+			log.Printf("Warning: possible ONNX tensor leak: at least %d tensors stayed live over the last %s (previously %d)",
+				floor.Tensors, config.LeakCheckInterval, lastFloor)
+		}
+		if extraSessions > 0 {
+			log.Printf("Warning: possible ONNX session leak: %d more sessions than the loaded engines hold over the last %s",
+				extraSessions, config.LeakCheckInterval)
+		}
+		lastFloor = floor.Tensors
+		start, first = time.Now(), true
+	}
+}
+
+// loadedSessions returns the number of ONNX sessions the loaded engines hold
+func loadedSessions() int64 {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	var sessions int64
+	for _, e := range engines {
+		sessions += int64(len(e.workers) * tts.SessionsPerWorker)
+	}
+	return sessions
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LLMBridgeRequest is the body of POST /v1/audio/speech/from-llm: the speech
+// settings plus where the text streams from, either an OpenAI-compatible
+// chat completions endpoint the server calls with stream forced on, or an
+// SSE stream URL it reads. input must be empty; the audio is a WAV stream.
+// buffer sets how the streamed text is grouped for synthesis (by sentence by default)
+type LLMBridgeRequest struct {
+	TTSRequest
+	LLM       *LLMUpstream  `json:"llm,omitempty"`
+	StreamURL string        `json:"stream_url,omitempty"`
+	Buffer    BufferOptions `json:"buffer,omitempty"`
+}
+
+// LLMUpstream is a chat completions call proxied by the bridge; Body is the
+// chat completions request (model, messages, ...)
+type LLMUpstream struct {
+	URL    string                 `json:"url"`
+	APIKey string                 `json:"api_key,omitempty"`
+	Body   map[string]interface{} `json:"body"`
+}
+
+// llmBridgeClient connects to LLM streams; a stream lasts as long as the
+// model keeps generating, so there is no overall timeout
+var llmBridgeClient = &http.Client{}
+
+// handleLLMBridge streams speech for text generated by an LLM: tokens are
+// read from the upstream SSE stream, buffered into sentences (or per the
+// buffer options) and each piece is synthesized and written to the WAV stream as it completes
+func handleLLMBridge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req LLMBridgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.key = requestAPIKey(r)
+	req.access = requestAccessRecord(r)
+	var upstream *http.Request
+	err := runPreValidateHooks(r, &req.TTSRequest)
+	if err == nil {
+		upstream, err = llmUpstreamRequest(&req)
+	}
+	if err == nil {
+		err = validateBufferOptions(&req.Buffer)
+	}
+	if err == nil {
+		// Validate the settings with a stand-in input; each sentence is validated again
+		req.Stream = true
+		req.Input = "LLM stream"
+		err = validateRequest(&req.TTSRequest)
+	}
+	auditRequest(r, &req.TTSRequest)
+	if err != nil {
+		sendError(w, err.Error(), validationStatus(w, err))
+		return
+	}
+
+	resp, err := llmBridgeClient.Do(upstream.WithContext(r.Context()))
+	if err != nil {
+		sendError(w, "LLM stream failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		sendError(w, fmt.Sprintf("LLM stream failed: %s: %s", resp.Status, bytes.TrimSpace(body)), http.StatusBadGateway)
+		return
+	}
+	log.Printf("LLM bridge: voice=%s, upstream=%s", req.Voice, upstream.URL.Host)
+
+	// Sentences are read ahead while the previous one is synthesized
+	sentences := make(chan string, 8)
+	go func() {
+		defer close(sentences)
+		if err := readLLMSentences(resp.Body, req.Buffer, sentences); err != nil {
+			log.Printf("LLM bridge: stream ended: %v", err)
+		}
+	}()
+	// Closing the upstream ends the reader, which is drained so it never blocks
+	defer func() {
+		resp.Body.Close()
+		for range sentences {
+		}
+	}()
+
+	rc := streamController(w)
+	started := false
+	written := 0
+	var writeErr error
+	onAudio := func(samples []float32, sampleRate int) {
+		if writeErr != nil {
+			return
+		}
+		if !started {
+			w.Header().Set("Content-Type", contentTypeFor(formatWAV))
+			if _, writeErr = w.Write(streamingWAVHeader(sampleRate)); writeErr != nil {
+				return
+			}
+			started = true
+		}
+		pcm := pcm16Bytes(quantize(samples, 32767, req.Dither, req.Seed+int64(written)))
+		if _, writeErr = w.Write(pcm); writeErr != nil {
+			return
+		}
+		written += len(samples)
+		flushStream(rc)
+	}
+
+	count := 0
+	for sentence := range sentences {
+		if writeErr != nil {
+			break
+		}
+		sentenceReq := req.TTSRequest
+		sentenceReq.Input = sentence
+		if err := validateRequest(&sentenceReq); err != nil {
+			log.Printf("LLM bridge: skipped sentence: %v", err)
+			continue
+		}
+		if _, _, err := synthesizeSpeech(&sentenceReq, onAudio); err != nil {
+			if !started {
+				sendError(w, "Speech generation failed: "+err.Error(), speechErrorStatus(w, err))
+				return
+			}
+			log.Printf("TTS Error (LLM bridge): %v", err)
+			break
+		}
+		count++
+	}
+	if !started {
+		sendError(w, "LLM stream produced no text", http.StatusBadGateway)
+		return
+	}
+	log.Printf("LLM bridge: streamed %d sentences, %d samples", count, written)
+}
+
+// llmUpstreamRequest builds the request that opens the bridge's text stream
+func llmUpstreamRequest(req *LLMBridgeRequest) (*http.Request, error) {
+	if req.Input != "" {
+		return nil, fmt.Errorf("input is not used by the LLM bridge; the text comes from llm or stream_url")
+	}
+	if (req.LLM == nil) == (req.StreamURL == "") {
+		return nil, fmt.Errorf("exactly one of llm and stream_url is required")
+	}
+
+	if req.StreamURL != "" {
+		if err := checkLLMUpstream(req.StreamURL); err != nil {
+			return nil, err
+		}
+		upstream, err := http.NewRequest(http.MethodGet, req.StreamURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stream_url: %w", err)
+		}
+		upstream.Header.Set("Accept", "text/event-stream")
+		return upstream, nil
+	}
+
+	if err := checkLLMUpstream(req.LLM.URL); err != nil {
+		return nil, err
+	}
+	body := map[string]interface{}{}
+	for k, v := range req.LLM.Body {
+		body[k] = v
+	}
+	body["stream"] = true
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid llm body: %w", err)
+	}
+	upstream, err := http.NewRequest(http.MethodPost, req.LLM.URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid llm url: %w", err)
+	}
+	upstream.Header.Set("Content-Type", "application/json")
+	upstream.Header.Set("Accept", "text/event-stream")
+	apiKey := req.LLM.APIKey
+	if apiKey == "" {
+		apiKey = config.LLMAPIKey
+	}
+	if apiKey != "" {
+		upstream.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	return upstream, nil
+}
+
+// checkLLMUpstream only lets the bridge connect to URLs under a prefix
+// listed in --llm-upstreams, so it cannot be pointed at internal services
+// or handed the --llm-api-key for another host: the scheme and host must
+// match exactly and the path must lie under the prefix's path
+func checkLLMUpstream(rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil || target.Host == "" || target.User != nil {
+		return fmt.Errorf("%s is not an allowed LLM upstream (--llm-upstreams)", rawURL)
+	}
+	for _, prefix := range strings.Split(config.LLMUpstreams, ",") {
+		allowed, err := url.Parse(strings.TrimSpace(prefix))
+		if err != nil || allowed.Host == "" {
+			continue
+		}
+		if strings.EqualFold(target.Scheme, allowed.Scheme) && strings.EqualFold(target.Host, allowed.Host) &&
+			underPath(target.Path, allowed.Path) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not an allowed LLM upstream (--llm-upstreams)", rawURL)
+}
+
+// underPath reports whether p is prefix or lies below it, comparing whole
+// segments after resolving dot segments (so /v1 does not cover /v10 or /v1/../admin)
+func underPath(p, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	cleaned := path.Clean("/" + p)
+	return cleaned == prefix || strings.HasPrefix(cleaned, prefix+"/")
+}
+
+// llmChunk is the part of a streamed chat completions chunk the bridge reads
+type llmChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		Text string `json:"text"` // legacy completions
+	} `json:"choices"`
+}
+
+// readLLMSentences reads an SSE stream and sends the text it carries to
+// sentences as the buffer options release it. Data events are chat
+// completions chunks, or plain text for other streams; [DONE] ends the stream
+func readLLMSentences(stream io.Reader, opts BufferOptions, sentences chan<- string) error {
+	tokens := make(chan string)
+	scanErr := make(chan error, 1)
+	go func() {
+		defer close(tokens)
+		scanner := bufio.NewScanner(stream)
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				continue
+			}
+			data = strings.TrimPrefix(data, " ")
+			if data == "[DONE]" {
+				break
+			}
+			tokens <- llmEventText(data)
+		}
+		scanErr <- scanner.Err()
+	}()
+
+	buf := textBuffer{opts: opts}
+	var idle <-chan time.Time
+	for {
+		select {
+		case token, ok := <-tokens:
+			if !ok {
+				if rest := buf.Flush(); rest != "" {
+					sentences <- rest
+				}
+				return <-scanErr
+			}
+			for _, s := range buf.Add(token) {
+				sentences <- s
+			}
+			if opts.IdleMS > 0 {
+				idle = time.After(time.Duration(opts.IdleMS) * time.Millisecond)
+			}
+		case <-idle:
+			if rest := buf.Flush(); rest != "" {
+				sentences <- rest
+			}
+			idle = nil
+		}
+	}
+}
+
+// llmEventText returns the text of one SSE data event
+func llmEventText(data string) string {
+	var chunk llmChunk
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		if unquoted, err := strconv.Unquote(data); err == nil {
+			return unquoted
+		}
+		return data
+	}
+	var text strings.Builder
+	for _, c := range chunk.Choices {
+		text.WriteString(c.Delta.Content)
+		text.WriteString(c.Text)
+	}
+	return text.String()
+}
+
+// BufferOptions choose when streamed text is handed to synthesis: longer
+// pieces read with better prosody, shorter ones start sounding sooner
+type BufferOptions struct {
+	Punctuation *bool `json:"punctuation,omitempty"` // at each sentence end (default true)
+	Tokens      int   `json:"tokens,omitempty"`      // once this many tokens are pending, at a word boundary
+	IdleMS      int   `json:"idle_ms,omitempty"`     // once no token arrived for this many milliseconds
+}
+
+// validateBufferOptions checks the buffering options of a streaming input
+func validateBufferOptions(opts *BufferOptions) error {
+	if opts.Punctuation == nil {
+		punctuation := true
+		opts.Punctuation = &punctuation
+	}
+	if opts.Tokens < 0 || opts.IdleMS < 0 {
+		return fmt.Errorf("buffer tokens and idle_ms must not be negative")
+	}
+	return nil
+}
+
+// textBuffer accumulates streamed text and releases it in pieces per its options
+type textBuffer struct {
+	opts    BufferOptions
+	text    strings.Builder
+	pending int // tokens added since text was last released
+}
+
+// Add appends a token and returns the pieces it completed. A sentence ends
+// at a newline or at sentence punctuation followed by a space, so decimals
+// and abbreviations split across tokens are not cut
+func (b *textBuffer) Add(token string) []string {
+	b.text.WriteString(token)
+	b.pending++
+	pending := b.text.String()
+	var pieces []string
+	start := 0
+	if *b.opts.Punctuation {
+		for i, r := range pending {
+			end := i + utf8.RuneLen(r)
+			next, _ := utf8.DecodeRuneInString(pending[end:])
+			if r == '\n' || isFullWidthEnd(r) || (isSentenceEnd(r) && unicode.IsSpace(next)) {
+				if s := strings.TrimSpace(pending[start:end]); s != "" {
+					pieces = append(pieces, s)
+				}
+				start = end
+				b.pending = 0
+			}
+		}
+	}
+	if b.opts.Tokens > 0 && b.pending >= b.opts.Tokens {
+		if cut := strings.LastIndexFunc(pending[start:], unicode.IsSpace); cut > 0 {
+			if s := strings.TrimSpace(pending[start : start+cut]); s != "" {
+				pieces = append(pieces, s)
+			}
+			start += cut
+			b.pending = 0
+		}
+	}
+	b.text.Reset()
+	b.text.WriteString(pending[start:])
+	return pieces
+}
+
+// Flush returns whatever text is pending
+func (b *textBuffer) Flush() string {
+	rest := strings.TrimSpace(b.text.String())
+	b.text.Reset()
+	b.pending = 0
+	return rest
+}
+
+// isSentenceEnd reports whether r ends a sentence when followed by a space
+func isSentenceEnd(r rune) bool {
+	return r == '.' || r == '!' || r == '?'
+}
+
+// isFullWidthEnd reports whether r ends a CJK sentence, which needs no space after it
+func isFullWidthEnd(r rune) bool {
+	return r == '。' || r == '！' || r == '？'
+}
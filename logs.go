@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logHistory is how many recent log lines are kept for /admin/logs/stream
+const logHistory = 1000
+
+// logKeepAlive is how often an idle log stream sends a comment, so proxies
+// and --stream-write-timeout do not close it
+const logKeepAlive = 15 * time.Second
+
+// Log levels, lowest first
+const (
+	logInfo  = "info"
+	logWarn  = "warn"
+	logError = "error"
+)
+
+var logLevels = map[string]int{logInfo: 0, logWarn: 1, logError: 2}
+
+// LogEntry is one log line as sent by /admin/logs/stream
+type LogEntry struct {
+	ID      uint64    `json:"id"`
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+// logBuffer keeps the recent log lines and hands new ones to live streams
+type logBuffer struct {
+	mu          sync.Mutex
+	entries     []LogEntry // oldest first
+	next        uint64
+	subscribers map[chan LogEntry]struct{}
+}
+
+// logs holds the server's recent log lines
+var logs *logBuffer
+
+// captureLogs copies everything written to the standard logger into logs,
+// keeping the existing output
+func captureLogs() {
+	logs = &logBuffer{next: 1, subscribers: map[chan LogEntry]struct{}{}}
+	log.SetOutput(io.MultiWriter(log.Writer(), logs))
+}
+
+// Write records one line of the standard logger, dropping the date and time
+// prefix it added since the entry carries its own
+func (b *logBuffer) Write(p []byte) (int, error) {
+	message := strings.TrimRight(string(p), "\n")
+	skip := 0
+	if log.Flags()&log.Ldate != 0 {
+		skip++
+	}
+	if log.Flags()&(log.Ltime|log.Lmicroseconds) != 0 {
+		skip++
+	}
+	for ; skip > 0; skip-- {
+		_, message, _ = strings.Cut(message, " ")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry := LogEntry{ID: b.next, Time: time.Now().UTC(), Level: classifyLog(message), Message: message}
+	b.next++
+	b.entries = append(b.entries, entry)
+	if len(b.entries) > logHistory {
+		b.entries = b.entries[1:]
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- entry:
+		default: // a stream that cannot keep up misses lines rather than stalling logging
+		}
+	}
+	return len(p), nil
+}
+
+// classifyLog guesses the level of a log line. The server logs plain
+// messages, so failures and warnings are recognised by their wording
+func classifyLog(message string) string {
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "failed") || strings.Contains(lower, "error") || strings.Contains(lower, "panic"):
+		return logError
+	case strings.HasPrefix(lower, "warning") || strings.Contains(lower, "rejected") || strings.Contains(lower, "skipped") ||
+		strings.Contains(lower, "invalid") || strings.Contains(lower, "falling back") || strings.Contains(lower, "degraded"):
+		return logWarn
+	}
+	return logInfo
+}
+
+// subscribe returns the kept lines after id at or above level and a channel
+// of the lines logged from now on
+func (b *logBuffer) subscribe(after uint64, level string) ([]LogEntry, chan LogEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var recent []LogEntry
+	for _, entry := range b.entries {
+		if entry.ID > after && logLevels[entry.Level] >= logLevels[level] {
+			recent = append(recent, entry)
+		}
+	}
+	ch := make(chan LogEntry, 256)
+	b.subscribers[ch] = struct{}{}
+	return recent, ch
+}
+
+// unsubscribe stops sending lines to a stream
+func (b *logBuffer) unsubscribe(ch chan LogEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, ch)
+}
+
+// handleAdminLogStream streams log lines as server-sent events: first up to
+// ?history= recent lines (default 100), then new ones as they are logged.
+// ?level= (info, warn or error) is the lowest level sent. A reconnecting
+// client's Last-Event-ID resumes after the last line it received
+func handleAdminLogStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	level := query.Get("level")
+	if level == "" {
+		level = logInfo
+	}
+	if _, ok := logLevels[level]; !ok {
+		sendError(w, "level must be info, warn or error", http.StatusBadRequest)
+		return
+	}
+	history := 100
+	if v := query.Get("history"); v != "" {
+		var err error
+		if history, err = strconv.Atoi(v); err != nil || history < 0 {
+			sendError(w, "history must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+	var after uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		after, _ = strconv.ParseUint(v, 10, 64)
+		history = logHistory
+	}
+
+	recent, ch := logs.subscribe(after, level)
+	defer logs.unsubscribe(ch)
+	if len(recent) > history {
+		recent = recent[len(recent)-history:]
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	rc := streamController(w)
+	send := func(entry LogEntry) error {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", entry.ID, data); err != nil {
+			return err
+		}
+		flushStream(rc)
+		return nil
+	}
+	for _, entry := range recent {
+		if send(entry) != nil {
+			return
+		}
+	}
+	w.Write([]byte(": connected\n\n"))
+	flushStream(rc)
+
+	keepAlive := time.NewTicker(logKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case entry := <-ch:
+			if logLevels[entry.Level] < logLevels[level] {
+				continue
+			}
+			if send(entry) != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+			flushStream(rc)
+		}
+	}
+}
@@ -2,49 +2,638 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
+	"math"
+	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
-	"github.com/go-audio/audio"
-	"github.com/go-audio/wav"
 	ort "github.com/yalue/onnxruntime_go"
 	"go-supertonic/tts"
 )
 
 // TTSRequest with OpenAI TTS request structure
 type TTSRequest struct {
+	Model          string  `json:"model"`
 	Input          string  `json:"input"`
 	Voice          string  `json:"voice"`
 	Speed          float64 `json:"speed"`
+	ResponseFormat string  `json:"response_format"`
+
+	// Language of the input: a model language code or "auto"; inline <xx>...</xx> tags override it per span
+	Language string `json:"language,omitempty"`
+
+	// Pacing: wpm targets a reading rate in words per minute (pace names a preset: slow,
+	// presentation, elearning, audiobook, news or fast); the speed is derived from it
+	WPM  float64 `json:"wpm,omitempty"`
+	Pace string  `json:"pace,omitempty"`
+
+	// max_duration_seconds speeds the request up (to at most --max-auto-speed) when the predicted
+	// duration is longer, and fails with the predicted duration when even that is not enough
+	MaxDurationSeconds float64 `json:"max_duration_seconds,omitempty"`
+
+	// Text normalization: number_style is auto, cardinal, ordinal, digits or year; urls is read
+	// ("example dot com slash docs") or skip for URLs and e-mail addresses
+	NumberStyle string `json:"number_style,omitempty"`
+	URLs        string `json:"urls,omitempty"`
+
+	// Spell-out: spell_out reads the whole input character by character (inline <spell>...</spell> does a span);
+	// spell_alphabet is "letters" or "nato"; acronyms spells all-caps tokens of up to four letters
+	// (\WORD\ always spells WORD)
+	SpellOut      bool   `json:"spell_out,omitempty"`
+	SpellAlphabet string `json:"spell_alphabet,omitempty"`
+	Acronyms      *bool  `json:"acronyms,omitempty"`
+
+	// Input interpretation: "text" (default) or "phonemes" (IPA or ARPAbet); unsupported_chars is
+	// "skip" or "error" for characters the model cannot speak (e.g. scripts it wasn't trained on)
+	InputType        string `json:"input_type,omitempty"`
+	PhonemeAlphabet  string `json:"phoneme_alphabet,omitempty"`
+	UnsupportedChars string `json:"unsupported_chars,omitempty"`
+
+	// Optional sampler overrides for power users
+	Steps           int      `json:"steps,omitempty"`
+	SilenceDuration *float64 `json:"silence_duration,omitempty"`
+	NoiseScale      float64  `json:"noise_scale,omitempty"`
+	SwayCoefficient *float64 `json:"sway_coefficient,omitempty"`
+	Seed            int64    `json:"seed,omitempty"`
+	Scheduler       string   `json:"scheduler,omitempty"`
+	// adaptive_steps scales the steps per chunk with its length (fewer for "OK", more for long
+	// sentences); defaults to --adaptive-steps for requests that don't set steps
+	AdaptiveSteps *bool `json:"adaptive_steps,omitempty"`
+
+	// Two-pass mode: a fast low-step preview, optionally followed by the final render
+	Preview      bool `json:"preview,omitempty"`
+	PreviewSteps int  `json:"preview_steps,omitempty"`
+	Final        bool `json:"final,omitempty"`
+
+	// Output encoding: response_format is wav, ulaw or alaw; telephony band-limits to 300-3400 Hz at 8 kHz
+	// (implied by ulaw/alaw); sample_format is s16, s24 or f32; dither is tpdf or none (integer formats only)
+	Telephony    bool   `json:"telephony,omitempty"`
+	SampleFormat string `json:"sample_format,omitempty"`
+	Dither       string `json:"dither,omitempty"`
+	Declick      *bool  `json:"declick,omitempty"` // remove DC offset and smooth chunk joins
+
+	// URL mode: respond with a download URL for the saved audio instead of the audio itself
+	ReturnURL bool `json:"return_url,omitempty"`
+
+	// Quality report: measure integrated loudness (LUFS), sample peak (dBFS) and
+	// clipped samples of the output, returned in headers or the URL/job JSON
+	QualityReport bool `json:"quality_report,omitempty"`
+
+	// Podcast feed metadata: the episode title of saved audio (--podcast-title)
+	Title string `json:"title,omitempty"`
+
+	// Speech marks: respond with Amazon Polly style JSON lines of sentence, word and/or
+	// viseme marks (time in ms, byte offsets into input) instead of the audio
+	SpeechMarks []string `json:"speech_marks,omitempty"`
+
+	// Visemes: return the audio with a timeline of "oculus" viseme IDs (or the "arkit" blendshape
+	// weights posing them) in a multipart/mixed response, for avatar lip animation
+	Visemes string `json:"visemes,omitempty"`
+
+	// Streaming: write the WAV header and each chunk as soon as it is synthesized (wav, s16 only);
+	// low_latency vocodes each chunk in short frame windows (--low-latency-frames) with fewer
+	// steps (--low-latency-steps) so the first audio arrives sooner, at slight quality cost
+	Stream     bool `json:"stream,omitempty"`
+	LowLatency bool `json:"low_latency,omitempty"`
+
+	// Chunks that fail even after a retry are replaced by a pause and reported, unless false
+	SkipFailedChunks *bool `json:"skip_failed_chunks,omitempty"`
+
+	// waitForGPU queues for a GPU session instead of failing (set for async jobs)
+	waitForGPU bool
+	// defaultSteps is set when steps came from --total-step, so --latency-slo may lower them
+	defaultSteps bool
+	// truncated is set when the input was cut at --max-input-chars; chunks is
+	// the number of chunks it was synthesized in, and duration the seconds of audio
+	truncated bool
+	chunks    int
+	duration  float64
+	skipped   []tts.SkippedSpan
+	quality   *audioQuality
+	// key is the API key an HTTP request was authorized with (--api-keys)
+	key *apiKey
+	// access collects synthesis time and audio duration for the access log
+	access *accessRecord
+	// spool is set when the response may be spooled to disk (--spool-after);
+	// predicted is the predicted duration in seconds, when it was needed
+	spool     bool
+	predicted float64
+	// restartAudio, when set, discards the audio already passed to onAudio so
+	// synthesizeSpeech may retry after healing a worker (see generateEncoded)
+	restartAudio func()
 }
 
 // ServerConfig with API server configuration
 type ServerConfig struct {
+	ConfigFile   string
 	Port         string
 	AssetsDir    string
 	UseGPU       bool
+	StrictGPU    bool
+	GPUDevices   string
+	GPUSessions  int
+	GPUMinFreeMB int
 	TotalStep    int
 	DefaultSpeed float64
+	MaxAutoSpeed float64
 	SaveDir      string
+	PodcastTitle string
+
+	DefaultVoice  string
+	DefaultModel  string
+	DefaultFormat string
+
+	SilenceDuration float64
+	NoiseScale      float64
+	SwayCoefficient float64
+	Scheduler       string
+	PreviewSteps    int
+
+	LowLatencyFrames int
+	LowLatencySteps  int
+
+	LatencySLO    time.Duration
+	SLOMinSteps   int
+	AdaptiveSteps bool
+
+	ModelAliases string
+	AdminToken   string
+	APIKeys      string
+	VoiceDir     string
+	VoiceQuota   int
+	UsageFile    string
+	DataDir      string
+
+	HeteronymRules   string
+	NumberStyle      string
+	URLs             string
+	Acronyms         bool
+	UnsupportedChars string
+	CodeSwitch       string
+	SampleFormat     string
+	Dither           string
+	Declick          bool
+
+	SkipFailedChunks bool
+
+	FilterWordlist string
+	FilterAction   string
+	FilterWebhook  string
+
+	JobWorkers        int
+	JobTTL            time.Duration
+	MaxQueuedJobs     int
+	MaxQueuedJobsKey  int
+	IdleUnload        time.Duration
+	LeakCheckInterval time.Duration
+	FrontEndCache     int
+	AudioCacheMB      int
+	MaxInputChars     int
+	RequestMemoryMB   int
+	SpoolAfter        time.Duration
+	CallbackSecret    string
+	URLSigningSecret  string
+	SignedURLMaxAge   time.Duration
+
+	S3        S3Config
+	Stateless bool
+
+	AuditLog         string
+	AuditRedactInput bool
+	AccessLog        string
+	AccessLogFormat  string
+	DebugEndpoints   string
+	TrustedProxies   string
+	Compression      string
+
+	WyomingPort string
+
+	MQTT    MQTTConfig
+	BaseURL string
+
+	LLMUpstreams string
+	LLMAPIKey    string
+
+	SessionIdle time.Duration
+
+	ReadHeaderTimeout  time.Duration
+	ReadTimeout        time.Duration
+	WriteTimeout       time.Duration
+	StreamWriteTimeout time.Duration
+	IdleTimeout        time.Duration
+	MaxHeaderBytes     int
 }
 
 var config ServerConfig
 
 func main() {
+	// Subcommands share the server's configuration flags
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			run(os.Args[2:])
+			return
+		}
+	}
+
+	runServer(os.Args[1:])
+}
+
+// runServer parses the server flags from args and serves until it fails
+func runServer(args []string) {
 	// Parse command-line flags
+	assetsDir := registerFlags(flag.CommandLine)
+	flag.CommandLine.Parse(args)
+
+	// Keep recent log lines for /admin/logs/stream, which --config may enable
+	captureLogs()
+	setupConfig()
+	if err := setupSocketActivation(); err != nil {
+		log.Fatalf("systemd socket activation failed: %v", err)
+	}
+
+	if config.AuditLog != "" {
+		if err := openAuditLog(config.AuditLog); err != nil {
+			log.Fatalf("Invalid --audit-log: %v", err)
+		}
+		defer auditFile.Close()
+	}
+	if config.AccessLog != "" {
+		if err := openAccessLog(config.AccessLog); err != nil {
+			log.Fatalf("Invalid --access-log: %v", err)
+		}
+	}
+
+	fmt.Println("=== Supertonic OpenAI-Compatible TTS API ===")
+	initRuntime(*assetsDir)
+	defer ort.DestroyEnvironment()
+
+	// Load and warm the models served by default
+	fmt.Printf("Loading models...\n")
+	if err := preloadEngines(); err != nil {
+		log.Fatalf("Failed to load models: %v", err)
+	}
+	defer destroyEngines()
+
+	// Setup HTTP routes
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/audio/speech", auditHandler(requireAPIKey(handleTTSRequest)))
+	mux.HandleFunc("GET /v1/audio/speech", auditHandler(handleSignedSpeech))
+	mux.HandleFunc("/v1/audio/speech/from-llm", auditHandler(requireAPIKey(handleLLMBridge)))
+	mux.HandleFunc("/v1/sessions", requireAPIKey(handleSessions))
+	mux.HandleFunc("/v1/sessions/{id}", requireAPIKey(handleSession))
+	mux.HandleFunc("/v1/sessions/{id}/speech", auditHandler(requireAPIKey(handleSessionSpeech)))
+	mux.HandleFunc("/v1/audio/jobs", auditHandler(requireAPIKey(handleCreateJob)))
+	mux.HandleFunc("/v1/audio/jobs/{id}", requireAPIKey(handleGetJob))
+	mux.HandleFunc("/v1/audio/jobs/{id}/audio", requireAPIKey(handleGetJobAudio))
+	mux.HandleFunc("/v1/audio/files/{name}", handleAudioFile)
+	mux.HandleFunc("/v1/audio/podcast.xml", apiKeyFromQuery(requireAPIKey(handlePodcastFeed)))
+	mux.HandleFunc("/v1/audio/twilio", apiKeyFromQuery(requireAPIKey(handleTwilioStream)))
+	mux.HandleFunc("/v1/text/analyze", requireAPIKey(handleTextAnalyze))
+	mux.HandleFunc("/v1/models", handleModels)
+	mux.HandleFunc("/v1/models/{id}", handleModelInfo)
+	mux.HandleFunc("/v1/voices", requireAPIKey(handleVoices))
+	mux.HandleFunc("/v1/usage", requireAPIKey(handleUsage))
+	mux.HandleFunc("/v1/voices/{name...}", auditHandler(requireAPIKey(handleCustomVoice)))
+	mux.HandleFunc("/api/tts", auditHandler(requireAPIKey(handleCompatTTS)))
+	mux.HandleFunc("/api/voices", handleCompatVoices)
+	mux.HandleFunc("/api/languages", handleCompatLanguages)
+	mux.HandleFunc("/health", handleHealthCheck)
+	mux.HandleFunc("/admin/models", requireAdmin(handleAdminModels))
+	mux.HandleFunc("/admin/models/load", requireAdmin(handleAdminModelLoad))
+	mux.HandleFunc("/admin/audit", requireAdmin(handleAdminAudit))
+	mux.HandleFunc("/admin/signed-urls", requireAdmin(handleAdminSignURL))
+	mux.HandleFunc("/admin/logs/stream", requireAdmin(handleAdminLogStream))
+	registerDashboard(mux)
+	registerDebugHandlers(mux)
+	mux.HandleFunc("/", handleRoot)
+
+	if config.IdleUnload > 0 {
+		go runIdleUnloader()
+	}
+	if config.LeakCheckInterval > 0 {
+		go runLeakCheck()
+	}
+	if config.UsageFile != "" || (config.Stateless && apiKeys != nil) {
+		go runUsageSaver()
+	}
+	if dashboard != nil {
+		go dashboard.run()
+	}
+
+	// Serve Home Assistant / Wyoming clients alongside HTTP
+	if config.WyomingPort != "" || activatedListeners[sdWyomingSocket] != nil {
+		go serveWyoming(":" + config.WyomingPort)
+	}
+
+	// Subscribe to MQTT announcements
+	if config.MQTT.Broker != "" {
+		go runMQTT()
+	}
+
+	// Start server, on the systemd socket when socket-activated
+	addr := ":" + config.Port
+	listener, err := listen("http", addr)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	fmt.Printf("\nServer starting on http://%s\n", listener.Addr())
+	fmt.Printf("Endpoint: POST /v1/audio/speech\n")
+	fmt.Printf("Voices: %v\n", tts.GetAvailableVoices())
+	fmt.Printf("Models: %v\n", availableModels())
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           accessLogHandler(dashboardHandler(compressHandler(mux))),
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+	}
+	sdNotify("READY=1")
+	log.Fatal(server.Serve(listener))
+}
+
+// registerFlags defines the configuration flags on fs and returns the assets directory flag
+func registerFlags(fs *flag.FlagSet) *string {
 	var assetsDir string
-	flag.StringVar(&config.Port, "port", "8880", "Server port")
-	flag.StringVar(&assetsDir, "assets-dir", "", "Path to assets directory (optional, will auto-detect if not provided)")
-	flag.BoolVar(&config.UseGPU, "use-gpu", false, "Use GPU for inference")
-	flag.IntVar(&config.TotalStep, "total-step", 5, "Number of denoising steps (quality vs speed)")
-	flag.Float64Var(&config.DefaultSpeed, "default-speed", 1.0, "Default speech speed")
-	flag.Parse()
+	configFlags = fs
+	fs.StringVar(&config.ConfigFile, "config", os.Getenv("SUPERTONIC_CONFIG"), "File of flag = value lines for flags not given on the command line (supertonic tune writes one)")
+	fs.StringVar(&config.Port, "port", "8880", "Server port")
+	fs.DurationVar(&config.ReadHeaderTimeout, "read-header-timeout", 10*time.Second, "Time allowed to read a request's headers")
+	fs.DurationVar(&config.ReadTimeout, "read-timeout", time.Minute, "Time allowed to read a whole request, including uploads, or one WebSocket frame or Wyoming event (0 disables)")
+	fs.DurationVar(&config.WriteTimeout, "write-timeout", 10*time.Minute, "Time allowed from the end of the request headers to the end of the response, long enough for the longest synthesis (0 disables)")
+	fs.DurationVar(&config.StreamWriteTimeout, "stream-write-timeout", time.Minute, "Time allowed for each chunk of a streamed response, WebSocket frame or Wyoming event, extended chunk by chunk in place of --write-timeout so long streams are not cut off (0 keeps --write-timeout)")
+	fs.DurationVar(&config.IdleTimeout, "idle-timeout", 2*time.Minute, "How long an idle keep-alive connection is kept open")
+	fs.IntVar(&config.MaxHeaderBytes, "max-header-bytes", 64<<10, "Maximum size of request headers in bytes")
+	fs.StringVar(&assetsDir, "assets-dir", "", "Path to assets directory (default: $SUPERTONIC_ASSETS, else auto-detected)")
+	fs.BoolVar(&config.UseGPU, "use-gpu", false, "Use GPU for inference")
+	fs.BoolVar(&config.StrictGPU, "strict-gpu", false, "Exit if the GPU fails to initialize instead of falling back to CPU")
+	fs.StringVar(&config.GPUDevices, "gpu-devices", "0", "Comma-separated CUDA devices to shard requests across with --use-gpu")
+	fs.IntVar(&config.GPUSessions, "gpu-sessions", 1, "Maximum concurrent syntheses per GPU with --use-gpu (requests beyond it get 503)")
+	fs.IntVar(&config.GPUMinFreeMB, "gpu-min-free-mb", 0, "Refuse GPU requests while free VRAM is below this many MB (0 disables, needs nvidia-smi)")
+	fs.IntVar(&config.TotalStep, "total-step", 5, "Number of denoising steps (quality vs speed)")
+	fs.Float64Var(&config.DefaultSpeed, "default-speed", 1.0, "Default speech speed")
+	fs.StringVar(&config.DefaultVoice, "default-voice", "F5", "Voice used when a request names none")
+	fs.StringVar(&config.DefaultModel, "default-model", "tts-1", "Model (pack or alias) used when a request names none")
+	fs.StringVar(&config.DefaultFormat, "default-format", formatWAV, "Response format used when a request names none")
+	fs.Float64Var(&config.MaxAutoSpeed, "max-auto-speed", 1.5, "Highest speed max_duration_seconds may speed a request up to")
+	fs.Float64Var(&config.SilenceDuration, "silence-duration", 0.3, "Seconds of silence inserted between text chunks")
+	fs.Float64Var(&config.NoiseScale, "noise-scale", 1.0, "Standard deviation of the initial noisy latent")
+	fs.Float64Var(&config.SwayCoefficient, "sway-coefficient", 0.0, "Timestep sway coefficient in [-1, 1] (0 = uniform schedule)")
+	fs.IntVar(&config.PreviewSteps, "preview-steps", 2, "Denoising steps for fast preview renders")
+	fs.IntVar(&config.LowLatencyFrames, "low-latency-frames", 4, "Latent frames vocoded per window for low_latency streams (smaller sends audio sooner)")
+	fs.IntVar(&config.LowLatencySteps, "low-latency-steps", 2, "Denoising steps for low_latency streams that don't set steps")
+	fs.DurationVar(&config.LatencySLO, "latency-slo", 0, "p95 latency target for interactive requests; under load, requests that don't set steps get fewer (disabled if 0)")
+	fs.IntVar(&config.SLOMinSteps, "slo-min-steps", 3, "Fewest denoising steps --latency-slo reduces requests to")
+	fs.BoolVar(&config.AdaptiveSteps, "adaptive-steps", false, "Scale the steps of requests that don't set them per chunk: fewer for short utterances, more for long sentences")
+	fs.StringVar(&config.Scheduler, "scheduler", "euler", "Denoising scheduler: euler, midpoint or dpm")
+	fs.StringVar(&config.AdminToken, "admin-token", os.Getenv("SUPERTONIC_ADMIN_TOKEN"), "Bearer token for admin endpoints (disabled if empty)")
+	fs.StringVar(&config.VoiceDir, "voice-dir", "", "Directory for voice styles uploaded to /v1/voices, one namespace per API key (disabled if empty)")
+	fs.IntVar(&config.VoiceQuota, "voice-quota", 20, "Maximum custom voices per API key")
+	fs.StringVar(&config.UsageFile, "usage-file", "", "File that per-key monthly usage is kept in across restarts (in memory only if empty; --stateless keeps it in the S3 bucket)")
+	fs.StringVar(&config.DataDir, "data-dir", os.Getenv("SUPERTONIC_DATA"), "Writable directory for per-instance data; --voice-dir, --save-dir and --usage-file default to voices/, audio/ and usage.json in it")
+	fs.StringVar(&config.APIKeys, "api-keys", "", "JSON file of API keys and the voices each may use; synthesis endpoints then require one as a Bearer token")
+	fs.StringVar(&config.NumberStyle, "number-style", "", "Default number reading style: auto, cardinal, ordinal, digits or year (empty leaves digits to the model)")
+	fs.StringVar(&config.FilterWordlist, "filter-wordlist", "", "Path to a content filter wordlist (one term per line)")
+	fs.StringVar(&config.FilterAction, "filter-action", "reject", "Action for filtered terms: reject, bleep or redact")
+	fs.StringVar(&config.FilterWebhook, "filter-webhook", "", "URL of a content filter webhook consulted before synthesis")
+	fs.IntVar(&config.MaxInputChars, "max-input-chars", 20000, "Hard cap on input length in characters; longer input is cut at a sentence or word boundary and reported as truncated")
+	fs.DurationVar(&config.SpoolAfter, "spool-after", 0, "WAV responses predicted to run longer than this are rendered to a temporary file and encoded from disk, keeping memory flat (0 disables)")
+	fs.IntVar(&config.RequestMemoryMB, "request-memory-mb", 0, "Reject requests (413) whose predicted output would need more than this many MB of audio buffers (0 disables)")
+	fs.DurationVar(&config.SessionIdle, "session-idle", 10*time.Minute, "How long a conversation session is kept after its last use")
+	fs.IntVar(&config.JobWorkers, "job-workers", 1, "Number of async jobs synthesized concurrently")
+	fs.DurationVar(&config.JobTTL, "job-ttl", time.Hour, "How long finished async jobs are kept")
+	fs.IntVar(&config.MaxQueuedJobs, "max-queued-jobs", 1000, "Async jobs queued or running at once before new ones are refused with 429 (0 is unlimited)")
+	fs.IntVar(&config.MaxQueuedJobsKey, "max-queued-jobs-per-key", 100, "Async jobs one API key may have queued or running at once (requests without a key share one limit; 0 is unlimited)")
+	fs.DurationVar(&config.IdleUnload, "idle-unload", 0, "Unload models after this long without requests, reloading on demand (0 keeps them loaded)")
+	fs.DurationVar(&config.LeakCheckInterval, "leak-check-interval", 10*time.Minute, "How often live ONNX tensors and sessions are checked for growth, logging possible native memory leaks (0 disables)")
+	fs.IntVar(&config.AudioCacheMB, "audio-cache-mb", 0, "Cache of finished responses to seeded requests, in MB; repeats skip synthesis and carry strong ETags for If-None-Match on GET (0 disables)")
+	fs.IntVar(&config.FrontEndCache, "frontend-cache-mb", 64, "Per-engine cache of duration and text-encoder outputs for re-rendered text, in MB (0 disables)")
+	fs.StringVar(&config.CallbackSecret, "callback-secret", os.Getenv("SUPERTONIC_CALLBACK_SECRET"), "HMAC secret used to sign job callbacks")
+	fs.StringVar(&config.URLSigningSecret, "url-signing-secret", os.Getenv("SUPERTONIC_URL_SIGNING_SECRET"), "HMAC secret for signed GET /v1/audio/speech?payload= URLs, which need no API key and can be cached by a CDN (disabled if empty)")
+	fs.DurationVar(&config.SignedURLMaxAge, "signed-url-max-age", 365*24*time.Hour, "Cache-Control max-age of signed GET speech responses (never past the URL's exp) and the lifetime of signed URLs created without exp")
+	fs.StringVar(&config.SaveDir, "save-dir", "", "Directory where generated audio is saved and served from (disabled if empty)")
+	fs.StringVar(&config.PodcastTitle, "podcast-title", "", "Publish audio saved in --save-dir as an RSS podcast feed with this title at /v1/audio/podcast.xml (disabled if empty)")
+	fs.StringVar(&config.S3.Endpoint, "s3-endpoint", "", "S3-compatible endpoint URL (defaults to AWS for --s3-region)")
+	fs.StringVar(&config.S3.Bucket, "s3-bucket", "", "Bucket that generated audio is uploaded to (disabled if empty)")
+	fs.StringVar(&config.S3.Region, "s3-region", os.Getenv("AWS_REGION"), "S3 region used for request signing (default us-east-1)")
+	fs.StringVar(&config.S3.Prefix, "s3-prefix", "", "Key prefix for uploaded audio (e.g. tts/)")
+	fs.StringVar(&config.S3.AccessKey, "s3-access-key", os.Getenv("AWS_ACCESS_KEY_ID"), "S3 access key ID")
+	fs.StringVar(&config.S3.SecretKey, "s3-secret-key", os.Getenv("AWS_SECRET_ACCESS_KEY"), "S3 secret access key")
+	fs.BoolVar(&config.S3.PathStyle, "s3-path-style", false, "Use path-style bucket addressing (MinIO and most self-hosted stores)")
+	fs.DurationVar(&config.S3.URLExpiry, "s3-url-expiry", time.Hour, "Lifetime of presigned download URLs (max 168h)")
+	fs.BoolVar(&config.Stateless, "stateless", false, "Keep all mutable state (job records, audio, per-key usage) in the S3 bucket so replicas can scale horizontally")
+	fs.StringVar(&config.AuditLog, "audit-log", "", "Path of a JSONL audit log recording every synthesis request (disabled if empty)")
+	fs.BoolVar(&config.AuditRedactInput, "audit-redact-input", false, "Omit input text from the audit log")
+	fs.StringVar(&config.AccessLog, "access-log", "", "Path of an HTTP access log, - for stdout (disabled if empty)")
+	fs.StringVar(&config.AccessLogFormat, "access-log-format", accessFormatCLF, "Access log format: clf (Common Log Format plus synthesis ms and audio seconds) or json")
+	fs.StringVar(&config.Compression, "compression", "none", "Content encodings offered for WAV and G.711 responses, in order of preference, e.g. zstd,gzip (none disables)")
+	fs.StringVar(&config.DebugEndpoints, "debug-endpoints", debugOff, "Serve /debug/pprof and /debug/vars (goroutines, GC, native memory): off, admin (requires the admin token) or localhost")
+	fs.StringVar(&config.TrustedProxies, "trusted-proxies", "", "Comma-separated IPs or CIDRs of reverse proxies whose X-Forwarded-For names the client in logs (ignored from everyone else)")
+	fs.StringVar(&config.SampleFormat, "sample-format", "s16", "Default WAV sample format: s16, s24 or f32")
+	fs.StringVar(&config.Dither, "dither", "tpdf", "Default dither for integer WAV output: tpdf or none")
+	fs.BoolVar(&config.Declick, "declick", true, "Remove DC offset and smooth chunk boundaries by default")
+	fs.BoolVar(&config.SkipFailedChunks, "skip-failed-chunks", true, "Replace chunks that fail after a retry with a pause instead of failing the request, by default")
+	fs.StringVar(&config.WyomingPort, "wyoming-port", "", "TCP port for the Wyoming TTS protocol, e.g. 10200 (disabled if empty)")
+	fs.StringVar(&config.MQTT.Broker, "mqtt-broker", "", "MQTT broker for announcements, e.g. tcp://localhost:1883 (disabled if empty)")
+	fs.StringVar(&config.MQTT.Topic, "mqtt-topic", "supertonic/say", "MQTT topic carrying text or JSON speech requests")
+	fs.StringVar(&config.MQTT.OutputTopic, "mqtt-output-topic", "supertonic/audio", "MQTT topic the synthesized result is published to")
+	fs.StringVar(&config.MQTT.Publish, "mqtt-publish", "audio", "What to publish: audio (raw bytes) or url (save and publish a JSON link)")
+	fs.StringVar(&config.MQTT.ClientID, "mqtt-client-id", "", "MQTT client ID (random if empty)")
+	fs.StringVar(&config.MQTT.Username, "mqtt-username", os.Getenv("SUPERTONIC_MQTT_USERNAME"), "MQTT username")
+	fs.StringVar(&config.MQTT.Password, "mqtt-password", os.Getenv("SUPERTONIC_MQTT_PASSWORD"), "MQTT password")
+	fs.StringVar(&config.BaseURL, "base-url", "", "Externally visible server URL for links built outside a request (default http://localhost:<port>)")
+	fs.StringVar(&config.LLMUpstreams, "llm-upstreams", "", "Comma-separated URL prefixes /v1/audio/speech/from-llm may stream text from, e.g. https://api.openai.com/v1/ (disabled if empty)")
+	fs.StringVar(&config.LLMAPIKey, "llm-api-key", os.Getenv("OPENAI_API_KEY"), "Bearer token sent to the LLM upstream when a bridge request has no api_key")
+	fs.StringVar(&config.URLs, "urls", tts.URLsRead, "Default handling of URLs and e-mail addresses: read or skip")
+	fs.BoolVar(&config.Acronyms, "acronyms", true, "Spell short all-caps tokens (API, CPU) letter by letter by default")
+	fs.StringVar(&config.UnsupportedChars, "unsupported-chars", tts.UnsupportedSkip, "Default handling of characters the model cannot speak: skip or error (reports their offsets)")
+	fs.StringVar(&config.CodeSwitch, "code-switch", tts.CodeSwitchOff, "Handling of foreign-script words inside a sentence: off, route (read them with their own language, transliterating Cyrillic, Greek and kana) or transliterate (transliteration only)")
+	fs.StringVar(&config.HeteronymRules, "heteronym-rules", "", "Path to a JSON file with extra heteronym pronunciation rules")
+	fs.StringVar(&config.ModelAliases, "model-aliases", "", "Comma-separated model aliases mapping request models to packs (e.g. tts-1=default,tts-1-hd=v2)")
+	return &assetsDir
+}
+
+// setupConfig validates the parsed configuration and loads the files it references
+func setupConfig() {
+	if config.ConfigFile != "" {
+		if err := applyConfigFile(configFlags, config.ConfigFile); err != nil {
+			log.Fatalf("Invalid --config %s: %v", config.ConfigFile, err)
+		}
+	}
+
+	if _, ok := tts.VoiceMapping[config.DefaultVoice]; !ok {
+		log.Fatalf("Invalid --default-voice: unsupported voice %s. Available voices: %v", config.DefaultVoice, sortedVoices())
+	}
+	if err := validateResponseFormat(config.DefaultFormat); err != nil {
+		log.Fatalf("Invalid --default-format: %v", err)
+	}
+
+	if _, err := tts.ParseScheduler(config.Scheduler); err != nil {
+		log.Fatalf("Invalid --scheduler: %v", err)
+	}
+
+	if _, err := tts.ParseNumberStyle(config.NumberStyle); err != nil {
+		log.Fatalf("Invalid --number-style: %v", err)
+	}
+	if _, err := tts.ParseURLMode(config.URLs); err != nil {
+		log.Fatalf("Invalid --urls: %v", err)
+	}
+	if config.UnsupportedChars != tts.UnsupportedSkip && config.UnsupportedChars != tts.UnsupportedError {
+		log.Fatalf("--unsupported-chars must be %s or %s", tts.UnsupportedSkip, tts.UnsupportedError)
+	}
+	if _, err := tts.ParseCodeSwitch(config.CodeSwitch); err != nil {
+		log.Fatalf("Invalid --code-switch: %v", err)
+	}
+
+	if err := validateSampleFormat(config.SampleFormat); err != nil {
+		log.Fatalf("Invalid --sample-format: %v", err)
+	}
+	if err := validateDither(config.Dither); err != nil {
+		log.Fatalf("Invalid --dither: %v", err)
+	}
+
+	if err := validateAccessLogFormat(config.AccessLogFormat); err != nil {
+		log.Fatalf("Invalid --access-log-format: %v", err)
+	}
+	if err := setupCompression(config.Compression); err != nil {
+		log.Fatalf("Invalid --compression: %v", err)
+	}
+	if err := validateDebugEndpoints(config.DebugEndpoints); err != nil {
+		log.Fatalf("Invalid --debug-endpoints: %v", err)
+	}
+	if err := setupTrustedProxies(config.TrustedProxies); err != nil {
+		log.Fatalf("Invalid --trusted-proxies: %v", err)
+	}
 
+	if err := validateFilterAction(config.FilterAction); err != nil {
+		log.Fatalf("Invalid --filter-action: %v", err)
+	}
+	if config.FilterWordlist != "" {
+		if err := loadContentFilter(config.FilterWordlist); err != nil {
+			log.Fatalf("Invalid --filter-wordlist: %v", err)
+		}
+	}
+
+	if err := setupDataDir(); err != nil {
+		log.Fatalf("Invalid --data-dir: %v", err)
+	}
+	if config.APIKeys != "" {
+		if err := loadAPIKeys(config.APIKeys); err != nil {
+			log.Fatalf("Invalid --api-keys: %v", err)
+		}
+	}
+	if config.UsageFile != "" {
+		if err := loadUsage(config.UsageFile); err != nil {
+			log.Fatalf("Invalid --usage-file: %v", err)
+		}
+	}
+	if err := setupVoiceStore(); err != nil {
+		log.Fatalf("Invalid custom voice configuration: %v", err)
+	}
+
+	if config.LowLatencyFrames < 1 || config.LowLatencySteps < 1 {
+		log.Fatalf("--low-latency-frames and --low-latency-steps must be at least 1")
+	}
+	if config.LatencySLO < 0 || config.SLOMinSteps < 1 {
+		log.Fatalf("--latency-slo cannot be negative and --slo-min-steps must be at least 1")
+	}
+
+	if config.MaxInputChars < 1 {
+		log.Fatalf("--max-input-chars must be at least 1")
+	}
+	if config.RequestMemoryMB < 0 || config.SpoolAfter < 0 {
+		log.Fatalf("--request-memory-mb and --spool-after must not be negative")
+	}
+
+	if config.MaxAutoSpeed < 0.25 || config.MaxAutoSpeed > 4.0 {
+		log.Fatalf("--max-auto-speed must be between 0.25 and 4.0")
+	}
+
+	if config.FrontEndCache < 0 {
+		log.Fatalf("--frontend-cache-mb must not be negative")
+	}
+	tts.SetFrontEndCacheSize(int64(config.FrontEndCache) << 20)
+	if config.SignedURLMaxAge < 0 {
+		log.Fatalf("--signed-url-max-age must not be negative")
+	}
+	if config.AudioCacheMB < 0 {
+		log.Fatalf("--audio-cache-mb must not be negative")
+	}
+	renders = newAudioCache(int64(config.AudioCacheMB) << 20)
+	if config.AdminToken != "" {
+		dashboard = newDashboardStats()
+	}
+
+	if config.IdleUnload < 0 {
+		log.Fatalf("--idle-unload must not be negative")
+	}
+
+	if config.ReadHeaderTimeout <= 0 || config.IdleTimeout <= 0 {
+		log.Fatalf("--read-header-timeout and --idle-timeout must be positive")
+	}
+	if config.ReadTimeout < 0 || config.WriteTimeout < 0 || config.StreamWriteTimeout < 0 {
+		log.Fatalf("--read-timeout, --write-timeout and --stream-write-timeout must not be negative")
+	}
+	if config.MaxHeaderBytes < 1024 {
+		log.Fatalf("--max-header-bytes must be at least 1024")
+	}
+
+	if config.SessionIdle <= 0 {
+		log.Fatalf("--session-idle must be positive")
+	}
+
+	if config.JobWorkers < 1 {
+		log.Fatalf("--job-workers must be at least 1")
+	}
+	jobSlots = newFairScheduler(config.JobWorkers)
+	if config.MaxQueuedJobs < 0 || config.MaxQueuedJobsKey < 0 {
+		log.Fatalf("--max-queued-jobs and --max-queued-jobs-per-key must not be negative")
+	}
+
+	if err := setupGPU(); err != nil {
+		log.Fatalf("Invalid GPU configuration: %v", err)
+	}
+
+	if err := setupStorage(); err != nil {
+		log.Fatalf("Invalid storage configuration: %v", err)
+	}
+	if err := validateStatelessConfig(); err != nil {
+		log.Fatalf("Invalid stateless configuration: %v", err)
+	}
+	if config.Stateless && apiKeys != nil {
+		if err := syncSharedUsage(); err != nil {
+			log.Fatalf("Failed to load usage from the S3 bucket: %v", err)
+		}
+	}
+
+	if config.BaseURL == "" {
+		config.BaseURL = "http://localhost:" + config.Port
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	if err := validateMQTTConfig(); err != nil {
+		log.Fatalf("Invalid MQTT configuration: %v", err)
+	}
+
+	if config.HeteronymRules != "" {
+		if err := tts.LoadHeteronymRules(config.HeteronymRules); err != nil {
+			log.Fatalf("Invalid --heteronym-rules: %v", err)
+		}
+	}
+}
+
+// initRuntime locates the assets, discovers model packs and initializes ONNX Runtime
+func initRuntime(assetsDir string) {
 	// Find assets directory
 	var err error
 	config.AssetsDir, err = findAssetsDir(assetsDir)
@@ -52,82 +641,120 @@ func main() {
 		log.Fatalf("Failed to locate assets directory: %v", err)
 	}
 
+	checkWritablePaths()
+
+	// Discover model packs
+	modelPacks, err = discoverModelPacks(config.AssetsDir)
+	if err != nil {
+		log.Fatalf("Failed to discover model packs: %v", err)
+	}
+	if pack, ok := modelPacks[defaultModelPack]; ok {
+		tts.SetFallbackDir(pack.Dir)
+	}
+	if err := tts.LoadLanguagePacks(filepath.Join(config.AssetsDir, "languages")); err != nil {
+		log.Fatalf("Failed to load language packs: %v", err)
+	}
+	modelAliases, err = parseModelAliases(config.ModelAliases, firstModelPack(modelPacks))
+	if err != nil {
+		log.Fatalf("Invalid model aliases: %v", err)
+	}
+	if _, err := resolveModelPack(config.DefaultModel); err != nil {
+		log.Fatalf("Invalid --default-model: %v", err)
+	}
+
 	// Initialize ONNX Runtime
-	fmt.Println("=== Supertonic OpenAI-Compatible TTS API ===")
-	fmt.Printf("Using assets directory: %s\n", config.AssetsDir)
-	fmt.Printf("Initializing ONNX Runtime...\n")
+	fmt.Fprintf(os.Stderr, "Using assets directory: %s\n", config.AssetsDir)
+	fmt.Fprintf(os.Stderr, "Initializing ONNX Runtime...\n")
 	if err := tts.InitializeONNXRuntime(); err != nil {
 		log.Fatalf("Failed to initialize ONNX Runtime: %v", err)
 	}
-	defer ort.DestroyEnvironment()
 
 	// Verify assets exist
 	if err := verifyAssets(); err != nil {
 		log.Fatalf("Asset verification failed: %v", err)
 	}
 
-	// Setup HTTP routes
-	mux := http.NewServeMux()
-	mux.HandleFunc("/v1/audio/speech", handleTTSRequest)
-	mux.HandleFunc("/health", handleHealthCheck)
-	mux.HandleFunc("/", handleRoot)
-
-	// Start server
-	addr := ":" + config.Port
-	fmt.Printf("\nServer starting on http://localhost%s\n", addr)
-	fmt.Printf("Endpoint: POST /v1/audio/speech\n")
-	fmt.Printf("Voices: %v\n", tts.GetAvailableVoices())
-
-	log.Fatal(http.ListenAndServe(addr, mux))
+	if err := checkGPU(modelPacks[firstModelPack(modelPacks)]); err != nil {
+		log.Fatalf("GPU initialization failed: %v", err)
+	}
 }
 
 // findAssetsDir locates the assets directory based on priority:
 // 1. Command-line flag (if provided)
-// 2. System-wide location: /var/lib/supertonic/assets
-// 3. Local directory: ./assets
+// 2. SUPERTONIC_ASSETS environment variable (if set)
+// 3. $XDG_DATA_HOME/supertonic, then ~/.local/share/supertonic
+// 4. System-wide location: /var/lib/supertonic/assets
+// 5. assets next to the executable
+// 6. Local directory: ./assets
 func findAssetsDir(cmdLinePath string) (string, error) {
-	// Priority 1: Command line flag
-	if cmdLinePath != "" {
-		info, err := os.Stat(cmdLinePath)
+	// Priority 1 and 2: an explicit path must exist
+	explicit, source := cmdLinePath, "specified"
+	if explicit == "" {
+		explicit, source = os.Getenv("SUPERTONIC_ASSETS"), "SUPERTONIC_ASSETS"
+	}
+	if explicit != "" {
+		info, err := os.Stat(explicit)
 		if err != nil {
-			return "", fmt.Errorf("specified assets directory not accessible: %s: %w", cmdLinePath, err)
+			return "", fmt.Errorf("%s assets directory not accessible: %s: %w", source, explicit, err)
 		}
 		if !info.IsDir() {
-			return "", fmt.Errorf("specified assets directory is not a directory: %s", cmdLinePath)
+			return "", fmt.Errorf("%s assets directory is not a directory: %s", source, explicit)
 		}
 		// Convert to absolute path for consistency
-		absPath, err := filepath.Abs(cmdLinePath)
+		absPath, err := filepath.Abs(explicit)
 		if err != nil {
-			return cmdLinePath, nil // Fallback to original if abs fails
+			return explicit, nil // Fallback to original if abs fails
 		}
 		return absPath, nil
 	}
 
-	// Priority 2: System-wide location
-	systemPath := "/var/lib/supertonic/assets"
-	if info, err := os.Stat(systemPath); err == nil && info.IsDir() {
-		absPath, _ := filepath.Abs(systemPath)
-		return absPath, nil
+	var searched []string
+	if xdg := os.Getenv("XDG_DATA_HOME"); xdg != "" {
+		searched = append(searched, filepath.Join(xdg, "supertonic"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		searched = append(searched, filepath.Join(home, ".local", "share", "supertonic"))
+	}
+	searched = append(searched, "/var/lib/supertonic/assets")
+	if exe, err := os.Executable(); err == nil {
+		if exe, err := filepath.EvalSymlinks(exe); err == nil {
+			searched = append(searched, filepath.Join(filepath.Dir(exe), "assets"))
+		}
 	}
+	searched = append(searched, "./assets")
 
-	// Priority 3: Local directory (relative to working directory)
-	localPath := "./assets"
-	if info, err := os.Stat(localPath); err == nil && info.IsDir() {
-		absPath, _ := filepath.Abs(localPath)
-		return absPath, nil
+	for _, path := range searched {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			absPath, _ := filepath.Abs(path)
+			return absPath, nil
+		}
 	}
 
-	return "", fmt.Errorf("could not find assets directory in any default location. " +
-		"Please specify the path using --assets-dir\n" +
-		"Searched locations:\n" +
-		"  - /var/lib/supertonic/assets\n" +
-		"  - ./assets")
+	return "", fmt.Errorf("could not find assets directory in any default location. "+
+		"Please specify the path using --assets-dir or SUPERTONIC_ASSETS\n"+
+		"Searched locations:\n  - %s", strings.Join(searched, "\n  - "))
 }
 
-// verifyAssets checks if required model files exist in the determined assets directory
+// verifyAssets checks if required model files exist for every model pack and alias
 func verifyAssets() error {
-	onnxDir := filepath.Join(config.AssetsDir, "onnx")
-	voiceStylesDir := filepath.Join(config.AssetsDir, "voice_styles")
+	for alias, pack := range modelAliases {
+		if _, exists := modelPacks[pack]; !exists {
+			return fmt.Errorf("model alias %s points to unknown model pack %s", alias, pack)
+		}
+	}
+
+	for _, pack := range modelPacks {
+		if err := verifyModelPack(pack); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyModelPack checks if required model files exist in a model pack directory
+func verifyModelPack(pack ModelPack) error {
+	onnxDir := filepath.Join(pack.Dir, "onnx")
+	voiceStylesDir := filepath.Join(pack.Dir, "voice_styles")
 
 	// Check for ONNX model files
 	requiredFiles := []string{
@@ -141,16 +768,19 @@ func verifyAssets() error {
 
 	for _, file := range requiredFiles {
 		path := filepath.Join(onnxDir, file)
-		if _, err := os.Stat(path); err != nil {
+		if !tts.AssetExists(path) {
 			return fmt.Errorf("missing required ONNX file: %s", path)
 		}
+		if tts.IsEmbeddedAsset(path) {
+			log.Printf("Using embedded %s for model %s", file, pack.Name)
+		}
 	}
 
 	// Check voice style files
 	for voiceName, filename := range tts.VoiceMapping {
 		path := filepath.Join(voiceStylesDir, filename)
-		if _, err := os.Stat(path); err != nil {
-			log.Printf("Warning: Missing voice style %s at %s", voiceName, path)
+		if !tts.AssetExists(path) {
+			log.Printf("Warning: Missing voice style %s for model %s at %s", voiceName, pack.Name, path)
 		}
 	}
 
@@ -164,11 +794,29 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
 		"message": "Supertonic OpenAI-Compatible TTS API",
 		"endpoints": map[string]string{
-			"POST /v1/audio/speech": "Generate speech from text",
-			"GET /health":           "Health check",
+			"POST /v1/audio/speech":          "Generate speech from text",
+			"GET /v1/audio/speech":           "CDN-cacheable synthesis of a signed ?payload= from POST /admin/signed-urls (--url-signing-secret)",
+			"POST /v1/audio/speech/from-llm": "Stream speech for an LLM's streamed output, sentence by sentence (--llm-upstreams)",
+			"POST /v1/sessions":              "Start a conversation session holding voice, speed, language and lexicon settings (--session-idle)",
+			"POST /v1/sessions/{id}/speech":  "Speak a fragment with the session's settings (GET/DELETE /v1/sessions/{id} inspect or end it)",
+			"POST /v1/text/analyze":          "Show normalized text, tokens and predicted durations",
+			"POST /v1/audio/jobs":            "Queue asynchronous speech generation (optional callback_url; multipart HTML/PDF/Markdown upload)",
+			"GET /v1/audio/jobs/{id}":        "Get async job status",
+			"GET /v1/audio/jobs/{id}/audio":  "Download async job audio",
+			"GET /v1/audio/files/{name}":     "Download audio saved with --save-dir",
+			"GET /v1/audio/podcast.xml":      "RSS podcast feed of saved audio (--podcast-title; API key in ?api_key= for podcast apps)",
+			"GET /v1/audio/twilio":           "Twilio Media Streams WebSocket (8 kHz µ-law; API key in ?api_key=)",
+			"GET /v1/models":                 "Available models and the languages they speak, including language packs",
+			"GET /v1/models/{id}":            "Model metadata: sample rate, languages, voices, limits and versions",
+			"GET /v1/voices":                 "Voices the caller may use, including its custom voices",
+			"PUT /v1/voices/{name}":          "Upload a custom voice style JSON as <key name>/{name} (--voice-dir; DELETE removes it)",
+			"GET /v1/usage":                  "The caller's monthly usage and remaining quota (--api-keys)",
+			"GET /api/tts":                   "OpenTTS/Piper/Coqui-compatible synthesis (text, voice or speaker_id, lang or language_id)",
+			"GET /api/voices":                "OpenTTS-compatible voice list",
+			"GET /health":                    "Health check",
 		},
-		"voices":           tts.GetAvailableVoices(),
-		"models":           []string{"tts-1", "tts-1-hd"},
+		"voices": tts.GetAvailableVoices(),
+		"models": availableModels(),
 	}
 	json.NewEncoder(w).Encode(response)
 }
@@ -176,10 +824,21 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 // handleHealthCheck returns service health
 func handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "healthy",
-		"service": "supertonic-tts",
-	})
+	health := map[string]interface{}{
+		"status":   "healthy",
+		"service":  "supertonic-tts",
+		"degraded": gpuDegraded != "",
+	}
+	if gpuDegraded != "" {
+		health["degraded_reason"] = gpuDegraded
+	}
+	if config.LatencySLO > 0 {
+		health["latency_slo"] = slo.status()
+	}
+	if renders != nil {
+		health["audio_cache"] = renders.status()
+	}
+	json.NewEncoder(w).Encode(health)
 }
 
 // handleTTSRequest processes OpenAI-compatible TTS requests
@@ -191,55 +850,308 @@ func handleTTSRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse request body
+	// Parse request body: JSON, or a multipart upload of a document
 	var req TTSRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if isMultipartRequest(r) {
+		var err error
+		if req, err = decodeUploadRequest(w, r); err != nil {
+			sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Invalid JSON")
 		sendError(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	serveSpeech(w, r, &req)
+}
+
+// serveSpeech validates a decoded speech request and writes its response in
+// the mode the request asks for
+func serveSpeech(w http.ResponseWriter, r *http.Request, req *TTSRequest) {
+	// Only renders with a caller-chosen seed repeat, so only those are cached
+	seeded := req.Seed != 0
 
 	// Validate request
-	if err := validateRequest(&req); err != nil {
-		sendError(w, err.Error(), http.StatusBadRequest)
+	req.key = requestAPIKey(r)
+	req.access = requestAccessRecord(r)
+	err := runPreValidateHooks(r, req)
+	if err == nil {
+		err = validateRequest(req)
+	}
+	auditRequest(r, req)
+	if err != nil {
+		sendError(w, err.Error(), validationStatus(w, err))
 		return
 	}
 
+	applyLatencySLO(w, req)
+	if !req.Stream {
+		defer func(start time.Time) { slo.record(time.Since(start)) }(time.Now())
+	}
+
 	// Log request
-	log.Printf("TTS Request: voice=%s, speed=%.2f, text=\"%.50s\"",
-		req.Voice, req.Speed, req.Input)
+	log.Printf("TTS Request: model=%s, voice=%s, speed=%.2f, text=\"%.50s\"",
+		req.Model, req.Voice, req.Speed, req.Input)
+	if req.truncated {
+		log.Printf("Input truncated to %d characters (--max-input-chars)", config.MaxInputChars)
+	}
 
-	// Generate speech
-	audioData, err := generateSpeech(&req)
-	if err != nil {
-		log.Printf("TTS Error: %v", err)
-		sendError(w, "Speech generation failed: "+err.Error(), http.StatusInternalServerError)
+	if len(req.SpeechMarks) > 0 {
+		handleSpeechMarksResponse(w, req)
+		return
+	}
+	if req.Visemes != "" {
+		handleVisemeResponse(w, req)
+		return
+	}
+	if req.Preview {
+		handlePreviewResponse(w, req)
+		return
+	}
+	if req.Stream {
+		handleStreamResponse(w, req)
 		return
 	}
 
-	// Set wav headers
-	w.Header().Set("Content-Type", "audio/wav")
+	// Repeated seeded requests are served from the audio cache (--audio-cache-mb)
+	cacheKey := audioCacheKey(req, seeded)
+	var audioData []byte
+	if entry, ok := renders.get(cacheKey); ok {
+		entry.restore(req)
+		recordUsage(req, entry.duration)
+		dashboard.recordVoice(req.Voice, entry.duration)
+		w.Header().Set("X-Supertonic-Cache", "hit")
+		if notModified(w, r, entry.etag) {
+			return
+		}
+		audioData = entry.data
+	} else {
+		// Generate speech; long WAV renders may be spooled to disk instead
+		var spool *pcmSpool
+		if canSpool(req) {
+			req.spool = true
+			audioData, spool, err = generateEncoded(req, requestEncoder(req).(StreamEncoder))
+		} else {
+			audioData, err = generateSpeech(req)
+		}
+		if err != nil {
+			log.Printf("TTS Error: %v", err)
+			sendError(w, "Speech generation failed: "+err.Error(), speechErrorStatus(w, err))
+			return
+		}
+		if spool != nil {
+			serveSpooled(w, r, req, spool)
+			return
+		}
+		if cacheKey != "" {
+			etag := strongETag(audioData)
+			cacheRender(cacheKey, req, audioData, etag)
+			w.Header().Set("X-Supertonic-Cache", "miss")
+			if notModified(w, r, etag) {
+				return
+			}
+		}
+	}
+
+	// Persist the audio when a save directory or bucket is configured
+	if storageEnabled() {
+		name := newAudioName(req.ResponseFormat)
+		audioURL, err := storeAudio(name, audioData, contentTypeFor(req.ResponseFormat), requestBaseURL(r))
+		if err != nil {
+			log.Printf("Storage Error: %v", err)
+			sendError(w, "Saving audio failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		saveEpisode(name, req)
+		if req.ReturnURL {
+			sendAudioURL(w, req, audioURL, len(audioData))
+			return
+		}
+		w.Header().Set("X-Supertonic-Audio-URL", audioURL)
+	}
+
+	setSpeechHeaders(w, req)
 
 	// Write audio data
 	w.Write(audioData)
 }
 
+// sendAudioURL answers a return_url request with where the audio was saved
+func sendAudioURL(w http.ResponseWriter, req *TTSRequest, audioURL string, audioBytes int) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":         audioURL,
+		"audio_bytes": audioBytes,
+		"chunks":      req.chunks,
+		"truncated":   req.truncated,
+		"skipped":     req.skipped,
+		"speed":       req.Speed,
+		"quality":     req.quality,
+	})
+}
+
+// setSpeechHeaders sets the content type of a speech response and reports how
+// the input was split (and whether it was cut at --max-input-chars)
+func setSpeechHeaders(w http.ResponseWriter, req *TTSRequest) {
+	w.Header().Set("X-Supertonic-Chunks", strconv.Itoa(req.chunks))
+	w.Header().Set("X-Supertonic-Truncated", strconv.FormatBool(req.truncated))
+	w.Header().Set("X-Supertonic-Skipped", strconv.Itoa(len(req.skipped)))
+	w.Header().Set("X-Supertonic-Speed", strconv.FormatFloat(req.Speed, 'f', 2, 64))
+	if q := req.quality; q != nil {
+		w.Header().Set("X-Supertonic-Loudness-LUFS", strconv.FormatFloat(q.LUFS, 'f', 1, 64))
+		w.Header().Set("X-Supertonic-Peak-DBFS", strconv.FormatFloat(q.PeakDBFS, 'f', 1, 64))
+		w.Header().Set("X-Supertonic-Clipped-Samples", strconv.Itoa(q.Clipped))
+	}
+	w.Header().Set("Content-Type", contentTypeFor(req.ResponseFormat))
+}
+
 // validateRequest checks if the request is valid
 func validateRequest(req *TTSRequest) error {
 	if req.Input == "" {
 		return fmt.Errorf("input text is required")
 	}
+	// Input of any length is split into model-sized chunks; the hard cap bounds
+	// the work a single request can queue
+	req.Input, req.truncated = truncateInput(req.Input, config.MaxInputChars)
 
 	if req.Voice == "" {
-		req.Voice = "F5" // Default voice
+		req.Voice = config.DefaultVoice
+	}
+	if !req.key.allowsVoice(req.Voice) {
+		return fmt.Errorf("%w: %s", errVoiceForbidden, req.Voice)
+	}
+	if err := checkQuota(req); err != nil {
+		return err
 	}
 
+	if err := resolvePace(req); err != nil {
+		return err
+	}
 	if req.Speed == 0 {
 		req.Speed = config.DefaultSpeed
 	}
 
+	if req.Steps == 0 && req.LowLatency {
+		req.Steps = config.LowLatencySteps
+	}
+	if req.Steps == 0 {
+		req.Steps = config.TotalStep
+		req.defaultSteps = true
+	}
+	if req.AdaptiveSteps == nil {
+		adaptive := config.AdaptiveSteps && req.defaultSteps
+		req.AdaptiveSteps = &adaptive
+	}
+
+	if req.SilenceDuration == nil {
+		req.SilenceDuration = &config.SilenceDuration
+	}
+
+	if req.NoiseScale == 0 {
+		req.NoiseScale = config.NoiseScale
+	}
+
+	if req.SwayCoefficient == nil {
+		req.SwayCoefficient = &config.SwayCoefficient
+	}
+
+	if req.Scheduler == "" {
+		req.Scheduler = config.Scheduler
+	}
+
+	if req.PreviewSteps == 0 {
+		req.PreviewSteps = config.PreviewSteps
+	}
+
+	// Pin the seed so preview and final renders of a request are reproducible
+	if req.Seed == 0 {
+		req.Seed = rand.Int63n(math.MaxInt32) + 1
+	}
+
+	if req.Model == "" {
+		req.Model = config.DefaultModel
+	}
+
+	if req.Language == "" {
+		req.Language = "en" // Default language
+	}
+	if !tts.IsSupportedLanguage(req.Language) {
+		return fmt.Errorf("unsupported language: %s. Available: %v", req.Language, append([]string{"auto"}, tts.AvailableLangs...))
+	}
+	if _, err := tts.SplitLanguageSegments(req.Input, req.Language); err != nil {
+		return err
+	}
+
+	if req.NumberStyle == "" {
+		req.NumberStyle = config.NumberStyle
+	}
+	if _, err := tts.ParseNumberStyle(req.NumberStyle); err != nil {
+		return err
+	}
+	if _, err := tts.ParseSpellAlphabet(req.SpellAlphabet); err != nil {
+		return err
+	}
+	if req.ResponseFormat == "" {
+		req.ResponseFormat = config.DefaultFormat
+	}
+	if err := validateResponseFormat(req.ResponseFormat); err != nil {
+		return err
+	}
+	if req.SampleFormat == "" {
+		req.SampleFormat = config.SampleFormat
+	}
+	if err := validateSampleFormat(req.SampleFormat); err != nil {
+		return err
+	}
+	if req.Declick == nil {
+		req.Declick = &config.Declick
+	}
+	if req.SkipFailedChunks == nil {
+		req.SkipFailedChunks = &config.SkipFailedChunks
+	}
+	if req.Dither == "" {
+		req.Dither = config.Dither
+	}
+	if err := validateDither(req.Dither); err != nil {
+		return err
+	}
+
+	// Validate input type
+	switch req.InputType {
+	case "", "text":
+		req.InputType = "text"
+	case "phonemes":
+		if _, err := tts.PhonemesToText(req.Input, req.PhonemeAlphabet); err != nil {
+			return fmt.Errorf("invalid phoneme input: %w", err)
+		}
+	default:
+		return fmt.Errorf("input_type must be \"text\" or \"phonemes\"")
+	}
+	if req.URLs == "" {
+		req.URLs = config.URLs
+	}
+	if _, err := tts.ParseURLMode(req.URLs); err != nil {
+		return err
+	}
+	if req.Acronyms == nil {
+		req.Acronyms = &config.Acronyms
+	}
+	if req.UnsupportedChars == "" {
+		req.UnsupportedChars = config.UnsupportedChars
+	}
+	if req.UnsupportedChars != tts.UnsupportedSkip && req.UnsupportedChars != tts.UnsupportedError {
+		return fmt.Errorf("unsupported_chars must be %q or %q", tts.UnsupportedSkip, tts.UnsupportedError)
+	}
+
+	// Validate model
+	pack, err := resolveModelPack(req.Model)
+	if err != nil {
+		return err
+	}
+
 	// Validate voice
-	if _, err := tts.GetVoicePath(req.Voice, config.AssetsDir); err != nil {
+	if _, err := voiceStylePath(req, pack); err != nil {
 		return err
 	}
 
@@ -247,108 +1159,365 @@ func validateRequest(req *TTSRequest) error {
 	if req.Speed < 0.25 || req.Speed > 4.0 {
 		return fmt.Errorf("speed must be between 0.25 and 4.0")
 	}
+	if req.MaxDurationSeconds < 0 {
+		return fmt.Errorf("max_duration_seconds must not be negative")
+	}
+
+	// Validate sampler settings
+	if req.Steps < 1 || req.Steps > 64 {
+		return fmt.Errorf("steps must be between 1 and 64")
+	}
+	if *req.SilenceDuration < 0 || *req.SilenceDuration > 5.0 {
+		return fmt.Errorf("silence_duration must be between 0 and 5.0")
+	}
+	if req.NoiseScale < 0 || req.NoiseScale > 2.0 {
+		return fmt.Errorf("noise_scale must be between 0 and 2.0")
+	}
+	if *req.SwayCoefficient < -1.0 || *req.SwayCoefficient > 1.0 {
+		return fmt.Errorf("sway_coefficient must be between -1.0 and 1.0")
+	}
+	if _, err := tts.ParseScheduler(req.Scheduler); err != nil {
+		return err
+	}
+	if req.PreviewSteps < 1 {
+		return fmt.Errorf("preview_steps must be at least 1")
+	}
+	if req.Final && !req.Preview {
+		return fmt.Errorf("final requires preview")
+	}
+	if req.ReturnURL && !storageEnabled() {
+		return fmt.Errorf("return_url requires the server to run with --save-dir or --s3-bucket")
+	}
+	if req.ReturnURL && req.Preview {
+		return fmt.Errorf("return_url is not supported with preview")
+	}
+	if req.Stream {
+		if err := validateStream(req); err != nil {
+			return err
+		}
+	}
+	if req.LowLatency && !req.Stream {
+		return fmt.Errorf("low_latency requires stream")
+	}
+	if err := validateSpeechMarks(req); err != nil {
+		return err
+	}
+	if err := validateVisemes(req); err != nil {
+		return err
+	}
+
+	// Apply the pre-synthesis content filter
+	if req.InputType == "text" {
+		if err := filterContent(req); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
 // generateSpeech generates speech from the request
 func generateSpeech(req *TTSRequest) ([]byte, error) {
-	// Load config from assets directory
-	cfg, err := tts.LoadCfgs(config.AssetsDir)
+	if encoder, ok := requestEncoder(req).(StreamEncoder); ok && encodesIncrementally(req) {
+		audioData, _, err := generateEncoded(req, encoder)
+		return audioData, err
+	}
+
+	result, sampleRate, err := synthesizeSpeech(req, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %w", err)
+		return nil, err
 	}
 
-	// Load TTS components from assets directory
-	textToSpeech, err := tts.LoadTextToSpeech(config.AssetsDir, config.UseGPU, cfg)
+	// Convert to the requested format
+	audioData, err := convertToFormat(result.Wav, sampleRate, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load TTS: %w", err)
+		return nil, err
+	}
+
+	log.Printf("Generated audio: %d bytes, duration: %.2fs", len(audioData), result.Duration)
+	return audioData, nil
+}
+
+// generateEncoded is generateSpeech for formats with a StreamEncoder: each
+// block of samples is encoded as soon as it is synthesized and then dropped,
+// so only the encoded response is held in memory. A request that spooled()
+// writes its samples to a pcmSpool instead, returned in place of the bytes
+func generateEncoded(req *TTSRequest, encoder StreamEncoder) ([]byte, *pcmSpool, error) {
+	var stream EncodeStream
+	var spool *pcmSpool
+	var encodeErr error
+	onAudio := func(samples []float32, sampleRate int) {
+		if encodeErr != nil {
+			return
+		}
+		if stream == nil && spool == nil {
+			if spooled(req) {
+				if spool, encodeErr = newPCMSpool(sampleRate); encodeErr != nil {
+					return
+				}
+			} else {
+				stream = encoder.NewStream(sampleRate)
+			}
+		}
+		if spool != nil {
+			encodeErr = spool.Write(samples)
+		} else {
+			encodeErr = stream.Write(samples)
+		}
 	}
-	defer textToSpeech.Destroy()
+	req.restartAudio = func() {
+		if spool != nil {
+			spool.remove()
+		}
+		stream, spool, encodeErr = nil, nil, nil
+	}
+	defer func() { req.restartAudio = nil }()
+
+	result, sampleRate, err := synthesizeSpeech(req, onAudio)
+	if err == nil {
+		err = encodeErr
+	}
+	if err != nil {
+		if spool != nil {
+			spool.remove()
+		}
+		return nil, nil, err
+	}
+	if spool != nil {
+		log.Printf("Spooled audio: %d samples to %s, duration: %.2fs", spool.samples, spool.file.Name(), result.Duration)
+		return nil, spool, nil
+	}
+	if stream == nil {
+		stream = encoder.NewStream(sampleRate)
+	}
+	audioData, err := stream.Bytes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	log.Printf("Generated audio: %d bytes, duration: %.2fs", len(audioData), result.Duration)
+	return audioData, nil, nil
+}
+
+// synthesizeSpeech renders the request's samples, handing them to onAudio as
+// chunks finish when it is set, and returns them with the model's sample rate
+func synthesizeSpeech(req *TTSRequest, onAudio func(samples []float32, sampleRate int)) (*tts.SynthesisResult, int, error) {
+	// Queued jobs are checked again: the quota may have been spent meanwhile
+	if err := checkQuota(req); err != nil {
+		return nil, 0, err
+	}
+	if err := runPreSynthesizeHooks(req); err != nil {
+		return nil, 0, err
+	}
+
+	// Resolve model pack
+	pack, err := resolveModelPack(req.Model)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Acquire the loaded engine for the model pack
+	eng, err := acquireEngine(pack)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer eng.release()
+
+	// Reserve a GPU session so concurrent requests can't exhaust VRAM mid-synthesis;
+	// with several devices this also picks the least loaded one
+	device, releaseGPU, err := admitGPU(req.waitForGPU)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer releaseGPU()
+	textToSpeech := eng.worker(device)
 
 	// Get voice style path
-	voicePath, err := tts.GetVoicePath(req.Voice, config.AssetsDir)
+	voicePath, err := voiceStylePath(req, pack)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	// Load voice style
 	style, err := tts.LoadVoiceStyle([]string{voicePath}, false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load voice style: %w", err)
+		return nil, 0, fmt.Errorf("failed to load voice style: %w", err)
 	}
 	defer style.Destroy()
 
+	text, err := speechText(req, textToSpeech)
+	if err != nil {
+		return nil, 0, err
+	}
+	secondsQuota := req.key != nil && req.key.MonthlySeconds > 0
+	if req.WPM > 0 || req.MaxDurationSeconds > 0 || config.RequestMemoryMB > 0 || req.spool || secondsQuota {
+		predicted, err := applyPacing(req, textToSpeech, text, style)
+		if err != nil {
+			return nil, 0, err
+		}
+		req.predicted = predicted
+		if err := checkMemoryBudget(req, predicted, textToSpeech.SampleRate, onAudio != nil); err != nil {
+			return nil, 0, err
+		}
+	}
+	// Concurrent requests of a key must not together overshoot its quota
+	releaseQuota, err := reserveQuota(req, req.predicted)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer releaseQuota()
 
-	// Generate speech (language detection could be added here)
-	language := "en"
+	// Generate speech (per-segment language routing happens in CallWithOptions)
+	language := req.Language
 	fmt.Printf("Generating speech (steps=%d, speed=%.2f)...\n",
-		config.TotalStep, req.Speed)
+		req.Steps, req.Speed)
 
-	// Generate using the Call method (handles chunking)
-	wav, duration, err := textToSpeech.Call(req.Input, language, style, config.TotalStep, float32(req.Speed), 0.3)
+	// Generate using the Synthesize method (handles chunking and per-chunk recovery)
+	opts := synthesisOptions(req)
+	var hookErr error
+	if onAudio != nil {
+		// Callers keep what they need of each block, so the result holds no copy
+		opts.DiscardEmitted = true
+		// Streamed audio passes through the post-synthesis hooks block by block
+		opts.OnAudio = func(samples []float32) {
+			if hookErr != nil {
+				return
+			}
+			if samples, hookErr = runPostSynthesizeHooks(req, samples, textToSpeech.SampleRate); hookErr == nil {
+				onAudio(samples, textToSpeech.SampleRate)
+			}
+		}
+	}
+	start := time.Now()
+	result, err := textToSpeech.Synthesize(text, language, style, opts)
+	if inferenceFailed(result, err) && healWorker(pack, device, textToSpeech, result, err) && (onAudio == nil || req.restartAudio != nil) {
+		// Streamed audio has already been sent, so only buffered requests are retried
+		if req.restartAudio != nil {
+			req.restartAudio()
+		}
+		result, err = textToSpeech.Synthesize(text, language, style, opts)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("speech generation failed: %w", err)
+		return nil, 0, fmt.Errorf("speech generation failed: %w", err)
 	}
+	if hookErr != nil {
+		return nil, 0, hookErr
+	}
+	if onAudio == nil && len(hooks) > 0 {
+		if result.Wav, err = runPostSynthesizeHooks(req, result.Wav, textToSpeech.SampleRate); err != nil {
+			return nil, 0, err
+		}
+		result.Duration = float32(len(result.Wav)) / float32(textToSpeech.SampleRate)
+	}
+	req.chunks, req.skipped, req.duration = result.Chunks, result.Skipped, float64(result.Duration)
+	recordUsage(req, float64(result.Duration))
+	dashboard.recordVoice(req.Voice, float64(result.Duration))
+	req.access.recordSynthesis(time.Since(start), float64(result.Duration))
+	for _, span := range result.Skipped {
+		log.Printf("Skipped chunk at %.2fs (%v): \"%.50s\"", span.Offset, span.Error, span.Text)
+	}
+	return result, textToSpeech.SampleRate, nil
+}
 
-	// Convert to bytes
-	audioData := wavToBytes(wav, textToSpeech.SampleRate)
-
-	log.Printf("Generated audio: %d bytes, duration: %.2fs", len(audioData), duration)
-	return audioData, nil
+// speechErrorStatus maps a generateSpeech error to an HTTP status: 400 for input
+// the model cannot speak, 429 once the key's monthly quota is spent, 503 (asking
+// the client to retry) when the GPU was at capacity, or a hook's HookError status
+func speechErrorStatus(w http.ResponseWriter, err error) int {
+	var unsupported *tts.UnsupportedTextError
+	var tooLong *durationLimitError
+	var quota *quotaError
+	var refused *HookError
+	var overBudget *memoryBudgetError
+	switch {
+	case errors.As(err, &unsupported), errors.As(err, &tooLong):
+		return http.StatusBadRequest
+	case errors.As(err, &overBudget):
+		return http.StatusRequestEntityTooLarge
+	case errors.As(err, &quota), errors.As(err, &refused):
+		return validationStatus(w, err)
+	case errors.Is(err, errGPUBusy):
+		w.Header().Set("Retry-After", "1")
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
 }
 
-// sendError sends JSON error response
-func sendError(w http.ResponseWriter, message string, status int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(map[string]string{
-		"error": message,
-	})
+// truncateInput cuts text longer than limit characters at the last sentence end
+// in its final fifth, else at the last space, else at the limit itself
+func truncateInput(text string, limit int) (string, bool) {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text, false
+	}
+	cut := string(runes[:limit])
+	if i := strings.LastIndexAny(cut, ".!?\n"); i >= 0 && utf8.RuneCountInString(cut[:i]) >= limit*4/5 {
+		return cut[:i+1], true
+	}
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		return cut[:i], true
+	}
+	return cut, true
 }
 
-// wavToBytes converts float32 WAV data to WAV file bytes using a temporary file
-func wavToBytes(audioData []float32, sampleRate int) []byte {
-	// Create a temporary file (implements io.WriteSeeker)
-	tmpfile, err := os.CreateTemp("", "supertonic-*.wav")
+// speechText returns the text handed to the model: phoneme input becomes a
+// respelling, text input has embedded foreign words routed per --code-switch,
+// characters the model cannot speak handled per unsupported_chars and gets the
+// request's normalization options applied
+func speechText(req *TTSRequest, textToSpeech *tts.TextToSpeech) (string, error) {
+	if req.InputType == "phonemes" {
+		return tts.PhonemesToText(req.Input, req.PhonemeAlphabet)
+	}
+	input := tts.SwitchCode(tts.MapCharacters(req.Input, req.Language), req.Language, config.CodeSwitch)
+	input, err := textToSpeech.ApplyUnicodePolicy(input, req.UnsupportedChars)
 	if err != nil {
-		log.Printf("Error creating temp file: %v", err)
-		return nil
+		return "", err
 	}
-	defer os.Remove(tmpfile.Name())
-	defer tmpfile.Close()
-
-	// Create WAV encoder with the temp file
-	encoder := wav.NewEncoder(tmpfile, sampleRate, 16, 1, 1)
+	return tts.NormalizeText(input, req.Language, textOptions(req)), nil
+}
 
-	// Convert float32 to int16
-	data := make([]int, len(audioData))
-	for i, sample := range audioData {
-		clamped := float64(sample)
-		if clamped > 1.0 {
-			clamped = 1.0
-		} else if clamped < -1.0 {
-			clamped = -1.0
-		}
-		data[i] = int(clamped * 32767)
+// textOptions builds the text normalization settings for a validated request
+func textOptions(req *TTSRequest) tts.TextOptions {
+	return tts.TextOptions{
+		NumberStyle:   tts.NumberStyle(req.NumberStyle),
+		SpellOut:      req.SpellOut,
+		SpellAlphabet: req.SpellAlphabet,
+		Acronyms:      *req.Acronyms,
+		URLs:          req.URLs,
 	}
+}
 
-	// Write audio data
-	audioBuf := &audio.IntBuffer{
-		Data:           data,
-		Format:         &audio.Format{SampleRate: sampleRate, NumChannels: 1},
-		SourceBitDepth: 16,
-	}
-	encoder.Write(audioBuf)
-	encoder.Close()
+// wavOptionsFor returns the WAV encoding options of a request
+func wavOptionsFor(req *TTSRequest) wavOptions {
+	return wavOptions{SampleFormat: req.SampleFormat, Dither: req.Dither, Seed: req.Seed}
+}
 
-	// Seek back to beginning and read the file
-	tmpfile.Seek(0, 0)
-	bytes, err := io.ReadAll(tmpfile)
-	if err != nil {
-		log.Printf("Error reading temp file: %v", err)
-		return nil
+// synthesisOptions builds the sampler settings for a validated request
+func synthesisOptions(req *TTSRequest) tts.SynthesisOptions {
+	opts := tts.SynthesisOptions{
+		TotalStep:       req.Steps,
+		Speed:           float32(req.Speed),
+		SilenceDuration: float32(*req.SilenceDuration),
+		NoiseScale:      float32(req.NoiseScale),
+		SwayCoefficient: float32(*req.SwayCoefficient),
+		Seed:            req.Seed,
+		Scheduler:       tts.Scheduler(req.Scheduler),
+		Declick:         *req.Declick,
+
+		SkipFailedChunks: *req.SkipFailedChunks,
+		AdaptiveSteps:    *req.AdaptiveSteps,
 	}
+	if req.LowLatency {
+		opts.FrameWindow = config.LowLatencyFrames
+	}
+	return opts
+}
 
-	return bytes
+// sendError sends JSON error response
+func sendError(w http.ResponseWriter, message string, status int) {
+	dashboard.recordError(message, status)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": message,
+	})
 }
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-supertonic/tts"
+)
+
+// defaultModelPack is the name given to models installed directly under the assets directory
+const defaultModelPack = "default"
+
+// ModelPack describes one installed Supertonic model version.
+// Dir has the same layout as the assets directory: onnx/ and voice_styles/
+type ModelPack struct {
+	Name string
+	Dir  string
+}
+
+// packLoadRetry is how long a model pack that failed to load is reported
+// unavailable before a request may try to load it again
+const packLoadRetry = time.Minute
+
+// modelsMu guards modelPacks, modelAliases, engines and packFailures, which change at runtime on hot-swap
+var modelsMu sync.RWMutex
+
+// packLoadFailure is why a model pack could not be loaded, and when
+type packLoadFailure struct {
+	err error
+	at  time.Time
+}
+
+// packFailures holds the model packs whose last load failed
+var packFailures = map[string]packLoadFailure{}
+
+// errModelUnavailable is returned for a model whose pack is installed but failed to load
+var errModelUnavailable = errors.New("model unavailable")
+
+// modelPacks holds every discovered model pack by name
+var modelPacks = map[string]ModelPack{}
+
+// modelAliases maps request model names (tts-1, tts-1-hd, ...) to model pack names
+var modelAliases = map[string]string{}
+
+// discoverModelPacks finds installed model packs in the assets directory:
+// the legacy layout ([assetsDir]/onnx) becomes the "default" pack and every
+// subdirectory of [assetsDir]/models/ becomes a pack named after the directory
+func discoverModelPacks(assetsDir string) (map[string]ModelPack, error) {
+	packs := map[string]ModelPack{}
+
+	if info, err := os.Stat(filepath.Join(assetsDir, "onnx")); err == nil && info.IsDir() {
+		packs[defaultModelPack] = ModelPack{Name: defaultModelPack, Dir: assetsDir}
+	}
+
+	modelsDir := filepath.Join(assetsDir, "models")
+	entries, err := os.ReadDir(modelsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read models directory %s: %w", modelsDir, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		if _, exists := packs[name]; exists {
+			return nil, fmt.Errorf("model pack name %q is reserved", name)
+		}
+		packs[name] = ModelPack{Name: name, Dir: filepath.Join(modelsDir, name)}
+	}
+
+	if len(packs) == 0 {
+		return nil, fmt.Errorf("no model packs found in %s (expected onnx/ or models/<name>/onnx/)", assetsDir)
+	}
+	return packs, nil
+}
+
+// parseModelAliases parses a comma-separated alias list such as
+// "tts-1=default,tts-1-hd=v2". tts-1 and tts-1-hd fall back to fallbackPack
+// when they are not listed explicitly
+func parseModelAliases(spec string, fallbackPack string) (map[string]string, error) {
+	aliases := map[string]string{
+		"tts-1":    fallbackPack,
+		"tts-1-hd": fallbackPack,
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		alias, pack, ok := strings.Cut(entry, "=")
+		alias = strings.TrimSpace(alias)
+		pack = strings.TrimSpace(pack)
+		if !ok || alias == "" || pack == "" {
+			return nil, fmt.Errorf("invalid model alias %q (expected alias=pack)", entry)
+		}
+		aliases[alias] = pack
+	}
+	return aliases, nil
+}
+
+// resolveModelPack returns the model pack for a request model name,
+// which may be an alias or the name of a pack itself
+func resolveModelPack(model string) (ModelPack, error) {
+	if model == "" {
+		model = config.DefaultModel
+	}
+
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+
+	name := model
+	if target, ok := modelAliases[model]; ok {
+		name = target
+	}
+
+	pack, exists := modelPacks[name]
+	if !exists {
+		return ModelPack{}, fmt.Errorf("unsupported model: %s. Available models: %v", model, availableModelsLocked())
+	}
+	if packFailedLocked(name) {
+		return ModelPack{}, fmt.Errorf("%w: %s (model pack %s failed to load: %v). Available models: %v",
+			errModelUnavailable, model, name, packFailures[name].err, availableModelsLocked())
+	}
+	return pack, nil
+}
+
+// packFailedLocked reports whether a pack failed to load within packLoadRetry.
+// The caller must hold modelsMu
+func packFailedLocked(name string) bool {
+	failure, failed := packFailures[name]
+	return failed && time.Since(failure.at) < packLoadRetry
+}
+
+// recordPackLoad remembers the outcome of loading a model pack, so requests
+// for a pack that cannot load are rejected up front for packLoadRetry
+func recordPackLoad(name string, err error) {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	if err != nil {
+		packFailures[name] = packLoadFailure{err: err, at: time.Now()}
+	} else {
+		delete(packFailures, name)
+	}
+}
+
+// firstModelPack returns the pack used when no alias is configured:
+// "default" if present, otherwise the alphabetically first pack
+func firstModelPack(packs map[string]ModelPack) string {
+	if _, ok := packs[defaultModelPack]; ok {
+		return defaultModelPack
+	}
+	names := make([]string, 0, len(packs))
+	for name := range packs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// availableModels returns every model name a request may use (aliases and pack names)
+func availableModels() []string {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	return availableModelsLocked()
+}
+
+// availableModelsLocked is availableModels for callers already holding modelsMu.
+// Packs that recently failed to load, and their aliases, are left out
+func availableModelsLocked() []string {
+	seen := map[string]bool{}
+	models := make([]string, 0, len(modelAliases)+len(modelPacks))
+	for alias, name := range modelAliases {
+		seen[alias] = true
+		if !packFailedLocked(name) {
+			models = append(models, alias)
+		}
+	}
+	for name := range modelPacks {
+		if !seen[name] && !packFailedLocked(name) {
+			models = append(models, name)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+// ModelInfo is the metadata returned by GET /v1/models/{id}
+type ModelInfo struct {
+	ID            string              `json:"id"`
+	Object        string              `json:"object"`
+	Pack          string              `json:"pack"`
+	SampleRate    int                 `json:"sample_rate"`
+	Languages     []string            `json:"languages"`
+	LanguagePacks []LanguageSummary   `json:"language_packs,omitempty"`
+	Voices        []string            `json:"voices"`
+	VoiceStyles   map[string][]string `json:"language_voice_styles,omitempty"`
+	MaxInputChars int                 `json:"max_input_chars"`
+	MaxChunkChars map[string]int      `json:"max_chunk_chars"`
+	Steps         ModelRange          `json:"steps"`
+	Speed         ModelRange          `json:"speed"`
+	Metadata      map[string]string   `json:"metadata,omitempty"`
+}
+
+// LanguageSummary describes a language added by a language pack
+type LanguageSummary struct {
+	Code string `json:"code"`
+	Name string `json:"name,omitempty"`
+	Base string `json:"base"`
+}
+
+// languageSummaries lists the loaded language packs
+func languageSummaries() []LanguageSummary {
+	var summaries []LanguageSummary
+	for _, pack := range tts.LanguagePacks() {
+		summaries = append(summaries, LanguageSummary{Code: pack.Code, Name: pack.Name, Base: pack.Base})
+	}
+	return summaries
+}
+
+// handleModels serves GET /v1/models: the OpenAI-style model list, with the
+// languages every model speaks
+func handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := []map[string]interface{}{}
+	for _, id := range availableModels() {
+		data = append(data, map[string]interface{}{
+			"id":        id,
+			"object":    "model",
+			"owned_by":  "supertonic",
+			"languages": tts.AvailableLangs,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"object":         "list",
+		"data":           data,
+		"language_packs": languageSummaries(),
+	})
+}
+
+// ModelRange is the accepted range and server default of a numeric parameter
+type ModelRange struct {
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Default float64 `json:"default"`
+}
+
+// handleModelInfo serves GET /v1/models/{id}: the sample rate, languages,
+// voices and limits of a model (alias or pack name), plus the version strings
+// embedded in its tts.json, so clients can adapt without hard-coding them
+func handleModelInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PathValue("id")
+	pack, err := resolveModelPack(id)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	info, err := modelInfo(id, pack)
+	if err != nil {
+		sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// modelInfo reads a pack's configuration and voices
+func modelInfo(id string, pack ModelPack) (ModelInfo, error) {
+	cfg, err := tts.LoadCfgs(pack.Dir)
+	if err != nil {
+		return ModelInfo{}, err
+	}
+
+	info := ModelInfo{
+		ID:            id,
+		Object:        "model",
+		Pack:          pack.Name,
+		SampleRate:    cfg.AE.SampleRate,
+		Languages:     tts.AvailableLangs,
+		LanguagePacks: languageSummaries(),
+		MaxInputChars: config.MaxInputChars,
+		MaxChunkChars: map[string]int{},
+		Steps:         ModelRange{Min: 1, Max: 64, Default: float64(config.TotalStep)},
+		Speed:         ModelRange{Min: 0.25, Max: 4.0, Default: config.DefaultSpeed},
+		Metadata:      map[string]string{},
+	}
+	for _, lang := range tts.AvailableLangs {
+		info.MaxChunkChars[lang] = tts.ChunkLimit(lang)
+	}
+	for _, voice := range sortedVoices() {
+		if _, err := tts.GetVoicePath(voice, pack.Dir); err == nil {
+			info.Voices = append(info.Voices, voice)
+		}
+		// Voices with a style tuned for a language, e.g. voice_styles/ko/F1.json
+		for _, lang := range tts.AvailableLangs {
+			if tts.AssetExists(filepath.Join(pack.Dir, "voice_styles", lang, tts.VoiceMapping[voice])) {
+				if info.VoiceStyles == nil {
+					info.VoiceStyles = map[string][]string{}
+				}
+				info.VoiceStyles[lang] = append(info.VoiceStyles[lang], voice)
+			}
+		}
+	}
+
+	// Top-level strings in tts.json carry the export's version information
+	data, err := tts.ReadAsset(filepath.Join(pack.Dir, "onnx", "tts.json"))
+	if err != nil {
+		return ModelInfo{}, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return ModelInfo{}, fmt.Errorf("failed to parse tts.json: %w", err)
+	}
+	for key, raw := range fields {
+		var value string
+		if json.Unmarshal(raw, &value) == nil {
+			info.Metadata[key] = value
+		}
+	}
+	return info, nil
+}
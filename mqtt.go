@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types
+const (
+	mqttConnect    = 1
+	mqttConnAck    = 2
+	mqttPublish    = 3
+	mqttPubAck     = 4
+	mqttSubscribe  = 8
+	mqttSubAck     = 9
+	mqttPingReq    = 12
+	mqttPingResp   = 13
+	mqttDisconnect = 14
+)
+
+// mqttKeepAlive is the keep-alive interval announced to the broker
+const mqttKeepAlive = 60 * time.Second
+
+// MQTTConfig holds the announce integration settings
+type MQTTConfig struct {
+	Broker      string // tcp://host:1883
+	Topic       string // subscribed topic carrying text (or JSON speech requests)
+	OutputTopic string // topic the result is published to
+	Publish     string // "audio" publishes the audio bytes, "url" saves it and publishes a JSON link
+	ClientID    string
+	Username    string
+	Password    string
+}
+
+// mqttClient is a minimal MQTT 3.1.1 client: QoS 0 publishing and QoS 0/1 delivery
+type mqttClient struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+	nextID  uint16
+}
+
+// validateMQTTConfig checks the MQTT flags
+func validateMQTTConfig() error {
+	if config.MQTT.Broker == "" {
+		return nil
+	}
+	u, err := url.Parse(config.MQTT.Broker)
+	if err != nil || (u.Scheme != "tcp" && u.Scheme != "mqtt") || u.Host == "" {
+		return fmt.Errorf("--mqtt-broker must look like tcp://host:1883")
+	}
+	if config.MQTT.Topic == "" || config.MQTT.OutputTopic == "" {
+		return fmt.Errorf("--mqtt-topic and --mqtt-output-topic are required")
+	}
+	switch config.MQTT.Publish {
+	case "audio":
+	case "url":
+		if !storageEnabled() {
+			return fmt.Errorf("--mqtt-publish=url requires --save-dir or --s3-bucket")
+		}
+	default:
+		return fmt.Errorf("--mqtt-publish must be audio or url")
+	}
+	return nil
+}
+
+// runMQTT keeps an MQTT session alive, reconnecting with backoff, and answers
+// every message on the input topic with synthesized audio on the output topic
+func runMQTT() {
+	backoff := time.Second
+	for {
+		started := time.Now()
+		err := mqttSession()
+		log.Printf("MQTT: session ended: %v", err)
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		time.Sleep(backoff)
+		backoff = min(backoff*2, time.Minute)
+	}
+}
+
+// mqttSession connects, subscribes and processes messages until the connection fails
+func mqttSession() error {
+	u, _ := url.Parse(config.MQTT.Broker)
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "1883")
+	}
+
+	conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	client := &mqttClient{conn: conn, reader: bufio.NewReader(conn)}
+	defer conn.Close()
+
+	if err := client.connect(); err != nil {
+		return err
+	}
+	if err := client.subscribe(config.MQTT.Topic); err != nil {
+		return err
+	}
+	log.Printf("MQTT: connected to %s, listening on %s", host, config.MQTT.Topic)
+
+	done := make(chan struct{})
+	defer close(done)
+	go client.keepAlive(done)
+
+	// Announcements are synthesized in arrival order without blocking the reader
+	messages := make(chan []byte, 32)
+	defer close(messages)
+	go func() {
+		for payload := range messages {
+			client.announce(payload)
+		}
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(mqttKeepAlive * 3 / 2))
+		packetType, flags, body, err := client.readPacket()
+		if err != nil {
+			return err
+		}
+
+		switch packetType {
+		case mqttPublish:
+			payload, packetID, err := parsePublish(flags, body)
+			if err != nil {
+				return err
+			}
+			if packetID != nil {
+				client.writePacket(mqttPubAck<<4, packetID)
+			}
+			select {
+			case messages <- payload:
+			default:
+				log.Printf("MQTT: announcement queue full, dropping message")
+			}
+		case mqttPingResp, mqttSubAck:
+		}
+	}
+}
+
+// announce synthesizes one message and publishes the result
+func (c *mqttClient) announce(payload []byte) {
+	var req TTSRequest
+	text := strings.TrimSpace(string(payload))
+	if strings.HasPrefix(text, "{") {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			log.Printf("MQTT: invalid JSON request: %v", err)
+			return
+		}
+	} else {
+		req.Input = text
+	}
+	if err := validateRequest(&req); err != nil {
+		log.Printf("MQTT: invalid request: %v", err)
+		return
+	}
+
+	log.Printf("MQTT: announcing voice=%s, text=\"%.50s\"", req.Voice, req.Input)
+	audioData, err := generateSpeech(&req)
+	if err != nil {
+		log.Printf("MQTT: speech generation failed: %v", err)
+		return
+	}
+
+	result := audioData
+	if config.MQTT.Publish == "url" {
+		audioURL, err := storeAudio(newAudioName(req.ResponseFormat), audioData, contentTypeFor(req.ResponseFormat), config.BaseURL)
+		if err != nil {
+			log.Printf("MQTT: %v", err)
+			return
+		}
+		result, _ = json.Marshal(map[string]interface{}{
+			"url":          audioURL,
+			"text":         req.Input,
+			"voice":        req.Voice,
+			"content_type": contentTypeFor(req.ResponseFormat),
+		})
+	}
+	if err := c.publish(config.MQTT.OutputTopic, result); err != nil {
+		log.Printf("MQTT: publish failed: %v", err)
+	}
+}
+
+// connect sends CONNECT and waits for a successful CONNACK
+func (c *mqttClient) connect() error {
+	clientID := config.MQTT.ClientID
+	if clientID == "" {
+		clientID = "supertonic-" + newJobID()[4:12]
+	}
+
+	flags := byte(0x02) // clean session
+	payload := mqttString(clientID)
+	if config.MQTT.Username != "" {
+		flags |= 0x80
+		payload = append(payload, mqttString(config.MQTT.Username)...)
+		if config.MQTT.Password != "" {
+			flags |= 0x40
+			payload = append(payload, mqttString(config.MQTT.Password)...)
+		}
+	}
+
+	keepAlive := int(mqttKeepAlive.Seconds())
+	body := append(mqttString("MQTT"), 4, flags, byte(keepAlive>>8), byte(keepAlive))
+	if err := c.writePacket(mqttConnect<<4, append(body, payload...)); err != nil {
+		return err
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	packetType, _, ack, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if packetType != mqttConnAck || len(ack) < 2 {
+		return fmt.Errorf("unexpected packet %d waiting for CONNACK", packetType)
+	}
+	if ack[1] != 0 {
+		return fmt.Errorf("broker refused connection (code %d)", ack[1])
+	}
+	return nil
+}
+
+// subscribe requests QoS 1 delivery of a topic filter
+func (c *mqttClient) subscribe(topic string) error {
+	c.nextID++
+	body := []byte{byte(c.nextID >> 8), byte(c.nextID)}
+	body = append(append(body, mqttString(topic)...), 1)
+	return c.writePacket(mqttSubscribe<<4|0x02, body)
+}
+
+// publish sends a QoS 0 message
+func (c *mqttClient) publish(topic string, payload []byte) error {
+	return c.writePacket(mqttPublish<<4, append(mqttString(topic), payload...))
+}
+
+// keepAlive pings the broker until done is closed
+func (c *mqttClient) keepAlive(done chan struct{}) {
+	ticker := time.NewTicker(mqttKeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			c.writePacket(mqttDisconnect<<4, nil)
+			return
+		case <-ticker.C:
+			if err := c.writePacket(mqttPingReq<<4, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writePacket sends one control packet
+func (c *mqttClient) writePacket(header byte, body []byte) error {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(append(packet, body...))
+	return err
+}
+
+// readPacket reads one control packet, returning its type, flags and body
+func (c *mqttClient) readPacket() (byte, byte, []byte, error) {
+	header, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		length += int(b&0x7F) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, 0, nil, fmt.Errorf("malformed remaining length")
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return header >> 4, header & 0x0F, body, nil
+}
+
+// parsePublish splits a PUBLISH body into its payload and, for QoS 1+, the packet ID to acknowledge
+func parsePublish(flags byte, body []byte) ([]byte, []byte, error) {
+	if len(body) < 2 {
+		return nil, nil, fmt.Errorf("malformed PUBLISH packet")
+	}
+	rest := body[2:]
+	topicLen := int(body[0])<<8 | int(body[1])
+	if len(rest) < topicLen {
+		return nil, nil, fmt.Errorf("malformed PUBLISH packet")
+	}
+	rest = rest[topicLen:]
+
+	if (flags>>1)&3 == 0 {
+		return rest, nil, nil
+	}
+	if len(rest) < 2 {
+		return nil, nil, fmt.Errorf("malformed PUBLISH packet")
+	}
+	return rest[2:], rest[:2], nil
+}
+
+// mqttString encodes a length-prefixed UTF-8 string
+func mqttString(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go-supertonic/tts"
+)
+
+// pacePresets are common narration rates in words per minute
+var pacePresets = map[string]float64{
+	"slow":         120,
+	"presentation": 130,
+	"elearning":    150,
+	"audiobook":    155,
+	"news":         170,
+	"fast":         190,
+}
+
+// wordPattern matches a spoken word; markup such as <en> or [bleep] is removed first
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+([.,'’][\p{L}\p{N}]+)*`)
+
+// markupPattern matches inline tags, audio tokens and the respelling half of
+// {{word|respelling}}, which are not words
+var markupPattern = regexp.MustCompile(`<[^>]*>|\[[^\]]*\]|\|[^{}|]*\}\}`)
+
+// resolvePace turns a pace preset into a wpm target and validates it. It runs
+// before the speed default is applied, since an explicit speed and a wpm target
+// conflict; applyWPM replaces the default once the predicted duration is known
+func resolvePace(req *TTSRequest) error {
+	if req.Pace != "" {
+		wpm, ok := pacePresets[req.Pace]
+		if !ok {
+			names := make([]string, 0, len(pacePresets))
+			for name := range pacePresets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("pace must be one of %s", strings.Join(names, ", "))
+		}
+		if req.WPM != 0 {
+			return fmt.Errorf("pace and wpm cannot be combined")
+		}
+		req.WPM = wpm
+	}
+	if req.WPM == 0 {
+		return nil
+	}
+	if req.WPM < 60 || req.WPM > 400 {
+		return fmt.Errorf("wpm must be between 60 and 400")
+	}
+	if req.Speed != 0 {
+		return fmt.Errorf("speed and wpm cannot be combined")
+	}
+	return nil
+}
+
+// countWords counts the words of the input as written, so "1,250" is one word
+// even though it is read as four
+func countWords(input string) int {
+	return len(wordPattern.FindAllString(markupPattern.ReplaceAllString(input, " "), -1))
+}
+
+// predictTiming returns the predicted seconds of speech at speed 1 and the
+// seconds of chunk pauses and tones, which speed does not scale
+func predictTiming(textToSpeech *tts.TextToSpeech, text string, req *TTSRequest, style *tts.Style) (float64, float64, error) {
+	chunks, err := textToSpeech.Analyze(text, req.Language, style, 1)
+	if err != nil {
+		return 0, 0, fmt.Errorf("duration prediction failed: %w", err)
+	}
+
+	speech, fixed := 0.0, 0.0
+	for i, chunk := range chunks {
+		if i > 0 && !chunk.JoinsPrevious {
+			fixed += *req.SilenceDuration
+		}
+		if chunk.Tone {
+			fixed += float64(chunk.Duration)
+			continue
+		}
+		speech += float64(chunk.Duration)
+	}
+	return speech, fixed, nil
+}
+
+// durationLimitError reports a request that cannot fit max_duration_seconds
+// even at --max-auto-speed
+type durationLimitError struct {
+	Predicted float64 // seconds at the requested speed
+	Fastest   float64 // seconds at the highest allowed speed
+	Max       float64
+}
+
+func (e *durationLimitError) Error() string {
+	return fmt.Sprintf("predicted duration %.2fs exceeds max_duration_seconds %.2fs (%.2fs at the fastest allowed speed)",
+		e.Predicted, e.Max, e.Fastest)
+}
+
+// applyPacing predicts the request's duration once and adjusts its speed: to
+// meet the wpm target, then to fit max_duration_seconds. It returns the
+// predicted seconds of audio at the final speed
+func applyPacing(req *TTSRequest, textToSpeech *tts.TextToSpeech, text string, style *tts.Style) (float64, error) {
+	speech, fixed, err := predictTiming(textToSpeech, text, req, style)
+	if err != nil {
+		return 0, err
+	}
+	if speech <= 0 {
+		return fixed, nil
+	}
+	if req.WPM > 0 {
+		applyWPM(req, speech, fixed)
+	}
+	if req.MaxDurationSeconds > 0 {
+		if err := fitDuration(req, speech, fixed); err != nil {
+			return 0, err
+		}
+	}
+	return speech/req.Speed + fixed, nil
+}
+
+// applyWPM sets the speed that brings the request to its wpm target. The
+// duration predictor stands in for a syllable count: it already knows how long
+// this voice takes over every syllable of the text
+func applyWPM(req *TTSRequest, speech, fixed float64) {
+	words := countWords(req.Input)
+	if words == 0 {
+		return
+	}
+
+	target := float64(words) / req.WPM * 60
+	speed := 4.0
+	if target > fixed {
+		speed = speech / (target - fixed)
+	}
+	clamped := min(max(speed, 0.25), 4.0)
+	if clamped != speed {
+		log.Printf("wpm %.0f needs speed %.2f; clamped to %.2f", req.WPM, speed, clamped)
+	}
+	req.Speed = clamped
+}
+
+// fitDuration speeds the request up, to at most --max-auto-speed, when its
+// predicted duration is longer than max_duration_seconds
+func fitDuration(req *TTSRequest, speech, fixed float64) error {
+	predicted := speech/req.Speed + fixed
+	if predicted <= req.MaxDurationSeconds {
+		return nil
+	}
+
+	fastest := max(config.MaxAutoSpeed, req.Speed)
+	if req.MaxDurationSeconds <= fixed || speech/(req.MaxDurationSeconds-fixed) > fastest {
+		return &durationLimitError{Predicted: predicted, Fastest: speech/fastest + fixed, Max: req.MaxDurationSeconds}
+	}
+	speed := speech / (req.MaxDurationSeconds - fixed)
+	log.Printf("Predicted duration %.2fs exceeds max_duration_seconds %.2fs; speed %.2f -> %.2f",
+		predicted, req.MaxDurationSeconds, req.Speed, speed)
+	req.Speed = speed
+	return nil
+}
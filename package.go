@@ -0,0 +1,202 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"go-supertonic/tts"
+)
+
+// Job package formats
+const (
+	packageZip = "zip"
+	packageTar = "tar"
+)
+
+// packageContentTypes maps package formats to their MIME types
+var packageContentTypes = map[string]string{
+	packageZip: "application/zip",
+	packageTar: "application/x-tar",
+}
+
+// maxJobItems bounds the number of files in one packaged job
+const maxJobItems = 1000
+
+// JobItem is one output file of a packaged job; voice overrides the job's voice
+type JobItem struct {
+	Name  string `json:"name,omitempty"`
+	Input string `json:"input"`
+	Voice string `json:"voice,omitempty"`
+}
+
+// packageEntry describes one file of a package in manifest.json
+type packageEntry struct {
+	File     string            `json:"file"`
+	Name     string            `json:"name,omitempty"`
+	Text     string            `json:"text"`
+	Voice    string            `json:"voice"`
+	Duration float32           `json:"duration_seconds"`
+	Bytes    int               `json:"bytes"`
+	Skipped  []tts.SkippedSpan `json:"skipped,omitempty"`
+	Quality  *audioQuality     `json:"quality,omitempty"`
+}
+
+// packageManifest is the manifest.json written alongside the audio files
+type packageManifest struct {
+	JobID     string         `json:"job_id"`
+	Model     string         `json:"model"`
+	Format    string         `json:"response_format"`
+	CreatedAt time.Time      `json:"created_at"`
+	Files     []packageEntry `json:"files"`
+}
+
+// packageFileName keeps the characters of an item name that are safe in archive paths
+var packageFileName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// validatePackage checks a job's package format
+func validatePackage(format string) error {
+	if _, ok := packageContentTypes[format]; !ok {
+		return fmt.Errorf("package must be %s or %s", packageZip, packageTar)
+	}
+	return nil
+}
+
+// jobItemRequests validates each item of a packaged job as its own speech
+// request, built from the job's unvalidated settings so defaults apply per item
+func jobItemRequests(base TTSRequest, items []JobItem) ([]TTSRequest, error) {
+	if len(items) > maxJobItems {
+		return nil, fmt.Errorf("items is limited to %d entries", maxJobItems)
+	}
+	requests := make([]TTSRequest, len(items))
+	for i, item := range items {
+		req := base
+		req.Input = item.Input
+		if item.Voice != "" {
+			req.Voice = item.Voice
+		}
+		if err := validateRequest(&req); err != nil {
+			return nil, fmt.Errorf("items[%d]: %w", i, err)
+		}
+		requests[i] = req
+	}
+	return requests, nil
+}
+
+// renderPackage synthesizes every request of a job into an archive written
+// to w as it goes: each file is added once rendered, and manifest.json, which
+// needs every file's duration, comes last. The job's chunk, truncation and
+// skip counters are updated to cover all files
+func renderPackage(w io.Writer, job *Job, requests []TTSRequest, names []string) error {
+	manifest := packageManifest{
+		JobID:     job.ID,
+		Model:     job.request.Model,
+		Format:    job.Format,
+		CreatedAt: job.CreatedAt,
+	}
+	archive := newArchiveWriter(w, job.Package)
+	tenant := requestTenant(&job.request)
+	for i := range requests {
+		// Let other tenants' jobs run between files of a large package
+		if i > 0 {
+			jobSlots.yield(tenant)
+		}
+		req := &requests[i]
+		req.waitForGPU = true
+		result, sampleRate, err := synthesizeSpeech(req, nil)
+		if err != nil {
+			return fmt.Errorf("file %d: %w", i+1, err)
+		}
+		audio, err := convertToFormat(result.Wav, sampleRate, req)
+		if err != nil {
+			return fmt.Errorf("file %d: %w", i+1, err)
+		}
+
+		file := fmt.Sprintf("%03d", i+1)
+		if name := strings.Trim(packageFileName.ReplaceAllString(names[i], "_"), "._"); name != "" {
+			file += "-" + name
+		}
+		file += "." + responseFormats[req.ResponseFormat].Extension
+		// Audio barely compresses, so it is stored
+		if err := archive.add(file, audio, false); err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, packageEntry{
+			File:     file,
+			Name:     names[i],
+			Text:     req.Input,
+			Voice:    req.Voice,
+			Duration: result.Duration,
+			Bytes:    len(audio),
+			Skipped:  req.skipped,
+			Quality:  req.quality,
+		})
+
+		job.request.chunks += req.chunks
+		job.request.truncated = job.request.truncated || req.truncated
+		job.request.skipped = append(job.request.skipped, req.skipped...)
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := archive.add("manifest.json", manifestData, true); err != nil {
+		return err
+	}
+	return archive.close()
+}
+
+// archiveWriter writes the files of a zip or tar package straight to its output
+type archiveWriter struct {
+	zip     *zip.Writer
+	tar     *tar.Writer
+	modTime time.Time
+}
+
+// newArchiveWriter starts a package in format on w
+func newArchiveWriter(w io.Writer, format string) *archiveWriter {
+	a := &archiveWriter{modTime: time.Now()}
+	if format == packageTar {
+		a.tar = tar.NewWriter(w)
+	} else {
+		a.zip = zip.NewWriter(w)
+	}
+	return a
+}
+
+// add appends a file, deflated in a zip when compress is set
+func (a *archiveWriter) add(name string, data []byte, compress bool) error {
+	if a.tar != nil {
+		header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: a.modTime}
+		if err := a.tar.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := a.tar.Write(data)
+		return err
+	}
+
+	method := zip.Store
+	if compress {
+		method = zip.Deflate
+	}
+	w, err := a.zip.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: a.modTime})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// close finishes the archive: the zip central directory or the tar trailer
+func (a *archiveWriter) close() error {
+	if a.tar != nil {
+		return a.tar.Close()
+	}
+	return a.zip.Close()
+}
@@ -0,0 +1,910 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// A minimal PDF text extractor: enough of the object model to walk the page
+// tree, inflate content streams and map glyph codes to text through the fonts'
+// ToUnicode CMaps (or WinAnsi for simple fonts). Scanned PDFs and fonts without
+// a usable encoding yield no text
+
+// PDF object values are nil, bool, float64, pdfName, pdfString, []interface{},
+// pdfDict or pdfRef
+type (
+	pdfName    string
+	pdfString  string
+	pdfKeyword string
+	pdfDict    map[pdfName]interface{}
+	pdfRef     struct{ num int }
+)
+
+// pdfObject is one indirect object with its decoded stream, if any
+type pdfObject struct {
+	value  interface{}
+	stream []byte
+}
+
+// pdfDocument holds the indirect objects of a file by object number
+type pdfDocument struct {
+	objects map[int]*pdfObject
+	decoded int   // bytes inflated from the file's streams so far
+	err     error // set when decoding ran past maxPDFDecoded
+}
+
+// pdfFont decodes the strings shown with one font
+type pdfFont struct {
+	toUnicode map[uint32]string
+	codeBytes int  // bytes per character code
+	composite bool // Type0 font: codes are glyph IDs, undecodable without a CMap
+}
+
+// pdfLine is a line of text with the largest font size used on it
+type pdfLine struct {
+	text string
+	size float64
+	page int
+}
+
+var pdfObjectPattern = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+// maxPDFNesting bounds how deeply arrays and dictionaries nest, so a file of
+// brackets cannot exhaust the stack
+const maxPDFNesting = 256
+
+// maxPDFStream and maxPDFDecoded bound the inflated size of one stream and
+// of all of a file's streams together
+const (
+	maxPDFStream  = 64 << 20
+	maxPDFDecoded = 256 << 20
+)
+
+var errPDFNesting = fmt.Errorf("PDF arrays or dictionaries nested deeper than %d levels", maxPDFNesting)
+
+// extractPDF returns the text of a PDF as sections, starting a new section at
+// each line set noticeably larger than the body text
+func extractPDF(data []byte) ([]docSection, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF")) {
+		return nil, fmt.Errorf("not a PDF file")
+	}
+	doc, err := parsePDF(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []pdfLine
+	for i, page := range doc.pages() {
+		pageLines, err := doc.pageLines(page, i)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, pageLines...)
+	}
+	lines = dropRepeatedLines(lines)
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no extractable text in PDF (scanned or unsupported fonts)")
+	}
+	return pdfSections(lines), nil
+}
+
+// parsePDF indexes every "N G obj" in the file, later definitions replacing
+// earlier ones as incremental updates do, then unpacks object streams
+func parsePDF(data []byte) (*pdfDocument, error) {
+	doc := &pdfDocument{objects: map[int]*pdfObject{}}
+	for _, loc := range pdfObjectPattern.FindAllSubmatchIndex(data, -1) {
+		num, _ := strconv.Atoi(string(data[loc[2]:loc[3]]))
+		lex := &pdfLexer{data: data, pos: loc[1]}
+		value := lex.value()
+		if lex.err != nil {
+			return nil, lex.err
+		}
+		obj := &pdfObject{value: value}
+		if dict, ok := value.(pdfDict); ok {
+			obj.stream = lex.stream(dict)
+		}
+		doc.objects[num] = obj
+	}
+
+	for _, obj := range doc.objects {
+		dict, ok := obj.value.(pdfDict)
+		if !ok || dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		content := doc.decode(dict, obj.stream)
+		if doc.err != nil {
+			return nil, doc.err
+		}
+		count, first := int(pdfNumber(dict["N"])), int(pdfNumber(dict["First"]))
+		if content == nil || first <= 0 || first > len(content) {
+			continue
+		}
+		header := &pdfLexer{data: content[:first]}
+		for i := 0; i < count; i++ {
+			num, offset := pdfNumber(header.value()), pdfNumber(header.value())
+			if _, defined := doc.objects[int(num)]; defined || first+int(offset) >= len(content) {
+				continue
+			}
+			member := &pdfLexer{data: content, pos: first + int(offset)}
+			value := member.value()
+			if member.err != nil {
+				return nil, member.err
+			}
+			doc.objects[int(num)] = &pdfObject{value: value}
+		}
+	}
+	return doc, nil
+}
+
+// resolve follows an indirect reference
+func (doc *pdfDocument) resolve(v interface{}) interface{} {
+	for depth := 0; depth < 16; depth++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		obj := doc.objects[ref.num]
+		if obj == nil {
+			return nil
+		}
+		v = obj.value
+	}
+	return nil
+}
+
+// dict resolves v as a dictionary
+func (doc *pdfDocument) dict(v interface{}) pdfDict {
+	d, _ := doc.resolve(v).(pdfDict)
+	return d
+}
+
+// streamData returns the decoded stream of a referenced object
+func (doc *pdfDocument) streamData(v interface{}) []byte {
+	ref, ok := v.(pdfRef)
+	if !ok || doc.objects[ref.num] == nil {
+		return nil
+	}
+	obj := doc.objects[ref.num]
+	dict, _ := obj.value.(pdfDict)
+	return doc.decode(dict, obj.stream)
+}
+
+// pages returns the page dictionaries in page-tree order, falling back to
+// object order when the file has no readable catalog
+func (doc *pdfDocument) pages() []pdfDict {
+	var pages []pdfDict
+	var walk func(node pdfDict, depth int)
+	walk = func(node pdfDict, depth int) {
+		if node == nil || depth > 32 {
+			return
+		}
+		if node["Type"] == pdfName("Page") {
+			pages = append(pages, node)
+			return
+		}
+		kids, _ := doc.resolve(node["Kids"]).([]interface{})
+		for _, kid := range kids {
+			walk(doc.dict(kid), depth+1)
+		}
+	}
+
+	for _, obj := range doc.objects {
+		if dict, ok := obj.value.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			walk(doc.dict(dict["Pages"]), 0)
+			if len(pages) > 0 {
+				return pages
+			}
+		}
+	}
+
+	nums := make([]int, 0, len(doc.objects))
+	for num := range doc.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		if dict, ok := doc.objects[num].value.(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			pages = append(pages, dict)
+		}
+	}
+	return pages
+}
+
+// inherited returns a page attribute, looking up the page tree when the page lacks it
+func (doc *pdfDocument) inherited(page pdfDict, key pdfName) interface{} {
+	for depth := 0; page != nil && depth < 32; depth++ {
+		if v, ok := page[key]; ok {
+			return v
+		}
+		page = doc.dict(page["Parent"])
+	}
+	return nil
+}
+
+// pageFonts loads the fonts of a page's resources by resource name
+func (doc *pdfDocument) pageFonts(page pdfDict) map[pdfName]*pdfFont {
+	fonts := map[pdfName]*pdfFont{}
+	resources := doc.dict(doc.inherited(page, "Resources"))
+	for name, ref := range doc.dict(resources["Font"]) {
+		font := doc.dict(ref)
+		f := &pdfFont{codeBytes: 1, composite: font["Subtype"] == pdfName("Type0")}
+		if f.composite {
+			f.codeBytes = 2
+		}
+		if cmap := doc.streamData(font["ToUnicode"]); cmap != nil {
+			f.toUnicode, f.codeBytes = parseToUnicode(cmap, f.codeBytes)
+		}
+		fonts[name] = f
+	}
+	return fonts
+}
+
+// pageLines runs a page's content streams and collects its text lines
+func (doc *pdfDocument) pageLines(page pdfDict, index int) ([]pdfLine, error) {
+	var content []byte
+	switch contents := doc.resolve(page["Contents"]).(type) {
+	case []interface{}:
+		for _, ref := range contents {
+			content = append(append(content, doc.streamData(ref)...), '\n')
+		}
+	case pdfDict:
+		content = doc.streamData(page["Contents"])
+	}
+	fonts := doc.pageFonts(page)
+	if doc.err != nil {
+		return nil, doc.err
+	}
+	return runContentStream(content, fonts, index)
+}
+
+// runContentStream interprets the text operators of a content stream
+func runContentStream(content []byte, fonts map[pdfName]*pdfFont, page int) ([]pdfLine, error) {
+	var lines []pdfLine
+	var line strings.Builder
+	lineSize := 0.0
+	font := &pdfFont{codeBytes: 1}
+	fontSize, scale := 12.0, 1.0
+
+	flush := func() {
+		if text := strings.Join(strings.Fields(line.String()), " "); text != "" {
+			lines = append(lines, pdfLine{text: text, size: lineSize, page: page})
+		}
+		line.Reset()
+		lineSize = 0
+	}
+	show := func(s pdfString) {
+		line.WriteString(font.decode(string(s)))
+		lineSize = math.Max(lineSize, fontSize*scale)
+	}
+	space := func() {
+		if line.Len() > 0 {
+			line.WriteByte(' ')
+		}
+	}
+
+	lex := &pdfLexer{data: content}
+	var operands []interface{}
+	for {
+		v, ok := lex.operand()
+		if !ok {
+			break
+		}
+		op, isOp := v.(pdfKeyword)
+		if !isOp {
+			operands = append(operands, v)
+			continue
+		}
+
+		arg := func(i int) float64 {
+			if i < len(operands) {
+				return pdfNumber(operands[i])
+			}
+			return 0
+		}
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				name, _ := operands[0].(pdfName)
+				if f := fonts[name]; f != nil {
+					font = f
+				}
+				fontSize = math.Abs(arg(1))
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				flush()
+				scale = math.Max(math.Hypot(arg(0), arg(1)), math.Hypot(arg(2), arg(3)))
+			}
+		case "Td", "TD":
+			if arg(1) != 0 {
+				flush()
+			} else {
+				space()
+			}
+		case "T*", "ET":
+			flush()
+		case "Tj":
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					show(s)
+				}
+			}
+		case "'", "\"":
+			flush()
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					show(s)
+				}
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				items, _ := operands[len(operands)-1].([]interface{})
+				for _, item := range items {
+					switch item := item.(type) {
+					case pdfString:
+						show(item)
+					case float64:
+						// Adjustments are in thousandths of an em; a large gap is a word break
+						if item < -200 {
+							space()
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	if lex.err != nil {
+		return nil, lex.err
+	}
+	flush()
+	return lines, nil
+}
+
+// decode maps the character codes of a shown string to text
+func (f *pdfFont) decode(s string) string {
+	if f.toUnicode == nil {
+		if f.composite {
+			return ""
+		}
+		return winAnsiString(s)
+	}
+
+	var b strings.Builder
+	for i := 0; i+f.codeBytes <= len(s); i += f.codeBytes {
+		code := uint32(0)
+		for _, c := range []byte(s[i : i+f.codeBytes]) {
+			code = code<<8 | uint32(c)
+		}
+		if text, ok := f.toUnicode[code]; ok {
+			b.WriteString(text)
+		} else if f.codeBytes == 1 {
+			b.WriteString(winAnsiString(s[i : i+1]))
+		}
+	}
+	return b.String()
+}
+
+// winAnsiHigh maps the WinAnsiEncoding codes 0x80-0x9F that differ from Latin-1
+var winAnsiHigh = map[byte]rune{
+	0x80: '€', 0x85: '…', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”',
+	0x95: '•', 0x96: '–', 0x97: '—', 0x99: '™',
+}
+
+// winAnsiString decodes single-byte text as WinAnsiEncoding
+func winAnsiString(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case c >= 0x80 && c <= 0x9F:
+			if r, ok := winAnsiHigh[c]; ok {
+				b.WriteRune(r)
+			}
+		case c >= 0x20 || c == '\t':
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
+
+// parseToUnicode reads the bfchar and bfrange mappings of a ToUnicode CMap,
+// returning them with the code width declared by its codespace range
+func parseToUnicode(cmap []byte, codeBytes int) (map[uint32]string, int) {
+	mapping := map[uint32]string{}
+	lex := &pdfLexer{data: cmap}
+	var operands []interface{}
+	section := ""
+	for {
+		v, ok := lex.operand()
+		if !ok {
+			break
+		}
+		op, isOp := v.(pdfKeyword)
+		if !isOp {
+			operands = append(operands, v)
+			continue
+		}
+
+		switch op {
+		case "begincodespacerange", "beginbfchar", "beginbfrange":
+			section = string(op)
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if lo, ok := operands[0].(pdfString); ok && len(lo) > 0 {
+					codeBytes = len(lo)
+				}
+			}
+			section = ""
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, _ := operands[i].(pdfString)
+				dst, _ := operands[i+1].(pdfString)
+				mapping[pdfCode(src)] = utf16BEString(string(dst))
+			}
+			section = ""
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, _ := operands[i].(pdfString)
+				hi, _ := operands[i+1].(pdfString)
+				start, end := pdfCode(lo), pdfCode(hi)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					base := []rune(utf16BEString(string(dst)))
+					if len(base) == 0 {
+						continue
+					}
+					for code := start; code <= end; code++ {
+						r := append([]rune(nil), base...)
+						r[len(r)-1] += rune(code - start)
+						mapping[code] = string(r)
+					}
+				case []interface{}:
+					for j, item := range dst {
+						if s, ok := item.(pdfString); ok && start+uint32(j) <= end {
+							mapping[start+uint32(j)] = utf16BEString(string(s))
+						}
+					}
+				}
+			}
+			section = ""
+		}
+		if section == "" || op == pdfKeyword(section) {
+			operands = operands[:0]
+		}
+	}
+	return mapping, codeBytes
+}
+
+// pdfCode reads a big-endian character code
+func pdfCode(s pdfString) uint32 {
+	code := uint32(0)
+	for _, c := range []byte(s) {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+// utf16BEString decodes a CMap destination string
+func utf16BEString(s string) string {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// decode inflates a FlateDecode stream; other filters (images) are not needed
+// for text. Past maxPDFDecoded for the whole file it fails the document
+func (doc *pdfDocument) decode(dict pdfDict, raw []byte) []byte {
+	filter := dict["Filter"]
+	if filters, ok := filter.([]interface{}); ok && len(filters) == 1 {
+		filter = filters[0]
+	}
+	switch filter {
+	case nil:
+		return raw
+	case pdfName("FlateDecode"):
+		r, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil
+		}
+		defer r.Close()
+		// Truncated streams are common; keep what inflated
+		remaining := maxPDFDecoded - doc.decoded
+		out, _ := io.ReadAll(io.LimitReader(r, int64(min(maxPDFStream, remaining)+1)))
+		if len(out) > remaining {
+			doc.err = fmt.Errorf("PDF streams inflate to more than %d MB", maxPDFDecoded>>20)
+			return nil
+		}
+		out = out[:min(len(out), maxPDFStream)]
+		doc.decoded += len(out)
+		return out
+	}
+	return nil
+}
+
+// pdfNumber returns a numeric value, or 0
+func pdfNumber(v interface{}) float64 {
+	n, _ := v.(float64)
+	return n
+}
+
+// pdfLexer tokenizes PDF syntax, both object bodies and content streams
+type pdfLexer struct {
+	data  []byte
+	pos   int
+	depth int   // arrays and dictionaries being parsed
+	err   error // set when they nest deeper than maxPDFNesting
+}
+
+// isPDFSpace and isPDFDelimiter classify bytes as the PDF grammar does
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// skipSpace skips whitespace and comments
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// token returns the next token: a value other than an array or dictionary,
+// or a pdfKeyword (operators, R, obj and the delimiters [ ] << >>)
+func (l *pdfLexer) token() (interface{}, bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, false
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '(':
+		return l.literalString(), true
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		return pdfKeyword("<<"), true
+	case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+		l.pos += 2
+		return pdfKeyword(">>"), true
+	case c == '<':
+		return l.hexString(), true
+	case c == '[' || c == ']' || c == '{' || c == '}':
+		l.pos++
+		return pdfKeyword(string(c)), true
+	case c == '/':
+		l.pos++
+		return pdfName(l.word()), true
+	}
+
+	word := l.word()
+	if word == "" {
+		l.pos++ // stray delimiter
+		return pdfKeyword(string(c)), true
+	}
+	if n, err := strconv.ParseFloat(word, 64); err == nil {
+		return n, true
+	}
+	switch word {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	case "null":
+		return nil, true
+	}
+	return pdfKeyword(word), true
+}
+
+// word reads a run of regular characters
+func (l *pdfLexer) word() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// literalString reads a (...) string with its escapes and balanced parentheses
+func (l *pdfLexer) literalString() pdfString {
+	var b []byte
+	depth := 0
+	for l.pos++; l.pos < len(l.data); l.pos++ {
+		c := l.data[l.pos]
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				l.pos++
+				return pdfString(b)
+			}
+			depth--
+		case '\\':
+			l.pos++
+			if l.pos >= len(l.data) {
+				return pdfString(b)
+			}
+			e := l.data[l.pos]
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				if e == '\r' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					n := 0
+					for k := 0; k < 3 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; k++ {
+						n = n*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					l.pos--
+					c = byte(n)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return pdfString(b)
+}
+
+// hexString reads a <...> string
+func (l *pdfLexer) hexString() pdfString {
+	var digits []byte
+	for l.pos++; l.pos < len(l.data) && l.data[l.pos] != '>'; l.pos++ {
+		if c := l.data[l.pos]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, len(digits)/2)
+	for i := range b {
+		v, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		b[i] = byte(v)
+	}
+	return pdfString(b)
+}
+
+// value parses one complete value, combining "num gen R" into a pdfRef
+func (l *pdfLexer) value() interface{} {
+	tok, ok := l.token()
+	if !ok {
+		return nil
+	}
+	return l.complete(tok)
+}
+
+// nest enters an array or dictionary; past maxPDFNesting it stops the lexer
+// with errPDFNesting
+func (l *pdfLexer) nest() bool {
+	if l.depth >= maxPDFNesting {
+		l.err = errPDFNesting
+		l.pos = len(l.data)
+		return false
+	}
+	l.depth++
+	return true
+}
+
+// complete finishes the value that starts with tok
+func (l *pdfLexer) complete(tok interface{}) interface{} {
+	switch t := tok.(type) {
+	case pdfKeyword:
+		if (t == "[" || t == "<<") && !l.nest() {
+			return nil
+		}
+		switch t {
+		case "[":
+			defer func() { l.depth-- }()
+			var items []interface{}
+			for {
+				next, ok := l.token()
+				if !ok || next == pdfKeyword("]") {
+					return items
+				}
+				items = append(items, l.complete(next))
+			}
+		case "<<":
+			defer func() { l.depth-- }()
+			dict := pdfDict{}
+			for {
+				key, ok := l.token()
+				if !ok || key == pdfKeyword(">>") {
+					return dict
+				}
+				if name, isName := key.(pdfName); isName {
+					dict[name] = l.value()
+				}
+			}
+		}
+	case float64:
+		// Look ahead for an indirect reference
+		save := l.pos
+		gen, ok1 := l.token()
+		r, ok2 := l.token()
+		if _, isNum := gen.(float64); ok1 && ok2 && isNum && r == pdfKeyword("R") {
+			return pdfRef{num: int(t)}
+		}
+		l.pos = save
+	}
+	return tok
+}
+
+// operand returns the next content-stream operand or operator. Arrays and
+// dictionaries are parsed whole; inline image data (BI ... ID ... EI) is skipped
+func (l *pdfLexer) operand() (interface{}, bool) {
+	tok, ok := l.token()
+	if !ok {
+		return nil, false
+	}
+	if tok == pdfKeyword("ID") {
+		if end := bytes.Index(l.data[l.pos:], []byte("EI")); end >= 0 {
+			l.pos += end + 2
+		} else {
+			l.pos = len(l.data)
+		}
+		return pdfKeyword("EI"), true
+	}
+	if kw, isKw := tok.(pdfKeyword); isKw && kw != "[" && kw != "<<" {
+		return kw, true
+	}
+	if _, isNum := tok.(float64); isNum {
+		return tok, true // no references in content streams
+	}
+	return l.complete(tok), true
+}
+
+// stream reads the stream data following a dictionary, if any
+func (l *pdfLexer) stream(dict pdfDict) []byte {
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		return nil
+	}
+	start := l.pos + len("stream")
+	if start < len(l.data) && l.data[start] == '\r' {
+		start++
+	}
+	if start < len(l.data) && l.data[start] == '\n' {
+		start++
+	}
+
+	if length, ok := dict["Length"].(float64); ok {
+		end := start + int(length)
+		if end <= len(l.data) && bytes.Contains(l.data[end:min(end+32, len(l.data))], []byte("endstream")) {
+			return l.data[start:end]
+		}
+	}
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil
+	}
+	return bytes.TrimRight(l.data[start:start+end], "\r\n")
+}
+
+// pageNumberPattern matches running page numbers such as "12" or "Page 3 of 10"
+var pageNumberPattern = regexp.MustCompile(`(?i)^(page\s*)?\d+(\s*(of|/)\s*\d+)?$`)
+
+// dropRepeatedLines removes page numbers and running headers and footers:
+// lines that recur, digits aside, on more than half of the pages
+func dropRepeatedLines(lines []pdfLine) []pdfLine {
+	digits := regexp.MustCompile(`\d+`)
+	pagesWith := map[string]map[int]bool{}
+	pages := map[int]bool{}
+	for _, line := range lines {
+		key := digits.ReplaceAllString(line.text, "#")
+		if pagesWith[key] == nil {
+			pagesWith[key] = map[int]bool{}
+		}
+		pagesWith[key][line.page] = true
+		pages[line.page] = true
+	}
+
+	kept := lines[:0]
+	for _, line := range lines {
+		key := digits.ReplaceAllString(line.text, "#")
+		if pageNumberPattern.MatchString(line.text) {
+			continue
+		}
+		if len(pages) >= 3 && len(pagesWith[key])*2 > len(pages) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return kept
+}
+
+// pdfSections groups lines into sections, taking lines set at least a quarter
+// larger than the body size (the most common size by text length) as headings.
+// Lines join into running text, rejoining words hyphenated across lines
+func pdfSections(lines []pdfLine) []docSection {
+	weight := map[float64]int{}
+	for _, line := range lines {
+		weight[math.Round(line.size*2)/2] += len(line.text)
+	}
+	body, best := 0.0, -1
+	for size, w := range weight {
+		if w > best || (w == best && size < body) {
+			body, best = size, w
+		}
+	}
+
+	var sections []docSection
+	current := &docSection{}
+	var text strings.Builder
+	finish := func() {
+		current.Text = strings.TrimSpace(text.String())
+		if current.Title != "" || current.Text != "" {
+			sections = append(sections, *current)
+		}
+		text.Reset()
+	}
+	for _, line := range lines {
+		if body > 0 && line.size >= body*1.25 && len(line.text) <= 120 {
+			// Consecutive heading lines are one wrapped title
+			if text.Len() == 0 && current.Title != "" {
+				current.Title += " " + line.text
+				continue
+			}
+			finish()
+			current = &docSection{Title: line.text}
+			continue
+		}
+		s := text.String()
+		switch {
+		case text.Len() == 0:
+		case strings.HasSuffix(s, "-") && len(s) > 1 && isLetterByte(s[len(s)-2]) && line.text[0] >= 'a' && line.text[0] <= 'z':
+			text.Reset()
+			text.WriteString(s[:len(s)-1])
+		default:
+			text.WriteByte(' ')
+		}
+		text.WriteString(line.text)
+	}
+	finish()
+	return sections
+}
+
+// isLetterByte reports whether an ASCII byte is a letter
+func isLetterByte(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// playerCandidates lists the WAV players tried per platform, in order. Playback
+// uses the system's player rather than an audio library so the binary stays
+// cgo-free and needs no sound headers to build. PowerShell reads the path from
+// playFileEnv: arguments after -Command become part of the script, so a path
+// with quotes (a user named O'Brien) must never be spliced into it
+var playerCandidates = map[string][][]string{
+	"darwin":  {{"afplay"}},
+	"windows": {{"powershell", "-NoProfile", "-Command", "(New-Object Media.SoundPlayer $env:" + playFileEnv + ").PlaySync()"}},
+	"linux":   {{"pw-play"}, {"paplay"}, {"aplay", "-q"}, {"ffplay", "-nodisp", "-autoexit", "-loglevel", "quiet"}},
+}
+
+// playFileEnv is the environment variable holding the WAV file's path for the player
+const playFileEnv = "SUPERTONIC_PLAY_FILE"
+
+// findPlayer returns the command used to play a WAV file. An explicit player
+// command line (e.g. "mpv --no-video") wins over auto-detection. The file is
+// appended as the last argument unless an argument contains {file} or reads
+// the path from $SUPERTONIC_PLAY_FILE
+func findPlayer(player string) ([]string, error) {
+	if player != "" {
+		return strings.Fields(player), nil
+	}
+	candidates, ok := playerCandidates[runtime.GOOS]
+	if !ok {
+		candidates = playerCandidates["linux"]
+	}
+	for _, candidate := range candidates {
+		if _, err := exec.LookPath(candidate[0]); err == nil {
+			return candidate, nil
+		}
+	}
+	return nil, fmt.Errorf("no audio player found (tried %v); set --player or SUPERTONIC_PLAYER", candidates)
+}
+
+// playAudio plays WAV data on the default audio device and waits for it to finish
+func playAudio(audioData []byte, player string) error {
+	command, err := findPlayer(player)
+	if err != nil {
+		return err
+	}
+
+	tmpfile, err := os.CreateTemp("", "supertonic-*.wav")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpfile.Name())
+	if _, err := tmpfile.Write(audioData); err != nil {
+		tmpfile.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	tmpfile.Close()
+
+	args := append([]string{}, command[1:]...)
+	substituted := false
+	for i, arg := range args {
+		if strings.Contains(arg, "{file}") {
+			args[i] = strings.ReplaceAll(arg, "{file}", tmpfile.Name())
+			substituted = true
+		} else if strings.Contains(arg, playFileEnv) {
+			substituted = true
+		}
+	}
+	if !substituted {
+		args = append(args, tmpfile.Name())
+	}
+
+	cmd := exec.Command(command[0], args...)
+	cmd.Env = append(os.Environ(), playFileEnv+"="+tmpfile.Name())
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("audio player %s failed: %w", command[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+)
+
+// handlePreviewResponse renders a fast low-step preview and flushes it to the
+// client immediately. When req.Final is set, the full-step render for the same
+// text and seed follows in the same multipart/mixed response; otherwise the
+// client can request it later by resending the request with the returned seed
+func handlePreviewResponse(w http.ResponseWriter, req *TTSRequest) {
+	preview := *req
+	preview.Steps = req.PreviewSteps
+	if preview.Steps > req.Steps {
+		preview.Steps = req.Steps
+	}
+	fixed := false
+	preview.AdaptiveSteps = &fixed // a preview uses exactly its few steps
+
+	previewData, err := generateSpeech(&preview)
+	if err != nil {
+		log.Printf("TTS Error (preview): %v", err)
+		sendError(w, "Speech generation failed: "+err.Error(), speechErrorStatus(w, err))
+		return
+	}
+
+	w.Header().Set("X-Supertonic-Seed", strconv.FormatInt(req.Seed, 10))
+	w.Header().Set("X-Supertonic-Preview-Steps", strconv.Itoa(preview.Steps))
+
+	if !req.Final {
+		w.Header().Set("Content-Type", contentTypeFor(req.ResponseFormat))
+		w.Write(previewData)
+		return
+	}
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	flusher, _ := w.(http.Flusher)
+
+	if err := writeAudioPart(mw, "preview", preview.Steps, req.ResponseFormat, previewData); err != nil {
+		log.Printf("Failed to write preview part: %v", err)
+		return
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	finalData, err := generateSpeech(req)
+	if err != nil {
+		// Headers are already sent, so report the failure as a part of its own
+		log.Printf("TTS Error (final): %v", err)
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", "application/json")
+		header.Set("X-Supertonic-Render", "error")
+		if part, perr := mw.CreatePart(header); perr == nil {
+			fmt.Fprintf(part, "{\"error\":%q}", "Speech generation failed: "+err.Error())
+		}
+		mw.Close()
+		return
+	}
+
+	if err := writeAudioPart(mw, "final", req.Steps, req.ResponseFormat, finalData); err != nil {
+		log.Printf("Failed to write final part: %v", err)
+		return
+	}
+	mw.Close()
+}
+
+// writeAudioPart writes one render as a multipart part
+func writeAudioPart(mw *multipart.Writer, render string, steps int, format string, audioData []byte) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentTypeFor(format))
+	header.Set("X-Supertonic-Render", render)
+	header.Set("X-Supertonic-Steps", strconv.Itoa(steps))
+
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(audioData)
+	return err
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// regressCorpus is the built-in regression corpus: plain prose, numbers,
+// a question, an abbreviation-heavy line and a long multi-chunk sentence
+var regressCorpus = []string{
+	"The quick brown fox jumps over the lazy dog.",
+	"On March 3rd, 2024, the total came to $1,249.50 for 17 items.",
+	"Are you sure you want to delete all of your saved messages?",
+	"Dr. Smith met the CEO of NASA at 10:30 a.m. on Main St.",
+	"When the evening light finally faded behind the hills, the travellers set up camp by the river, lit a small fire, and talked quietly about the long road that still lay ahead of them.",
+}
+
+// Spectrogram settings for the regression comparison (~46 ms frames at 44.1 kHz)
+const (
+	regressFrameSize = 2048
+	regressHop       = 512
+)
+
+// runRegress implements `supertonic regress --baseline dir`: synthesize a fixed
+// corpus with fixed seeds and compare each clip's log-spectral distance and
+// duration against the stored baseline WAVs, exiting non-zero on regressions.
+// --update (re)writes the baselines instead
+func runRegress(args []string) {
+	fs, opts := newCLIFlagSet("regress")
+	baseline := fs.String("baseline", "", "Directory holding the baseline WAVs (required)")
+	update := fs.Bool("update", false, "Write new baselines instead of comparing")
+	corpus := fs.String("corpus", "", "File with one sentence per line (built-in corpus if empty)")
+	voices := fs.String("voices", "F1,M1", "Comma-separated voices to render the corpus with")
+	model := fs.String("model", "", "Model pack to test (default pack if empty)")
+	maxDistance := fs.Float64("max-distance", 2.0, "Largest acceptable mean log-spectral distance in dB")
+	maxDurationChange := fs.Float64("max-duration-change", 0.05, "Largest acceptable relative duration change")
+	fs.Parse(args)
+
+	if *baseline == "" {
+		log.Fatalf("--baseline is required")
+	}
+	sentences := regressCorpus
+	if *corpus != "" {
+		var err error
+		if sentences, err = readCorpus(*corpus); err != nil {
+			log.Fatalf("Failed to read corpus: %v", err)
+		}
+	}
+	if *update {
+		if err := os.MkdirAll(*baseline, 0o755); err != nil {
+			log.Fatalf("Failed to create baseline directory: %v", err)
+		}
+	}
+
+	cleanup := startCLI(opts)
+	defer cleanup()
+	config.SampleFormat = sampleFormatS16
+	config.Dither = ditherNone // dither noise would dominate the spectra of silent frames
+
+	failures, total := 0, 0
+	for i, text := range sentences {
+		for _, voice := range splitList(*voices) {
+			total++
+			name := fmt.Sprintf("%02d-%s.wav", i+1, voice)
+			path := filepath.Join(*baseline, name)
+
+			req := TTSRequest{
+				Model:          *model,
+				Input:          text,
+				Voice:          voice,
+				Language:       *opts.language,
+				Speed:          *opts.speed,
+				Seed:           int64(1000 + i),
+				ResponseFormat: formatWAV,
+			}
+			if err := validateRequest(&req); err != nil {
+				log.Fatalf("%s: %v", name, err)
+			}
+			audioData, err := generateSpeech(&req)
+			if err != nil {
+				failures++
+				fmt.Fprintf(cliStdout, "FAIL %s: %v\n", name, err)
+				continue
+			}
+
+			if *update {
+				if err := os.WriteFile(path, audioData, 0o644); err != nil {
+					log.Fatalf("%v", err)
+				}
+				fmt.Fprintf(cliStdout, "wrote %s\n", path)
+				continue
+			}
+
+			expected, err := os.ReadFile(path)
+			if err != nil {
+				failures++
+				fmt.Fprintf(cliStdout, "FAIL %s: no baseline (run with --update): %v\n", name, err)
+				continue
+			}
+			distance, durationChange, err := compareAudio(expected, audioData)
+			switch {
+			case err != nil:
+			case distance > *maxDistance:
+				err = fmt.Errorf("spectral distance %.2f dB exceeds %.2f", distance, *maxDistance)
+			case math.Abs(durationChange) > *maxDurationChange:
+				err = fmt.Errorf("duration changed by %+.1f%%", durationChange*100)
+			}
+			if err != nil {
+				failures++
+				fmt.Fprintf(cliStdout, "FAIL %s: %v\n", name, err)
+				continue
+			}
+			fmt.Fprintf(cliStdout, "ok   %s: distance %.2f dB, duration %+.1f%%\n", name, distance, durationChange*100)
+		}
+	}
+
+	if *update {
+		return
+	}
+	if failures > 0 {
+		cleanup()
+		log.Printf("%d of %d clips regressed", failures, total)
+		os.Exit(1)
+	}
+	log.Printf("All %d clips match the baseline", total)
+}
+
+// readCorpus reads one sentence per non-empty line
+func readCorpus(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sentences []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			sentences = append(sentences, line)
+		}
+	}
+	if len(sentences) == 0 && scanner.Err() == nil {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	return sentences, scanner.Err()
+}
+
+// compareAudio returns the mean log-spectral distance (dB) between two WAVs
+// over their common length, and the relative duration change from baseline to actual
+func compareAudio(baseline, actual []byte) (float64, float64, error) {
+	baseRate, basePCM, err := wavPCM(baseline)
+	if err != nil {
+		return 0, 0, fmt.Errorf("baseline: %w", err)
+	}
+	rate, pcm, err := wavPCM(actual)
+	if err != nil {
+		return 0, 0, err
+	}
+	if rate != baseRate {
+		return 0, 0, fmt.Errorf("sample rate changed from %d to %d", baseRate, rate)
+	}
+
+	baseFrames := logSpectrogram(pcmToFloat32(basePCM), regressFrameSize, regressHop)
+	frames := logSpectrogram(pcmToFloat32(pcm), regressFrameSize, regressHop)
+	n := min(len(baseFrames), len(frames))
+	if n == 0 || len(basePCM) == 0 {
+		return 0, 0, fmt.Errorf("audio too short to compare")
+	}
+
+	var total float64
+	for i := 0; i < n; i++ {
+		var sum float64
+		for k := range frames[i] {
+			d := frames[i][k] - baseFrames[i][k]
+			sum += d * d
+		}
+		total += math.Sqrt(sum / float64(len(frames[i])))
+	}
+	durationChange := float64(len(pcm)-len(basePCM)) / float64(len(basePCM))
+	return total / float64(n), durationChange, nil
+}
+
+// pcmToFloat32 converts s16le PCM to samples in [-1, 1)
+func pcmToFloat32(pcm []byte) []float32 {
+	samples := make([]float32, len(pcm)/2)
+	for i := range samples {
+		samples[i] = float32(int16(binary.LittleEndian.Uint16(pcm[2*i:]))) / 32768
+	}
+	return samples
+}
@@ -0,0 +1,113 @@
+package main
+
+import "sync"
+
+// fairScheduler hands a fixed number of slots to waiting work round-robin
+// across tenants, so one tenant's backlog queues behind its own work instead of
+// everyone's. A tenant with weight n is granted up to n slots per turn
+type fairScheduler struct {
+	mu      sync.Mutex
+	free    int
+	queues  map[string][]chan struct{} // waiters per tenant, oldest first
+	order   []string                   // tenants with waiters, in turn order
+	turn    int                        // index into order of the tenant being served
+	credits int                        // grants left in that tenant's turn
+}
+
+// newFairScheduler returns a scheduler with slots free slots
+func newFairScheduler(slots int) *fairScheduler {
+	return &fairScheduler{free: slots, queues: map[string][]chan struct{}{}}
+}
+
+// tenantWeight returns the share of a tenant: its API key's weight, default 1
+func tenantWeight(tenant string) int {
+	for _, key := range apiKeys {
+		if key.Name == tenant && key.Weight > 0 {
+			return key.Weight
+		}
+	}
+	return 1
+}
+
+// requestTenant names the tenant a request is scheduled as: its API key, or
+// "" for requests without one
+func requestTenant(req *TTSRequest) string {
+	if req.key == nil {
+		return ""
+	}
+	return req.key.Name
+}
+
+// acquire blocks until the tenant is granted a slot
+func (s *fairScheduler) acquire(tenant string) {
+	s.mu.Lock()
+	if s.free > 0 && len(s.order) == 0 {
+		s.free--
+		s.mu.Unlock()
+		return
+	}
+	ticket := make(chan struct{})
+	if len(s.queues[tenant]) == 0 {
+		s.order = append(s.order, tenant)
+	}
+	s.queues[tenant] = append(s.queues[tenant], ticket)
+	s.mu.Unlock()
+	<-ticket
+}
+
+// release frees a slot, handing it straight to the next waiter in turn
+func (s *fairScheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.order) == 0 {
+		s.free++
+		return
+	}
+
+	if s.turn >= len(s.order) {
+		s.turn, s.credits = 0, 0
+	}
+	tenant := s.order[s.turn]
+	if s.credits <= 0 {
+		s.credits = tenantWeight(tenant)
+	}
+	queue := s.queues[tenant]
+	ticket := queue[0]
+	s.queues[tenant] = queue[1:]
+	s.credits--
+
+	if len(s.queues[tenant]) == 0 {
+		// Out of work: drop from the rotation; the next tenant slides into this index
+		delete(s.queues, tenant)
+		s.order = append(s.order[:s.turn], s.order[s.turn+1:]...)
+		s.credits = 0
+	} else if s.credits == 0 {
+		s.turn++
+	}
+	close(ticket)
+}
+
+// yield gives the tenant's slot to the next waiter in turn and queues for it
+// again; with nobody waiting it returns at once. Long work calls it between
+// units so other tenants are served in the meantime
+func (s *fairScheduler) yield(tenant string) {
+	s.mu.Lock()
+	waiting := len(s.order) > 0
+	s.mu.Unlock()
+	if !waiting {
+		return
+	}
+	s.release()
+	s.acquire(tenant)
+}
+
+// waiting returns how many acquires are queued for a slot
+func (s *fairScheduler) waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, queue := range s.queues {
+		n += len(queue)
+	}
+	return n
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "log"
+
+func init() {
+	commands["service"] = func([]string) {
+		log.Fatalf("service mode is only available on Windows; use systemd (Type=notify) elsewhere")
+	}
+}
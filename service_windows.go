@@ -0,0 +1,165 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceName is the name the Windows service and its event source are registered under
+const serviceName = "Supertonic"
+
+func init() {
+	commands["service"] = runService
+}
+
+// runService manages the Windows service: install [server flags] registers
+// it to start automatically with those flags, uninstall removes it, and run
+// is what the service control manager starts
+func runService(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("usage: supertonic service install [server flags] | uninstall | run [server flags]")
+	}
+	var err error
+	switch args[0] {
+	case "install":
+		err = installService(args[1:])
+	case "uninstall":
+		err = uninstallService()
+	case "run":
+		err = runAsService(args[1:])
+	default:
+		err = fmt.Errorf("unknown service command %q (install, uninstall or run)", args[0])
+	}
+	if err != nil {
+		log.Fatalf("service %s: %v", args[0], err)
+	}
+}
+
+// installService registers the service and its event log source
+func installService(flags []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.Abs(exe); err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", serviceName)
+	}
+
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "Supertonic TTS",
+		Description: "Supertonic OpenAI-compatible text-to-speech server",
+		StartType:   mgr.StartAutomatic,
+	}, append([]string{"service", "run"}, flags...)...)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to register event log source: %w", err)
+	}
+	fmt.Printf("Installed service %s: %s service run %s\n", serviceName, exe, strings.Join(flags, " "))
+	return nil
+}
+
+// uninstallService removes the service and its event log source
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+	if err := eventlog.Remove(serviceName); err != nil {
+		return fmt.Errorf("failed to remove event log source: %w", err)
+	}
+	fmt.Printf("Removed service %s\n", serviceName)
+	return nil
+}
+
+// runAsService serves under the service control manager, logging to the
+// Windows event log
+func runAsService(flags []string) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		return fmt.Errorf("not started by the service control manager (run the server directly instead)")
+	}
+
+	elog, err := eventlog.Open(serviceName)
+	if err != nil {
+		return fmt.Errorf("failed to open event log: %w", err)
+	}
+	defer elog.Close()
+	log.SetOutput(eventLogWriter{elog})
+	log.SetFlags(0)
+
+	return svc.Run(serviceName, &windowsService{flags: flags})
+}
+
+// windowsService runs the server until the service manager stops it
+type windowsService struct {
+	flags []string
+}
+
+// Execute implements svc.Handler
+func (ws *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	go runServer(ws.flags)
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for req := range requests {
+		switch req.Cmd {
+		case svc.Interrogate:
+			status <- req.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			log.Printf("Service stopping")
+			status <- svc.Status{State: svc.StopPending, WaitHint: uint32((5 * time.Second).Milliseconds())}
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// eventLogWriter sends log output to the Windows event log
+type eventLogWriter struct {
+	elog *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+	if strings.Contains(msg, "Failed") || strings.Contains(msg, "Error") {
+		return len(p), w.elog.Error(1, msg)
+	}
+	return len(p), w.elog.Info(1, msg)
+}
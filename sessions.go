@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionRequest is the body of POST /v1/sessions: speech settings (voice,
+// speed, language, model, ...) applied to every fragment spoken in the
+// session, and lexicon overrides respelling whole words, e.g.
+// {"tomato": "toh-MAH-toh"}
+type SessionRequest struct {
+	TTSRequest
+	Lexicon map[string]string `json:"lexicon,omitempty"`
+}
+
+// Session holds the settings of a conversation until it is idle for --session-idle
+type Session struct {
+	ID        string            `json:"id"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Settings  TTSRequest        `json:"settings"`
+	Lexicon   map[string]string `json:"lexicon,omitempty"`
+
+	key     *apiKey
+	pattern *regexp.Regexp // matches the lexicon's words; nil without a lexicon
+}
+
+var (
+	sessionsMu sync.Mutex
+	sessions   = map[string]*Session{}
+)
+
+// newSessionID returns a random session identifier
+func newSessionID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "sess_" + hex.EncodeToString(b)
+}
+
+// handleSessions creates a session
+func handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if config.Stateless {
+		sendError(w, "Sessions live on one replica and are disabled in stateless mode; send full speech requests instead", http.StatusConflict)
+		return
+	}
+
+	var req SessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Input != "" {
+		sendError(w, "input is sent per fragment to /v1/sessions/{id}/speech", http.StatusBadRequest)
+		return
+	}
+	req.key = requestAPIKey(r)
+	pattern, err := lexiconPattern(req.Lexicon)
+	if err == nil {
+		// Validate the settings with a stand-in input; defaults are applied per fragment
+		check := req.TTSRequest
+		check.Input = "session"
+		err = validateRequest(&check)
+	}
+	if err != nil {
+		sendError(w, err.Error(), validationStatus(w, err))
+		return
+	}
+
+	now := time.Now().UTC()
+	session := &Session{
+		ID:        newSessionID(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(config.SessionIdle),
+		Settings:  req.TTSRequest,
+		Lexicon:   req.Lexicon,
+		key:       req.key,
+		pattern:   pattern,
+	}
+	sessionsMu.Lock()
+	for id, s := range sessions {
+		if now.After(s.ExpiresAt) {
+			delete(sessions, id)
+		}
+	}
+	sessions[session.ID] = session
+	sessionsMu.Unlock()
+	log.Printf("Session %s created: voice=%s, language=%s", session.ID, req.Voice, req.Language)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// handleSession returns (GET) or ends (DELETE) a session
+func handleSession(w http.ResponseWriter, r *http.Request) {
+	session := lookupSession(w, r)
+	if session == nil {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		sessionsMu.Lock()
+		snapshot := *session
+		sessionsMu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshot)
+	case http.MethodDelete:
+		sessionsMu.Lock()
+		delete(sessions, session.ID)
+		sessionsMu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSessionSpeech speaks one fragment with the session's settings. The
+// body is a speech request whose fields override the session's for this
+// fragment only; usually just {"input": "..."}
+func handleSessionSpeech(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	session := lookupSession(w, r)
+	if session == nil {
+		return
+	}
+
+	req := session.Settings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.InputType != "phonemes" {
+		req.Input = applyLexicon(req.Input, session.pattern, session.Lexicon)
+	}
+	serveSpeech(w, r, &req)
+}
+
+// lookupSession finds the session named in the path, answering 404 when it
+// is unknown, expired or belongs to another API key; using it renews its expiry
+func lookupSession(w http.ResponseWriter, r *http.Request) *Session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	session := sessions[r.PathValue("id")]
+	now := time.Now().UTC()
+	if session != nil && now.After(session.ExpiresAt) {
+		delete(sessions, session.ID)
+		session = nil
+	}
+	if session == nil || session.key != requestAPIKey(r) {
+		sendError(w, "Session not found", http.StatusNotFound)
+		return nil
+	}
+	session.ExpiresAt = now.Add(config.SessionIdle)
+	return session
+}
+
+// lexiconPattern compiles a pattern matching the lexicon's words as whole
+// words, longest first so multi-word entries win
+func lexiconPattern(lexicon map[string]string) (*regexp.Regexp, error) {
+	if len(lexicon) == 0 {
+		return nil, nil
+	}
+	words := make([]string, 0, len(lexicon))
+	for word, respelling := range lexicon {
+		if strings.TrimSpace(word) == "" || strings.TrimSpace(respelling) == "" {
+			return nil, fmt.Errorf("lexicon entries need a word and a respelling")
+		}
+		if strings.ContainsAny(word+respelling, "{}|") {
+			return nil, fmt.Errorf("lexicon entry %q must not contain braces or |", word)
+		}
+		words = append(words, regexp.QuoteMeta(word))
+	}
+	sort.Slice(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+	return regexp.Compile(`(?i)\b(?:` + strings.Join(words, "|") + `)\b`)
+}
+
+// applyLexicon marks each lexicon word in text as an inline respelling
+// ({{word|respelling}}), which the normalizer expands
+func applyLexicon(text string, pattern *regexp.Regexp, lexicon map[string]string) string {
+	if pattern == nil {
+		return text
+	}
+	lower := make(map[string]string, len(lexicon))
+	for word, respelling := range lexicon {
+		lower[strings.ToLower(word)] = respelling
+	}
+	return pattern.ReplaceAllStringFunc(text, func(word string) string {
+		return "{{" + word + "|" + lower[strings.ToLower(word)] + "}}"
+	})
+}
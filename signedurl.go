@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signedSpeech is the payload of a signed GET speech URL
+type signedSpeech struct {
+	Key     string     `json:"key,omitempty"` // name of the --api-keys entry usage is charged to
+	Expires int64      `json:"exp"`           // unix seconds after which the URL is refused
+	Request TTSRequest `json:"request"`
+}
+
+// signSpeechPayload encodes a payload for /v1/audio/speech?payload=: the
+// base64url JSON, a dot and the base64url HMAC-SHA256 of the encoded JSON
+// with --url-signing-secret
+func signSpeechPayload(payload *signedSpeech) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(payloadMAC(encoded)), nil
+}
+
+// payloadMAC returns the HMAC-SHA256 of an encoded payload
+func payloadMAC(encoded string) []byte {
+	mac := hmac.New(sha256.New, []byte(config.URLSigningSecret))
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// verifySpeechPayload checks a payload's signature and expiry and decodes it
+func verifySpeechPayload(signed string) (*signedSpeech, error) {
+	encoded, signature, ok := strings.Cut(signed, ".")
+	if !ok {
+		return nil, fmt.Errorf("payload is not signed")
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, payloadMAC(encoded)) {
+		return nil, fmt.Errorf("invalid payload signature")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload encoding")
+	}
+	var payload signedSpeech
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("invalid payload JSON: %w", err)
+	}
+	if payload.Expires == 0 {
+		return nil, fmt.Errorf("payload has no expiry")
+	}
+	if time.Now().Unix() >= payload.Expires {
+		return nil, fmt.Errorf("payload expired at %s", time.Unix(payload.Expires, 0).UTC().Format(time.RFC3339))
+	}
+	return &payload, nil
+}
+
+// validateSignedRequest checks that a signed request renders the same audio
+// every time, so a CDN may cache it: a pinned seed and a plain audio response
+func validateSignedRequest(req *TTSRequest) error {
+	switch {
+	case req.Seed == 0:
+		return fmt.Errorf("signed requests must set seed")
+	case req.Stream || req.ReturnURL || req.Preview || len(req.SpeechMarks) > 0 || req.Visemes != "":
+		return fmt.Errorf("signed requests must return plain audio (no stream, return_url, preview, speech_marks or visemes)")
+	}
+	return nil
+}
+
+// apiKeyByName returns the --api-keys entry with a name, or nil
+func apiKeyByName(name string) *apiKey {
+	for _, key := range apiKeys {
+		if key.Name == name {
+			return key
+		}
+	}
+	return nil
+}
+
+// cacheControlWriter marks successful responses cacheable by shared caches
+// and everything else (errors, quota refusals) uncacheable
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (w *cacheControlWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status == http.StatusOK || status == http.StatusNotModified {
+			w.Header().Set("Cache-Control", w.value)
+		} else {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheControlWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the connection
+func (w *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// handleSignedSpeech serves GET /v1/audio/speech?payload=<signed>: a speech
+// request signed with --url-signing-secret, needing no API key, whose
+// deterministic output is sent with long-lived Cache-Control headers so a CDN
+// can cache prompts at the edge, but never past the payload's expiry
+func handleSignedSpeech(w http.ResponseWriter, r *http.Request) {
+	if config.URLSigningSecret == "" {
+		sendError(w, "Signed speech URLs are disabled (start the server with --url-signing-secret)", http.StatusNotFound)
+		return
+	}
+	payload, err := verifySpeechPayload(r.URL.Query().Get("payload"))
+	if err != nil {
+		log.Printf("Rejected signed speech URL from %s: %v", clientAddr(r), err)
+		sendError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	req := &payload.Request
+	if err := validateSignedRequest(req); err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if apiKeys != nil && payload.Key != "" {
+		key := apiKeyByName(payload.Key)
+		if key == nil {
+			sendError(w, "Signed payload names an unknown API key", http.StatusForbidden)
+			return
+		}
+		if entry, ok := r.Context().Value(auditContextKey{}).(*AuditEntry); ok {
+			entry.APIKey = key.Name
+		}
+		if record := requestAccessRecord(r); record != nil {
+			record.apiKey = key.Name
+		}
+		r = r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key))
+	}
+
+	maxAge := min(int64(config.SignedURLMaxAge.Seconds()), payload.Expires-time.Now().Unix())
+	value := "public, max-age=" + strconv.FormatInt(maxAge, 10) + ", immutable"
+	serveSpeech(&cacheControlWriter{ResponseWriter: w, value: value}, r, req)
+}
+
+// handleAdminSignURL signs a speech request (optionally charged to an API key
+// name) and returns its GET URL. A request without a seed gets one pinned,
+// since cached output must not change; one without exp expires after
+// --signed-url-max-age
+func handleAdminSignURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if config.URLSigningSecret == "" {
+		sendError(w, "Signed speech URLs are disabled (start the server with --url-signing-secret)", http.StatusNotFound)
+		return
+	}
+
+	var payload signedSpeech
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		sendError(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if payload.Request.Seed == 0 {
+		payload.Request.Seed = rand.Int63n(math.MaxInt32) + 1
+	}
+	if err := validateSignedRequest(&payload.Request); err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if payload.Expires == 0 && config.SignedURLMaxAge > 0 {
+		payload.Expires = time.Now().Add(config.SignedURLMaxAge).Unix()
+	}
+	if payload.Expires <= time.Now().Unix() {
+		sendError(w, "exp must be in the future", http.StatusBadRequest)
+		return
+	}
+	if payload.Key != "" && apiKeyByName(payload.Key) == nil {
+		sendError(w, "Unknown API key name: "+payload.Key, http.StatusBadRequest)
+		return
+	}
+
+	signed, err := signSpeechPayload(&payload)
+	if err != nil {
+		sendError(w, "Signing failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":        requestBaseURL(r) + "/v1/audio/speech?payload=" + url.QueryEscape(signed),
+		"seed":       payload.Request.Seed,
+		"expires_at": time.Unix(payload.Expires, 0).UTC(),
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// sloWindow is how many recent interactive request latencies the p95 is taken over
+const sloWindow = 200
+
+// sloMinSamples is how many latencies are needed before steps are adjusted,
+// and how many new ones between adjustments
+const sloMinSamples = 20
+
+// sloRecover is the fraction of the SLO the p95 must fall below before a
+// step reduction is undone
+const sloRecover = 0.7
+
+// latencySLO tracks the p95 latency of interactive requests against
+// --latency-slo and the denoising steps they are currently capped at
+type latencySLO struct {
+	mu        sync.Mutex
+	latencies []time.Duration // ring of the last sloWindow latencies
+	next      int
+	since     int // latencies recorded since the last adjustment
+	steps     int // current cap on default steps
+}
+
+var slo = &latencySLO{}
+
+// record adds the latency of a finished interactive request and, every
+// sloMinSamples requests, moves the step cap one step towards keeping the p95
+// under the SLO: down to --slo-min-steps while it is over, back up to
+// --total-step once it is comfortably under
+func (s *latencySLO) record(latency time.Duration) {
+	if config.LatencySLO <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.latencies) < sloWindow {
+		s.latencies = append(s.latencies, latency)
+	} else {
+		s.latencies[s.next] = latency
+		s.next = (s.next + 1) % sloWindow
+	}
+	if s.steps == 0 {
+		s.steps = config.TotalStep
+	}
+
+	s.since++
+	if s.since < sloMinSamples || len(s.latencies) < sloMinSamples {
+		return
+	}
+	s.since = 0
+	p95 := s.p95Locked()
+	switch {
+	case p95 > config.LatencySLO && s.steps > config.SLOMinSteps:
+		s.steps--
+		s.resetLocked()
+		log.Printf("Latency SLO: p95 %s over %s, capping default steps at %d", p95.Round(time.Millisecond), config.LatencySLO, s.steps)
+	case p95 < time.Duration(float64(config.LatencySLO)*sloRecover) && s.steps < config.TotalStep:
+		s.steps++
+		s.resetLocked()
+		log.Printf("Latency SLO: p95 %s under %s, capping default steps at %d", p95.Round(time.Millisecond), config.LatencySLO, s.steps)
+	}
+}
+
+// resetLocked forgets the latencies measured at the previous step cap
+func (s *latencySLO) resetLocked() {
+	s.latencies = s.latencies[:0]
+	s.next = 0
+}
+
+// p95Locked returns the 95th percentile of the recorded latencies
+func (s *latencySLO) p95Locked() time.Duration {
+	sorted := append([]time.Duration(nil), s.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[(len(sorted)*95)/100]
+}
+
+// status returns the current p95 and step cap for /health
+func (s *latencySLO) status() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	steps := s.steps
+	if steps == 0 {
+		steps = config.TotalStep
+	}
+	status := map[string]interface{}{
+		"slo_ms": config.LatencySLO.Milliseconds(),
+		"steps":  steps,
+	}
+	if len(s.latencies) > 0 {
+		status["p95_ms"] = s.p95Locked().Milliseconds()
+	}
+	return status
+}
+
+// applyLatencySLO lowers the steps of an interactive request that left them
+// at the default to the current cap, and says so in X-Supertonic-Degraded
+func applyLatencySLO(w http.ResponseWriter, req *TTSRequest) {
+	if config.LatencySLO <= 0 || !req.defaultSteps {
+		return
+	}
+	slo.mu.Lock()
+	steps := slo.steps
+	slo.mu.Unlock()
+	if steps > 0 && steps < req.Steps {
+		w.Header().Set("X-Supertonic-Degraded", fmt.Sprintf("steps=%d->%d", req.Steps, steps))
+		req.Steps = steps
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"go-supertonic/tts"
+)
+
+// speechdSymbolicVoices are the voice types speech-dispatcher clients select by;
+// each numbered voice is offered under the matching type (M2 as MALE2, F4 as FEMALE3)
+var speechdSymbolicVoices = map[byte]string{'M': "MALE", 'F': "FEMALE"}
+
+// runSpeechdConfig implements `supertonic speechd-config`: print an sd_generic
+// module configuration that makes speech-dispatcher (and so Orca and other
+// accessibility tools) speak through a running server's /api/tts endpoint.
+// Talking to the server keeps the models loaded between utterances, which a
+// per-utterance `supertonic say` could not
+func runSpeechdConfig(args []string) {
+	fs, _ := newCLIFlagSet("speechd-config")
+	server := fs.String("server", "", "Server URL the module sends text to (defaults to http://localhost:<port>)")
+	output := fs.String("output", "-", "Write the module configuration to this file (- for stdout)")
+	fs.Parse(args)
+
+	if *server == "" {
+		*server = "http://localhost:" + config.Port
+	}
+
+	module := speechdModuleConfig(strings.TrimSuffix(*server, "/"))
+	if *output == "-" {
+		fmt.Print(module)
+		return
+	}
+	if err := os.WriteFile(*output, []byte(module), 0o644); err != nil {
+		log.Fatalf("%v", err)
+	}
+	log.Printf("Wrote %s; add `AddModule \"supertonic\" \"sd_generic\" \"%s\"` to speechd.conf", *output, *output)
+}
+
+// speechdModuleConfig renders the sd_generic configuration for a server URL.
+// speech-dispatcher's rate (-100..100) maps to speed 0.5..1.5
+func speechdModuleConfig(server string) string {
+	var b strings.Builder
+	b.WriteString("# speech-dispatcher output module for Supertonic (generated by `supertonic speechd-config`)\n")
+	b.WriteString("#\n")
+	b.WriteString("# Install as /etc/speech-dispatcher/modules/supertonic.conf (or ~/.config/speech-dispatcher/modules/),\n")
+	b.WriteString("# then add to speechd.conf:\n")
+	b.WriteString("#   AddModule \"supertonic\" \"sd_generic\" \"supertonic.conf\"\n")
+	b.WriteString("#   DefaultModule supertonic\n")
+	b.WriteString("# The Supertonic server must be running at " + server + ".\n\n")
+
+	b.WriteString("GenericExecuteSynth \"printf %s \\'$DATA\\' | curl -sf -H Content-Type:text/plain --data-binary @- ")
+	b.WriteString("-o /tmp/supertonic-speechd.wav \\\"" + server + "/api/tts?voice=$VOICE&lang=$LANGUAGE&speed=$RATE\\\" ")
+	b.WriteString("&& $PLAY_COMMAND /tmp/supertonic-speechd.wav\"\n")
+	b.WriteString("GenericCmdDependency \"curl\"\n")
+	b.WriteString("GenericStripPunctChars \"\"\n")
+	b.WriteString("GenericRecodeFallback \"?\"\n")
+	b.WriteString("GenericRateAdd 1\n")
+	b.WriteString("GenericRateMultiply 0.005\n")
+	b.WriteString("GenericRateForceInteger 0\n\n")
+
+	for _, lang := range tts.AvailableLangs {
+		fmt.Fprintf(&b, "GenericLanguage \"%s\" \"%s\" \"utf-8\"\n", lang, lang)
+	}
+	b.WriteString("\n")
+	for _, lang := range tts.AvailableLangs {
+		for _, name := range sortedVoices() {
+			if symbolic, ok := speechdSymbolicVoice(name); ok {
+				fmt.Fprintf(&b, "AddVoice \"%s\" \"%s\" \"%s\"\n", lang, symbolic, name)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "\nDefaultVoice \"%s\"\n", config.DefaultVoice)
+	return b.String()
+}
+
+// speechdSymbolicVoice maps a voice name such as "M2" to its speech-dispatcher voice type
+func speechdSymbolicVoice(name string) (string, bool) {
+	kind, ok := speechdSymbolicVoices[name[0]]
+	if !ok {
+		return "", false
+	}
+	n, err := strconv.Atoi(name[1:])
+	if err != nil || n < 1 {
+		return "", false
+	}
+	return kind + strconv.Itoa(min(n, 3)), true
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go-supertonic/tts"
+)
+
+// Speech mark types, as in Amazon Polly's SpeechMarkTypes
+const (
+	markSentence = "sentence"
+	markWord     = "word"
+	markViseme   = "viseme"
+)
+
+// speechMarkTypes lists the supported speech mark types
+var speechMarkTypes = []string{markSentence, markWord, markViseme}
+
+// speechMarksContentType is the media type Polly returns speech marks with
+const speechMarksContentType = "application/x-json-stream"
+
+// SpeechMark is one line of a Polly-style speech marks response. Time is in
+// milliseconds into the audio; Start and End are byte offsets of Value in the
+// request input (absent for visemes)
+type SpeechMark struct {
+	Time  int    `json:"time"`
+	Type  string `json:"type"`
+	Start *int   `json:"start,omitempty"`
+	End   *int   `json:"end,omitempty"`
+	Value string `json:"value"`
+}
+
+// validateSpeechMarks checks the requested speech mark types; marks replace
+// the audio, so they cannot be combined with other response modes
+func validateSpeechMarks(req *TTSRequest) error {
+	if len(req.SpeechMarks) == 0 {
+		return nil
+	}
+	for _, t := range req.SpeechMarks {
+		known := false
+		for _, s := range speechMarkTypes {
+			known = known || s == t
+		}
+		if !known {
+			return fmt.Errorf("unsupported speech mark type: %s. Available: %v", t, speechMarkTypes)
+		}
+	}
+	if req.Stream || req.Preview || req.ReturnURL {
+		return fmt.Errorf("speech_marks is not supported with stream, preview or return_url")
+	}
+	return nil
+}
+
+// handleSpeechMarksResponse synthesizes the request and responds with its
+// speech marks, one JSON object per line, instead of the audio
+func handleSpeechMarksResponse(w http.ResponseWriter, req *TTSRequest) {
+	result, _, err := synthesizeSpeech(req, nil)
+	if err != nil {
+		log.Printf("TTS Error: %v", err)
+		sendError(w, "Speech generation failed: "+err.Error(), speechErrorStatus(w, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", speechMarksContentType)
+	enc := json.NewEncoder(w)
+	for _, mark := range buildSpeechMarks(req.Input, result.Spans, req.SpeechMarks) {
+		enc.Encode(mark)
+	}
+}
+
+// spokenWord is a word of the synthesized text with the time it is heard
+type spokenWord struct {
+	Text       string
+	Start, End float32 // seconds
+}
+
+// buildSpeechMarks derives speech marks from the synthesized chunk spans.
+// The model does not report alignments, so word times are interpolated over
+// each chunk by word length. Spoken words are matched back to the input;
+// words the normalizer produced (e.g. "five dollars" for "$5") are reported
+// as the input token they were read from
+func buildSpeechMarks(input string, spans []tts.SpokenSpan, types []string) []SpeechMark {
+	want := map[string]bool{}
+	for _, t := range types {
+		want[t] = true
+	}
+
+	var words []SpeechMark
+	var visemes []SpeechMark
+	cursor := 0
+	for _, span := range spans {
+		for _, w := range spokenWords(span) {
+			start, end, matched := matchInputWord(input, w.Text, cursor)
+			if matched {
+				cursor = end
+			}
+			if n := len(words); n == 0 || *words[n-1].Start != start {
+				words = append(words, SpeechMark{Time: millis(w.Start), Type: markWord, Start: intPtr(start), End: intPtr(end), Value: input[start:end]})
+			}
+			visemes = append(visemes, wordVisemes(w)...)
+		}
+		visemes = append(visemes, SpeechMark{Time: millis(span.End), Type: markViseme, Value: "sil"})
+	}
+
+	var marks []SpeechMark
+	if want[markSentence] {
+		marks = append(marks, sentenceMarks(input, words)...)
+	}
+	if want[markWord] {
+		marks = append(marks, words...)
+	}
+	if want[markViseme] {
+		marks = append(marks, visemes...)
+	}
+	// Polly orders marks by time, sentences before the words they contain
+	sortMarks(marks)
+	return marks
+}
+
+// spokenWords spreads a span's duration over its words in proportion to
+// their letters, counting clause and sentence punctuation as a short pause
+func spokenWords(span tts.SpokenSpan) []spokenWord {
+	fields := strings.Fields(span.Text)
+	weights := make([]float32, len(fields))
+	var total float32
+	for i, f := range fields {
+		weights[i] = float32(utf8.RuneCountInString(strings.TrimFunc(f, isMarkPunct))) + 1
+		if strings.ContainsAny(f[len(f)-1:], ".!?") {
+			weights[i] += 4
+		} else if strings.ContainsAny(f[len(f)-1:], ",;:") {
+			weights[i] += 2
+		}
+		total += weights[i]
+	}
+
+	var words []spokenWord
+	length := span.End - span.Start
+	var elapsed float32
+	for i, f := range fields {
+		start := span.Start + length*elapsed/total
+		elapsed += weights[i]
+		if word := strings.TrimFunc(f, isMarkPunct); word != "" {
+			words = append(words, spokenWord{Text: word, Start: start, End: span.Start + length*elapsed/total})
+		}
+	}
+	return words
+}
+
+// isMarkPunct reports whether r is punctuation around a word rather than part of it
+func isMarkPunct(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+}
+
+// markMatchTokens is how many input tokens ahead of the cursor a spoken word
+// may match, so a common word never jumps far ahead in the input
+const markMatchTokens = 3
+
+// matchInputWord finds word as a whole word in the input at or after cursor,
+// returning its byte offsets; when it is not found, the next input token is returned unmatched
+func matchInputWord(input string, word string, cursor int) (int, int, bool) {
+	tokens := inputTokens(input, cursor, markMatchTokens+1)
+	if len(tokens) == 0 {
+		return len(input), len(input), false
+	}
+	limit := len(input)
+	if len(tokens) > markMatchTokens {
+		limit = tokens[markMatchTokens][0]
+	}
+	for i := cursor; i+len(word) <= limit; {
+		if strings.EqualFold(input[i:i+len(word)], word) && isWordBoundary(input, i) && isWordBoundary(input, i+len(word)) {
+			return i, i + len(word), true
+		}
+		_, size := utf8.DecodeRuneInString(input[i:])
+		i += size
+	}
+	return tokens[0][0], tokens[0][1], false
+}
+
+// isWordBoundary reports whether byte offset i of text does not split a word
+func isWordBoundary(text string, i int) bool {
+	if i == 0 || i == len(text) {
+		return true
+	}
+	before, _ := utf8.DecodeLastRuneInString(text[:i])
+	after, _ := utf8.DecodeRuneInString(text[i:])
+	return isMarkPunct(before) || isMarkPunct(after)
+}
+
+// inputTokens returns the byte spans of up to n whitespace-separated input
+// tokens after cursor, without their surrounding punctuation (symbols such
+// as $ are kept)
+func inputTokens(input string, cursor int, n int) [][2]int {
+	var tokens [][2]int
+	for i := cursor; i < len(input) && len(tokens) < n; {
+		r, size := utf8.DecodeRuneInString(input[i:])
+		if unicode.IsPunct(r) {
+			i += size
+			continue
+		}
+		end := i
+		for j := i; j < len(input); {
+			r, size := utf8.DecodeRuneInString(input[j:])
+			if unicode.IsSpace(r) {
+				break
+			}
+			j += size
+			if !unicode.IsPunct(r) {
+				end = j
+			}
+		}
+		tokens = append(tokens, [2]int{i, end})
+		for i = end; i < len(input); {
+			r, size := utf8.DecodeRuneInString(input[i:])
+			if unicode.IsSpace(r) {
+				break
+			}
+			i += size
+		}
+	}
+	return tokens
+}
+
+// markSentencePattern matches one sentence of the input with its closing punctuation
+var markSentencePattern = regexp.MustCompile(`[^.!?。！？\n]+[.!?。！？]*`)
+
+// sentenceMarks reports each input sentence at the time of its first word
+func sentenceMarks(input string, words []SpeechMark) []SpeechMark {
+	var marks []SpeechMark
+	for _, loc := range markSentencePattern.FindAllStringIndex(input, -1) {
+		text := strings.TrimSpace(input[loc[0]:loc[1]])
+		if text == "" {
+			continue
+		}
+		start := loc[0] + strings.Index(input[loc[0]:loc[1]], text)
+		for _, w := range words {
+			if *w.Start >= start && *w.Start < loc[1] {
+				marks = append(marks, SpeechMark{Time: w.Time, Type: markSentence, Start: intPtr(start), End: intPtr(start + len(text)), Value: text})
+				break
+			}
+		}
+	}
+	return marks
+}
+
+// visemeLetters maps letters and digraphs to Polly's viseme classes. The
+// model has no phoneme output, so visemes follow the spelling
+var visemeLetters = map[string]string{
+	"ch": "S", "sh": "S", "th": "T", "ph": "f", "ng": "k",
+	"b": "p", "m": "p", "p": "p",
+	"d": "t", "t": "t", "n": "t", "l": "t",
+	"j": "S", "f": "f", "v": "f",
+	"g": "k", "k": "k", "c": "k", "q": "k", "x": "k", "h": "k",
+	"r": "r", "s": "s", "z": "s",
+	"w": "u", "u": "u", "y": "i", "i": "i",
+	"a": "a", "e": "e", "o": "o",
+}
+
+// wordVisemes spreads a word's visemes evenly over its duration
+func wordVisemes(w spokenWord) []SpeechMark {
+	values := letterVisemes(w.Text, visemeLetters, "@")
+	marks := make([]SpeechMark, len(values))
+	step := (w.End - w.Start) / float32(max(len(values), 1))
+	for i, v := range values {
+		marks[i] = SpeechMark{Time: millis(w.Start + step*float32(i)), Type: markViseme, Value: v}
+	}
+	return marks
+}
+
+// letterVisemes reads a word's visemes from its spelling with a letter
+// table, merging repeats; a word starting with letters the table lacks
+// (another script) opens with the fallback viseme
+func letterVisemes(word string, table map[string]string, fallback string) []string {
+	letters := []rune(strings.ToLower(word))
+	var values []string
+	for i := 0; i < len(letters); i++ {
+		v, ok := "", false
+		if i+1 < len(letters) {
+			if v, ok = table[string(letters[i:i+2])]; ok {
+				i++
+			}
+		}
+		if !ok {
+			v, ok = table[string(letters[i])]
+		}
+		if ok && (len(values) == 0 || values[len(values)-1] != v) {
+			values = append(values, v)
+		} else if !ok && unicode.IsLetter(letters[i]) && len(values) == 0 {
+			values = append(values, fallback)
+		}
+	}
+	return values
+}
+
+// sortMarks orders marks by time, keeping sentences ahead of the words and
+// words ahead of the visemes starting at the same time
+func sortMarks(marks []SpeechMark) {
+	rank := map[string]int{markSentence: 0, markWord: 1, markViseme: 2}
+	sort.SliceStable(marks, func(i, j int) bool {
+		if marks[i].Time != marks[j].Time {
+			return marks[i].Time < marks[j].Time
+		}
+		return rank[marks[i].Type] < rank[marks[j].Type]
+	})
+}
+
+// millis converts seconds to whole milliseconds
+func millis(seconds float32) int {
+	return int(seconds*1000 + 0.5)
+}
+
+// intPtr returns a pointer to v
+func intPtr(v int) *int {
+	return &v
+}
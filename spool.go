@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// pcmSpool holds a render's float32 samples in a temporary file, so renders
+// longer than --spool-after keep memory flat however long they get
+type pcmSpool struct {
+	file       *os.File
+	w          *bufio.Writer
+	buf        []byte
+	samples    int64
+	sampleRate int
+}
+
+// newPCMSpool creates an empty spool file in the temporary directory
+func newPCMSpool(sampleRate int) (*pcmSpool, error) {
+	f, err := os.CreateTemp("", "supertonic-spool-*.f32")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	return &pcmSpool{file: f, w: bufio.NewWriterSize(f, 1<<20), sampleRate: sampleRate}, nil
+}
+
+// Write appends samples as little-endian float32
+func (s *pcmSpool) Write(samples []float32) error {
+	if cap(s.buf) < 4*len(samples) {
+		s.buf = make([]byte, 4*len(samples))
+	}
+	packFloat(s.buf, samples)
+	s.samples += int64(len(samples))
+	if _, err := s.w.Write(s.buf[:4*len(samples)]); err != nil {
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+	return nil
+}
+
+// remove closes and deletes the spool file
+func (s *pcmSpool) remove() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+// seconds returns the spooled duration
+func (s *pcmSpool) seconds() float64 {
+	return float64(s.samples) / float64(s.sampleRate)
+}
+
+// wavSize returns the size of the spool encoded as a WAV file
+func (s *pcmSpool) wavSize(opts wavOptions) int64 {
+	bitDepth, _, _ := wavLayout(opts.SampleFormat)
+	return wavHeaderSize + s.samples*int64(bitDepth/8)
+}
+
+// encodeWAV writes the spool to w as a WAV file, reading it back a block at a
+// time. The length is known, so the header is final and the output is
+// byte-identical to wavToBytes
+func (s *pcmSpool) encodeWAV(w io.Writer, opts wavOptions) error {
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	bitDepth, format, scale := wavLayout(opts.SampleFormat)
+	width := bitDepth / 8
+	header := make([]byte, wavHeaderSize)
+	putWAVHeader(header, s.sampleRate, bitDepth, format, int(s.samples)*width)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if format == wavFormatFloat {
+		// The spool already holds the data chunk
+		_, err := io.Copy(w, io.LimitReader(s.file, 4*s.samples))
+		return err
+	}
+
+	r := bufio.NewReaderSize(s.file, 1<<20)
+	raw := make([]byte, 4*quantizeBlock)
+	samples := make([]float32, quantizeBlock)
+	pcm := make([]int, quantizeBlock)
+	out := make([]byte, width*quantizeBlock)
+	for offset := int64(0); offset < s.samples; offset += quantizeBlock {
+		n := int(min(quantizeBlock, s.samples-offset))
+		if _, err := io.ReadFull(r, raw[:4*n]); err != nil {
+			return fmt.Errorf("failed to read spool file: %w", err)
+		}
+		for i := range samples[:n] {
+			samples[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:]))
+		}
+
+		// Blocks line up with quantize's, so the dither matches too
+		var rng *rand.Rand
+		if opts.Dither == ditherTPDF {
+			rng = rand.New(rand.NewSource(opts.Seed + offset))
+		}
+		quantizeInto(pcm[:n], samples[:n], scale, rng)
+		packPCM(out, pcm[:n], bitDepth)
+		if _, err := w.Write(out[:width*n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// canSpool reports whether a speech response may be spooled to disk: a WAV
+// encoded as it is synthesized, kept locally if it is saved at all
+func canSpool(req *TTSRequest) bool {
+	return config.SpoolAfter > 0 && req.ResponseFormat == formatWAV && encodesIncrementally(req) && config.S3.Bucket == ""
+}
+
+// spooled reports whether a request allowed to spool is predicted to run
+// longer than --spool-after
+func spooled(req *TTSRequest) bool {
+	return req.spool && req.predicted > config.SpoolAfter.Seconds()
+}
+
+// serveSpooled encodes a spooled render straight into the response, or into
+// the saved file first when --save-dir is set
+func serveSpooled(w http.ResponseWriter, r *http.Request, req *TTSRequest, spool *pcmSpool) {
+	defer spool.remove()
+	opts := wavOptionsFor(req)
+	size := spool.wavSize(opts)
+
+	if config.SaveDir != "" {
+		name := newAudioName(req.ResponseFormat)
+		f, err := os.Create(filepath.Join(config.SaveDir, name))
+		if err == nil {
+			err = spool.encodeWAV(f, opts)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			log.Printf("Storage Error: %v", err)
+			sendError(w, "Saving audio failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		saveEpisode(name, req)
+		audioURL := savedAudioURL(requestBaseURL(r), name)
+		if req.ReturnURL {
+			sendAudioURL(w, req, audioURL, int(size))
+			return
+		}
+		saved, err := os.Open(filepath.Join(config.SaveDir, name))
+		if err != nil {
+			sendError(w, "Reading saved audio failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer saved.Close()
+		w.Header().Set("X-Supertonic-Audio-URL", audioURL)
+		setSpeechHeaders(w, req)
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		io.Copy(w, saved)
+		return
+	}
+
+	setSpeechHeaders(w, req)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	if err := spool.encodeWAV(w, opts); err != nil {
+		// Headers are already sent; the response just ends early
+		log.Printf("Spooled audio: encoding failed: %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"time"
+)
+
+// Stateless mode lets several replicas sit behind a load balancer without
+// sticky sessions. Every piece of mutable state that outlives a request lives
+// in the S3-compatible store instead of process memory:
+//
+//   - async job records are written to <prefix>jobs/<id>.json on every status
+//     change, so any replica can answer GET /v1/audio/jobs/{id}
+//   - job and speech audio is uploaded to <prefix><name>.<format> and served via
+//     presigned URLs
+//   - each API key's monthly usage is kept in <prefix>usage/<name>.json. Replicas
+//     charge requests locally and merge them into it with conditional writes
+//     every usageSaveInterval, so quotas hold across replicas but can be
+//     overshot by what the others charged since the last merge
+//
+// Replica-local state is refused at startup (--save-dir, --voice-dir and
+// --usage-file) or at request time (admin model hot-swap, conversation
+// sessions). The audio cache (--audio-cache-mb) stays on each
+// replica: a miss only costs a synthesis, never a wrong answer. Expire old
+// job records and audio with a bucket lifecycle rule; --job-ttl only applies
+// to in-memory jobs.
+
+// jobIDPattern matches the IDs produced by newJobID
+var jobIDPattern = regexp.MustCompile(`^job_[0-9a-f]{24}$`)
+
+// validateStatelessConfig rejects configurations that keep state on one replica
+func validateStatelessConfig() error {
+	if !config.Stateless {
+		return nil
+	}
+	if config.S3.Bucket == "" {
+		return fmt.Errorf("--stateless requires --s3-bucket for job records and audio")
+	}
+	if config.SaveDir != "" {
+		return fmt.Errorf("--stateless cannot be combined with --save-dir (local files are not shared between replicas)")
+	}
+	if config.VoiceDir != "" {
+		return fmt.Errorf("--stateless cannot be combined with --voice-dir (uploaded voices would only exist on one replica)")
+	}
+	if config.UsageFile != "" {
+		return fmt.Errorf("--stateless cannot be combined with --usage-file (usage is kept in the bucket)")
+	}
+	return nil
+}
+
+// jobRecordKey returns the object key of a job record
+func jobRecordKey(id string) string {
+	return config.S3.Prefix + "jobs/" + id + ".json"
+}
+
+// putJobRecord writes a job snapshot to the shared store
+func putJobRecord(job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s3PutObject(jobRecordKey(job.ID), data, "application/json")
+}
+
+// getJobRecord reads a job snapshot from the shared store
+func getJobRecord(id string) (*Job, error) {
+	if !jobIDPattern.MatchString(id) {
+		return nil, nil
+	}
+	data, err := s3GetObject(jobRecordKey(id))
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("invalid job record %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// usageMergeAttempts bounds the retries when other replicas keep updating a
+// usage record between our read and write
+const usageMergeAttempts = 5
+
+// usageRecordKey returns the object key of an API key name's usage record
+func usageRecordKey(name string) string {
+	return config.S3.Prefix + "usage/" + url.PathEscape(name) + ".json"
+}
+
+// syncSharedUsage merges every API key's locally charged usage into the shared
+// store and takes in what the other replicas charged
+func syncSharedUsage() error {
+	names := map[string]bool{}
+	for _, key := range apiKeys {
+		names[key.Name] = true
+	}
+	var errs []error
+	for name := range names {
+		if err := syncKeyUsage(name); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// syncKeyUsage adds one key name's unshared usage to its shared record with a
+// compare-and-swap, then adopts the merged totals
+func syncKeyUsage(name string) error {
+	usageMu.Lock()
+	u := currentUsageOf(name)
+	period, chars, seconds := u.Period, u.unsharedChars, u.unsharedSeconds
+	u.unsharedChars, u.unsharedSeconds = 0, 0
+	usageMu.Unlock()
+
+	shared, err := mergeUsageRecord(name, period, chars, seconds)
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	u = currentUsageOf(name)
+	if u.Period != period || (shared != nil && shared.Period != period) {
+		return err
+	}
+	if err != nil {
+		// Keep the charges for the next attempt
+		u.unsharedChars += chars
+		u.unsharedSeconds += seconds
+		return err
+	}
+	u.Characters = shared.Characters + u.unsharedChars
+	u.Seconds = shared.Seconds + u.unsharedSeconds
+	return nil
+}
+
+// mergeUsageRecord adds chars and seconds to a key name's shared usage record
+// for period and returns the record as stored
+func mergeUsageRecord(name, period string, chars int64, seconds float64) (*keyUsage, error) {
+	key := usageRecordKey(name)
+	for attempt := 0; attempt < usageMergeAttempts; attempt++ {
+		data, etag, err := s3GetObjectETag(key)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		record := &keyUsage{Period: period}
+		if err == nil {
+			if err := json.Unmarshal(data, record); err != nil {
+				return nil, fmt.Errorf("invalid usage record: %w", err)
+			}
+		}
+		if record.Period != period {
+			// A new month starts afresh; a replica still in the old one
+			// must not reset a record another has already moved on
+			if record.Period > period {
+				return record, nil
+			}
+			record = &keyUsage{Period: period}
+		}
+		if chars == 0 && seconds == 0 {
+			return record, nil
+		}
+
+		record.Characters += chars
+		record.Seconds += seconds
+		if data, err = json.Marshal(record); err != nil {
+			return nil, err
+		}
+		err = s3PutObjectIfMatch(key, data, "application/json", etag)
+		if !errors.Is(err, errS3Conflict) {
+			return record, err
+		}
+		time.Sleep(time.Duration(attempt+1) * 100 * time.Millisecond)
+	}
+	return nil, errS3Conflict
+}
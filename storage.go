@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config holds the S3-compatible object storage settings
+type S3Config struct {
+	Endpoint     string // e.g. https://s3.us-east-1.amazonaws.com or http://minio:9000
+	Bucket       string
+	Region       string
+	Prefix       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	PathStyle    bool
+	URLExpiry    time.Duration
+}
+
+// s3Client uploads audio objects
+var s3Client = &http.Client{Timeout: 60 * time.Second}
+
+// setupStorage validates the storage flags and prepares the save directory
+func setupStorage() error {
+	if config.SaveDir != "" {
+		if err := os.MkdirAll(config.SaveDir, 0o755); err != nil {
+			return fmt.Errorf("failed to create save directory: %w", err)
+		}
+	}
+
+	if config.PodcastTitle != "" && config.SaveDir == "" {
+		return fmt.Errorf("--podcast-title requires --save-dir")
+	}
+
+	if config.S3.Bucket == "" {
+		return nil
+	}
+	if config.S3.Region == "" {
+		config.S3.Region = "us-east-1"
+	}
+	if config.S3.Endpoint == "" {
+		config.S3.Endpoint = "https://s3." + config.S3.Region + ".amazonaws.com"
+	}
+	if _, err := s3ObjectURL(""); err != nil {
+		return err
+	}
+	if config.S3.AccessKey == "" || config.S3.SecretKey == "" {
+		return fmt.Errorf("S3 credentials are required (--s3-access-key/--s3-secret-key or AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY)")
+	}
+	if config.S3.URLExpiry <= 0 || config.S3.URLExpiry > 7*24*time.Hour {
+		return fmt.Errorf("--s3-url-expiry must be between 1s and 168h")
+	}
+	config.S3.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	return nil
+}
+
+// newAudioName returns a random file name for a saved speech response
+func newAudioName(format string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "speech_" + hex.EncodeToString(b) + "." + responseFormats[format].Extension
+}
+
+// storageEnabled reports whether finished audio is persisted anywhere
+func storageEnabled() bool {
+	return config.SaveDir != "" || config.S3.Bucket != ""
+}
+
+// storeAudio persists audio under name in SaveDir and/or S3 and returns the
+// URL clients should download it from: a presigned S3 URL when S3 is
+// configured, otherwise the local file-serving endpoint
+func storeAudio(name string, data []byte, contentType string, baseURL string) (string, error) {
+	if config.SaveDir != "" {
+		if err := os.WriteFile(filepath.Join(config.SaveDir, name), data, 0o644); err != nil {
+			return "", fmt.Errorf("failed to save audio: %w", err)
+		}
+	}
+
+	if config.S3.Bucket != "" {
+		key := config.S3.Prefix + name
+		if err := s3PutObject(key, data, contentType); err != nil {
+			return "", fmt.Errorf("failed to upload audio: %w", err)
+		}
+		return s3PresignGet(key, config.S3.URLExpiry, time.Now())
+	}
+
+	if config.SaveDir != "" {
+		return savedAudioURL(baseURL, name), nil
+	}
+	return "", nil
+}
+
+// savedAudioURL returns the file-serving endpoint URL of audio saved in SaveDir
+func savedAudioURL(baseURL, name string) string {
+	return baseURL + "/v1/audio/files/" + url.PathEscape(name)
+}
+
+// handleAudioFile serves audio saved in SaveDir, with byte-range support
+func handleAudioFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if config.SaveDir == "" {
+		sendError(w, "Audio persistence is disabled (start the server with --save-dir)", http.StatusNotFound)
+		return
+	}
+
+	name := r.PathValue("name")
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		sendError(w, "Invalid file name", http.StatusBadRequest)
+		return
+	}
+
+	file, err := os.Open(filepath.Join(config.SaveDir, name))
+	if err != nil {
+		sendError(w, "File not found", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		sendError(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	// ServeContent answers Range and conditional requests (and advertises
+	// Accept-Ranges) so players can seek within long files
+	w.Header().Set("Content-Type", contentTypeForFile(name))
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+// s3ObjectURL returns the URL and host of an object for the configured addressing style
+func s3ObjectURL(key string) (*url.URL, error) {
+	endpoint, err := url.Parse(config.S3.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint: %s", config.S3.Endpoint)
+	}
+
+	u := &url.URL{Scheme: endpoint.Scheme, Host: endpoint.Host}
+	if config.S3.PathStyle {
+		u.Path = "/" + config.S3.Bucket + "/" + key
+	} else {
+		u.Host = config.S3.Bucket + "." + endpoint.Host
+		u.Path = "/" + key
+	}
+	return u, nil
+}
+
+// s3PutObject uploads an object
+func s3PutObject(key string, data []byte, contentType string) error {
+	resp, err := s3Request(http.MethodPut, key, data, contentType, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3GetObject downloads an object, returning os.ErrNotExist if it is missing
+func s3GetObject(key string) ([]byte, error) {
+	data, _, err := s3GetObjectETag(key)
+	return data, err
+}
+
+// errS3Conflict reports a conditional upload refused because the object
+// changed since it was read
+var errS3Conflict = errors.New("object was modified concurrently")
+
+// s3GetObjectETag downloads an object along with its ETag for a later
+// s3PutObjectIfMatch
+func s3GetObjectETag(key string) ([]byte, string, error) {
+	resp, err := s3Request(http.MethodGet, key, nil, "", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return data, resp.Header.Get("ETag"), err
+}
+
+// s3PutObjectIfMatch uploads an object only if it still has the given ETag,
+// or does not exist yet when etag is empty, returning errS3Conflict otherwise
+func s3PutObjectIfMatch(key string, data []byte, contentType string, etag string) error {
+	condition := map[string]string{"if-match": etag}
+	if etag == "" {
+		condition = map[string]string{"if-none-match": "*"}
+	}
+	resp, err := s3Request(http.MethodPut, key, data, contentType, condition)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3Request sends a SigV4-signed request for an object, with any extra
+// headers, and checks its status
+func s3Request(method string, key string, data []byte, contentType string, extra map[string]string) (*http.Response, error) {
+	u, err := s3ObjectURL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	payloadHash := sha256Hex(data)
+	headers := map[string]string{
+		"host":                 u.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           now.Format("20060102T150405Z"),
+	}
+	if contentType != "" {
+		headers["content-type"] = contentType
+	}
+	if config.S3.SessionToken != "" {
+		headers["x-amz-security-token"] = config.S3.SessionToken
+	}
+	for name, value := range extra {
+		headers[name] = value
+	}
+
+	signedHeaders, canonicalHeaders := canonicalizeHeaders(headers)
+	canonicalRequest := strings.Join([]string{
+		method,
+		awsURIEncode(u.Path, false),
+		"",
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope, signature := sigV4Sign(canonicalRequest, now)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		if name != "host" {
+			req.Header.Set(name, value)
+		}
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		config.S3.AccessKey, scope, signedHeaders, signature))
+
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, os.ErrNotExist
+	}
+	// Stores answer 409 when two conditional writes to one object race
+	if extra != nil && (resp.StatusCode == http.StatusPreconditionFailed || resp.StatusCode == http.StatusConflict) {
+		resp.Body.Close()
+		return nil, errS3Conflict
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 %s returned status %d: %s", method, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// s3PresignGet returns a presigned GET URL for an object valid for expiry
+func s3PresignGet(key string, expiry time.Duration, now time.Time) (string, error) {
+	u, err := s3ObjectURL(key)
+	if err != nil {
+		return "", err
+	}
+
+	now = now.UTC()
+	scope := s3Scope(now)
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    config.S3.AccessKey + "/" + scope,
+		"X-Amz-Date":          now.Format("20060102T150405Z"),
+		"X-Amz-Expires":       strconv.Itoa(int(expiry.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	if config.S3.SessionToken != "" {
+		query["X-Amz-Security-Token"] = config.S3.SessionToken
+	}
+
+	canonicalQuery := canonicalizeQuery(query)
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		awsURIEncode(u.Path, false),
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	_, signature := sigV4Sign(canonicalRequest, now)
+
+	return u.Scheme + "://" + u.Host + awsURIEncode(u.Path, false) + "?" + canonicalQuery + "&X-Amz-Signature=" + signature, nil
+}
+
+// s3Scope returns the SigV4 credential scope for a time
+func s3Scope(t time.Time) string {
+	return t.Format("20060102") + "/" + config.S3.Region + "/s3/aws4_request"
+}
+
+// sigV4Sign signs a canonical request and returns the credential scope and hex signature
+func sigV4Sign(canonicalRequest string, t time.Time) (string, string) {
+	scope := s3Scope(t)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format("20060102T150405Z"),
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+config.S3.SecretKey), t.Format("20060102"))
+	key = hmacSHA256(key, config.S3.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return scope, hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// canonicalizeHeaders returns the signed header list and canonical header block
+func canonicalizeHeaders(headers map[string]string) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	return strings.Join(names, ";"), canonical.String()
+}
+
+// canonicalizeQuery returns the SigV4 canonical query string
+func canonicalizeQuery(query map[string]string) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = awsURIEncode(k, true) + "=" + awsURIEncode(query[k], true)
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent-encodes everything except unreserved characters
+// (and '/' unless encodeSlash is set), as SigV4 requires
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
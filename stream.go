@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// validateStream checks that a streamed request can be written progressively:
+// a 16-bit WAV stream without conditioning that needs the whole signal
+func validateStream(req *TTSRequest) error {
+	switch {
+	case req.ResponseFormat != formatWAV || req.SampleFormat != sampleFormatS16:
+		return fmt.Errorf("stream requires response_format wav with sample_format s16")
+	case req.Telephony:
+		return fmt.Errorf("stream is not supported with telephony")
+	case req.ReturnURL || req.Preview:
+		return fmt.Errorf("stream is not supported with return_url or preview")
+	case req.QualityReport:
+		return fmt.Errorf("stream is not supported with quality_report")
+	}
+	return nil
+}
+
+// handleStreamResponse writes the WAV header as soon as the first chunk is
+// synthesized, then each chunk's PCM as it finishes, so players start before
+// the whole text is rendered. The header's sizes are the open-ended streaming
+// values since the length is not known yet; streamed audio is not saved
+func handleStreamResponse(w http.ResponseWriter, req *TTSRequest) {
+	rc := streamController(w)
+	started := false
+	written := 0
+	var writeErr error
+
+	onAudio := func(samples []float32, sampleRate int) {
+		if writeErr != nil {
+			return
+		}
+		if !started {
+			w.Header().Set("Content-Type", contentTypeFor(formatWAV))
+			w.Header().Set("X-Supertonic-Truncated", strconv.FormatBool(req.truncated))
+			if _, writeErr = w.Write(streamingWAVHeader(sampleRate)); writeErr != nil {
+				return
+			}
+			started = true
+		}
+
+		// Dither noise is seeded per block so consecutive blocks don't repeat it
+		pcm := pcm16Bytes(quantize(samples, 32767, req.Dither, req.Seed+int64(written)))
+		if _, writeErr = w.Write(pcm); writeErr != nil {
+			return
+		}
+		written += len(samples)
+		flushStream(rc)
+	}
+
+	result, _, err := synthesizeSpeech(req, onAudio)
+	switch {
+	case err != nil && !started:
+		log.Printf("TTS Error: %v", err)
+		sendError(w, "Speech generation failed: "+err.Error(), speechErrorStatus(w, err))
+	case err != nil:
+		// Headers are already sent; the stream just ends early
+		log.Printf("TTS Error (after %d streamed samples): %v", written, err)
+	case writeErr != nil:
+		log.Printf("Stream closed by client: %v", writeErr)
+	default:
+		log.Printf("Streamed audio: %d samples, duration: %.2fs", written, result.Duration)
+	}
+}
+
+// streamController returns the controller of a streamed response, giving its
+// first chunk --stream-write-timeout from now instead of the whole-response
+// --write-timeout
+func streamController(w http.ResponseWriter) *http.ResponseController {
+	rc := http.NewResponseController(w)
+	extendStreamDeadline(rc)
+	return rc
+}
+
+// flushStream sends the chunk written so far and extends the write deadline
+// for the next one, so a stream lasts as long as chunks keep coming
+func flushStream(rc *http.ResponseController) {
+	rc.Flush()
+	extendStreamDeadline(rc)
+}
+
+// extendStreamDeadline moves the write deadline --stream-write-timeout ahead
+func extendStreamDeadline(rc *http.ResponseController) {
+	if config.StreamWriteTimeout <= 0 {
+		return
+	}
+	if err := rc.SetWriteDeadline(time.Now().Add(config.StreamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Failed to extend stream write deadline: %v", err)
+	}
+}
+
+// pcm16Bytes packs quantized samples as little-endian 16-bit PCM
+func pcm16Bytes(samples []int) []byte {
+	data := make([]byte, 2*len(samples))
+	for i, v := range samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(int16(v)))
+	}
+	return data
+}
+
+// streamingWAVHeader returns a 16-bit mono WAV header whose sizes are left at
+// the maximum, the convention for WAV streams of unknown length
+func streamingWAVHeader(rate int) []byte {
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], 0xFFFFFFFF)
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], 1) // mono
+	binary.LittleEndian.PutUint32(header[24:], uint32(rate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(rate*2))
+	binary.LittleEndian.PutUint16(header[32:], 2)
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], 0xFFFFFFFF)
+	return header
+}
+
+// patchWAVSizes rewrites the RIFF and data sizes of a streaming header at the
+// start of f once dataBytes of PCM have followed it. It does nothing unless f is
+// a regular file, so pipes and terminals keep the open-ended header
+func patchWAVSizes(f *os.File, dataBytes int64) error {
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	// A file opened for appending may hold earlier content before the header
+	start, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+	headerAt := start - dataBytes - 44
+	if headerAt < 0 || dataBytes > 0xFFFFFFFF-36 {
+		return nil
+	}
+
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(36+dataBytes))
+	if _, err := f.WriteAt(size[:], headerAt+4); err != nil {
+		return fmt.Errorf("failed to patch WAV header: %w", err)
+	}
+	binary.LittleEndian.PutUint32(size[:], uint32(dataBytes))
+	if _, err := f.WriteAt(size[:], headerAt+40); err != nil {
+		return fmt.Errorf("failed to patch WAV header: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sdListenFDsStart is the first file descriptor systemd passes (SD_LISTEN_FDS_START)
+const sdListenFDsStart = 3
+
+// sdWyomingSocket is the FileDescriptorName= that marks a socket for the
+// Wyoming server; any other passed socket serves HTTP
+const sdWyomingSocket = "wyoming"
+
+// activatedListeners are the sockets passed by systemd socket activation, by
+// role ("http" or "wyoming"); empty when the server was not socket-activated
+var activatedListeners = map[string]net.Listener{}
+
+// setupSocketActivation adopts the sockets systemd passed in LISTEN_FDS
+// (when LISTEN_PID is this process) and clears the variables so child
+// processes do not adopt them too
+func setupSocketActivation() error {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	for i := 0; i < count; i++ {
+		role := "http"
+		if i < len(names) && names[i] == sdWyomingSocket {
+			role = sdWyomingSocket
+		}
+		if activatedListeners[role] != nil {
+			return fmt.Errorf("more than one %s socket passed", role)
+		}
+		f := os.NewFile(uintptr(sdListenFDsStart+i), "systemd-socket-"+strconv.Itoa(i))
+		listener, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("socket %d is not a listening socket: %w", i, err)
+		}
+		activatedListeners[role] = listener
+		log.Printf("Using systemd %s socket %s", role, listener.Addr())
+	}
+	return nil
+}
+
+// listen returns the socket-activated listener for a role, or listens on addr
+func listen(role string, addr string) (net.Listener, error) {
+	if listener := activatedListeners[role]; listener != nil {
+		return listener, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// sdNotify sends a state change (e.g. READY=1) to systemd for Type=notify
+// services; it does nothing when NOTIFY_SOCKET is not set
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:] // abstract namespace
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		log.Printf("systemd notify failed: %v", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		log.Printf("systemd notify failed: %v", err)
+	}
+}
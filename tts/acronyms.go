@@ -0,0 +1,116 @@
+package tts
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// acronymPattern matches inline escapes (\NASA\ forces spelling) and all-caps
+// tokens of two to four letters, optionally pluralized with a lower-case s
+var acronymPattern = regexp.MustCompile(`\\([A-Za-z0-9]+)\\|\b([A-Z]{2,4})(s?)\b`)
+
+// capsWords are short words commonly written in capitals for emphasis or as
+// word-acronyms; they are read as words rather than spelled
+var capsWords = map[string]bool{
+	"NO": true, "YES": true, "NOT": true, "ALL": true, "AND": true, "THE": true, "BUT": true,
+	"FOR": true, "YOU": true, "ARE": true, "WAS": true, "CAN": true, "DO": true, "DID": true,
+	"NOW": true, "NEW": true, "FREE": true, "STOP": true, "GO": true, "SO": true, "VERY": true,
+	"MUST": true, "NEVER": true, "ONLY": true, "WHY": true, "HOW": true, "WHAT": true, "HELP": true,
+	"NASA": true, "NATO": true, "OPEC": true, "FIFA": true, "AIDS": true, "GIF": true,
+	"PIN": true, "SIM": true, "RAM": true, "ROM": true, "LAN": true, "WAN": true, "JPEG": true, "JSON": true,
+	"II": true, "III": true, "IV": true, "VI": true, "VII": true, "VIII": true, "IX": true, "XI": true, "XII": true,
+}
+
+// capsHomographs are acronyms that are also common words ("the US" vs "tell US");
+// they are spelled only after an article
+var capsHomographs = map[string]bool{"US": true, "IT": true, "AM": true}
+
+// expandAcronyms spells inline \WORD\ escapes and, with heuristics, short
+// all-caps acronyms ("API" -> "ay pee eye", "CPUs" -> "see pee yous").
+// Mixed-case tokens are words, and sentences written entirely in capitals are
+// left alone
+func expandAcronyms(text string, heuristics bool) string {
+	matches := acronymPattern.FindAllStringSubmatchIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(text[last:m[0]])
+		last = m[1]
+
+		if m[2] >= 0 { // \escape\
+			b.WriteString(spellLetters(text[m[2]:m[3]]))
+			continue
+		}
+
+		word, plural := text[m[4]:m[5]], text[m[6]:m[7]]
+		if !heuristics || !isAcronym(text, m[0], word) {
+			b.WriteString(text[m[0]:m[1]])
+			continue
+		}
+		b.WriteString(spellLetters(word))
+		b.WriteString(plural)
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// isAcronym decides whether an all-caps token at start should be spelled
+func isAcronym(text string, start int, word string) bool {
+	if capsWords[word] {
+		return false
+	}
+	if capsHomographs[word] {
+		prev := strings.ToLower(previousWord(text[:start]))
+		if prev != "the" && prev != "a" && prev != "an" {
+			return false
+		}
+	}
+	return !shoutedSentence(text, start, start+len(word))
+}
+
+// spellLetters reads a token as letter names and digits separated by spaces
+func spellLetters(token string) string {
+	names := make([]string, 0, len(token))
+	for _, r := range strings.ToLower(token) {
+		switch {
+		case r >= '0' && r <= '9':
+			names = append(names, ones[r-'0'])
+		case letterNames[r] != "":
+			names = append(names, letterNames[r])
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// previousWord returns the last word of text
+func previousWord(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.TrimFunc(fields[len(fields)-1], func(r rune) bool { return !unicode.IsLetter(r) })
+}
+
+// shoutedSentence reports whether the sentence around text[start:end] has no
+// lower-case letters outside the token, i.e. is written in capitals
+func shoutedSentence(text string, start, end int) bool {
+	from := strings.LastIndexAny(text[:start], ".!?\n") + 1
+	to := len(text)
+	if i := strings.IndexAny(text[end:], ".!?\n"); i >= 0 {
+		to = end + i
+	}
+	sentence := text[from:start] + text[end:to]
+	hasLetters := false
+	for _, r := range sentence {
+		if unicode.IsLower(r) {
+			return false
+		}
+		hasLetters = hasLetters || unicode.IsLetter(r)
+	}
+	return hasLetters
+}
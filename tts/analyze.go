@@ -0,0 +1,80 @@
+package tts
+
+// ChunkAnalysis describes how the model sees one chunk of input text
+type ChunkAnalysis struct {
+	Text           string   `json:"text"`
+	Language       string   `json:"language"`
+	Normalized     string   `json:"normalized"`
+	Tokens         []string `json:"tokens"`
+	TextIDs        []int64  `json:"text_ids"`
+	UnknownOffsets []int    `json:"unknown_offsets"`
+	Duration       float32  `json:"duration_seconds"`
+	JoinsPrevious  bool     `json:"joins_previous,omitempty"`
+	Tone           bool     `json:"tone,omitempty"` // an audio token rendered as a tone or pause
+}
+
+// Analyze runs the text front-end and duration predictor on text without
+// synthesizing audio, exposing each intermediate stage for debugging
+func (tts *TextToSpeech) Analyze(text string, lang string, style *Style, speed float32) ([]ChunkAnalysis, error) {
+	tts.sessionsMu.RLock()
+	defer tts.sessionsMu.RUnlock()
+
+	pieces, err := planChunks(text, lang)
+	if err != nil {
+		return nil, err
+	}
+	analysis := make([]ChunkAnalysis, 0, len(pieces))
+
+	for _, piece := range pieces {
+		if piece.Tone != nil {
+			analysis = append(analysis, ChunkAnalysis{
+				Text:           piece.Text,
+				Tokens:         []string{},
+				TextIDs:        []int64{},
+				UnknownOffsets: []int{},
+				Duration:       piece.Tone.Duration,
+				JoinsPrevious:  true,
+				Tone:           true,
+			})
+			continue
+		}
+
+		chunk := piece.Text
+		normalized := preprocessText(chunk, piece.Lang)
+		textIDs, textMask := tts.textProcessor.Call([]string{chunk}, []string{piece.Lang})
+
+		runes := []rune(normalized)
+		tokens := make([]string, len(runes))
+		unknown := []int{}
+		for i, r := range runes {
+			tokens[i] = string(r)
+			if textIDs[0][i] < 0 {
+				unknown = append(unknown, i)
+			}
+		}
+
+		textIDsShape := []int64{1, int64(len(textIDs[0]))}
+		textMaskShape := []int64{1, 1, int64(len(textMask[0][0]))}
+		textIDsTensor := IntArrayToTensor(textIDs, textIDsShape)
+		textMaskTensor := ArrayToTensor(textMask, textMaskShape)
+		duration, err := tts.cachedDuration(frontEndKey([]string{chunk}, []string{piece.Lang}, style), textIDsTensor, textMaskTensor, style)
+		destroyTensor(textIDsTensor)
+		destroyTensor(textMaskTensor)
+		if err != nil {
+			return nil, err
+		}
+
+		analysis = append(analysis, ChunkAnalysis{
+			Text:           chunk,
+			Language:       piece.Lang,
+			Normalized:     normalized,
+			Tokens:         tokens,
+			TextIDs:        textIDs[0],
+			UnknownOffsets: unknown,
+			Duration:       duration[0] / speed,
+			JoinsPrevious:  !piece.NewChunk,
+		})
+	}
+
+	return analysis, nil
+}
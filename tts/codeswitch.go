@@ -0,0 +1,330 @@
+package tts
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Code-switch modes for foreign words embedded in a sentence
+const (
+	CodeSwitchOff           = "off"           // leave them to the sentence's front-end
+	CodeSwitchRoute         = "route"         // read them with their own language, transliterating scripts no language reads
+	CodeSwitchTransliterate = "transliterate" // only transliterate scripts the model cannot read into Latin letters
+)
+
+// CodeSwitchModes lists the supported code-switch modes
+var CodeSwitchModes = []string{CodeSwitchOff, CodeSwitchRoute, CodeSwitchTransliterate}
+
+// ParseCodeSwitch validates a code-switch mode ("" selects off)
+func ParseCodeSwitch(name string) (string, error) {
+	if name == "" {
+		return CodeSwitchOff, nil
+	}
+	for _, m := range CodeSwitchModes {
+		if m == name {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported code-switch mode: %s. Available: %v", name, CodeSwitchModes)
+}
+
+// Scripts told apart by code-switch detection
+const (
+	scriptNone = iota // digits, punctuation, spaces
+	scriptLatin
+	scriptHangul
+	scriptKana
+	scriptHan
+	scriptCyrillic
+	scriptGreek
+	scriptOther
+)
+
+// scriptOf returns the script of a letter
+func scriptOf(r rune) int {
+	switch {
+	case !unicode.IsLetter(r) && r != 'ー':
+		return scriptNone
+	case unicode.Is(unicode.Latin, r):
+		return scriptLatin
+	case unicode.Is(unicode.Hangul, r):
+		return scriptHangul
+	case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r), r == 'ー':
+		return scriptKana
+	case unicode.Is(unicode.Han, r):
+		return scriptHan
+	case unicode.Is(unicode.Cyrillic, r):
+		return scriptCyrillic
+	case unicode.Is(unicode.Greek, r):
+		return scriptGreek
+	}
+	return scriptOther
+}
+
+// isNativeScript reports whether a language's front-end reads a script
+func isNativeScript(script int, lang string) bool {
+	switch modelLanguage(lang) {
+	case "ko":
+		return script == scriptHangul
+	case "ja":
+		return script == scriptKana || script == scriptHan
+	}
+	return script == scriptLatin
+}
+
+// SwitchCode finds runs of words in another script than the sentence's
+// language (e.g. "Google Maps" in a Korean sentence) and, with CodeSwitchRoute,
+// tags them with the language that reads them: Latin words become English,
+// kana Japanese once a pack enables it. Cyrillic, Greek and kana without a
+// Japanese front-end are transliterated into Latin letters. Explicitly tagged
+// spans and audio tokens are left alone, and {{word|respelling}} spans are
+// routed whole; Hangul runs are already read as Korean by
+// SplitLanguageSegments. Run it before ApplyUnicodePolicy, which would drop
+// the unreadable scripts
+func SwitchCode(text string, lang string, mode string) string {
+	if mode == CodeSwitchOff || mode == "" || text == "" {
+		return text
+	}
+	if lang == "auto" || lang == "" {
+		lang = DetectLanguage(languageTagPattern.ReplaceAllString(text, ""))
+	}
+	return mapTextParts(text, func(part string) string {
+		return mapUntaggedText(part, func(untagged string) string {
+			return mapRespellings(untagged, func(plain string) string {
+				return switchRuns(plain, lang, mode)
+			}, func(span string) string {
+				return switchRespelling(span, lang, mode)
+			})
+		})
+	})
+}
+
+// mapRespellings applies fn to the text between {{word|respelling}} spans
+// and span to each span, so tags are never inserted inside one
+func mapRespellings(text string, fn func(string) string, span func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range respellPattern.FindAllStringIndex(text, -1) {
+		b.WriteString(fn(text[last:loc[0]]))
+		b.WriteString(span(text[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	b.WriteString(fn(text[last:]))
+	return b.String()
+}
+
+// switchRespelling routes a whole {{word|respelling}} span to English when its
+// respelling is written in Latin letters the sentence's language does not read
+func switchRespelling(span string, lang string, mode string) string {
+	if mode != CodeSwitchRoute || isNativeScript(scriptLatin, lang) {
+		return span
+	}
+	respelling := respellPattern.FindStringSubmatch(span)[2]
+	for _, r := range respelling {
+		if script := scriptOf(r); script != scriptNone {
+			if script == scriptLatin {
+				return "<en>" + span + "</en>"
+			}
+			break
+		}
+	}
+	return span
+}
+
+// mapUntaggedText applies fn to the text outside explicit language tags;
+// unclosed tags are left for SplitLanguageSegments to report
+func mapUntaggedText(text string, fn func(string) string) string {
+	var b strings.Builder
+	rest := text
+	for {
+		loc := languageTagPattern.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			break
+		}
+		closing := "</" + rest[loc[2]:loc[3]] + ">"
+		end := strings.Index(rest[loc[1]:], closing)
+		if end < 0 {
+			break
+		}
+		end += loc[1] + len(closing)
+		b.WriteString(fn(rest[:loc[0]]))
+		b.WriteString(rest[loc[0]:end])
+		rest = rest[end:]
+	}
+	b.WriteString(fn(rest))
+	return b.String()
+}
+
+// switchRuns rewrites the foreign-script runs of untagged text
+func switchRuns(text string, lang string, mode string) string {
+	runes := []rune(text)
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		script := scriptOf(runes[i])
+		if script == scriptNone || script == scriptHangul || script == scriptOther || isNativeScript(script, lang) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		// Extend the run over letters of the same script and the spaces,
+		// digits and joiners between its words
+		end := i + 1
+		for j := i + 1; j < len(runes); j++ {
+			if s := scriptOf(runes[j]); s == script || unicode.Is(unicode.Mn, runes[j]) {
+				end = j + 1
+			} else if s != scriptNone || !(unicode.IsSpace(runes[j]) || unicode.IsDigit(runes[j]) || strings.ContainsRune("'’-.&", runes[j])) {
+				break
+			}
+		}
+		b.WriteString(switchRun(string(runes[i:end]), script, lang, mode))
+		i = end
+	}
+	return b.String()
+}
+
+// switchRun routes or transliterates one foreign-script run
+func switchRun(run string, script int, lang string, mode string) string {
+	route := mode == CodeSwitchRoute
+	switch script {
+	case scriptLatin:
+		if route {
+			return "<en>" + run + "</en>"
+		}
+		return run
+	case scriptKana:
+		if route && isValidLang("ja") {
+			return "<ja>" + run + "</ja>"
+		}
+		run = romanizeKana(run)
+	case scriptCyrillic, scriptGreek:
+		run = transliterateAlphabet(run)
+	default:
+		// Han outside Japanese has no reading to fall back on
+		return run
+	}
+	if route && !isNativeScript(scriptLatin, lang) {
+		return "<en>" + run + "</en>"
+	}
+	return run
+}
+
+// alphabetLetters maps lowercase Cyrillic and Greek letters to Latin
+var alphabetLetters = map[rune]string{
+	// Cyrillic (Russian, Ukrainian, Belarusian)
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "w",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+	'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+	'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps",
+	'ω': "o",
+}
+
+// transliterateAlphabet spells Cyrillic and Greek letters with Latin ones,
+// keeping capitals and dropping accents
+func transliterateAlphabet(text string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		latin, ok := alphabetLetters[unicode.ToLower(r)]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+		if unicode.IsUpper(r) && latin != "" {
+			latin = strings.ToUpper(latin[:1]) + latin[1:]
+		}
+		b.WriteString(latin)
+	}
+	return norm.NFC.String(b.String())
+}
+
+// kanaSyllables are the Hepburn readings of hiragana; katakana is read
+// through its hiragana counterpart
+var kanaSyllables = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n", 'ゔ': "vu",
+}
+
+// smallKanaVowels are the small kana that replace the vowel of the kana
+// before them (きゃ kya, ファ fa)
+var smallKanaVowels = map[rune]string{
+	'ゃ': "a", 'ゅ': "u", 'ょ': "o", 'ゎ': "a",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+}
+
+// romanizeKana spells hiragana and katakana in Hepburn romaji: small ya/yu/yo
+// form digraphs (しゃ sha), っ doubles the next consonant and ー lengthens
+// the vowel before it
+func romanizeKana(text string) string {
+	var out []string
+	double := false
+	for _, r := range text {
+		if r >= 'ァ' && r <= 'ヶ' {
+			r -= 'ァ' - 'ぁ'
+		}
+		last := ""
+		if len(out) > 0 {
+			last = out[len(out)-1]
+		}
+		switch {
+		case r == 'っ':
+			double = true
+			continue
+		case r == 'ー':
+			if last != "" {
+				out[len(out)-1] += last[len(last)-1:]
+			}
+			continue
+		case smallKanaVowels[r] != "":
+			vowel := smallKanaVowels[r]
+			if last == "" {
+				out = append(out, vowel)
+				continue
+			}
+			stem := last[:len(last)-1]
+			if (r == 'ゃ' || r == 'ゅ' || r == 'ょ') && !strings.HasSuffix(stem, "sh") && !strings.HasSuffix(stem, "ch") && !strings.HasSuffix(stem, "j") {
+				stem += "y"
+			}
+			out[len(out)-1] = stem + vowel
+			continue
+		}
+
+		syllable, ok := kanaSyllables[r]
+		if !ok {
+			syllable = string(r)
+		}
+		if double && ok && r != 'ん' && !strings.ContainsRune("aiueo", rune(syllable[0])) {
+			if strings.HasPrefix(syllable, "ch") {
+				syllable = "t" + syllable
+			} else {
+				syllable = syllable[:1] + syllable
+			}
+		}
+		double = false
+		out = append(out, syllable)
+	}
+	return strings.Join(out, "")
+}
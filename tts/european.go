@@ -0,0 +1,624 @@
+package tts
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// europeanLanguage holds the reading rules of one European language
+type europeanLanguage struct {
+	cardinal func(n int64) string
+	count    func(n int64) string // cardinal before a noun ("un euro", "ein Euro")
+	ordinal  func(n int64, feminine bool) string
+	year     func(n int64) string
+	date     func(day, month int64, year string, article string) string
+
+	months        []string
+	abbreviations [][2]string // written form and reading, longest first
+	minus         string
+	decimal       string // word for the decimal comma
+	digitDecimals bool   // read the decimals digit by digit instead of as a number
+	percent       string
+	euro, euros   string
+	cents         string // joins euros and cents
+
+	numberPattern  *regexp.Regexp
+	ordinalPattern *regexp.Regexp // number and ordinal marker (1.º, 1er, ...)
+	abbrevPattern  *regexp.Regexp
+}
+
+// europeanLanguages are the languages normalizeEuropean knows. German only
+// takes effect once a language pack makes "de" available
+var europeanLanguages = map[string]*europeanLanguage{
+	"es": {
+		cardinal: esCardinal,
+		count:    func(n int64) string { return esApocope(esCardinal(n)) },
+		ordinal:  esOrdinal,
+		year:     esCardinal,
+		date: func(day, month int64, year string, _ string) string {
+			words := esCardinal(day)
+			if day == 1 {
+				words = "primero"
+			}
+			words += " de " + esMonths[month-1]
+			if year != "" {
+				words += " de " + year
+			}
+			return words
+		},
+		months: esMonths,
+		abbreviations: [][2]string{
+			{"EE. UU.", "Estados Unidos"}, {"EE.UU.", "Estados Unidos"}, {"p. ej.", "por ejemplo"},
+			{"Srta.", "señorita"}, {"Sra.", "señora"}, {"Sr.", "señor"}, {"Dra.", "doctora"}, {"Dr.", "doctor"},
+			{"Uds.", "ustedes"}, {"Ud.", "usted"}, {"aprox.", "aproximadamente"}, {"etc.", "etcétera"},
+			{"núm.", "número"}, {"nº", "número"}, {"Av.", "avenida"}, {"pág.", "página"},
+		},
+		minus:          "menos",
+		decimal:        "coma",
+		percent:        "por ciento",
+		euro:           "euro",
+		euros:          "euros",
+		cents:          " con ",
+		numberPattern:  regexp.MustCompile(`(^|[^\p{L}\p{N}.,])(-?)(\d{1,3}(?:\.\d{3})+|\d+)(,\d+)?`),
+		ordinalPattern: regexp.MustCompile(`(^|[^\p{L}\p{N}.,])(\d+)\.?(º|ª|er)`),
+	},
+	"fr": {
+		cardinal: frCardinal,
+		count:    frCardinal,
+		ordinal:  frOrdinal,
+		year:     frCardinal,
+		date: func(day, month int64, year string, _ string) string {
+			words := frCardinal(day)
+			if day == 1 {
+				words = "premier"
+			}
+			words += " " + frMonths[month-1]
+			if year != "" {
+				words += " " + year
+			}
+			return words
+		},
+		months: frMonths,
+		abbreviations: [][2]string{
+			{"p. ex.", "par exemple"}, {"Mlle", "mademoiselle"}, {"Mme", "madame"}, {"M.", "monsieur"},
+			{"Dr", "docteur"}, {"etc.", "et cetera"}, {"n°", "numéro"}, {"av.", "avenue"}, {"bd", "boulevard"},
+			{"Ste", "sainte"}, {"St", "saint"},
+		},
+		minus:          "moins",
+		decimal:        "virgule",
+		percent:        "pour cent",
+		euro:           "euro",
+		euros:          "euros",
+		cents:          " ",
+		numberPattern:  regexp.MustCompile(`(^|[^\p{L}\p{N}.,])(-?)(\d{1,3}(?:[.\x{00A0}\x{202F} ]\d{3})+|\d+)(,\d+)?`),
+		ordinalPattern: regexp.MustCompile(`(^|[^\p{L}\p{N}.,])(\d+)(ère|ème|re|er|e)\b`),
+	},
+	"de": {
+		cardinal: deCardinal,
+		count: func(n int64) string {
+			if words, ok := strings.CutSuffix(deCardinal(n), "eins"); ok {
+				return words + "ein"
+			}
+			return deCardinal(n)
+		},
+		ordinal: func(n int64, _ bool) string {
+			return deOrdinalStem(n) + "e"
+		},
+		year: deYear,
+		date: func(day, month int64, year string, article string) string {
+			words := deOrdinalStem(day) + deOrdinalEnding(article) + " " + deMonths[month-1]
+			if year != "" {
+				words += " " + year
+			}
+			return words
+		},
+		months: deMonths,
+		abbreviations: [][2]string{
+			{"z. B.", "zum Beispiel"}, {"z.B.", "zum Beispiel"}, {"d. h.", "das heißt"}, {"d.h.", "das heißt"},
+			{"u. a.", "unter anderem"}, {"usw.", "und so weiter"}, {"bzw.", "beziehungsweise"}, {"evtl.", "eventuell"},
+			{"Nr.", "Nummer"}, {"Str.", "Straße"}, {"ca.", "circa"}, {"Dr.", "Doktor"}, {"Hr.", "Herr"}, {"Fr.", "Frau"},
+		},
+		minus:          "minus",
+		decimal:        "Komma",
+		digitDecimals:  true,
+		percent:        "Prozent",
+		euro:           "Euro",
+		euros:          "Euro",
+		cents:          " ",
+		numberPattern:  regexp.MustCompile(`(^|[^\p{L}\p{N}.,])(-?)(\d{1,3}(?:\.\d{3})+|\d+)(,\d+)?`),
+		ordinalPattern: nil, // German ordinals ("3.") are only read before a month name
+	},
+}
+
+var (
+	esMonths = []string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"}
+	frMonths = []string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"}
+	deMonths = []string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"}
+
+	// numericDatePattern matches day/month/year dates written 3/5/2024, 03.05.2024 or 3-5-2024
+	numericDatePattern = regexp.MustCompile(`(?i)(\b(?:am|vom|zum|im|beim|seit dem|bis zum|der|den|dem)\s+)?\b(\d{1,2})[./-](\d{1,2})[./-](\d{4})\b`)
+	// germanDayPattern matches "3. Mai", optionally after the word that decides its case
+	germanDayPattern = regexp.MustCompile(`(?i)(\b(?:am|vom|zum|im|beim|seit dem|bis zum|der|den|dem)\s+)?\b(\d{1,2})\.\s*(Januar|Februar|März|April|Mai|Juni|Juli|August|September|Oktober|November|Dezember)\b`)
+	// europeanAmountPattern matches a number directly before or after % and €
+	europeanAmountPattern = regexp.MustCompile(`(€\s?)?(\d{1,3}(?:[.\x{00A0}\x{202F} ]\d{3})+|\d+)(,\d+)?(\s?(?:%|€))?`)
+)
+
+func init() {
+	for _, lang := range europeanLanguages {
+		alternatives := make([]string, len(lang.abbreviations))
+		for i, abbrev := range lang.abbreviations {
+			alternatives[i] = regexp.QuoteMeta(abbrev[0])
+		}
+		// The trailing group keeps "St" from matching inside "Stade"
+		lang.abbrevPattern = regexp.MustCompile(`(^|[^\p{L}])(` + strings.Join(alternatives, "|") + `)([^\p{L}]|$)`)
+	}
+}
+
+// normalizeEuropean expands abbreviations in Spanish, French and German text
+// and verbalizes dates, ordinals, amounts and numbers according to style
+func normalizeEuropean(text string, lang string, style NumberStyle) string {
+	rules := europeanLanguages[lang]
+	if rules == nil {
+		return text
+	}
+
+	// Adjacent abbreviations share the character between them, so a second pass catches the rest
+	for range 2 {
+		text = rules.abbrevPattern.ReplaceAllStringFunc(text, func(match string) string {
+			m := rules.abbrevPattern.FindStringSubmatch(match)
+			for _, abbrev := range rules.abbreviations {
+				if abbrev[0] == m[2] {
+					return m[1] + abbrev[1] + m[3]
+				}
+			}
+			return match
+		})
+	}
+	if style == NumberStyleNone {
+		return text
+	}
+
+	text = numericDatePattern.ReplaceAllStringFunc(text, func(match string) string {
+		m := numericDatePattern.FindStringSubmatch(match)
+		day, _ := strconv.ParseInt(m[2], 10, 64)
+		month, _ := strconv.ParseInt(m[3], 10, 64)
+		year, _ := strconv.ParseInt(m[4], 10, 64)
+		if day < 1 || day > 31 || month < 1 || month > 12 {
+			return match
+		}
+		return m[1] + rules.date(day, month, rules.year(year), strings.TrimSpace(m[1]))
+	})
+	if lang == "de" {
+		text = germanDayPattern.ReplaceAllStringFunc(text, func(match string) string {
+			m := germanDayPattern.FindStringSubmatch(match)
+			day, _ := strconv.ParseInt(m[2], 10, 64)
+			for month, name := range deMonths {
+				if strings.EqualFold(name, m[3]) && day >= 1 && day <= 31 {
+					return m[1] + rules.date(day, int64(month+1), "", strings.TrimSpace(m[1]))
+				}
+			}
+			return match
+		})
+	}
+	if rules.ordinalPattern != nil {
+		text = rules.ordinalPattern.ReplaceAllStringFunc(text, func(match string) string {
+			m := rules.ordinalPattern.FindStringSubmatch(match)
+			n, err := strconv.ParseInt(m[2], 10, 64)
+			if err != nil || n == 0 {
+				return match
+			}
+			marker := m[3]
+			if marker == "er" && lang == "es" {
+				// 1.er and 3.er are the shortened primer and tercer
+				return m[1] + strings.TrimSuffix(esOrdinal(n, false), "o")
+			}
+			return m[1] + rules.ordinal(n, marker == "ª" || marker == "re" || marker == "ère")
+		})
+	}
+
+	text = europeanAmountPattern.ReplaceAllStringFunc(text, func(match string) string {
+		m := europeanAmountPattern.FindStringSubmatch(match)
+		before, after := strings.TrimSpace(m[1]), strings.TrimSpace(m[4])
+		if before == "" && after == "" || before != "" && after != "" {
+			return match
+		}
+		n, err := strconv.ParseInt(stripThousands(m[2]), 10, 64)
+		if err != nil {
+			return match
+		}
+		if after == "%" {
+			return rules.readNumber(n, m[2], m[3], NumberStyleCardinal) + " " + rules.percent
+		}
+		if m[3] != "" && len(m[3]) != 3 {
+			return rules.readNumber(n, m[2], m[3], NumberStyleCardinal) + " " + rules.euros
+		}
+
+		// Two decimals are cents: "tres euros con cincuenta", "drei Euro fünfzig"
+		words := rules.count(n) + " " + rules.euros
+		if n == 1 {
+			words = rules.count(n) + " " + rules.euro
+		}
+		if cents, _ := strconv.ParseInt(strings.TrimPrefix(m[3], ","), 10, 64); cents > 0 {
+			words += rules.cents + rules.cardinal(cents)
+		}
+		return words
+	})
+
+	return rules.numberPattern.ReplaceAllStringFunc(text, func(match string) string {
+		m := rules.numberPattern.FindStringSubmatch(match)
+		n, err := strconv.ParseInt(stripThousands(m[3]), 10, 64)
+		if err != nil {
+			return match
+		}
+		words := rules.readNumber(n, m[3], m[4], style)
+		if m[2] != "" {
+			words = rules.minus + " " + words
+		}
+		return m[1] + words
+	})
+}
+
+// readNumber reads a number (written with its thousands separators) and its
+// ",decimals" in the given style
+func (rules *europeanLanguage) readNumber(n int64, written string, fraction string, style NumberStyle) string {
+	var words string
+	switch {
+	case style == NumberStyleDigits:
+		words = rules.digits(stripThousands(written))
+	case style == NumberStyleOrdinal && fraction == "" && n > 0:
+		words = rules.ordinal(n, false)
+	case style == NumberStyleYear && fraction == "":
+		words = rules.year(n)
+	default:
+		words = rules.cardinal(n)
+	}
+	if fraction != "" {
+		decimals := fraction[1:]
+		if d, err := strconv.ParseInt(decimals, 10, 64); err == nil && !rules.digitDecimals && decimals[0] != '0' {
+			words += " " + rules.decimal + " " + rules.cardinal(d)
+		} else {
+			words += " " + rules.decimal + " " + rules.digits(decimals)
+		}
+	}
+	return words
+}
+
+// digits reads each digit on its own
+func (rules *europeanLanguage) digits(digits string) string {
+	words := make([]string, 0, len(digits))
+	for _, d := range digits {
+		words = append(words, rules.cardinal(int64(d-'0')))
+	}
+	return strings.Join(words, " ")
+}
+
+// stripThousands removes thousands separators from a written number
+func stripThousands(written string) string {
+	return strings.NewReplacer(".", "", " ", "", " ", "", " ", "").Replace(written)
+}
+
+var (
+	esSmall = []string{"cero", "uno", "dos", "tres", "cuatro", "cinco", "seis", "siete", "ocho", "nueve",
+		"diez", "once", "doce", "trece", "catorce", "quince", "dieciséis", "diecisiete", "dieciocho", "diecinueve",
+		"veinte", "veintiuno", "veintidós", "veintitrés", "veinticuatro", "veinticinco", "veintiséis", "veintisiete", "veintiocho", "veintinueve"}
+	esTens     = []string{"", "", "", "treinta", "cuarenta", "cincuenta", "sesenta", "setenta", "ochenta", "noventa"}
+	esHundreds = []string{"", "ciento", "doscientos", "trescientos", "cuatrocientos", "quinientos", "seiscientos", "setecientos", "ochocientos", "novecientos"}
+	esOrdinals = []string{"", "primero", "segundo", "tercero", "cuarto", "quinto", "sexto", "séptimo", "octavo", "noveno", "décimo"}
+)
+
+// esBelow1000 reads 1..999 in Spanish
+func esBelow1000(n int64) string {
+	if n == 100 {
+		return "cien"
+	}
+	var parts []string
+	if h := n / 100; h > 0 {
+		parts = append(parts, esHundreds[h])
+	}
+	switch r := n % 100; {
+	case r == 0:
+	case r < 30:
+		parts = append(parts, esSmall[r])
+	case r%10 == 0:
+		parts = append(parts, esTens[r/10])
+	default:
+		parts = append(parts, esTens[r/10]+" y "+esSmall[r%10])
+	}
+	return strings.Join(parts, " ")
+}
+
+// esApocope shortens a final "uno" before mil and millón ("veintiún mil")
+func esApocope(words string) string {
+	if w, ok := strings.CutSuffix(words, "veintiuno"); ok {
+		return w + "veintiún"
+	}
+	if words == "uno" || strings.HasSuffix(words, " uno") {
+		return strings.TrimSuffix(words, "uno") + "un"
+	}
+	return words
+}
+
+// esBelowMillion reads 1..999999 in Spanish
+func esBelowMillion(n int64, apocope bool) string {
+	var parts []string
+	if t := n / 1000; t == 1 {
+		parts = append(parts, "mil")
+	} else if t > 1 {
+		parts = append(parts, esApocope(esBelow1000(t))+" mil")
+	}
+	if r := n % 1000; r > 0 {
+		words := esBelow1000(r)
+		if apocope {
+			words = esApocope(words)
+		}
+		parts = append(parts, words)
+	}
+	return strings.Join(parts, " ")
+}
+
+// esCardinal reads a non-negative integer in Spanish (long scale: billón is 10^12)
+func esCardinal(n int64) string {
+	if n == 0 {
+		return esSmall[0]
+	}
+	var parts []string
+	if b := n / 1e12; b == 1 {
+		parts = append(parts, "un billón")
+	} else if b > 1 {
+		parts = append(parts, esApocope(esCardinal(b))+" billones")
+	}
+	if m := n / 1e6 % 1e6; m == 1 {
+		parts = append(parts, "un millón")
+	} else if m > 1 {
+		parts = append(parts, esBelowMillion(m, true)+" millones")
+	}
+	if r := n % 1e6; r > 0 {
+		parts = append(parts, esBelowMillion(r, false))
+	}
+	return strings.Join(parts, " ")
+}
+
+// esOrdinal reads 1..10 as Spanish ordinals, larger numbers as cardinals as is
+// usual in speech
+func esOrdinal(n int64, feminine bool) string {
+	if n < 1 || n >= int64(len(esOrdinals)) {
+		return esCardinal(n)
+	}
+	if feminine {
+		return strings.TrimSuffix(esOrdinals[n], "o") + "a"
+	}
+	return esOrdinals[n]
+}
+
+var (
+	frSmall = []string{"zéro", "un", "deux", "trois", "quatre", "cinq", "six", "sept", "huit", "neuf",
+		"dix", "onze", "douze", "treize", "quatorze", "quinze", "seize"}
+	frTens = []string{"", "dix", "vingt", "trente", "quarante", "cinquante", "soixante"}
+)
+
+// frBelow100 reads 0..99 in French
+func frBelow100(n int64) string {
+	switch {
+	case n <= 16:
+		return frSmall[n]
+	case n < 20:
+		return "dix-" + frSmall[n-10]
+	case n < 70:
+		switch t, u := n/10, n%10; u {
+		case 0:
+			return frTens[t]
+		case 1:
+			return frTens[t] + " et un"
+		default:
+			return frTens[t] + "-" + frSmall[u]
+		}
+	case n < 80:
+		if n == 71 {
+			return "soixante et onze"
+		}
+		return "soixante-" + frBelow100(n-60)
+	case n == 80:
+		return "quatre-vingts"
+	}
+	return "quatre-vingt-" + frBelow100(n-80)
+}
+
+// frBelow1000 reads 1..999 in French; before "mille" the plural s of vingts
+// and cents is dropped
+func frBelow1000(n int64, final bool) string {
+	var words string
+	h, r := n/100, n%100
+	switch {
+	case h == 1:
+		words = "cent"
+	case h > 1:
+		words = frSmall[h] + " cent"
+		if r == 0 {
+			words += "s"
+		}
+	}
+	if r > 0 {
+		if words != "" {
+			words += " "
+		}
+		words += frBelow100(r)
+	}
+	if !final {
+		if w, ok := strings.CutSuffix(words, "vingts"); ok {
+			words = w + "vingt"
+		} else if w, ok := strings.CutSuffix(words, "cents"); ok {
+			words = w + "cent"
+		}
+	}
+	return words
+}
+
+// frCardinal reads a non-negative integer in French (long scale: billion is 10^12)
+func frCardinal(n int64) string {
+	if n == 0 {
+		return frSmall[0]
+	}
+	var parts []string
+	for _, scale := range []struct {
+		size int64
+		name string
+	}{{1e18, "trillion"}, {1e15, "billiard"}, {1e12, "billion"}, {1e9, "milliard"}, {1e6, "million"}} {
+		if count := n / scale.size % 1000; count == 1 {
+			parts = append(parts, "un "+scale.name)
+		} else if count > 1 {
+			parts = append(parts, frBelow1000(count, true)+" "+scale.name+"s")
+		}
+	}
+	if t := n / 1000 % 1000; t == 1 {
+		parts = append(parts, "mille")
+	} else if t > 1 {
+		parts = append(parts, frBelow1000(t, false)+" mille")
+	}
+	if r := n % 1000; r > 0 {
+		parts = append(parts, frBelow1000(r, true))
+	}
+	return strings.Join(parts, " ")
+}
+
+// frOrdinal reads n as a French ordinal ("premier", "vingt et unième")
+func frOrdinal(n int64, feminine bool) string {
+	if n == 1 {
+		if feminine {
+			return "première"
+		}
+		return "premier"
+	}
+	words := frCardinal(n)
+	switch {
+	case strings.HasSuffix(words, "vingts"), strings.HasSuffix(words, "cents"):
+		words = strings.TrimSuffix(words, "s")
+	}
+	switch {
+	case strings.HasSuffix(words, "cinq"):
+		return words + "uième"
+	case strings.HasSuffix(words, "neuf"):
+		return strings.TrimSuffix(words, "f") + "vième"
+	case strings.HasSuffix(words, "e"):
+		return strings.TrimSuffix(words, "e") + "ième"
+	}
+	return words + "ième"
+}
+
+var (
+	deSmall = []string{"null", "eins", "zwei", "drei", "vier", "fünf", "sechs", "sieben", "acht", "neun",
+		"zehn", "elf", "zwölf", "dreizehn", "vierzehn", "fünfzehn", "sechzehn", "siebzehn", "achtzehn", "neunzehn"}
+	deTens = []string{"", "", "zwanzig", "dreißig", "vierzig", "fünfzig", "sechzig", "siebzig", "achtzig", "neunzig"}
+)
+
+// deBelow100 reads 1..99 in German ("einundzwanzig")
+func deBelow100(n int64) string {
+	if n < 20 {
+		return deSmall[n]
+	}
+	t, u := n/10, n%10
+	if u == 0 {
+		return deTens[t]
+	}
+	return deCombining(u) + "und" + deTens[t]
+}
+
+// deCombining is the form of 1..9 inside a compound ("ein" rather than "eins")
+func deCombining(n int64) string {
+	if n == 1 {
+		return "ein"
+	}
+	return deSmall[n]
+}
+
+// deBelow1000 reads 1..999 in German as one word
+func deBelow1000(n int64) string {
+	var words string
+	if h := n / 100; h > 0 {
+		words = deCombining(h) + "hundert"
+	}
+	if r := n % 100; r > 0 {
+		words += deBelow100(r)
+	}
+	return words
+}
+
+// deCardinal reads a non-negative integer in German (long scale: Billion is 10^12)
+func deCardinal(n int64) string {
+	if n == 0 {
+		return deSmall[0]
+	}
+	var parts []string
+	for _, scale := range []struct {
+		size          int64
+		one, name, pl string
+	}{
+		{1e18, "eine Trillion", "Trillion", "Trillionen"},
+		{1e15, "eine Billiarde", "Billiarde", "Billiarden"},
+		{1e12, "eine Billion", "Billion", "Billionen"},
+		{1e9, "eine Milliarde", "Milliarde", "Milliarden"},
+		{1e6, "eine Million", "Million", "Millionen"},
+	} {
+		if count := n / scale.size % 1000; count == 1 {
+			parts = append(parts, scale.one)
+		} else if count > 1 {
+			parts = append(parts, deBelow1000(count)+" "+scale.pl)
+		}
+	}
+	var words string
+	if t := n / 1000 % 1000; t > 0 {
+		words = strings.TrimSuffix(deBelow1000(t), "eins")
+		if strings.HasSuffix(deBelow1000(t), "eins") {
+			words += "ein"
+		}
+		words += "tausend"
+	}
+	if r := n % 1000; r > 0 {
+		words += deBelow1000(r)
+	}
+	if words != "" {
+		parts = append(parts, words)
+	}
+	return strings.Join(parts, " ")
+}
+
+// deYear reads 1100..1999 in hundreds ("neunzehnhundertneunundneunzig"),
+// other years as cardinals
+func deYear(n int64) string {
+	if n >= 1100 && n < 2000 {
+		return deBelow100(n/100) + "hundert" + deBelow1000(n%100)
+	}
+	return deCardinal(n)
+}
+
+// deOrdinalStem returns a German ordinal without its ending ("dritt", "zwanzigst")
+func deOrdinalStem(n int64) string {
+	switch r := n % 100; {
+	case r == 1 && n < 100:
+		return "erst"
+	case r == 3 && n < 100:
+		return "dritt"
+	case r == 7 && n < 100:
+		return "siebt"
+	case r == 8 && n < 100:
+		return "acht"
+	case r > 0 && r < 20:
+		if n >= 100 {
+			return deCardinal(n-r) + deOrdinalStem(r)
+		}
+		return deSmall[r] + "t"
+	}
+	return deCardinal(n) + "st"
+}
+
+// deOrdinalEnding picks the ordinal's ending from the word before it: dative
+// after am, vom, zum ("am dritten Mai"), nominative after der, else "dritter"
+func deOrdinalEnding(before string) string {
+	switch strings.ToLower(before) {
+	case "am", "vom", "zum", "im", "beim", "seit dem", "bis zum", "den", "dem":
+		return "en"
+	case "der":
+		return "e"
+	}
+	return "er"
+}
@@ -0,0 +1,82 @@
+package tts
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fallbackAssets holds the JSON assets of the default model export, compiled
+// into the binary (see fallback/README.md) and used when a file is missing
+// from the default pack's directory
+//
+//go:generate sh -c "mkdir -p fallback/onnx && cp ../assets/onnx/tts.json ../assets/onnx/unicode_indexer.json fallback/onnx/ && cp -R ../assets/voice_styles fallback/"
+//go:embed all:fallback
+var fallbackAssets embed.FS
+
+// fallbackDir is the directory of the pack the embedded assets belong to;
+// files of other packs never fall back since they come from other exports
+var fallbackDir string
+
+// SetFallbackDir sets the model pack directory the embedded assets stand in
+// for. An empty dir disables the fallback
+func SetFallbackDir(dir string) {
+	fallbackDir = dir
+}
+
+// ReadAsset reads an asset file, falling back to the embedded copy of
+// onnx/<name> or voice_styles/[lang/]<name> of the default pack when it does
+// not exist on disk
+func ReadAsset(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return data, err
+	}
+	if name, ok := fallbackName(path); ok {
+		return fallbackAssets.ReadFile(name)
+	}
+	return nil, err
+}
+
+// AssetExists reports whether an asset file exists on disk or embedded
+func AssetExists(path string) bool {
+	if _, err := os.Stat(path); err == nil {
+		return true
+	}
+	_, ok := fallbackName(path)
+	return ok
+}
+
+// IsEmbeddedAsset reports whether an asset is missing on disk and served from the embedded copy
+func IsEmbeddedAsset(path string) bool {
+	if _, err := os.Stat(path); err == nil {
+		return false
+	}
+	_, ok := fallbackName(path)
+	return ok
+}
+
+// fallbackName returns the embedded file for an asset path under
+// fallbackDir: onnx/tts.json, voice_styles/F1.json or a language-tuned style
+// such as voice_styles/ko/F1.json
+func fallbackName(path string) (string, bool) {
+	if fallbackDir == "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(fallbackDir, path)
+	if err != nil {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if !strings.HasPrefix(rel, "onnx/") && !strings.HasPrefix(rel, "voice_styles/") {
+		return "", false
+	}
+	name := "fallback/" + rel
+	if info, err := fs.Stat(fallbackAssets, name); err == nil && !info.IsDir() {
+		return name, true
+	}
+	return "", false
+}
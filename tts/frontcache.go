@@ -0,0 +1,164 @@
+package tts
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// frontEndCacheLimit is the byte budget of each engine's front-end cache
+var frontEndCacheLimit int64 = 64 << 20
+
+// SetFrontEndCacheSize sets the byte budget of the front-end cache of
+// engines loaded afterwards; 0 disables caching
+func SetFrontEndCacheSize(bytes int64) {
+	frontEndCacheLimit = bytes
+}
+
+// frontEndCache keeps duration-predictor and text-encoder outputs, keyed on
+// the normalized chunk text, language and voice style, so re-rendering a script
+// with other steps, seeds or sampler settings skips both stages. Both models
+// are conditioned on the style, so a different voice is a different key
+type frontEndCache struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+	order *list.List // most recently used first
+	items map[string]*list.Element
+}
+
+// frontEndEntry holds the cached outputs for one key; either may be missing
+// (Analyze only runs the duration predictor)
+type frontEndEntry struct {
+	key      string
+	duration []float32
+	emb      []float32
+	embShape ort.Shape
+}
+
+// size approximates the entry's memory use in bytes
+func (e *frontEndEntry) size() int64 {
+	return int64(4*(len(e.duration)+len(e.emb)) + len(e.key))
+}
+
+// newFrontEndCache returns a cache with the current budget, or nil when caching is disabled
+func newFrontEndCache() *frontEndCache {
+	if frontEndCacheLimit <= 0 {
+		return nil
+	}
+	return &frontEndCache{limit: frontEndCacheLimit, order: list.New(), items: map[string]*list.Element{}}
+}
+
+// frontEndKey identifies the front-end inputs of a batch
+func frontEndKey(textList []string, langList []string, style *Style) string {
+	return style.key + "\x00" + strings.Join(langList, "\x01") + "\x00" + strings.Join(textList, "\x01")
+}
+
+// styleKey fingerprints a voice style's tensors
+func styleKey(ttl []float32, dp []float32) string {
+	h := sha256.New()
+	var buf [4]byte
+	for _, values := range [][]float32{ttl, dp} {
+		for _, v := range values {
+			binary.LittleEndian.PutUint32(buf[:], math.Float32bits(v))
+			h.Write(buf[:])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns a copy of the entry for key
+func (c *frontEndCache) get(key string) (frontEndEntry, bool) {
+	if c == nil {
+		return frontEndEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return frontEndEntry{}, false
+	}
+	c.order.MoveToFront(elem)
+	return *elem.Value.(*frontEndEntry), true
+}
+
+// update merges outputs into the entry for key and evicts the least recently
+// used entries over the budget
+func (c *frontEndCache) update(key string, fill func(*frontEndEntry)) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if ok {
+		c.used -= elem.Value.(*frontEndEntry).size()
+	} else {
+		elem = c.order.PushFront(&frontEndEntry{key: key})
+		c.items[key] = elem
+	}
+	entry := elem.Value.(*frontEndEntry)
+	fill(entry)
+	c.used += entry.size()
+	c.order.MoveToFront(elem)
+
+	for c.used > c.limit && c.order.Len() > 1 {
+		oldest := c.order.Back()
+		evicted := oldest.Value.(*frontEndEntry)
+		c.order.Remove(oldest)
+		delete(c.items, evicted.key)
+		c.used -= evicted.size()
+	}
+}
+
+// cachedDuration returns the unscaled duration prediction for key, running the predictor on a miss
+func (tts *TextToSpeech) cachedDuration(key string, textIDsTensor *ort.Tensor[int64], textMaskTensor *ort.Tensor[float32], style *Style) ([]float32, error) {
+	if entry, ok := tts.frontEnd.get(key); ok && entry.duration != nil {
+		return append([]float32(nil), entry.duration...), nil
+	}
+	duration, err := tts.predictDuration(textIDsTensor, textMaskTensor, style)
+	if err != nil {
+		return nil, err
+	}
+	tts.frontEnd.update(key, func(e *frontEndEntry) {
+		e.duration = append([]float32(nil), duration...)
+	})
+	return duration, nil
+}
+
+// cachedTextEmbedding returns the text-encoder output for key, running the encoder on a miss.
+// The caller destroys the returned tensor
+func (tts *TextToSpeech) cachedTextEmbedding(key string, textIDsTensor *ort.Tensor[int64], textMaskTensor *ort.Tensor[float32], style *Style) (*ort.Tensor[float32], error) {
+	if entry, ok := tts.frontEnd.get(key); ok && entry.emb != nil {
+		tensor, err := newTensor(entry.embShape, append([]float32(nil), entry.emb...))
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore cached text embedding: %w", err)
+		}
+		return tensor, nil
+	}
+
+	textEncOutputs := []ort.Value{nil}
+	err := tts.textEncOrt.Run(
+		[]ort.Value{textIDsTensor, style.TTLTensor, textMaskTensor},
+		textEncOutputs,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run text encoder: %w", err)
+	}
+	trackOutputs(textEncOutputs)
+	textEmbTensor := textEncOutputs[0].(*ort.Tensor[float32])
+	tts.frontEnd.update(key, func(e *frontEndEntry) {
+		e.emb = append([]float32(nil), textEmbTensor.GetData()...)
+		e.embShape = textEmbTensor.GetShape().Clone()
+	})
+	return textEmbTensor, nil
+}
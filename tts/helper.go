@@ -8,9 +8,12 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/go-audio/audio"
 	"github.com/go-audio/wav"
@@ -18,8 +21,8 @@ import (
 	"golang.org/x/text/unicode/norm"
 )
 
-// AvailableLangs for multilingual TTS
-var AvailableLangs = []string{"en", "ko", "es", "pt", "fr"}
+// AvailableLangs for multilingual TTS: the model languages plus any loaded language packs
+var AvailableLangs = append([]string{}, modelLangs...)
 
 // SpecProcessorConfig for the configuration structure
 type SpecProcessorConfig struct {
@@ -155,6 +158,38 @@ func (up *UnicodeProcessor) Call(textList []string, langList []string) ([][]int6
 // Text chunking utilities
 const maxChunkLength = 300
 
+// ChunkLimit returns the maximum chunk length in characters for a language
+func ChunkLimit(lang string) int {
+	if pack := languagePacks[lang]; pack != nil && pack.ChunkLimit > 0 {
+		return pack.ChunkLimit
+	}
+	if modelLanguage(lang) == "ko" {
+		return 120
+	}
+	return maxChunkLength
+}
+
+// splitLongWords breaks words longer than maxLen bytes (URLs, run-together
+// text) into pieces at rune boundaries so no chunk exceeds the model's limit
+func splitLongWords(words []string, maxLen int) []string {
+	var out []string
+	for _, word := range words {
+		for len(word) > maxLen {
+			cut := maxLen
+			for cut > 0 && !utf8.RuneStart(word[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				break
+			}
+			out = append(out, word[:cut])
+			word = word[cut:]
+		}
+		out = append(out, word)
+	}
+	return out
+}
+
 var abbreviations = []string{
 	"Dr.", "Mr.", "Mrs.", "Ms.", "Prof.", "Sr.", "Jr.",
 	"St.", "Ave.", "Rd.", "Blvd.", "Dept.", "Inc.", "Ltd.",
@@ -221,7 +256,7 @@ func chunkText(text string, maxLen int) []string {
 						var wordChunk strings.Builder
 						wordChunkLen := 0
 
-						for _, word := range words {
+						for _, word := range splitLongWords(words, maxLen) {
 							wordLen := len(word)
 							if wordChunkLen+wordLen+1 > maxLen && wordChunk.Len() > 0 {
 								chunks = append(chunks, strings.TrimSpace(wordChunk.String()))
@@ -340,43 +375,51 @@ func isValidLang(lang string) bool {
 	return false
 }
 
+// symbolReplacements maps dashes, quotes and symbols to what preprocessText speaks them as
+var symbolReplacements = map[string]string{
+	"–":      "-",  // en dash
+	"‑":      "-",  // non-breaking hyphen
+	"—":      "-",  // em dash
+	"_":      " ",  // underscore
+	"\u201C": "\"", // left double quote
+	"\u201D": "\"", // right double quote
+	"\u2018": "'",  // left single quote
+	"\u2019": "'",  // right single quote
+	"´":      "'",  // acute accent
+	"`":      "'",  // grave accent
+	"[":      " ",  // left bracket
+	"]":      " ",  // right bracket
+	"|":      " ",  // vertical bar
+	"/":      " ",  // slash
+	"#":      " ",  // hash
+	"→":      " ",  // right arrow
+	"←":      " ",  // left arrow
+}
+
+// specialSymbols are removed by preprocessText
+var specialSymbols = []string{"♥", "☆", "♡", "©", "\\"}
+
 // Utility functions
 func preprocessText(text string, lang string) string {
 	// TODO: Need advanced normalizer for better performance
+	// Disambiguate heteronyms before punctuation and spacing are rewritten
+	if lang == "en" {
+		text = resolveHeteronyms(text)
+	}
+
 	// Apply NFKD normalization using golang.org/x/text/unicode/norm
 	text = norm.NFKD.String(text)
 
-	// Remove emojis and various Unicode symbols
-	emojiPattern := regexp.MustCompile(`[\x{1F600}-\x{1F64F}\x{1F300}-\x{1F5FF}\x{1F680}-\x{1F6FF}\x{1F700}-\x{1F77F}\x{1F780}-\x{1F7FF}\x{1F800}-\x{1F8FF}\x{1F900}-\x{1F9FF}\x{1FA00}-\x{1FA6F}\x{1FA70}-\x{1FAFF}\x{2600}-\x{26FF}\x{2700}-\x{27BF}\x{1F1E6}-\x{1F1FF}]+`)
+	// Remove emojis, pictographs and invisible format characters (ZWJ, bidi marks, variation selectors)
 	text = emojiPattern.ReplaceAllString(text, "")
+	text = invisiblePattern.ReplaceAllString(text, "")
 
 	// Replace various dashes and symbols
-	replacements := map[string]string{
-		"–": "-",    // en dash
-		"‑": "-",    // non-breaking hyphen
-		"—": "-",    // em dash
-		"_": " ",    // underscore
-		"\u201C": "\"",   // left double quote
-		"\u201D": "\"",   // right double quote
-		"\u2018": "'",    // left single quote
-		"\u2019": "'",    // right single quote
-		"´": "'",    // acute accent
-		"`": "'",    // grave accent
-		"[": " ",    // left bracket
-		"]": " ",    // right bracket
-		"|": " ",    // vertical bar
-		"/": " ",    // slash
-		"#": " ",    // hash
-		"→": " ",    // right arrow
-		"←": " ",    // left arrow
-	}
-
-	for old, new := range replacements {
+	for old, new := range symbolReplacements {
 		text = strings.ReplaceAll(text, old, new)
 	}
 
 	// Remove special symbols
-	specialSymbols := []string{"♥", "☆", "♡", "©", "\\"}
 	for _, symbol := range specialSymbols {
 		text = strings.ReplaceAll(text, symbol, "")
 	}
@@ -430,7 +473,8 @@ func preprocessText(text string, lang string) string {
 	}
 
 	// Wrap text with language tags
-	text = fmt.Sprintf("<%s>%s</%s>", lang, text, lang)
+	base := modelLanguage(lang)
+	text = fmt.Sprintf("<%s>%s</%s>", base, text, base)
 
 	return text
 }
@@ -508,14 +552,16 @@ func writeWavFile(filename string, audioData []float64, sampleRate int) error {
 type Style struct {
 	TTLTensor *ort.Tensor[float32]
 	DpTensor  *ort.Tensor[float32]
+
+	key string // fingerprint of the tensors, part of front-end cache keys
 }
 
 func (s *Style) Destroy() {
 	if s.TTLTensor != nil {
-		s.TTLTensor.Destroy()
+		destroyTensor(s.TTLTensor)
 	}
 	if s.DpTensor != nil {
-		s.DpTensor.Destroy()
+		destroyTensor(s.DpTensor)
 	}
 }
 
@@ -524,7 +570,7 @@ func LoadVoiceStyle(voiceStylePaths []string, verbose bool) (*Style, error) {
 	bsz := len(voiceStylePaths)
 
 	// Read first file to get dimensions
-	firstData, err := os.ReadFile(voiceStylePaths[0])
+	firstData, err := ReadAsset(voiceStylePaths[0])
 	if err != nil {
 		return nil, fmt.Errorf("failed to read voice style file: %w", err)
 	}
@@ -550,7 +596,7 @@ func LoadVoiceStyle(voiceStylePaths []string, verbose bool) (*Style, error) {
 
 	// Fill in the data
 	for i := 0; i < bsz; i++ {
-		data, err := os.ReadFile(voiceStylePaths[i])
+		data, err := ReadAsset(voiceStylePaths[i])
 		if err != nil {
 			return nil, fmt.Errorf("failed to read voice style file: %w", err)
 		}
@@ -588,14 +634,14 @@ func LoadVoiceStyle(voiceStylePaths []string, verbose bool) (*Style, error) {
 	ttlShape := []int64{int64(bsz), ttlDim1, ttlDim2}
 	dpShape := []int64{int64(bsz), dpDim1, dpDim2}
 
-	ttlTensor, err := ort.NewTensor(ttlShape, ttlFlat)
+	ttlTensor, err := newTensor(ttlShape, ttlFlat)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create TTL tensor: %w", err)
 	}
 
-	dpTensor, err := ort.NewTensor(dpShape, dpFlat)
+	dpTensor, err := newTensor(dpShape, dpFlat)
 	if err != nil {
-		ttlTensor.Destroy()
+		destroyTensor(ttlTensor)
 		return nil, fmt.Errorf("failed to create DP tensor: %w", err)
 	}
 
@@ -606,24 +652,35 @@ func LoadVoiceStyle(voiceStylePaths []string, verbose bool) (*Style, error) {
 	return &Style{
 		TTLTensor: ttlTensor,
 		DpTensor:  dpTensor,
+		key:       styleKey(ttlFlat, dpFlat),
 	}, nil
 }
 
 // TextToSpeech generates speech from text
 type TextToSpeech struct {
+	// sessionsMu is held for reading around each chunk's ONNX calls, never
+	// while audio is handed to OnAudio, and for writing while Reload replaces
+	// the sessions, so a slow streaming client cannot hold up a reload
+	sessionsMu    sync.RWMutex
+	dir           string
+	device        int
 	cfg           Config
 	textProcessor *UnicodeProcessor
 	dpOrt         *ort.DynamicAdvancedSession
 	textEncOrt    *ort.DynamicAdvancedSession
 	vectorEstOrt  *ort.DynamicAdvancedSession
 	vocoderOrt    *ort.DynamicAdvancedSession
+	frontEnd      *frontEndCache
+	// scratch pools the reusable inference tensors (see acquireScratch)
+	scratchMu     sync.Mutex
+	scratch       []*inferScratch
 	SampleRate    int
 	baseChunkSize int
 	chunkCompress int
 	ldim          int
 }
 
-func (tts *TextToSpeech) sampleNoisyLatent(durOnnx []float32) ([][][]float64, [][][]float64) {
+func (tts *TextToSpeech) sampleNoisyLatent(durOnnx []float32, rng *rand.Rand, noiseScale float32) ([][][]float64, [][][]float64) {
 	bsz := len(durOnnx)
 	maxDur := float64(0)
 	for _, d := range durOnnx {
@@ -642,7 +699,6 @@ func (tts *TextToSpeech) sampleNoisyLatent(durOnnx []float32) ([][][]float64, []
 	latentLen := int((wavLenMax + float64(chunkSize) - 1) / float64(chunkSize))
 	latentDim := tts.ldim * tts.chunkCompress
 
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
 	noisyLatent := make([][][]float64, bsz)
 	for b := 0; b < bsz; b++ {
 		batch := make([][]float64, latentDim)
@@ -654,7 +710,7 @@ func (tts *TextToSpeech) sampleNoisyLatent(durOnnx []float32) ([][][]float64, []
 				const eps = 1e-10
 				u1 := math.Max(eps, rng.Float64())
 				u2 := rng.Float64()
-				row[t] = math.Sqrt(-2.0*math.Log(u1)) * math.Cos(2.0*math.Pi*u2)
+				row[t] = float64(noiseScale) * math.Sqrt(-2.0*math.Log(u1)) * math.Cos(2.0*math.Pi*u2)
 			}
 			batch[d] = row
 		}
@@ -675,8 +731,41 @@ func (tts *TextToSpeech) sampleNoisyLatent(durOnnx []float32) ([][][]float64, []
 	return noisyLatent, latentMask
 }
 
-func (tts *TextToSpeech) _infer(textList []string, langList []string, style *Style, totalStep int, speed float32) ([]float32, []float32, error) {
+// predictDuration runs the duration predictor and returns the per-item duration in seconds
+func (tts *TextToSpeech) predictDuration(textIDsTensor *ort.Tensor[int64], textMaskTensor *ort.Tensor[float32], style *Style) ([]float32, error) {
+	dpOutputs := []ort.Value{nil}
+	err := tts.dpOrt.Run(
+		[]ort.Value{textIDsTensor, style.DpTensor, textMaskTensor},
+		dpOutputs,
+		)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run duration predictor: %w", err)
+	}
+	trackOutputs(dpOutputs)
+	durTensor := dpOutputs[0].(*ort.Tensor[float32])
+	defer destroyTensor(durTensor)
+
+	return append([]float32(nil), durTensor.GetData()...), nil
+}
+
+func (tts *TextToSpeech) _infer(textList []string, langList []string, style *Style, opts SynthesisOptions) ([]float32, []float32, error) {
+	xt, durOnnx, err := tts.denoise(textList, langList, style, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	wav, err := tts.vocode(xt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wav, durOnnx, nil
+}
+
+// denoise runs the text front-end and the denoising loop, returning the final
+// latent and the per-item durations in seconds
+func (tts *TextToSpeech) denoise(textList []string, langList []string, style *Style, opts SynthesisOptions) ([][][]float64, []float32, error) {
 	bsz := len(textList)
+	totalStep := opts.TotalStep
+	speed := opts.Speed
 
 	// Process text
 	textIDs, textMask := tts.textProcessor.Call(textList, langList)
@@ -684,22 +773,16 @@ func (tts *TextToSpeech) _infer(textList []string, langList []string, style *Sty
 	textMaskShape := []int64{int64(bsz), 1, int64(len(textMask[0][0]))}
 
 	textIDsTensor := IntArrayToTensor(textIDs, textIDsShape)
-	defer textIDsTensor.Destroy()
+	defer destroyTensor(textIDsTensor)
 	textMaskTensor := ArrayToTensor(textMask, textMaskShape)
-	defer textMaskTensor.Destroy()
+	defer destroyTensor(textMaskTensor)
 
-	// Predict duration
-	dpOutputs := []ort.Value{nil}
-	err := tts.dpOrt.Run(
-		[]ort.Value{textIDsTensor, style.DpTensor, textMaskTensor},
-		dpOutputs,
-		)
+	// Predict duration (cached per text, language and style, like the text encoding below)
+	cacheKey := frontEndKey(textList, langList, style)
+	durOnnx, err := tts.cachedDuration(cacheKey, textIDsTensor, textMaskTensor, style)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to run duration predictor: %w", err)
+		return nil, nil, err
 	}
-	durTensor := dpOutputs[0].(*ort.Tensor[float32])
-	defer durTensor.Destroy()
-	durOnnx := durTensor.GetData()
 
 	// Apply speed factor to duration
 	for i := range durOnnx {
@@ -708,20 +791,15 @@ func (tts *TextToSpeech) _infer(textList []string, langList []string, style *Sty
 
 	// Encode text
 	textIDsTensor2 := IntArrayToTensor(textIDs, textIDsShape)
-	defer textIDsTensor2.Destroy()
-	textEncOutputs := []ort.Value{nil}
-	err = tts.textEncOrt.Run(
-		[]ort.Value{textIDsTensor2, style.TTLTensor, textMaskTensor},
-		textEncOutputs,
-		)
+	defer destroyTensor(textIDsTensor2)
+	textEmbTensor, err := tts.cachedTextEmbedding(cacheKey, textIDsTensor2, textMaskTensor, style)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to run text encoder: %w", err)
+		return nil, nil, err
 	}
-	textEmbTensor := textEncOutputs[0].(*ort.Tensor[float32])
-	defer textEmbTensor.Destroy()
+	defer destroyTensor(textEmbTensor)
 
 	// Sample noisy latent
-	xt, latentMask := tts.sampleNoisyLatent(durOnnx)
+	xt, latentMask := tts.sampleNoisyLatent(durOnnx, newRand(opts.Seed), opts.NoiseScale)
 	latentShape := []int64{int64(bsz), int64(len(xt[0])), int64(len(xt[0][0]))}
 	latentMaskShape := []int64{int64(bsz), 1, int64(len(latentMask[0][0]))}
 
@@ -732,55 +810,90 @@ func (tts *TextToSpeech) _infer(textList []string, langList []string, style *Sty
 	}
 	scalarShape := []int64{int64(bsz)}
 
-	totalStepTensor, _ := ort.NewTensor(scalarShape, totalStepArray)
-	defer totalStepTensor.Destroy()
+	// The loop's tensors come from the worker's scratch pool and are refilled in place
+	scratch := tts.acquireScratch()
+	defer tts.releaseScratch(scratch)
+	totalStepTensor, err := scratch.totalStep.get(scalarShape)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create step tensor: %w", err)
+	}
+	copy(totalStepTensor.GetData(), totalStepArray)
+	latentMaskTensor, err := scratch.latentMask.get(latentMaskShape)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create latent mask tensor: %w", err)
+	}
+	flattenInto(latentMaskTensor.GetData(), latentMask)
+	textMaskTensor2, err := scratch.textMask.get(textMaskShape)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create text mask tensor: %w", err)
+	}
+	flattenInto(textMaskTensor2.GetData(), textMask)
 
-	// Denoising loop
-	for step := 0; step < totalStep; step++ {
-		currentStepArray := make([]float32, bsz)
-		for b := 0; b < bsz; b++ {
-			currentStepArray[b] = float32(step)
+	// velocityAt runs the vector estimator at flow time t and returns the velocity it
+	// implies. The estimator advances the latent by a uniform step of 1/totalStep,
+	// so v = (denoised - x) * totalStep
+	velocityAt := func(x [][][]float64, t float64) ([]float64, error) {
+		currentStepTensor, err := scratch.currentStep.get(scalarShape)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create step tensor: %w", err)
+		}
+		currentStep := currentStepTensor.GetData()
+		for b := range currentStep {
+			currentStep[b] = float32(t * float64(totalStep))
+		}
+		noisyLatentTensor, err := scratch.noisyLatent.get(latentShape)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create latent tensor: %w", err)
+		}
+		flattenInto(noisyLatentTensor.GetData(), x)
+		// The output has the latent's shape, so the estimator writes into a reused tensor
+		denoisedTensor, err := scratch.denoised.get(latentShape)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output tensor: %w", err)
 		}
 
-		currentStepTensor, _ := ort.NewTensor(scalarShape, currentStepArray)
-		noisyLatentTensor := ArrayToTensor(xt, latentShape)
-		latentMaskTensor := ArrayToTensor(latentMask, latentMaskShape)
-		textMaskTensor2 := ArrayToTensor(textMask, textMaskShape)
-
-		vectorEstOutputs := []ort.Value{nil}
+		vectorEstOutputs := []ort.Value{denoisedTensor}
 		err = tts.vectorEstOrt.Run(
 			[]ort.Value{noisyLatentTensor, textEmbTensor, style.TTLTensor, latentMaskTensor, textMaskTensor2,
 				currentStepTensor, totalStepTensor},
 			vectorEstOutputs,
 			)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to run vector estimator: %w", err)
+			return nil, fmt.Errorf("failed to run vector estimator: %w", err)
 		}
-
-		denoisedTensor := vectorEstOutputs[0].(*ort.Tensor[float32])
 		denoisedData := denoisedTensor.GetData()
 
-		// Update latent
+		velocity := make([]float64, len(denoisedData))
 		idx := 0
 		for b := 0; b < bsz; b++ {
-			for d := 0; d < len(xt[b]); d++ {
-				for t := 0; t < len(xt[b][d]); t++ {
-					xt[b][d][t] = float64(denoisedData[idx])
+			for d := 0; d < len(x[b]); d++ {
+				for t := 0; t < len(x[b][d]); t++ {
+					velocity[idx] = (float64(denoisedData[idx]) - x[b][d][t]) * float64(totalStep)
 					idx++
 				}
 			}
 		}
+		return velocity, nil
+	}
 
-		noisyLatentTensor.Destroy()
-		latentMaskTensor.Destroy()
-		textMaskTensor2.Destroy()
-		currentStepTensor.Destroy()
-		denoisedTensor.Destroy()
+	// Denoising loop
+	xt, err = integrateFlow(xt, timesteps(totalStep, opts.SwayCoefficient), opts.Scheduler, velocityAt)
+	if err != nil {
+		return nil, nil, err
 	}
+	return xt, durOnnx, nil
+}
 
-	// Generate waveform
-	finalLatentTensor := ArrayToTensor(xt, latentShape)
-	defer finalLatentTensor.Destroy()
+// vocode runs the vocoder on a latent and returns the waveform
+func (tts *TextToSpeech) vocode(latent [][][]float64) ([]float32, error) {
+	latentShape := []int64{int64(len(latent)), int64(len(latent[0])), int64(len(latent[0][0]))}
+	scratch := tts.acquireScratch()
+	defer tts.releaseScratch(scratch)
+	finalLatentTensor, err := scratch.vocoderIn.get(latentShape)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create latent tensor: %w", err)
+	}
+	flattenInto(finalLatentTensor.GetData(), latent)
 
 	vocoderOutputs := []ort.Value{nil}
 	err = tts.vocoderOrt.Run(
@@ -788,79 +901,261 @@ func (tts *TextToSpeech) _infer(textList []string, langList []string, style *Sty
 		vocoderOutputs,
 		)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to run vocoder: %w", err)
+		return nil, fmt.Errorf("failed to run vocoder: %w", err)
 	}
+	trackOutputs(vocoderOutputs)
 
 	wavBatchTensor := vocoderOutputs[0].(*ort.Tensor[float32])
-	defer wavBatchTensor.Destroy()
-	wav := wavBatchTensor.GetData()
-
-	return wav, durOnnx, nil
+	defer destroyTensor(wavBatchTensor)
+	return append([]float32(nil), wavBatchTensor.GetData()...), nil
 }
 
 // Call synthesizes speech from a single text with automatic chunking
 func (tts *TextToSpeech) Call(text string, lang string, style *Style, totalStep int, speed float32, silenceDuration float32) ([]float32, float32, error) {
-	maxLen := 300
-	if lang == "ko" {
-		maxLen = 120
+	opts := DefaultSynthesisOptions()
+	opts.TotalStep = totalStep
+	opts.Speed = speed
+	opts.SilenceDuration = silenceDuration
+	return tts.CallWithOptions(text, lang, style, opts)
+}
+
+// CallWithOptions synthesizes speech from a single text with automatic chunking and explicit sampler settings
+func (tts *TextToSpeech) CallWithOptions(text string, lang string, style *Style, opts SynthesisOptions) ([]float32, float32, error) {
+	result, err := tts.Synthesize(text, lang, style, opts)
+	if err != nil {
+		return nil, 0, err
 	}
-	chunks := chunkText(text, maxLen)
+	return result.Wav, result.Duration, nil
+}
 
+// Synthesize is CallWithOptions reporting the chunk count and any chunks skipped
+// after failing (see inferPiece)
+func (tts *TextToSpeech) Synthesize(text string, lang string, style *Style, opts SynthesisOptions) (*SynthesisResult, error) {
+	silenceDuration := opts.SilenceDuration
+	pieces, err := planChunks(text, lang)
+	if err != nil {
+		return nil, err
+	}
+	if opts.FrameWindow > 0 && opts.OnAudio != nil {
+		return tts.synthesizeFrames(pieces, style, opts)
+	}
+
+	result := &SynthesisResult{}
 	var wavCat []float32
 	var durCat float32
+	fade := int(declickFade * float64(tts.SampleRate))
+
+	// emit hands OnAudio everything up to the last fade samples, which the next
+	// join may still crossfade or fade out
+	emitted := 0
+	emit := func(end int) {
+		if opts.OnAudio != nil && end > emitted {
+			opts.OnAudio(wavCat[emitted:end])
+			emitted = end
+			if opts.DiscardEmitted {
+				wavCat = append([]float32(nil), wavCat[end:]...)
+				emitted = 0
+			}
+		}
+	}
 
-	for i, chunk := range chunks {
-		wav, duration, err := tts._infer([]string{chunk}, []string{lang}, style, totalStep, speed)
-		if err != nil {
-			return nil, 0, err
+	for i, piece := range pieces {
+		if i > 0 {
+			emit(len(wavCat) - fade)
 		}
 
-		dur := duration[0]
-		wavLen := int(float32(tts.SampleRate) * dur)
-		wavChunk := wav[:wavLen]
+		var wavChunk []float32
+		var dur float32
+		spoken := false
+		if piece.Tone != nil {
+			wavChunk = piece.Tone.render(tts.SampleRate)
+			dur = piece.Tone.Duration
+		} else {
+			result.Chunks++
+			wavChunk, dur, err = tts.inferPiece(piece, style, opts)
+			if err != nil {
+				if !opts.SkipFailedChunks {
+					return nil, &InferenceError{Err: err}
+				}
+				result.Skipped = append(result.Skipped, SkippedSpan{Text: piece.Text, Offset: durCat, Error: err.Error(), Cause: err})
+				dur = skipPause
+				wavChunk = make([]float32, int(skipPause*float32(tts.SampleRate)))
+			} else {
+				spoken = true
+			}
+
+			if opts.Declick {
+				removeDCOffset(wavChunk)
+			}
+		}
 
 		if i == 0 {
 			wavCat = wavChunk
 			durCat = dur
+			if opts.Declick {
+				fadeIn(wavCat, fade)
+			}
+			if spoken {
+				result.Spans = append(result.Spans, SpokenSpan{Text: piece.Text, Start: 0, End: dur})
+			}
 		} else {
-			silenceLen := int(silenceDuration * float32(tts.SampleRate))
-			silence := make([]float32, silenceLen)
+			// Language switches and tones inside a sentence are joined without a pause
+			gap := silenceDuration
+			if !piece.NewChunk {
+				gap = 0
+			}
+			silenceLen := int(gap * float32(tts.SampleRate))
+
+			// Tones and pauses keep their exact length, so only speech is crossfaded
+			if opts.Declick && silenceLen == 0 && piece.Tone == nil && pieces[i-1].Tone == nil {
+				var overlap int
+				wavCat, overlap = crossfade(wavCat, wavChunk, fade)
+				start := durCat - float32(overlap)/float32(tts.SampleRate)
+				if spoken {
+					result.Spans = append(result.Spans, SpokenSpan{Text: piece.Text, Start: start, End: start + dur})
+				}
+				durCat = start + dur
+				continue
+			}
+			if opts.Declick {
+				fadeOut(wavCat, fade)
+				fadeIn(wavChunk, fade)
+			}
 
+			silence := make([]float32, silenceLen)
 			wavCat = append(wavCat, silence...)
 			wavCat = append(wavCat, wavChunk...)
-			durCat += silenceDuration + dur
+			if spoken {
+				result.Spans = append(result.Spans, SpokenSpan{Text: piece.Text, Start: durCat + gap, End: durCat + gap + dur})
+			}
+			durCat += gap + dur
+		}
+	}
+	if opts.Declick {
+		fadeOut(wavCat, fade)
+	}
+	emit(len(wavCat))
+
+	result.Wav, result.Duration = wavCat, durCat
+	return result, nil
+}
+
+// chunkPiece is one model inference unit of a synthesis call
+type chunkPiece struct {
+	Text     string
+	Lang     string
+	NewChunk bool      // false when the piece continues the previous one without a pause
+	Tone     *toneSpec // non-nil pieces are rendered as a tone instead of speech
+}
+
+// planChunks splits text at inline audio tokens, then into language segments and chunks
+func planChunks(text string, lang string) ([]chunkPiece, error) {
+	var pieces []chunkPiece
+	afterToken := false
+	parts, err := splitAudioTokens(text)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		if part.Tone != nil {
+			pieces = append(pieces, chunkPiece{Text: part.Text, Tone: part.Tone})
+			afterToken = true
+			continue
+		}
+		if !hasSpeakableText(part.Text) {
+			continue
 		}
+
+		textPieces, err := planTextChunks(part.Text, lang)
+		if err != nil {
+			return nil, err
+		}
+		if afterToken {
+			textPieces[0].NewChunk = false
+		}
+		pieces = append(pieces, textPieces...)
+		afterToken = false
 	}
 
-	return wavCat, durCat, nil
+	if len(pieces) == 0 {
+		return planTextChunks(text, lang)
+	}
+	return pieces, nil
+}
+
+// planTextChunks splits token-free text into language segments and each segment into chunks
+func planTextChunks(text string, lang string) ([]chunkPiece, error) {
+	segments, err := SplitLanguageSegments(text, lang)
+	if err != nil {
+		return nil, err
+	}
+
+	var pieces []chunkPiece
+	for s, seg := range segments {
+		segText := seg.Text
+		if s+1 < len(segments) && !endsWithPunctuation(segText) {
+			// Keep mid-sentence segments from being closed with a period
+			segText = strings.TrimSpace(segText) + ","
+		}
+		for c, chunk := range chunkFor(segText, seg.Lang) {
+			pieces = append(pieces, chunkPiece{Text: chunk, Lang: seg.Lang, NewChunk: c > 0 || s == 0})
+		}
+	}
+	return pieces, nil
+}
+
+// endsWithPunctuation reports whether text ends with sentence or clause punctuation
+func endsWithPunctuation(text string) bool {
+	text = strings.TrimSpace(text)
+	return text != "" && strings.ContainsAny(text[len(text)-1:], ".!?;:,")
 }
 
 // Batch synthesizes speech from multiple texts
 func (tts *TextToSpeech) Batch(textList []string, langList []string, style *Style, totalStep int, speed float32) ([]float32, []float32, error) {
-	return tts._infer(textList, langList, style, totalStep, speed)
+	opts := DefaultSynthesisOptions()
+	opts.TotalStep = totalStep
+	opts.Speed = speed
+	tts.sessionsMu.RLock()
+	defer tts.sessionsMu.RUnlock()
+	return tts._infer(textList, langList, style, opts)
 }
 
 func (tts *TextToSpeech) Destroy() {
+	tts.destroyScratch()
 	if tts.dpOrt != nil {
-		tts.dpOrt.Destroy()
+		destroySession(tts.dpOrt)
 	}
 	if tts.textEncOrt != nil {
-		tts.textEncOrt.Destroy()
+		destroySession(tts.textEncOrt)
 	}
 	if tts.vectorEstOrt != nil {
-		tts.vectorEstOrt.Destroy()
+		destroySession(tts.vectorEstOrt)
 	}
 	if tts.vocoderOrt != nil {
-		tts.vocoderOrt.Destroy()
+		destroySession(tts.vocoderOrt)
 	}
 }
 
+// CPUDevice selects CPU inference in LoadTextToSpeechOnDevice
+const CPUDevice = -1
+
 // LoadTextToSpeech loads TTS components from the assets directory
 func LoadTextToSpeech(assetsDir string, useGPU bool, cfg Config) (*TextToSpeech, error) {
+	device := CPUDevice
 	if useGPU {
-		return nil, fmt.Errorf("GPU mode is not supported yet")
+		device = 0
+	}
+	return LoadTextToSpeechOnDevice(assetsDir, device, cfg)
+}
+
+// LoadTextToSpeechOnDevice loads TTS components with every session pinned to
+// one CUDA device, or to the CPU for CPUDevice
+func LoadTextToSpeechOnDevice(assetsDir string, device int, cfg Config) (*TextToSpeech, error) {
+	if device == CPUDevice {
+		fmt.Println("Using CPU for inference")
+	} else {
+		fmt.Printf("Using GPU %d for inference\n", device)
 	}
-	fmt.Println("Using CPU for inference")
 
 	onnxDir := filepath.Join(assetsDir, "onnx")
 
@@ -871,31 +1166,42 @@ func LoadTextToSpeech(assetsDir string, useGPU bool, cfg Config) (*TextToSpeech,
 		return nil, fmt.Errorf("ONNX path is not a directory: %s", onnxDir)
 	}
 
+	options, err := newSessionOptions(device)
+	if err != nil {
+		return nil, err
+	}
+	if options != nil {
+		defer options.Destroy()
+	}
+
 	// Load models from onnx subdirectory
 	dpPath := filepath.Join(onnxDir, "duration_predictor.onnx")
 	textEncPath := filepath.Join(onnxDir, "text_encoder.onnx")
 	vectorEstPath := filepath.Join(onnxDir, "vector_estimator.onnx")
 	vocoderPath := filepath.Join(onnxDir, "vocoder.onnx")
 
-	dpOrt, err := ort.NewDynamicAdvancedSession(dpPath, []string{"text_ids", "style_dp", "text_mask"},
-		[]string{"duration"}, nil)
-	if err != nil {
+	// Sessions created before a later one fails to load are destroyed again
+	sessions := &TextToSpeech{}
+	defer func() {
+		if sessions != nil {
+			sessions.Destroy()
+		}
+	}()
+	if sessions.dpOrt, err = newSession(dpPath, []string{"text_ids", "style_dp", "text_mask"},
+		[]string{"duration"}, options); err != nil {
 		return nil, fmt.Errorf("failed to load duration predictor: %w", err)
 	}
-	textEncOrt, err := ort.NewDynamicAdvancedSession(textEncPath, []string{"text_ids", "style_ttl", "text_mask"},
-		[]string{"text_emb"}, nil)
-	if err != nil {
+	if sessions.textEncOrt, err = newSession(textEncPath, []string{"text_ids", "style_ttl", "text_mask"},
+		[]string{"text_emb"}, options); err != nil {
 		return nil, fmt.Errorf("failed to load text encoder: %w", err)
 	}
-	vectorEstOrt, err := ort.NewDynamicAdvancedSession(vectorEstPath,
+	if sessions.vectorEstOrt, err = newSession(vectorEstPath,
 		[]string{"noisy_latent", "text_emb", "style_ttl", "latent_mask", "text_mask", "current_step", "total_step"},
-		[]string{"denoised_latent"}, nil)
-	if err != nil {
+		[]string{"denoised_latent"}, options); err != nil {
 		return nil, fmt.Errorf("failed to load vector estimator: %w", err)
 	}
-	vocoderOrt, err := ort.NewDynamicAdvancedSession(vocoderPath, []string{"latent"},
-		[]string{"wav_tts"}, nil)
-	if err != nil {
+	if sessions.vocoderOrt, err = newSession(vocoderPath, []string{"latent"},
+		[]string{"wav_tts"}, options); err != nil {
 		return nil, fmt.Errorf("failed to load vocoder: %w", err)
 	}
 
@@ -907,20 +1213,71 @@ func LoadTextToSpeech(assetsDir string, useGPU bool, cfg Config) (*TextToSpeech,
 	}
 
 	textToSpeech := &TextToSpeech{
+		dir:           assetsDir,
+		device:        device,
 		cfg:           cfg,
 		textProcessor: textProcessor,
-		dpOrt:         dpOrt,
-		textEncOrt:    textEncOrt,
-		vectorEstOrt:  vectorEstOrt,
-		vocoderOrt:    vocoderOrt,
+		dpOrt:         sessions.dpOrt,
+		textEncOrt:    sessions.textEncOrt,
+		vectorEstOrt:  sessions.vectorEstOrt,
+		vocoderOrt:    sessions.vocoderOrt,
+		frontEnd:      newFrontEndCache(),
 		SampleRate:    cfg.AE.SampleRate,
 		baseChunkSize: cfg.AE.BaseChunkSize,
 		chunkCompress: cfg.TTL.ChunkCompressFactor,
 		ldim:          cfg.TTL.LatentDim,
 	}
+	sessions = nil
 	return textToSpeech, nil
 }
 
+// ProbeDevice checks that a device can run inference by loading the smallest
+// model of an assets directory on it
+func ProbeDevice(assetsDir string, device int) error {
+	options, err := newSessionOptions(device)
+	if err != nil {
+		return err
+	}
+	if options != nil {
+		defer options.Destroy()
+	}
+
+	dpPath := filepath.Join(assetsDir, "onnx", "duration_predictor.onnx")
+	session, err := newSession(dpPath, []string{"text_ids", "style_dp", "text_mask"},
+		[]string{"duration"}, options)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return destroySession(session)
+}
+
+// newSessionOptions returns session options appending the CUDA execution
+// provider for a device, or nil (ONNX Runtime defaults) for the CPU
+func newSessionOptions(device int) (*ort.SessionOptions, error) {
+	if device == CPUDevice {
+		return nil, nil
+	}
+
+	cudaOptions, err := ort.NewCUDAProviderOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize CUDA provider: %w", err)
+	}
+	defer cudaOptions.Destroy()
+	if err := cudaOptions.Update(map[string]string{"device_id": strconv.Itoa(device)}); err != nil {
+		return nil, fmt.Errorf("failed to select CUDA device %d: %w", device, err)
+	}
+
+	options, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session options: %w", err)
+	}
+	if err := options.AppendExecutionProviderCUDA(cudaOptions); err != nil {
+		options.Destroy()
+		return nil, fmt.Errorf("failed to enable CUDA on device %d: %w", device, err)
+	}
+	return options, nil
+}
+
 // InitializeONNXRuntime initializes ONNX Runtime environment
 func InitializeONNXRuntime() error {
 	libPath := os.Getenv("ONNXRUNTIME_LIB_PATH")
@@ -988,11 +1345,11 @@ func Timer(name string, fn func() interface{}) interface{} {
 	return result
 }
 
-// LoadCfgs loads configuration from JSON file in the assets directory
+// LoadCfgs loads configuration from JSON file in the assets directory (or the embedded fallback)
 func LoadCfgs(assetsDir string) (Config, error) {
 	onnxDir := filepath.Join(assetsDir, "onnx")
 	cfgPath := filepath.Join(onnxDir, "tts.json")
-	data, err := os.ReadFile(cfgPath)
+	data, err := ReadAsset(cfgPath)
 	if err != nil {
 		return Config{}, fmt.Errorf("failed to read config file %s: %w", cfgPath, err)
 	}
@@ -1007,7 +1364,7 @@ func LoadCfgs(assetsDir string) (Config, error) {
 
 // JSON loading helpers
 func loadJSONInt64(filePath string) ([]int64, error) {
-	data, err := os.ReadFile(filePath)
+	data, err := ReadAsset(filePath)
 	if err != nil {
 		return nil, err
 	}
@@ -1029,17 +1386,9 @@ func ArrayToTensor(array [][][]float64, shape []int64) *ort.Tensor[float32] {
 	}
 
 	flat := make([]float32, totalSize)
-	idx := 0
-	for b := 0; b < len(array); b++ {
-		for d := 0; d < len(array[b]); d++ {
-			for t := 0; t < len(array[b][d]); t++ {
-				flat[idx] = float32(array[b][d][t])
-				idx++
-			}
-		}
-	}
+	flattenInto(flat, array)
 
-	tensor, err := ort.NewTensor(shape, flat)
+	tensor, err := newTensor(shape, flat)
 	if err != nil {
 		panic(err)
 	}
@@ -1063,7 +1412,7 @@ func IntArrayToTensor(array [][]int64, shape []int64) *ort.Tensor[int64] {
 		}
 	}
 
-	tensor, err := ort.NewTensor(shape, flat)
+	tensor, err := newTensor(shape, flat)
 	if err != nil {
 		panic(err)
 	}
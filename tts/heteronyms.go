@@ -0,0 +1,213 @@
+package tts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// HeteronymRule picks a pronunciation for a heteronym from its context.
+// Prev and Next match the neighbouring word either literally (lower-case,
+// e.g. "have") or by part-of-speech tag (upper-case, e.g. "DET");
+// Sentence matches any word of the sentence. Empty conditions always match,
+// so a rule without conditions acts as the default
+type HeteronymRule struct {
+	Word          string   `json:"word"`
+	Pronunciation string   `json:"pronunciation"`
+	Prev          []string `json:"prev,omitempty"`
+	Next          []string `json:"next,omitempty"`
+	Sentence      []string `json:"sentence,omitempty"`
+}
+
+// posLexicon tags closed-class English words; everything else is untagged
+var posLexicon = map[string]string{
+	"a": "DET", "an": "DET", "the": "DET", "this": "DET", "that": "DET", "these": "DET",
+	"those": "DET", "my": "DET", "your": "DET", "his": "DET", "her": "DET", "its": "DET",
+	"our": "DET", "their": "DET", "some": "DET", "any": "DET", "no": "DET", "every": "DET",
+	"i": "PRON", "you": "PRON", "he": "PRON", "she": "PRON", "it": "PRON", "we": "PRON", "they": "PRON",
+	"will": "MODAL", "would": "MODAL", "can": "MODAL", "could": "MODAL", "should": "MODAL",
+	"shall": "MODAL", "may": "MODAL", "might": "MODAL", "must": "MODAL", "do": "MODAL",
+	"does": "MODAL", "don't": "MODAL", "doesn't": "MODAL", "to": "TO",
+	"have": "PERF", "has": "PERF", "had": "PERF", "was": "PERF", "were": "PERF", "been": "PERF",
+	"is": "BE", "are": "BE", "am": "BE", "be": "BE",
+	"of": "PREP", "in": "PREP", "on": "PREP", "with": "PREP", "from": "PREP", "for": "PREP", "by": "PREP",
+}
+
+// defaultHeteronymRules covers common English heteronyms; user rules loaded
+// with LoadHeteronymRules are checked before these
+var defaultHeteronymRules = []HeteronymRule{
+	{Word: "read", Pronunciation: "red", Prev: []string{"PERF", "already", "just", "never"}},
+	{Word: "read", Pronunciation: "red", Sentence: []string{"yesterday", "ago", "last", "earlier"}},
+	{Word: "read", Pronunciation: "reed"},
+
+	{Word: "lead", Pronunciation: "led", Next: []string{"pipe", "pipes", "paint", "poisoning", "pencil", "weight", "balloon"}},
+	{Word: "lead", Pronunciation: "led", Prev: []string{"DET", "PREP"}, Next: []string{"and", "or", ".", ","}},
+	{Word: "lead", Pronunciation: "leed"},
+
+	{Word: "live", Pronunciation: "lyve", Prev: []string{"DET", "BE"}},
+	{Word: "live", Pronunciation: "lyve", Next: []string{"music", "show", "stream", "broadcast", "audience", "event", "wire", "performance", "coverage"}},
+	{Word: "live", Pronunciation: "liv"},
+
+	{Word: "wind", Pronunciation: "wynd", Prev: []string{"TO", "MODAL", "PRON"}, Next: []string{"up", "down", "the", "it"}},
+	{Word: "wind", Pronunciation: "wind"},
+
+	{Word: "tear", Pronunciation: "tare", Prev: []string{"TO", "MODAL", "PRON"}},
+	{Word: "tear", Pronunciation: "tare", Next: []string{"up", "down", "apart", "off", "open"}},
+	{Word: "tear", Pronunciation: "teer"},
+
+	{Word: "wound", Pronunciation: "woond", Prev: []string{"DET", "PREP"}},
+	{Word: "wound", Pronunciation: "wownd", Next: []string{"up", "down", "around"}},
+	{Word: "wound", Pronunciation: "woond"},
+
+	{Word: "bass", Pronunciation: "base", Next: []string{"guitar", "player", "line", "drum", "clef", "note", "voice", "boost"}},
+	{Word: "bass", Pronunciation: "base", Prev: []string{"the", "on", "play", "plays", "played"}},
+	{Word: "bass", Pronunciation: "bass"},
+
+	{Word: "close", Pronunciation: "clohz", Prev: []string{"TO", "MODAL", "PRON", "please"}},
+	{Word: "close", Pronunciation: "clohss", Next: []string{"to", "by", "friend", "friends", "call"}},
+	{Word: "close", Pronunciation: "clohz"},
+}
+
+var (
+	heteronymMu    sync.RWMutex
+	heteronymRules = indexHeteronymRules(defaultHeteronymRules)
+)
+
+var (
+	heteronymSentencePattern = regexp.MustCompile(`[^.!?]+[.!?]*`)
+	heteronymWordPattern     = regexp.MustCompile(`[A-Za-z']+|[.,;:]`)
+)
+
+// indexHeteronymRules groups rules by lower-case word, keeping their order
+func indexHeteronymRules(rules []HeteronymRule) map[string][]HeteronymRule {
+	index := map[string][]HeteronymRule{}
+	for _, rule := range rules {
+		word := strings.ToLower(rule.Word)
+		index[word] = append(index[word], rule)
+	}
+	return index
+}
+
+// LoadHeteronymRules reads a JSON array of HeteronymRule from path.
+// The rules take precedence over the built-in ones for the same word
+func LoadHeteronymRules(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read heteronym rules: %w", err)
+	}
+
+	var rules []HeteronymRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("failed to parse heteronym rules JSON: %w", err)
+	}
+	for i, rule := range rules {
+		if rule.Word == "" || rule.Pronunciation == "" {
+			return fmt.Errorf("heteronym rule %d: word and pronunciation are required", i)
+		}
+	}
+
+	heteronymMu.Lock()
+	defer heteronymMu.Unlock()
+	heteronymRules = indexHeteronymRules(append(rules, defaultHeteronymRules...))
+	return nil
+}
+
+// resolveHeteronyms replaces heteronyms in English text with the respelling chosen by the rules
+func resolveHeteronyms(text string) string {
+	heteronymMu.RLock()
+	defer heteronymMu.RUnlock()
+
+	return heteronymSentencePattern.ReplaceAllStringFunc(text, func(sentence string) string {
+		locs := heteronymWordPattern.FindAllStringIndex(sentence, -1)
+		words := make([]string, len(locs))
+		for i, loc := range locs {
+			words[i] = strings.ToLower(sentence[loc[0]:loc[1]])
+		}
+
+		var out strings.Builder
+		last := 0
+		for i, loc := range locs {
+			rules, ok := heteronymRules[words[i]]
+			if !ok {
+				continue
+			}
+			pronunciation := matchHeteronym(rules, words, i)
+			if pronunciation == "" {
+				continue
+			}
+			out.WriteString(sentence[last:loc[0]])
+			out.WriteString(matchCase(sentence[loc[0]:loc[1]], pronunciation))
+			last = loc[1]
+		}
+		out.WriteString(sentence[last:])
+		return out.String()
+	})
+}
+
+// matchHeteronym returns the pronunciation of the first rule matching words[i]'s context
+func matchHeteronym(rules []HeteronymRule, words []string, i int) string {
+	prev, next := "", ""
+	if i > 0 {
+		prev = words[i-1]
+	}
+	if i+1 < len(words) {
+		next = words[i+1]
+	} else {
+		next = "."
+	}
+
+	for _, rule := range rules {
+		if len(rule.Prev) > 0 && !matchesContext(rule.Prev, prev) {
+			continue
+		}
+		if len(rule.Next) > 0 && !matchesContext(rule.Next, next) {
+			continue
+		}
+		if len(rule.Sentence) > 0 && !sentenceContains(rule.Sentence, words) {
+			continue
+		}
+		return rule.Pronunciation
+	}
+	return ""
+}
+
+// matchesContext reports whether a word matches any literal or POS-tag condition
+func matchesContext(conditions []string, word string) bool {
+	tag := posLexicon[word]
+	for _, c := range conditions {
+		if c == word || (tag != "" && c == tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// sentenceContains reports whether any of the words occurs in the sentence
+func sentenceContains(conditions []string, words []string) bool {
+	for _, c := range conditions {
+		for _, w := range words {
+			if c == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchCase applies the capitalization of original to replacement
+func matchCase(original, replacement string) string {
+	runes := []rune(original)
+	if len(runes) == 0 || !unicode.IsUpper(runes[0]) {
+		return replacement
+	}
+	if strings.ToUpper(original) == original && len(runes) > 1 {
+		return strings.ToUpper(replacement)
+	}
+	r := []rune(replacement)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
@@ -0,0 +1,162 @@
+package tts
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// readingDictionary maps written forms (kanji compounds) to their kana
+// readings, replaced longest match first
+type readingDictionary struct {
+	readings map[string]string
+	longest  int // longest written form, in runes
+}
+
+// loadReadingDictionary reads a tab-separated "written<TAB>reading" file;
+// blank lines and lines starting with # are skipped
+func loadReadingDictionary(path string) (*readingDictionary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dict := &readingDictionary{readings: map[string]string{}}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		written, reading, ok := strings.Cut(text, "\t")
+		written, reading = strings.TrimSpace(written), strings.TrimSpace(reading)
+		if !ok || written == "" || reading == "" {
+			return nil, fmt.Errorf("%s:%d: expected written form and reading separated by a tab", path, line)
+		}
+		dict.readings[written] = reading
+		dict.longest = max(dict.longest, utf8.RuneCountInString(written))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return dict, nil
+}
+
+// Process replaces every dictionary entry with its reading, preferring the
+// longest entry at each position; text without an entry is kept as written
+func (d *readingDictionary) Process(text string, _ string, _ TextOptions) string {
+	runes := []rune(text)
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		matched := false
+		for n := min(d.longest, len(runes)-i); n > 0; n-- {
+			if reading, ok := d.readings[string(runes[i:i+n])]; ok {
+				b.WriteString(reading)
+				i += n
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			b.WriteRune(runes[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+// smallKana combine with the preceding kana into one mora (きゃ, ファ)
+const smallKana = "ゃゅょぁぃぅぇぉゎャュョァィゥェォヮ"
+
+// moraCount approximates how many morae text takes to say: one per kana
+// (っ, ん and ー included), none for small kana that fuse with the one before,
+// two per kanji left without a reading and one per other letter or digit
+func moraCount(text string) int {
+	count := 0
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(smallKana, r):
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r), r == 'ー':
+			count++
+		case unicode.Is(unicode.Han, r):
+			count += 2
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			count++
+		}
+	}
+	return count
+}
+
+// japaneseSentenceEnds close a sentence; japaneseClauseEnds are where long
+// sentences may be split
+const (
+	japaneseSentenceEnds = "。！？!?\n"
+	japaneseClauseEnds   = "、，,"
+)
+
+// chunkMorae splits Japanese text into chunks of at most maxMorae morae:
+// whole sentences where they fit, else clauses, else a hard split
+func chunkMorae(text string, maxMorae int) []string {
+	if maxMorae <= 0 {
+		maxMorae = maxChunkLength
+	}
+
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			chunks = append(chunks, s)
+		}
+		current.Reset()
+	}
+	add := func(piece string) {
+		if moraCount(current.String())+moraCount(piece) > maxMorae {
+			flush()
+		}
+		current.WriteString(piece)
+	}
+
+	for _, sentence := range splitAfter(text, japaneseSentenceEnds) {
+		if moraCount(sentence) <= maxMorae {
+			add(sentence)
+			continue
+		}
+		for _, clause := range splitAfter(sentence, japaneseClauseEnds) {
+			if moraCount(clause) <= maxMorae {
+				add(clause)
+				continue
+			}
+			// No punctuation to break at: cut at the mora limit
+			flush()
+			for _, r := range clause {
+				if moraCount(current.String()+string(r)) > maxMorae {
+					flush()
+				}
+				current.WriteRune(r)
+			}
+		}
+	}
+	flush()
+	return chunks
+}
+
+// splitAfter splits text after every rune in marks, keeping the marks
+func splitAfter(text string, marks string) []string {
+	var parts []string
+	start := 0
+	for i, r := range text {
+		if strings.ContainsRune(marks, r) {
+			end := i + utf8.RuneLen(r)
+			parts = append(parts, text[start:end])
+			start = end
+		}
+	}
+	if start < len(text) {
+		parts = append(parts, text[start:])
+	}
+	return parts
+}
@@ -0,0 +1,323 @@
+package tts
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Hangul syllable block layout: syllable = base + (initial*21 + medial)*28 + final
+const (
+	hangulBase    = 0xAC00
+	hangulLast    = 0xD7A3
+	hangulFinals  = 28
+	hangulMedials = 21
+	finalRieul    = 8 // ㄹ as a final consonant
+)
+
+var (
+	sinoDigits = []string{"영", "일", "이", "삼", "사", "오", "육", "칠", "팔", "구"}
+	sinoUnits  = []string{"", "십", "백", "천"}
+	sinoScales = []string{"", "만", "억", "조", "경"}
+
+	nativeOnes       = []string{"", "하나", "둘", "셋", "넷", "다섯", "여섯", "일곱", "여덟", "아홉"}
+	nativeOnesBefore = []string{"", "한", "두", "세", "네", "다섯", "여섯", "일곱", "여덟", "아홉"}
+	nativeTens       = []string{"", "열", "스물", "서른", "마흔", "쉰", "예순", "일흔", "여든", "아흔"}
+)
+
+// nativeCounters are counters read with native Korean numbers ("세 개", "다섯 시"),
+// longest first so "시간" wins over "시"; other counters take Sino-Korean numbers
+var nativeCounters = []string{"번째", "사람", "시간", "그릇", "켤레", "마리", "가지", "개", "명", "살", "시", "권", "잔", "병", "장", "벌", "척", "달"}
+
+// koreanEndings are the particles and endings that may follow a counter in the same word
+var koreanEndings = []string{"", "은", "는", "이", "가", "을", "를", "과", "와", "으로", "로", "에", "에서", "의", "도", "만",
+	"부터", "까지", "쯤", "씩", "째", "이나", "나", "이에요", "예요", "입니다", "이다", "이랑", "랑", "동안"}
+
+// koreanParticles pairs each particle's form after a final consonant with its
+// form after a vowel, longest first
+var koreanParticles = [][2]string{
+	{"이에요", "예요"}, {"이랑", "랑"}, {"이나", "나"}, {"으로", "로"},
+	{"은", "는"}, {"을", "를"}, {"과", "와"}, {"이", "가"},
+}
+
+// koreanUnits maps unit symbols written after Korean numbers to their reading
+var koreanUnits = map[string]string{
+	"%": "퍼센트", "km": "킬로미터", "kg": "킬로그램", "cm": "센티미터", "mm": "밀리미터", "ml": "밀리리터",
+	"m": "미터", "g": "그램", "L": "리터", "°C": "도", "℃": "도",
+}
+
+// koreanCurrencies maps currency signs written before numbers to the word read after them
+var koreanCurrencies = map[string]string{"$": "달러", "€": "유로", "₩": "원", "¥": "엔"}
+
+var (
+	koreanNumberPattern = regexp.MustCompile(`(^|[^\w.])([$€₩¥]?)(-?)(\d{1,3}(?:,\d{3})+|\d+)(\.\d+)?(%|(?:km|kg|cm|mm|ml|m|g|L)\b|°C|℃)?( ?)([가-힣]*)`)
+	koreanPhonePattern  = regexp.MustCompile(`\b0\d{1,2}-\d{3,4}-\d{4}\b`)
+	compatJamoPattern   = regexp.MustCompile(`[\x{3131}-\x{318E}]+`)
+)
+
+// jamoWords reads common chat abbreviations written in bare jamo
+var jamoWords = map[string]string{
+	"ㅇㅋ": "오케이", "ㄱㅅ": "감사", "ㅇㅇ": "응", "ㄴㄴ": "노노", "ㅊㅋ": "축하", "ㅅㄱ": "수고", "ㄷㄷ": "덜덜",
+}
+
+// jamoNames are the names of the compatibility consonants ㄱ..ㅎ, read when one stands alone
+var jamoNames = map[rune]string{
+	'ㄱ': "기역", 'ㄲ': "쌍기역", 'ㄴ': "니은", 'ㄷ': "디귿", 'ㄸ': "쌍디귿", 'ㄹ': "리을", 'ㅁ': "미음",
+	'ㅂ': "비읍", 'ㅃ': "쌍비읍", 'ㅅ': "시옷", 'ㅆ': "쌍시옷", 'ㅇ': "이응", 'ㅈ': "지읒", 'ㅉ': "쌍지읒",
+	'ㅊ': "치읓", 'ㅋ': "키읔", 'ㅌ': "티읕", 'ㅍ': "피읖", 'ㅎ': "히읗",
+}
+
+// normalizeKorean composes decomposed Hangul, reads bare jamo and verbalizes
+// numbers according to style, fixing the particle after each number to agree
+// with its reading
+func normalizeKorean(text string, style NumberStyle) string {
+	text = norm.NFC.String(text)
+	text = compatJamoPattern.ReplaceAllStringFunc(text, readJamo)
+	if style == NumberStyleNone {
+		return text
+	}
+
+	text = koreanPhonePattern.ReplaceAllStringFunc(text, func(phone string) string {
+		groups := strings.Split(phone, "-")
+		for i, group := range groups {
+			groups[i] = strings.ReplaceAll(koreanDigits(group), "영", "공")
+		}
+		return strings.Join(groups, ", ")
+	})
+	return koreanNumberPattern.ReplaceAllStringFunc(text, func(match string) string {
+		m := koreanNumberPattern.FindStringSubmatch(match)
+		prefix, currency, sign, digits, fraction, unit, space, word := m[1], m[2], m[3], strings.ReplaceAll(m[4], ",", ""), m[5], m[6], m[7], m[8]
+		n, err := strconv.ParseInt(digits, 10, 64)
+		if err != nil {
+			return match
+		}
+
+		var reading string
+		counter, ending := splitCounter(word)
+		native := isNativeCounter(counter) && prefix != "제" && unit == "" && currency == "" && fraction == "" && n > 0 && n < 100
+		switch {
+		case style == NumberStyleDigits:
+			reading = koreanDigits(digits)
+		case counter == "번째" && fraction == "":
+			reading = strings.TrimSuffix(koreanOrdinal(n), " 번째")
+		case style == NumberStyleOrdinal && fraction == "" && counter == "":
+			reading = koreanOrdinal(n)
+		case native:
+			reading = nativeKorean(n, true)
+		case counter == "월" && (n == 6 || n == 10):
+			// 유월 and 시월 drop the final consonant
+			reading = map[int64]string{6: "유", 10: "시"}[n]
+		default:
+			reading = sinoKorean(n)
+		}
+		if fraction != "" {
+			reading += " 점 " + koreanDigits(fraction[1:])
+		}
+		if sign != "" {
+			reading = "마이너스 " + reading
+		}
+		if unit != "" {
+			reading += " " + koreanUnits[unit]
+		}
+		if currency != "" {
+			reading += " " + koreanCurrencies[currency]
+		}
+
+		switch {
+		case word == "":
+			return prefix + reading + space
+		case counter == "월":
+			// Month names are single words: 삼월, 유월
+			return prefix + reading + counter + ending
+		case counter != "":
+			return prefix + reading + " " + counter + ending
+		case space == "":
+			return prefix + agreeParticle(reading, word)
+		}
+		return prefix + reading + space + word
+	})
+}
+
+// splitCounter splits a word following a number into a counter and the
+// ending after it; words that are not a counter plus a known ending give ""
+func splitCounter(word string) (counter, ending string) {
+	for _, c := range nativeCounters {
+		if rest, ok := strings.CutPrefix(word, c); ok && isKoreanEnding(rest) {
+			return c, rest
+		}
+	}
+	// Any single syllable with a known ending is taken as a Sino-Korean counter (년, 월, 원, 층, ...)
+	if r, size := utf8.DecodeRuneInString(word); r != utf8.RuneError && isKoreanEnding(word[size:]) && !isParticle(word) {
+		return word[:size], word[size:]
+	}
+	return "", ""
+}
+
+// isNativeCounter reports whether a counter takes native Korean numbers
+func isNativeCounter(counter string) bool {
+	for _, c := range nativeCounters {
+		if c == counter {
+			return true
+		}
+	}
+	return false
+}
+
+// isKoreanEnding reports whether s may end a word after a counter
+func isKoreanEnding(s string) bool {
+	for _, e := range koreanEndings {
+		if s == e {
+			return true
+		}
+	}
+	return false
+}
+
+// isParticle reports whether word starts with a particle rather than a counter
+func isParticle(word string) bool {
+	for _, pair := range koreanParticles {
+		for _, form := range pair {
+			if rest, ok := strings.CutPrefix(word, form); ok && isKoreanEnding(rest) {
+				return true
+			}
+		}
+	}
+	return strings.HasPrefix(word, "에") || strings.HasPrefix(word, "의") || strings.HasPrefix(word, "도") || strings.HasPrefix(word, "만")
+}
+
+// agreeParticle attaches word to reading, switching a leading particle to the
+// form that agrees with the reading's last syllable ("일이" not "일가")
+func agreeParticle(reading, word string) string {
+	last, _ := utf8.DecodeLastRuneInString(reading)
+	if last < hangulBase || last > hangulLast {
+		return reading + word
+	}
+	final := (last - hangulBase) % hangulFinals
+	for _, pair := range koreanParticles {
+		for _, form := range pair {
+			rest, ok := strings.CutPrefix(word, form)
+			// 이 and 가 are only particles when nothing follows them
+			if !ok || ((form == "이" || form == "가") && rest != "") {
+				continue
+			}
+			choice := pair[0]
+			if final == 0 || (pair[0] == "으로" && final == finalRieul) {
+				choice = pair[1]
+			}
+			return reading + choice + rest
+		}
+	}
+	return reading + word
+}
+
+// sinoKorean reads a non-negative integer with Sino-Korean numerals in
+// groups of four digits ("삼만 오천이백"), dropping the 일 before 십, 백, 천 and
+// a leading 만
+func sinoKorean(n int64) string {
+	if n == 0 {
+		return sinoDigits[0]
+	}
+	var groups []string
+	for scale := 0; n > 0; scale++ {
+		group := n % 10000
+		n /= 10000
+		if group == 0 {
+			continue
+		}
+		var b strings.Builder
+		for pos := 3; pos >= 0; pos-- {
+			d := (group / pow10(pos)) % 10
+			if d == 0 {
+				continue
+			}
+			if d > 1 || pos == 0 {
+				b.WriteString(sinoDigits[d])
+			}
+			b.WriteString(sinoUnits[pos])
+		}
+		word := b.String()
+		if word == "일" && scale == 1 && n == 0 {
+			word = ""
+		}
+		groups = append([]string{word + sinoScales[scale]}, groups...)
+	}
+	return strings.Join(groups, " ")
+}
+
+// nativeKorean reads 1..99 with native Korean numerals; before a counter the
+// shortened forms are used ("한 개", "스무 살")
+func nativeKorean(n int64, beforeCounter bool) string {
+	tens, ones := n/10, n%10
+	if beforeCounter {
+		if ones == 0 && tens == 2 {
+			return "스무"
+		}
+		return nativeTens[tens] + nativeOnesBefore[ones]
+	}
+	return nativeTens[tens] + nativeOnes[ones]
+}
+
+// koreanOrdinal reads n as an ordinal ("첫 번째", "스물두 번째", "백 번째")
+func koreanOrdinal(n int64) string {
+	switch {
+	case n == 1:
+		return "첫 번째"
+	case n > 1 && n < 100:
+		return nativeKorean(n, true) + " 번째"
+	}
+	return sinoKorean(n) + " 번째"
+}
+
+// koreanDigits reads each digit with its Sino-Korean name
+func koreanDigits(digits string) string {
+	var b strings.Builder
+	for _, d := range digits {
+		if d >= '0' && d <= '9' {
+			b.WriteString(sinoDigits[d-'0'])
+		}
+	}
+	return b.String()
+}
+
+// readJamo reads a run of compatibility jamo: laughter and crying runs, common
+// chat abbreviations, and otherwise each consonant's name and each vowel as a syllable
+func readJamo(run string) string {
+	if word, ok := jamoWords[run]; ok {
+		return word
+	}
+	runes := []rune(run)
+	if strings.Trim(run, "ㅠㅜ") == "" {
+		return ""
+	}
+	for _, laugh := range []struct {
+		jamo rune
+		word string
+	}{{'ㅋ', "크"}, {'ㅎ', "흐"}} {
+		if strings.Trim(run, string(laugh.jamo)) == "" {
+			return strings.Repeat(laugh.word, min(len(runes), 3))
+		}
+	}
+
+	var parts []string
+	for _, r := range runes {
+		if name, ok := jamoNames[r]; ok {
+			parts = append(parts, name)
+		} else if r >= 'ㅏ' && r <= 'ㅣ' {
+			// A bare vowel is read with the silent initial ㅇ (index 11)
+			parts = append(parts, string(rune(hangulBase+(11*hangulMedials+int(r-'ㅏ'))*hangulFinals)))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// pow10 returns 10 to the power of n
+func pow10(n int) int64 {
+	p := int64(1)
+	for ; n > 0; n-- {
+		p *= 10
+	}
+	return p
+}
@@ -0,0 +1,226 @@
+package tts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// modelLangs are the languages the model itself was trained on; language
+// packs add languages synthesized as one of them
+var modelLangs = []string{"en", "ko", "es", "pt", "fr"}
+
+// languageCodePattern matches the two-letter codes language tags accept
+var languageCodePattern = regexp.MustCompile(`^[a-z]{2}$`)
+
+// LanguagePack is one assets/languages/<code>.json file (code defaults to the
+// file name). Base is the model
+// language the text is synthesized as (default: the code itself, which must
+// then be a model language). Characters maps characters the model's indexer
+// lacks onto ones it knows, Rules are regular-expression rewrites applied
+// during normalization, and Pauses inserts a pause of the given milliseconds
+// after punctuation.
+//
+// Native marks a language the installed model was trained on beyond the
+// built-in ones (e.g. Japanese with a Japanese model pack); packs shipped ahead
+// of their model set Disabled and are skipped. Dictionary names a
+// "written<TAB>reading" file next to the pack whose entries are replaced by
+// their reading (kanji to kana), and Chunking "mora" counts chunk_limit in
+// morae instead of characters
+type LanguagePack struct {
+	Code       string            `json:"code"`
+	Name       string            `json:"name"`
+	Base       string            `json:"base,omitempty"`
+	Native     bool              `json:"native,omitempty"`
+	Disabled   bool              `json:"disabled,omitempty"`
+	ChunkLimit int               `json:"chunk_limit,omitempty"`
+	Chunking   string            `json:"chunking,omitempty"`
+	Dictionary string            `json:"dictionary,omitempty"`
+	Characters map[string]string `json:"characters,omitempty"`
+	Rules      []LanguageRule    `json:"rules,omitempty"`
+	Pauses     map[string]int    `json:"pauses,omitempty"`
+}
+
+// LanguageRule rewrites matches of Pattern with Replace ($1 expands groups)
+type LanguageRule struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+}
+
+// languagePacks holds the loaded packs by code
+var languagePacks = map[string]*LanguagePack{}
+
+// LanguagePacks returns the loaded language packs sorted by code
+func LanguagePacks() []LanguagePack {
+	packs := make([]LanguagePack, 0, len(languagePacks))
+	for _, pack := range languagePacks {
+		packs = append(packs, *pack)
+	}
+	sort.Slice(packs, func(i, j int) bool { return packs[i].Code < packs[j].Code })
+	return packs
+}
+
+// LoadLanguagePacks reads every *.json language pack in dir, adds new
+// languages to AvailableLangs and registers each pack's rules and pauses with
+// its front-end. A missing directory is not an error. Call it once at startup
+func LoadLanguagePacks(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		if err := loadLanguagePack(file); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+	}
+	return nil
+}
+
+// loadLanguagePack validates and installs one language pack
+func loadLanguagePack(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var pack LanguagePack
+	if err := json.Unmarshal(data, &pack); err != nil {
+		return fmt.Errorf("invalid language pack: %w", err)
+	}
+	if pack.Disabled {
+		return nil
+	}
+
+	if pack.Code == "" {
+		pack.Code = strings.TrimSuffix(filepath.Base(file), ".json")
+	}
+	if !languageCodePattern.MatchString(pack.Code) {
+		return fmt.Errorf("code must be two lowercase letters, got %q", pack.Code)
+	}
+	if languagePacks[pack.Code] != nil {
+		return fmt.Errorf("language %s is defined twice", pack.Code)
+	}
+	if pack.Base == "" {
+		pack.Base = pack.Code
+	}
+	if pack.Native {
+		if pack.Base != pack.Code {
+			return fmt.Errorf("a native language has no base")
+		}
+		if !isModelLang(pack.Code) {
+			modelLangs = append(modelLangs, pack.Code)
+		}
+	}
+	if !isModelLang(pack.Base) {
+		return fmt.Errorf("base must be one of %v, got %q", modelLangs, pack.Base)
+	}
+	if pack.ChunkLimit < 0 {
+		return fmt.Errorf("chunk_limit must not be negative")
+	}
+	if pack.Chunking != "" && pack.Chunking != "mora" {
+		return fmt.Errorf("unsupported chunking %q (only \"mora\")", pack.Chunking)
+	}
+	var dict *readingDictionary
+	if pack.Dictionary != "" {
+		if dict, err = loadReadingDictionary(filepath.Join(filepath.Dir(file), pack.Dictionary)); err != nil {
+			return fmt.Errorf("failed to load dictionary: %w", err)
+		}
+	}
+	for char := range pack.Characters {
+		if len([]rune(char)) != 1 {
+			return fmt.Errorf("characters keys must be single characters, got %q", char)
+		}
+	}
+	rules := make([]*regexp.Regexp, len(pack.Rules))
+	for i, rule := range pack.Rules {
+		if rules[i], err = regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	for mark, ms := range pack.Pauses {
+		if mark == "" || ms <= 0 || ms > maxTokenDuration*1000 {
+			return fmt.Errorf("pause for %q must be between 1 and %d ms", mark, maxTokenDuration*1000)
+		}
+	}
+
+	languagePacks[pack.Code] = &pack
+	if !isValidLang(pack.Code) {
+		AvailableLangs = append(AvailableLangs, pack.Code)
+	}
+	if dict != nil {
+		RegisterTextProcessor(pack.Code, StageLexicon, dict)
+	}
+	if pack.Chunking == "mora" {
+		RegisterChunker(pack.Code, ChunkerFunc(chunkMorae))
+	}
+	if len(rules) > 0 {
+		RegisterTextProcessor(pack.Code, StageNormalize, TextProcessorFunc(func(text string, _ string, _ TextOptions) string {
+			for i, re := range rules {
+				text = re.ReplaceAllString(text, pack.Rules[i].Replace)
+			}
+			return text
+		}))
+	}
+	if len(pack.Pauses) > 0 {
+		pattern := pausePattern(pack.Pauses)
+		RegisterTextProcessor(pack.Code, StageSSML, TextProcessorFunc(func(text string, _ string, _ TextOptions) string {
+			return pattern.ReplaceAllStringFunc(text, func(match string) string {
+				mark := strings.TrimRightFunc(match, unicode.IsSpace)
+				return fmt.Sprintf("%s [pause:%dms] ", mark, pack.Pauses[mark])
+			})
+		}))
+	}
+	return nil
+}
+
+// pausePattern matches each listed punctuation mark where it ends a word,
+// longest marks first so "..." wins over "."
+func pausePattern(pauses map[string]int) *regexp.Regexp {
+	marks := make([]string, 0, len(pauses))
+	for mark := range pauses {
+		marks = append(marks, regexp.QuoteMeta(mark))
+	}
+	sort.Slice(marks, func(i, j int) bool { return len(marks[i]) > len(marks[j]) })
+	return regexp.MustCompile(`(?:` + strings.Join(marks, "|") + `)(?:\s+|$)`)
+}
+
+// isModelLang reports whether the model was trained on lang
+func isModelLang(lang string) bool {
+	for _, l := range modelLangs {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// modelLanguage returns the model language a language is synthesized as
+func modelLanguage(lang string) string {
+	if pack := languagePacks[lang]; pack != nil {
+		return pack.Base
+	}
+	return lang
+}
+
+// MapCharacters rewrites characters through the language pack's character
+// map, so later steps see characters the model's indexer knows
+func MapCharacters(text string, lang string) string {
+	pack := languagePacks[lang]
+	if pack == nil || len(pack.Characters) == 0 {
+		return text
+	}
+	var b strings.Builder
+	for _, r := range text {
+		if replacement, ok := pack.Characters[string(r)]; ok {
+			b.WriteString(replacement)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,144 @@
+package tts
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// LanguageSegment is a span of input text synthesized with one language front-end
+type LanguageSegment struct {
+	Text string `json:"text"`
+	Lang string `json:"language"`
+}
+
+// languageTagPattern matches an explicit opening language tag such as <ko>
+var languageTagPattern = regexp.MustCompile(`<([a-z]{2})>`)
+
+// IsSupportedLanguage reports whether lang is accepted by the model ("auto" included)
+func IsSupportedLanguage(lang string) bool {
+	return lang == "auto" || isValidLang(lang)
+}
+
+// DetectLanguage guesses the dominant language of text from its script
+func DetectLanguage(text string) string {
+	hangul, kana, han, letters := 0, 0, 0, 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+			switch {
+			case unicode.Is(unicode.Hangul, r):
+				hangul++
+			case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+				kana++
+			case unicode.Is(unicode.Han, r):
+				han++
+			}
+		}
+	}
+	if letters > 0 && hangul*2 > letters {
+		return "ko"
+	}
+	// Japanese is only detected once a language pack makes it available
+	if kana > 0 && (kana+han)*2 > letters && isValidLang("ja") {
+		return "ja"
+	}
+	return "en"
+}
+
+// SplitLanguageSegments splits text into language segments. Spans wrapped in an
+// explicit tag (e.g. "Call <ko>김민수</ko> now") use the tagged language; in other
+// spans, Hangul runs are detected as Korean and the rest uses defaultLang
+// ("auto" picks the dominant script)
+func SplitLanguageSegments(text string, defaultLang string) ([]LanguageSegment, error) {
+	if defaultLang == "auto" || defaultLang == "" {
+		defaultLang = DetectLanguage(languageTagPattern.ReplaceAllString(text, ""))
+	}
+	if !isValidLang(defaultLang) {
+		return nil, fmt.Errorf("unsupported language: %s. Available: %v", defaultLang, AvailableLangs)
+	}
+
+	var segments []LanguageSegment
+	rest := text
+	for {
+		loc := languageTagPattern.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			segments = append(segments, detectScriptSegments(rest, defaultLang)...)
+			break
+		}
+
+		lang := rest[loc[2]:loc[3]]
+		closing := "</" + lang + ">"
+		end := strings.Index(rest[loc[1]:], closing)
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed language tag <%s>", lang)
+		}
+		if !isValidLang(lang) {
+			return nil, fmt.Errorf("unsupported language tag <%s>. Available: %v", lang, AvailableLangs)
+		}
+
+		segments = append(segments, detectScriptSegments(rest[:loc[0]], defaultLang)...)
+		segments = append(segments, LanguageSegment{Text: rest[loc[1] : loc[1]+end], Lang: lang})
+		rest = rest[loc[1]+end+len(closing):]
+	}
+
+	return mergeLanguageSegments(segments, defaultLang), nil
+}
+
+// detectScriptSegments splits untagged text into Korean (Hangul) runs and defaultLang runs
+func detectScriptSegments(text string, defaultLang string) []LanguageSegment {
+	if defaultLang == "ko" {
+		return []LanguageSegment{{Text: text, Lang: defaultLang}}
+	}
+
+	var segments []LanguageSegment
+	runes := []rune(text)
+	start := 0
+	for i := 0; i < len(runes); {
+		if !unicode.Is(unicode.Hangul, runes[i]) {
+			i++
+			continue
+		}
+
+		// Extend the run over Hangul and the spaces between Hangul words
+		end := i
+		for j := i; j < len(runes); j++ {
+			if unicode.Is(unicode.Hangul, runes[j]) {
+				end = j + 1
+			} else if !unicode.IsSpace(runes[j]) {
+				break
+			}
+		}
+
+		segments = append(segments,
+			LanguageSegment{Text: string(runes[start:i]), Lang: defaultLang},
+			LanguageSegment{Text: string(runes[i:end]), Lang: "ko"})
+		start = end
+		i = end
+	}
+	return append(segments, LanguageSegment{Text: string(runes[start:]), Lang: defaultLang})
+}
+
+// mergeLanguageSegments drops segments without letters or digits and joins neighbours of the same language
+func mergeLanguageSegments(segments []LanguageSegment, defaultLang string) []LanguageSegment {
+	var merged []LanguageSegment
+	for _, seg := range segments {
+		if strings.IndexFunc(seg.Text, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) < 0 {
+			// Punctuation-only spans stay attached to the previous segment
+			if len(merged) > 0 {
+				merged[len(merged)-1].Text += seg.Text
+			}
+			continue
+		}
+		if len(merged) > 0 && merged[len(merged)-1].Lang == seg.Lang {
+			merged[len(merged)-1].Text += seg.Text
+			continue
+		}
+		merged = append(merged, seg)
+	}
+	if len(merged) == 0 {
+		return []LanguageSegment{{Text: "", Lang: defaultLang}}
+	}
+	return merged
+}
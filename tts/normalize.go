@@ -0,0 +1,49 @@
+package tts
+
+// TextOptions controls request-level text normalization applied before the model front-end
+type TextOptions struct {
+	NumberStyle   NumberStyle
+	SpellOut      bool   // spell the whole input character by character
+	SpellAlphabet string // "letters" or "nato" ("A as in Alpha")
+	Acronyms      bool   // spell short all-caps tokens as letters (\WORD\ escapes are always spelled)
+	URLs          string // "read" or "skip" for URLs and e-mail addresses
+}
+
+// NormalizeText applies request-level normalization to text in the given language.
+// Verbalization rules exist for English, Korean, Spanish, French and German;
+// other languages pass through.
+// Inline {{word|respelling}} fixes apply in every language; audio tokens such as
+// [pause:800ms] are left as written. Processors registered for the language
+// with RegisterTextProcessor run afterwards
+func NormalizeText(text string, lang string, opts TextOptions) string {
+	if lang == "auto" {
+		lang = DetectLanguage(text)
+	}
+	return mapTextParts(text, func(part string) string {
+		return processText(normalizePart(part, lang, opts), lang, opts)
+	})
+}
+
+// normalizePart normalizes text between audio tokens
+func normalizePart(text string, lang string, opts TextOptions) string {
+	text = expandRespellings(text, opts.SpellOut)
+	if lang == "ko" {
+		return normalizeKorean(stripSpellTags(text), opts.NumberStyle)
+	}
+	if europeanLanguages[lang] != nil {
+		return normalizeEuropean(stripSpellTags(text), lang, opts.NumberStyle)
+	}
+	if lang != "en" {
+		return stripSpellTags(text)
+	}
+
+	// Spell-out runs first so codes are never read as numbers
+	if opts.SpellOut {
+		text = spellOut(stripSpellTags(text), opts.SpellAlphabet)
+	} else {
+		text = expandSpellTags(text, opts.SpellAlphabet)
+		text = expandURLs(text, opts.URLs)
+		text = expandAcronyms(text, opts.Acronyms)
+	}
+	return expandNumbers(text, opts.NumberStyle)
+}
@@ -0,0 +1,190 @@
+package tts
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NumberStyle selects how digits in English and Korean text are verbalized
+type NumberStyle string
+
+const (
+	// NumberStyleNone leaves digits for the model to read as written
+	NumberStyleNone NumberStyle = ""
+	// NumberStyleAuto reads plausible years as years, suffixed numbers as ordinals and the rest as cardinals
+	NumberStyleAuto NumberStyle = "auto"
+	// NumberStyleCardinal reads "1999" as "one thousand nine hundred ninety-nine"
+	NumberStyleCardinal NumberStyle = "cardinal"
+	// NumberStyleOrdinal reads "21" as "twenty-first"
+	NumberStyleOrdinal NumberStyle = "ordinal"
+	// NumberStyleDigits reads "1999" as "one nine nine nine"
+	NumberStyleDigits NumberStyle = "digits"
+	// NumberStyleYear reads "1999" as "nineteen ninety-nine"
+	NumberStyleYear NumberStyle = "year"
+)
+
+// NumberStyles lists the supported number styles
+var NumberStyles = []NumberStyle{NumberStyleAuto, NumberStyleCardinal, NumberStyleOrdinal, NumberStyleDigits, NumberStyleYear}
+
+// ParseNumberStyle validates a number style name ("" leaves numbers untouched)
+func ParseNumberStyle(name string) (NumberStyle, error) {
+	if name == "" {
+		return NumberStyleNone, nil
+	}
+	for _, s := range NumberStyles {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported number style: %s. Available: %v", name, NumberStyles)
+}
+
+var numberPattern = regexp.MustCompile(`(^|[^\w.])(-?)(\d{1,3}(?:,\d{3})+|\d+)(\.\d+)?(st|nd|rd|th)?\b`)
+
+var (
+	ones = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+		"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen"}
+	tens   = []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+	scales = []string{"", "thousand", "million", "billion", "trillion"}
+)
+
+// maxScaledNumber is the first number past the largest entry of scales
+const maxScaledNumber = 1e15
+
+// ordinalWords maps the cardinal words whose ordinal is irregular
+var ordinalWords = map[string]string{
+	"one": "first", "two": "second", "three": "third", "five": "fifth", "eight": "eighth",
+	"nine": "ninth", "twelve": "twelfth",
+}
+
+// expandNumbers verbalizes the numbers in English text according to style
+func expandNumbers(text string, style NumberStyle) string {
+	if style == NumberStyleNone {
+		return text
+	}
+
+	return numberPattern.ReplaceAllStringFunc(text, func(match string) string {
+		m := numberPattern.FindStringSubmatch(match)
+		prefix, sign, digits, fraction, suffix := m[1], m[2], strings.ReplaceAll(m[3], ",", ""), m[4], m[5]
+
+		n, err := strconv.ParseInt(digits, 10, 64)
+		if err != nil {
+			return match
+		}
+
+		var words string
+		switch {
+		case style == NumberStyleDigits:
+			words = spellDigits(digits)
+			if fraction != "" {
+				words += " point " + spellDigits(fraction[1:])
+			}
+		case fraction != "":
+			words = cardinalWords(n) + " point " + spellDigits(fraction[1:])
+		case style == NumberStyleOrdinal || suffix != "":
+			words = ordinal(cardinalWords(n))
+		case style == NumberStyleYear || (style == NumberStyleAuto && sign == "" && isLikelyYear(m[3], n)):
+			words = yearWords(n)
+		default:
+			words = cardinalWords(n)
+		}
+
+		if sign != "" {
+			words = "minus " + words
+		}
+		return prefix + words
+	})
+}
+
+// isLikelyYear reports whether a number written without separators looks like a year
+func isLikelyYear(written string, n int64) bool {
+	return len(written) == 4 && n >= 1100 && n <= 2099
+}
+
+// cardinalWords spells a non-negative integer in English. Numbers too large
+// for the named scales are read digit by digit
+func cardinalWords(n int64) string {
+	if n < 20 {
+		return ones[n]
+	}
+	if n >= maxScaledNumber {
+		return spellDigits(strconv.FormatInt(n, 10))
+	}
+
+	var groups []string
+	for scale := 0; n > 0 && scale < len(scales); scale++ {
+		group := n % 1000
+		n /= 1000
+		if group == 0 {
+			continue
+		}
+		words := hundredsWords(group)
+		if scales[scale] != "" {
+			words += " " + scales[scale]
+		}
+		groups = append([]string{words}, groups...)
+	}
+	return strings.Join(groups, " ")
+}
+
+// hundredsWords spells 1..999
+func hundredsWords(n int64) string {
+	var parts []string
+	if n >= 100 {
+		parts = append(parts, ones[n/100]+" hundred")
+		n %= 100
+	}
+	if n >= 20 {
+		word := tens[n/10]
+		if n%10 != 0 {
+			word += "-" + ones[n%10]
+		}
+		parts = append(parts, word)
+	} else if n > 0 {
+		parts = append(parts, ones[n])
+	}
+	return strings.Join(parts, " ")
+}
+
+// yearWords reads a number the way years are spoken
+func yearWords(n int64) string {
+	switch {
+	case n < 1000 || n > 9999:
+		return cardinalWords(n)
+	case n%1000 == 0, n >= 2000 && n < 2010:
+		return cardinalWords(n)
+	case n%100 == 0:
+		return cardinalWords(n/100) + " hundred"
+	case n%100 < 10:
+		return cardinalWords(n/100) + " oh " + ones[n%100]
+	default:
+		return cardinalWords(n/100) + " " + cardinalWords(n%100)
+	}
+}
+
+// ordinal converts the last word of a cardinal to its ordinal form
+func ordinal(words string) string {
+	cut := strings.LastIndexAny(words, " -")
+	head, last := words[:cut+1], words[cut+1:]
+
+	if irregular, ok := ordinalWords[last]; ok {
+		return head + irregular
+	}
+	if strings.HasSuffix(last, "y") {
+		return head + strings.TrimSuffix(last, "y") + "ieth"
+	}
+	return head + last + "th"
+}
+
+// spellDigits reads each digit separately
+func spellDigits(digits string) string {
+	words := make([]string, 0, len(digits))
+	for _, d := range digits {
+		if d >= '0' && d <= '9' {
+			words = append(words, ones[d-'0'])
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,233 @@
+package tts
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Supertonic is a grapheme model: it reads unicode characters, not phonemes.
+// Phoneme input is therefore rendered as an English respelling ("huh-LOH")
+// whose spelling leaves the model no room for grapheme-to-sound guessing
+
+// arpabetRespelling maps ARPAbet phonemes (without stress digits) to respelled letters
+var arpabetRespelling = map[string]string{
+	// Vowels
+	"AA": "ah", "AE": "a", "AH": "uh", "AO": "aw", "AW": "ow", "AY": "eye",
+	"EH": "eh", "ER": "er", "EY": "ay", "IH": "ih", "IY": "ee", "OW": "oh",
+	"OY": "oy", "UH": "uu", "UW": "oo",
+	// Consonants
+	"B": "b", "CH": "ch", "D": "d", "DH": "th", "F": "f", "G": "g", "HH": "h",
+	"JH": "j", "K": "k", "L": "l", "M": "m", "N": "n", "NG": "ng", "P": "p",
+	"R": "r", "S": "s", "SH": "sh", "T": "t", "TH": "th", "V": "v", "W": "w",
+	"Y": "y", "Z": "z", "ZH": "zh",
+}
+
+// ipaToArpabet maps IPA symbols to ARPAbet; vowels get their stress digit from the surrounding marks
+var ipaToArpabet = map[string]string{
+	// Diphthongs and affricates first (matched longest-first)
+	"aʊ": "AW", "aɪ": "AY", "eɪ": "EY", "oʊ": "OW", "ɔɪ": "OY", "tʃ": "CH", "dʒ": "JH",
+	// Vowels
+	"ɑ": "AA", "a": "AA", "æ": "AE", "ʌ": "AH", "ə": "AH", "ɔ": "AO", "ɛ": "EH", "e": "EH",
+	"ɝ": "ER", "ɚ": "ER", "ɪ": "IH", "i": "IY", "o": "OW", "ʊ": "UH", "u": "UW",
+	// Consonants
+	"b": "B", "d": "D", "ð": "DH", "f": "F", "ɡ": "G", "g": "G", "h": "HH", "k": "K",
+	"l": "L", "m": "M", "n": "N", "ŋ": "NG", "p": "P", "ɹ": "R", "r": "R", "ɾ": "T",
+	"s": "S", "ʃ": "SH", "t": "T", "θ": "TH", "v": "V", "w": "W", "j": "Y", "z": "Z",
+	"ʒ": "ZH",
+}
+
+// PhonemeAlphabets lists the accepted phoneme alphabets
+var PhonemeAlphabets = []string{"ipa", "arpabet"}
+
+// PhonemesToText converts phoneme input to a respelled text the model can read.
+// ARPAbet words are separated by "|" (e.g. "HH AH0 L OW1 | W ER1 L D"),
+// IPA words by whitespace (e.g. "həˈloʊ wɝld"). An empty alphabet is auto-detected
+func PhonemesToText(input string, alphabet string) (string, error) {
+	if alphabet == "" {
+		alphabet = detectPhonemeAlphabet(input)
+	}
+
+	var words [][]string
+	var err error
+	switch alphabet {
+	case "arpabet":
+		words, err = parseArpabet(input)
+	case "ipa":
+		words, err = parseIPA(input)
+	default:
+		return "", fmt.Errorf("unsupported phoneme alphabet: %s. Available: %v", alphabet, PhonemeAlphabets)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	respelled := make([]string, 0, len(words))
+	for _, word := range words {
+		respelled = append(respelled, respellWord(word))
+	}
+	return strings.Join(respelled, " "), nil
+}
+
+// detectPhonemeAlphabet guesses ARPAbet when the input only contains upper-case letters, digits and separators
+func detectPhonemeAlphabet(input string) string {
+	for _, r := range input {
+		if !(r >= 'A' && r <= 'Z') && !unicode.IsDigit(r) && !unicode.IsSpace(r) && r != '|' {
+			return "ipa"
+		}
+	}
+	return "arpabet"
+}
+
+// parseArpabet splits ARPAbet input into words of validated phonemes
+func parseArpabet(input string) ([][]string, error) {
+	var words [][]string
+	for _, word := range strings.Split(input, "|") {
+		phonemes := strings.Fields(strings.ToUpper(word))
+		if len(phonemes) == 0 {
+			continue
+		}
+		for _, p := range phonemes {
+			if _, ok := arpabetRespelling[strings.TrimRight(p, "012")]; !ok {
+				return nil, fmt.Errorf("unknown ARPAbet phoneme: %s", p)
+			}
+		}
+		words = append(words, phonemes)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("phoneme input is empty")
+	}
+	return words, nil
+}
+
+// parseIPA converts IPA input to ARPAbet words, reporting the offset of any unknown symbol
+func parseIPA(input string) ([][]string, error) {
+	var words [][]string
+	runes := []rune(input)
+	var word []string
+	stress := "0"
+
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, word)
+			word = nil
+		}
+		stress = "0"
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+			i++
+			continue
+		case r == 'ˈ':
+			stress = "1"
+			i++
+			continue
+		case r == 'ˌ':
+			stress = "2"
+			i++
+			continue
+		case r == 'ː' || r == '.' || r == '/' || r == '[' || r == ']' || unicode.Is(unicode.Mn, r):
+			// Length marks, syllable breaks, transcription delimiters and diacritics carry no respelling
+			i++
+			continue
+		}
+
+		matched := false
+		for _, n := range []int{2, 1} {
+			if i+n > len(runes) {
+				continue
+			}
+			if p, ok := ipaToArpabet[string(runes[i:i+n])]; ok {
+				if isArpabetVowel(p) {
+					p += stress
+					stress = "0"
+				}
+				word = append(word, p)
+				i += n
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("unsupported IPA symbol %q at offset %d", string(r), i)
+		}
+	}
+	flush()
+
+	if len(words) == 0 {
+		return nil, fmt.Errorf("phoneme input is empty")
+	}
+	return words, nil
+}
+
+// isArpabetVowel reports whether an ARPAbet phoneme (without stress) is a vowel
+func isArpabetVowel(p string) bool {
+	switch p {
+	case "AA", "AE", "AH", "AO", "AW", "AY", "EH", "ER", "EY", "IH", "IY", "OW", "OY", "UH", "UW":
+		return true
+	}
+	return false
+}
+
+// respellWord turns one word of ARPAbet phonemes into hyphenated syllables,
+// upper-casing the syllable with primary stress
+func respellWord(phonemes []string) string {
+	var syllables []string
+	var stressed []bool
+	var current strings.Builder
+	currentStressed := false
+	hasVowel := false
+	var pending []string // consonants after the current syllable's vowel
+
+	for _, p := range phonemes {
+		base := strings.TrimRight(p, "012")
+		if !isArpabetVowel(base) {
+			if hasVowel {
+				pending = append(pending, base)
+			} else {
+				current.WriteString(arpabetRespelling[base])
+			}
+			continue
+		}
+
+		if hasVowel {
+			// Between two vowels the last consonant starts the new syllable, the rest close the old one
+			split := len(pending) - 1
+			if split < 0 {
+				split = 0
+			}
+			for _, c := range pending[:split] {
+				current.WriteString(arpabetRespelling[c])
+			}
+			syllables = append(syllables, current.String())
+			stressed = append(stressed, currentStressed)
+			current.Reset()
+			for _, c := range pending[split:] {
+				current.WriteString(arpabetRespelling[c])
+			}
+			pending = nil
+		}
+
+		current.WriteString(arpabetRespelling[base])
+		hasVowel = true
+		currentStressed = strings.HasSuffix(p, "1")
+	}
+	for _, c := range pending {
+		current.WriteString(arpabetRespelling[c])
+	}
+	syllables = append(syllables, current.String())
+	stressed = append(stressed, currentStressed)
+
+	if len(syllables) > 1 {
+		for i := range syllables {
+			if stressed[i] {
+				syllables[i] = strings.ToUpper(syllables[i])
+			}
+		}
+	}
+	return strings.Join(syllables, "-")
+}
@@ -0,0 +1,105 @@
+package tts
+
+import "fmt"
+
+// TextStage is a step of a language's text front-end. Stages run in order:
+// normalizers, then lexicons, then SSML/markup handlers, and finally the chunker
+type TextStage int
+
+const (
+	StageNormalize TextStage = iota // verbalize numbers, abbreviations, symbols
+	StageLexicon                    // respell or substitute words
+	StageSSML                       // interpret markup; audio tokens such as [pause:1s] never reach it
+	textStageCount
+)
+
+// TextProcessor rewrites the text between audio tokens for one stage of a
+// language's front-end
+type TextProcessor interface {
+	Process(text string, lang string, opts TextOptions) string
+}
+
+// TextProcessorFunc adapts a function to TextProcessor
+type TextProcessorFunc func(text string, lang string, opts TextOptions) string
+
+func (f TextProcessorFunc) Process(text string, lang string, opts TextOptions) string {
+	return f(text, lang, opts)
+}
+
+// Chunker splits token-free text into pieces of at most maxLen characters the
+// model can synthesize one at a time
+type Chunker interface {
+	Chunk(text string, maxLen int) []string
+}
+
+// ChunkerFunc adapts a function to Chunker
+type ChunkerFunc func(text string, maxLen int) []string
+
+func (f ChunkerFunc) Chunk(text string, maxLen int) []string {
+	return f(text, maxLen)
+}
+
+// textFrontEnd is the chain registered for one language
+type textFrontEnd struct {
+	stages  [textStageCount][]TextProcessor
+	chunker Chunker
+}
+
+// textFrontEnds are the registered front-ends by language. Registration
+// happens from init, so they are read without locking afterwards
+var textFrontEnds = map[string]*textFrontEnd{}
+
+// frontEndFor returns the language's front-end, creating it when register is set
+func frontEndFor(lang string, register bool) *textFrontEnd {
+	fe := textFrontEnds[lang]
+	if fe == nil && register {
+		fe = &textFrontEnd{}
+		textFrontEnds[lang] = fe
+	}
+	return fe
+}
+
+// RegisterTextProcessor appends a processor to a stage of the language's
+// front-end; processors of one stage run in registration order after the
+// built-in normalization. Call it from an init function
+func RegisterTextProcessor(lang string, stage TextStage, p TextProcessor) {
+	if !isValidLang(lang) {
+		panic(fmt.Sprintf("tts: cannot register a text processor for unsupported language %q", lang))
+	}
+	if stage < 0 || stage >= textStageCount {
+		panic(fmt.Sprintf("tts: invalid text stage %d", stage))
+	}
+	fe := frontEndFor(lang, true)
+	fe.stages[stage] = append(fe.stages[stage], p)
+}
+
+// RegisterChunker replaces the sentence chunker for a language. Call it from
+// an init function
+func RegisterChunker(lang string, c Chunker) {
+	if !isValidLang(lang) {
+		panic(fmt.Sprintf("tts: cannot register a chunker for unsupported language %q", lang))
+	}
+	frontEndFor(lang, true).chunker = c
+}
+
+// processText runs the language's registered stages over text between audio tokens
+func processText(text string, lang string, opts TextOptions) string {
+	fe := frontEndFor(lang, false)
+	if fe == nil {
+		return text
+	}
+	for _, stage := range fe.stages {
+		for _, p := range stage {
+			text = p.Process(text, lang, opts)
+		}
+	}
+	return text
+}
+
+// chunkFor splits text with the language's chunker, by default chunkText
+func chunkFor(text string, lang string) []string {
+	if fe := frontEndFor(lang, false); fe != nil && fe.chunker != nil {
+		return fe.chunker.Chunk(text, ChunkLimit(lang))
+	}
+	return chunkText(text, ChunkLimit(lang))
+}
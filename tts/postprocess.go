@@ -0,0 +1,56 @@
+package tts
+
+import "math"
+
+// declickFade is the length of the edge fades and crossfades applied by the
+// de-click stage, in seconds
+const declickFade = 0.005
+
+// removeDCOffset subtracts the mean of a chunk in place
+func removeDCOffset(samples []float32) {
+	if len(samples) == 0 {
+		return
+	}
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s)
+	}
+	mean := float32(sum / float64(len(samples)))
+	for i := range samples {
+		samples[i] -= mean
+	}
+}
+
+// fadeGain returns a raised-cosine ramp from 0 to 1 over n samples
+func fadeGain(i, n int) float32 {
+	return float32(0.5 - 0.5*math.Cos(math.Pi*float64(i)/float64(n)))
+}
+
+// fadeIn ramps the first n samples up from silence in place
+func fadeIn(samples []float32, n int) {
+	n = min(n, len(samples))
+	for i := 0; i < n; i++ {
+		samples[i] *= fadeGain(i, n)
+	}
+}
+
+// fadeOut ramps the last n samples down to silence in place
+func fadeOut(samples []float32, n int) {
+	n = min(n, len(samples))
+	for i := 0; i < n; i++ {
+		samples[len(samples)-1-i] *= fadeGain(i, n)
+	}
+}
+
+// crossfade appends next to prev, overlapping the last n samples of prev with
+// the first n of next so the join has no discontinuity. It returns the joined
+// audio and the number of samples the overlap removed
+func crossfade(prev, next []float32, n int) ([]float32, int) {
+	n = min(n, len(prev), len(next))
+	start := len(prev) - n
+	for i := 0; i < n; i++ {
+		g := fadeGain(i, n)
+		prev[start+i] = prev[start+i]*(1-g) + next[i]*g
+	}
+	return append(prev, next[n:]...), n
+}
@@ -0,0 +1,172 @@
+package tts
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// frameContext is how many latent frames either side of a window are
+// vocoded with it and then dropped, so window edges sound like the middle
+const frameContext = 2
+
+// leadWords is the longest first chunk low-latency mode synthesizes as is;
+// a longer one is split after its first clause (or this many words) so the
+// first audio does not wait for a whole sentence to be denoised
+const leadWords = 6
+
+// synthesizeFrames is Synthesize in low-latency mode (opts.FrameWindow set):
+// each chunk's denoised latent is vocoded opts.FrameWindow frames at a time
+// and every window is handed to OnAudio as soon as it is vocoded. Chunks are
+// joined with plain silence instead of crossfades, since audio already sent
+// cannot be blended
+func (tts *TextToSpeech) synthesizeFrames(pieces []chunkPiece, style *Style, opts SynthesisOptions) (*SynthesisResult, error) {
+	result := &SynthesisResult{}
+	fade := int(declickFade * float64(tts.SampleRate))
+	total := 0
+	push := func(samples []float32) {
+		if !opts.DiscardEmitted {
+			result.Wav = append(result.Wav, samples...)
+		}
+		total += len(samples)
+		opts.OnAudio(samples)
+	}
+
+	for i, piece := range splitLeadClause(pieces) {
+		if i > 0 && piece.NewChunk {
+			push(make([]float32, int(opts.SilenceDuration*float32(tts.SampleRate))))
+		}
+		start := float32(total) / float32(tts.SampleRate)
+
+		if piece.Tone != nil {
+			push(piece.Tone.render(tts.SampleRate))
+			continue
+		}
+		result.Chunks++
+		sent := 0
+		err := tts.inferFrames(piece.Text, piece.Lang, style, opts.forChunk(piece.Text), func(samples []float32, last bool) {
+			if opts.Declick {
+				if sent == 0 {
+					fadeIn(samples, fade)
+				}
+				if last {
+					fadeOut(samples, fade)
+				}
+			}
+			sent += len(samples)
+			push(samples)
+		})
+		if err != nil && sent == 0 {
+			// Nothing was heard yet, so the chunk can still go through the usual recovery
+			var wav []float32
+			if wav, _, err = tts.inferPiece(piece, style, opts); err == nil {
+				if opts.Declick {
+					removeDCOffset(wav)
+					fadeIn(wav, fade)
+					fadeOut(wav, fade)
+				}
+				sent = len(wav)
+				push(wav)
+			}
+		}
+		if err != nil {
+			if !opts.SkipFailedChunks {
+				return nil, &InferenceError{Err: err}
+			}
+			result.Skipped = append(result.Skipped, SkippedSpan{Text: piece.Text, Offset: start, Error: err.Error(), Cause: err})
+			push(make([]float32, int(skipPause*float32(tts.SampleRate))))
+			continue
+		}
+		result.Spans = append(result.Spans, SpokenSpan{Text: piece.Text, Start: start, End: start + float32(sent)/float32(tts.SampleRate)})
+	}
+
+	result.Duration = float32(total) / float32(tts.SampleRate)
+	return result, nil
+}
+
+// inferFrames synthesizes one chunk, vocoding the latent in windows of
+// opts.FrameWindow frames (with frameContext frames of context each side)
+// and passing each window's samples to onFrame in order
+func (tts *TextToSpeech) inferFrames(text, lang string, style *Style, opts SynthesisOptions, onFrame func(samples []float32, last bool)) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("inference panicked: %v", r)
+		}
+	}()
+
+	var latent [][][]float64
+	var duration []float32
+	tts.withSessions(func() {
+		latent, duration, err = tts.denoise([]string{text}, []string{lang}, style, opts)
+	})
+	if err != nil {
+		return err
+	}
+	frameSamples := tts.baseChunkSize * tts.chunkCompress
+	wavLen := int(float32(tts.SampleRate) * duration[0])
+	frames := min(len(latent[0][0]), (wavLen+frameSamples-1)/frameSamples)
+
+	for from := 0; from < frames; from += opts.FrameWindow {
+		to := min(from+opts.FrameWindow, frames)
+		lo, hi := max(from-frameContext, 0), min(to+frameContext, len(latent[0][0]))
+		// The sessions are released before onFrame, which may block on a slow client
+		var wav []float32
+		tts.withSessions(func() {
+			wav, err = tts.vocode(latentWindow(latent, lo, hi))
+		})
+		if err != nil {
+			return err
+		}
+
+		// Keep the window's own samples, dropping the context and the padding past the text
+		begin := (from - lo) * frameSamples
+		end := min((to-lo)*frameSamples, wavLen-lo*frameSamples, len(wav))
+		if end <= begin {
+			continue
+		}
+		samples := wav[begin:end]
+		for _, s := range samples {
+			if math.IsNaN(float64(s)) || math.IsInf(float64(s), 0) {
+				return &OutputCheckError{Reason: nonFiniteReason}
+			}
+		}
+		onFrame(samples, to == frames)
+	}
+	return nil
+}
+
+// latentWindow returns frames [lo, hi) of every channel of a latent
+func latentWindow(latent [][][]float64, lo, hi int) [][][]float64 {
+	window := make([][][]float64, len(latent))
+	for b := range latent {
+		window[b] = make([][]float64, len(latent[b]))
+		for d := range latent[b] {
+			window[b][d] = latent[b][d][lo:hi]
+		}
+	}
+	return window
+}
+
+// splitLeadClause splits the first speech chunk after its first clause, or
+// after leadWords words, when it is longer; the rest follows without a pause
+func splitLeadClause(pieces []chunkPiece) []chunkPiece {
+	if len(pieces) == 0 || pieces[0].Tone != nil {
+		return pieces
+	}
+	words := strings.Fields(pieces[0].Text)
+	if len(words) <= leadWords {
+		return pieces
+	}
+	cut := leadWords
+	for i, w := range words[:leadWords] {
+		if i > 0 && strings.ContainsAny(w[len(w)-1:], ",;:") {
+			cut = i + 1
+			break
+		}
+	}
+	lead, rest := pieces[0], pieces[0]
+	lead.Text = strings.Join(words[:cut], " ")
+	rest.Text = strings.Join(words[cut:], " ")
+	rest.NewChunk = false
+	return append([]chunkPiece{lead, rest}, pieces[1:]...)
+}
@@ -0,0 +1,253 @@
+package tts
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// skipPause is the silence inserted in place of a chunk that could not be synthesized
+const skipPause = 0.5
+
+// SkippedSpan is a chunk left out of the audio because it failed even after retrying
+type SkippedSpan struct {
+	Text   string  `json:"text"`
+	Offset float32 `json:"offset"` // seconds into the audio where the pause replaces it
+	Error  string  `json:"error"`
+	Cause  error   `json:"-"` // the error itself, for SessionFailure
+}
+
+// SynthesisResult is the audio of a Synthesize call with a report of how it was produced
+type SynthesisResult struct {
+	Wav      []float32
+	Duration float32
+	Chunks   int           // speech chunks synthesized (or skipped)
+	Skipped  []SkippedSpan // chunks replaced by a pause when opts.SkipFailedChunks is set
+	Spans    []SpokenSpan  // where each synthesized chunk's text is heard
+}
+
+// SpokenSpan is the text of one speech chunk and where it is heard in the
+// audio, in seconds
+type SpokenSpan struct {
+	Text  string
+	Start float32
+	End   float32
+}
+
+// InferenceError is returned by Synthesize when a chunk could not be
+// synthesized even after retrying, as opposed to input it cannot plan
+type InferenceError struct {
+	Err error
+}
+
+func (e *InferenceError) Error() string { return e.Err.Error() }
+
+func (e *InferenceError) Unwrap() error { return e.Err }
+
+// SessionFailure reports whether a synthesis error means the ONNX sessions
+// themselves misbehaved (a runtime error, a panic or non-finite output), as
+// opposed to audio failing a plausibility check, which fresh sessions would
+// not fix
+func SessionFailure(err error) bool {
+	var check *OutputCheckError
+	if errors.As(err, &check) {
+		return check.Reason == nonFiniteReason
+	}
+	return err != nil
+}
+
+// Reload replaces the ONNX sessions with freshly loaded ones, for when they
+// keep failing or producing non-finite audio. It waits for inferences in
+// progress (each chunk's ONNX calls, not whole syntheses), and the old
+// sessions are destroyed once replaced
+func (tts *TextToSpeech) Reload() error {
+	fresh, err := LoadTextToSpeechOnDevice(tts.dir, tts.device, tts.cfg)
+	if err != nil {
+		return err
+	}
+
+	tts.sessionsMu.Lock()
+	tts.dpOrt, fresh.dpOrt = fresh.dpOrt, tts.dpOrt
+	tts.textEncOrt, fresh.textEncOrt = fresh.textEncOrt, tts.textEncOrt
+	tts.vectorEstOrt, fresh.vectorEstOrt = fresh.vectorEstOrt, tts.vectorEstOrt
+	tts.vocoderOrt, fresh.vocoderOrt = fresh.vocoderOrt, tts.vocoderOrt
+	tts.frontEnd = fresh.frontEnd // cached outputs may come from the failing sessions
+	tts.sessionsMu.Unlock()
+
+	fresh.Destroy()
+	return nil
+}
+
+// withSessions runs fn holding sessionsMu for reading, releasing it even when
+// fn panics (inferText and inferFrames recover from panics)
+func (tts *TextToSpeech) withSessions(fn func()) {
+	tts.sessionsMu.RLock()
+	defer tts.sessionsMu.RUnlock()
+	fn()
+}
+
+// inferPiece synthesizes one speech chunk. If the model fails or its output
+// fails the sanity checks, the chunk is retried once with another seed and
+// more steps, then once more with characters the model has no embedding for
+// removed, split in two to halve the activation memory
+func (tts *TextToSpeech) inferPiece(piece chunkPiece, style *Style, opts SynthesisOptions) ([]float32, float32, error) {
+	opts = opts.forChunk(piece.Text)
+	wav, dur, err := tts.inferText(piece.Text, piece.Lang, style, opts)
+	if err == nil {
+		return wav, dur, nil
+	}
+
+	retry := opts
+	retry.TotalStep = opts.TotalStep + retryExtraSteps
+	if opts.Seed != 0 {
+		retry.Seed = opts.Seed + 1
+	}
+	if wav, dur, retryErr := tts.inferText(piece.Text, piece.Lang, style, retry); retryErr == nil {
+		return wav, dur, nil
+	}
+
+	halves := splitInHalf(tts.textProcessor.sanitize(piece.Text))
+	if len(halves) == 0 {
+		return nil, 0, err
+	}
+	var out []float32
+	var total float32
+	for _, half := range halves {
+		halfWav, halfDur, retryErr := tts.inferText(half, piece.Lang, style, retry)
+		if retryErr != nil {
+			return nil, 0, fmt.Errorf("%w (retry failed: %v)", err, retryErr)
+		}
+		out = append(out, halfWav...)
+		total += halfDur
+	}
+	return out, total, nil
+}
+
+// retryExtraSteps is how many more denoising steps a failed chunk is retried with
+const retryExtraSteps = 2
+
+// inferText runs the model on one chunk, turning panics and output failing
+// checkOutput into errors
+func (tts *TextToSpeech) inferText(text, lang string, style *Style, opts SynthesisOptions) (wav []float32, dur float32, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("inference panicked: %v", r)
+		}
+	}()
+
+	var out, duration []float32
+	tts.withSessions(func() {
+		out, duration, err = tts._infer([]string{text}, []string{lang}, style, opts)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	dur = duration[0]
+	wavLen := min(int(float32(tts.SampleRate)*dur), len(out))
+	if err := checkOutput(out[:wavLen], dur*opts.Speed, text); err != nil {
+		return nil, 0, err
+	}
+	return out[:wavLen], dur, nil
+}
+
+// nonFiniteReason is the OutputCheckError reason for NaN or infinite samples
+const nonFiniteReason = "non-finite samples"
+
+// OutputCheckError reports synthesized audio that failed a sanity check
+type OutputCheckError struct {
+	Reason string
+}
+
+func (e *OutputCheckError) Error() string {
+	return "generated audio failed sanity check: " + e.Reason
+}
+
+// Sanity check limits: at most this fraction of samples at full scale, and a
+// predicted duration within durationTolerance times the length estimated from
+// the text (checked for texts of at least minCheckedUnits)
+const (
+	maxClippedFraction = 0.01
+	durationTolerance  = 3
+	unitsPerSecond     = 14
+	minCheckedUnits    = 10
+)
+
+// checkOutput validates one chunk's audio: no NaN or Inf, not all silent, not
+// clipping throughout, and a duration at speed 1 (duration) plausible for text
+func checkOutput(samples []float32, duration float32, text string) error {
+	clipped := 0
+	silent := true
+	for _, s := range samples {
+		if math.IsNaN(float64(s)) || math.IsInf(float64(s), 0) {
+			return &OutputCheckError{Reason: nonFiniteReason}
+		}
+		if s != 0 {
+			silent = false
+		}
+		if s >= 1 || s <= -1 {
+			clipped++
+		}
+	}
+	if silent {
+		return &OutputCheckError{Reason: "audio is all zero"}
+	}
+	if float64(clipped) > maxClippedFraction*float64(len(samples)) {
+		return &OutputCheckError{Reason: fmt.Sprintf("%d of %d samples clipped", clipped, len(samples))}
+	}
+
+	if units := speechUnits(text); units >= minCheckedUnits {
+		expected := float32(units) / unitsPerSecond
+		if duration > expected*durationTolerance || duration < expected/durationTolerance {
+			return &OutputCheckError{Reason: fmt.Sprintf("predicted duration %.2fs is implausible for %d characters (expected about %.2fs)", duration, units, expected)}
+		}
+	}
+	return nil
+}
+
+// speechUnits measures how much there is to say in text: letters and digits
+// count as one unit, CJK characters and Hangul syllables as two
+func speechUnits(text string) int {
+	units := 0
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			units += 2
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			units++
+		}
+	}
+	return units
+}
+
+// sanitize drops characters the text processor has no embedding for and collapses whitespace
+func (up *UnicodeProcessor) sanitize(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if up.supports(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// splitInHalf splits text at the space nearest its middle (one piece if it has none)
+func splitInHalf(text string) []string {
+	if text == "" {
+		return nil
+	}
+	mid := len(text) / 2
+	before := strings.LastIndex(text[:mid], " ")
+	after := strings.Index(text[mid:], " ")
+	cut := before
+	if after >= 0 && (before < 0 || after < mid-before) {
+		cut = mid + after
+	}
+	if cut <= 0 {
+		return []string{text}
+	}
+	return []string{strings.TrimSpace(text[:cut]), strings.TrimSpace(text[cut:])}
+}
@@ -0,0 +1,67 @@
+package tts
+
+import (
+	"sync/atomic"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// Live ONNX Runtime objects. Their memory is native, invisible to the Go
+// heap, so they are counted here: between requests the tensor count should
+// return to the pooled tensors and the session count should match the loaded engines
+var liveTensors, liveSessions atomic.Int64
+
+// ResourceCounts is the number of live ONNX tensors and sessions. Pooled
+// tensors, included in Tensors, are kept for reuse by idle workers
+type ResourceCounts struct {
+	Tensors  int64 `json:"tensors"`
+	Pooled   int64 `json:"pooled_tensors"`
+	Sessions int64 `json:"sessions"`
+}
+
+// LiveResources returns the number of ONNX tensors and sessions not yet destroyed
+func LiveResources() ResourceCounts {
+	return ResourceCounts{Tensors: liveTensors.Load(), Pooled: pooledTensors.Load(), Sessions: liveSessions.Load()}
+}
+
+// SessionsPerWorker is the number of ONNX sessions one TextToSpeech holds
+const SessionsPerWorker = 4
+
+// newTensor is ort.NewTensor, counted
+func newTensor[T ort.TensorData](shape ort.Shape, data []T) (*ort.Tensor[T], error) {
+	tensor, err := ort.NewTensor(shape, data)
+	if err == nil {
+		liveTensors.Add(1)
+	}
+	return tensor, err
+}
+
+// trackOutputs counts the output tensors ONNX Runtime allocated in a Run
+func trackOutputs(outputs []ort.Value) {
+	for _, output := range outputs {
+		if output != nil {
+			liveTensors.Add(1)
+		}
+	}
+}
+
+// destroyTensor destroys a counted tensor
+func destroyTensor(tensor ort.Value) {
+	tensor.Destroy()
+	liveTensors.Add(-1)
+}
+
+// newSession is ort.NewDynamicAdvancedSession, counted
+func newSession(path string, inputs, outputs []string, options *ort.SessionOptions) (*ort.DynamicAdvancedSession, error) {
+	session, err := ort.NewDynamicAdvancedSession(path, inputs, outputs, options)
+	if err == nil {
+		liveSessions.Add(1)
+	}
+	return session, err
+}
+
+// destroySession destroys a counted session
+func destroySession(session *ort.DynamicAdvancedSession) error {
+	liveSessions.Add(-1)
+	return session.Destroy()
+}
@@ -0,0 +1,98 @@
+package tts
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+var (
+	runtimeOnce sync.Once
+	runtimeErr  error
+)
+
+// testAssets returns the assets directory named by SUPERTONIC_ASSETS with
+// ONNX Runtime initialized, skipping the test when either is unavailable
+func testAssets(t *testing.T) string {
+	t.Helper()
+	assetsDir := os.Getenv("SUPERTONIC_ASSETS")
+	if assetsDir == "" {
+		t.Skip("SUPERTONIC_ASSETS is not set")
+	}
+	runtimeOnce.Do(func() { runtimeErr = InitializeONNXRuntime() })
+	if runtimeErr != nil {
+		t.Skipf("ONNX Runtime unavailable: %v", runtimeErr)
+	}
+	return assetsDir
+}
+
+// TestSynthesisReleasesTensors checks that every tensor a synthesis creates
+// is destroyed again or parked in the worker's scratch pool
+func TestSynthesisReleasesTensors(t *testing.T) {
+	assetsDir := testAssets(t)
+	cfg, err := LoadCfgs(assetsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := LiveResources()
+
+	textToSpeech, err := LoadTextToSpeechOnDevice(assetsDir, CPUDevice, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	voicePath, err := GetVoicePath("F1", assetsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	style, err := LoadVoiceStyle([]string{voicePath}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := textToSpeech.Synthesize("Hello there. This is a short test.", "en", style, DefaultSynthesisOptions()); err != nil {
+		t.Fatal(err)
+	}
+	style.Destroy()
+
+	if live := LiveResources(); live.Tensors-before.Tensors != live.Pooled-before.Pooled {
+		t.Errorf("%d tensors live after synthesis, %d of them pooled", live.Tensors-before.Tensors, live.Pooled-before.Pooled)
+	}
+	textToSpeech.Destroy()
+	if live := LiveResources(); live != before {
+		t.Errorf("resources after Destroy = %+v, want %+v", live, before)
+	}
+}
+
+// TestPartialLoadReleasesSessions checks that sessions created before a later
+// model fails to load are destroyed with it
+func TestPartialLoadReleasesSessions(t *testing.T) {
+	assetsDir := testAssets(t)
+	cfg, err := LoadCfgs(assetsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A valid duration predictor and text encoder, then a broken vector estimator
+	dir := t.TempDir()
+	onnxDir := filepath.Join(dir, "onnx")
+	if err := os.Mkdir(onnxDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"duration_predictor.onnx", "text_encoder.onnx"} {
+		if err := os.Symlink(filepath.Join(assetsDir, "onnx", name), filepath.Join(onnxDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(onnxDir, "vector_estimator.onnx"), []byte("not a model"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	before := LiveResources()
+	if textToSpeech, err := LoadTextToSpeechOnDevice(dir, CPUDevice, cfg); err == nil {
+		textToSpeech.Destroy()
+		t.Fatal("loading a broken vector estimator succeeded")
+	}
+	if live := LiveResources(); live.Sessions != before.Sessions {
+		t.Errorf("%d sessions live after a failed load, want %d", live.Sessions, before.Sessions)
+	}
+}
@@ -0,0 +1,34 @@
+package tts
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// respellPattern matches inline respellings such as {{tomato|toh-MAH-toh}}
+var respellPattern = regexp.MustCompile(`\{\{([^{}|]+)\|([^{}|]+)\}\}`)
+
+// expandRespellings replaces each {{word|respelling}} with the respelling, or
+// with the word as written when keepWord is set (spell-out reads the original).
+// Syllable hyphens are joined and the stress capitals lowered, since the model
+// reads respellings like "tohmahtoh" as one word and has no stress control;
+// a capitalized word keeps its capital (only the first letter, so an all-caps
+// word is not then spelled as an acronym)
+func expandRespellings(text string, keepWord bool) string {
+	return respellPattern.ReplaceAllStringFunc(text, func(match string) string {
+		groups := respellPattern.FindStringSubmatch(match)
+		word := strings.TrimSpace(groups[1])
+		if keepWord {
+			return word
+		}
+		respelling := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(groups[2]), "-", ""))
+		if respelling == "" || word == "" {
+			return word + respelling
+		}
+		if r := []rune(word); unicode.IsUpper(r[0]) {
+			return matchCase(string(r[0]), respelling)
+		}
+		return respelling
+	})
+}
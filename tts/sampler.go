@@ -0,0 +1,196 @@
+package tts
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// SynthesisOptions holds the sampler hyperparameters for one synthesis call.
+// The classifier-free guidance scale is fixed inside the exported vector
+// estimator graph and cannot be changed at inference time
+type SynthesisOptions struct {
+	TotalStep       int       // number of denoising steps
+	Speed           float32   // duration divisor (>1 is faster speech)
+	SilenceDuration float32   // seconds of silence inserted between chunks
+	NoiseScale      float32   // standard deviation of the initial noisy latent
+	SwayCoefficient float32   // timestep sway: <0 spends more steps early, 0 is uniform
+	Seed            int64     // noise seed, 0 picks a random one
+	Scheduler       Scheduler // ODE solver used for the denoising loop
+	Declick         bool      // remove DC offset and smooth chunk boundaries
+
+	SkipFailedChunks bool // replace chunks that fail after a retry with a pause instead of failing
+
+	// OnAudio, when set, receives the output progressively as chunks finish:
+	// consecutive calls cover the final waveform in order, without overlap
+	OnAudio func(samples []float32)
+	// FrameWindow, when set with OnAudio, selects low-latency mode: the vocoder
+	// runs on windows of this many latent frames and each is sent as it is ready
+	FrameWindow int
+	// DiscardEmitted, when set with OnAudio, drops samples from the result
+	// once OnAudio has them, so Wav ends up empty and long renders never
+	// hold the whole waveform
+	DiscardEmitted bool
+	// AdaptiveSteps scales TotalStep per chunk with its length: short
+	// utterances get fewer steps, long narrative sentences more
+	AdaptiveSteps bool
+}
+
+// Adaptive step scaling: chunks of up to shortUnits speech units get
+// adaptiveShort of TotalStep, rising linearly to all of it at refUnits and
+// on to adaptiveLong of it at longUnits, never below adaptiveMinSteps
+const (
+	shortUnits       = 8
+	refUnits         = 60
+	longUnits        = 200
+	adaptiveShort    = 0.6
+	adaptiveLong     = 1.4
+	adaptiveMinSteps = 2
+)
+
+// forChunk returns the options for synthesizing one chunk of text, with
+// TotalStep scaled to its length when AdaptiveSteps is set
+func (opts SynthesisOptions) forChunk(text string) SynthesisOptions {
+	if opts.AdaptiveSteps {
+		opts.TotalStep = adaptiveSteps(opts.TotalStep, speechUnits(text))
+	}
+	return opts
+}
+
+// adaptiveSteps scales a step count for a chunk of the given speech units
+func adaptiveSteps(steps, units int) int {
+	var scale float64
+	switch {
+	case units <= shortUnits:
+		scale = adaptiveShort
+	case units <= refUnits:
+		scale = adaptiveShort + (1-adaptiveShort)*float64(units-shortUnits)/(refUnits-shortUnits)
+	default:
+		scale = 1 + (adaptiveLong-1)*min(1, float64(units-refUnits)/(longUnits-refUnits))
+	}
+	return max(min(steps, adaptiveMinSteps), int(math.Round(float64(steps)*scale)))
+}
+
+// Scheduler selects how the vector estimator's flow is integrated
+type Scheduler string
+
+const (
+	// SchedulerEuler takes one first-order step per estimator call (the model's native sampler)
+	SchedulerEuler Scheduler = "euler"
+	// SchedulerMidpoint evaluates the estimator twice per step for second-order accuracy
+	SchedulerMidpoint Scheduler = "midpoint"
+	// SchedulerDPM reuses the previous velocity for a second-order multistep update
+	// (DPM-Solver++ 2M style) at the cost of a single estimator call per step
+	SchedulerDPM Scheduler = "dpm"
+)
+
+// Schedulers lists the supported scheduler names
+var Schedulers = []Scheduler{SchedulerEuler, SchedulerMidpoint, SchedulerDPM}
+
+// ParseScheduler validates a scheduler name ("" selects Euler)
+func ParseScheduler(name string) (Scheduler, error) {
+	if name == "" {
+		return SchedulerEuler, nil
+	}
+	for _, s := range Schedulers {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported scheduler: %s. Available: %v", name, Schedulers)
+}
+
+// DefaultSynthesisOptions returns the sampler settings used by Call
+func DefaultSynthesisOptions() SynthesisOptions {
+	return SynthesisOptions{
+		TotalStep:       5,
+		Speed:           1.0,
+		SilenceDuration: 0.3,
+		NoiseScale:      1.0,
+		Scheduler:       SchedulerEuler,
+		Declick:         true,
+
+		SkipFailedChunks: true,
+	}
+}
+
+// newRand returns the noise source for a seed (0 means time-based)
+func newRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// timesteps returns totalStep+1 flow times from 0 to 1.
+// With sway s the uniform grid u is warped as u + s*(cos(pi/2*u) - 1 + u)
+func timesteps(totalStep int, sway float32) []float64 {
+	ts := make([]float64, totalStep+1)
+	for i := range ts {
+		u := float64(i) / float64(totalStep)
+		ts[i] = u + float64(sway)*(math.Cos(math.Pi/2*u)-1+u)
+	}
+	return ts
+}
+
+// velocityFunc evaluates the flow velocity at latent x and time t (flattened to match x)
+type velocityFunc func(x [][][]float64, t float64) ([]float64, error)
+
+// integrateFlow moves the latent from t=ts[0] to t=ts[len-1] with the given scheduler
+func integrateFlow(x [][][]float64, ts []float64, scheduler Scheduler, velocityAt velocityFunc) ([][][]float64, error) {
+	var prevV []float64
+	prevDt := 0.0
+
+	for step := 0; step+1 < len(ts); step++ {
+		t := ts[step]
+		dt := ts[step+1] - t
+
+		v, err := velocityAt(x, t)
+		if err != nil {
+			return nil, err
+		}
+
+		update := v
+		switch scheduler {
+		case SchedulerMidpoint:
+			mid := addScaled(x, v, dt/2)
+			update, err = velocityAt(mid, t+dt/2)
+			if err != nil {
+				return nil, err
+			}
+		case SchedulerDPM:
+			// Second-order Adams-Bashforth extrapolation with variable step size
+			if prevV != nil && prevDt > 0 {
+				r := dt / (2 * prevDt)
+				update = make([]float64, len(v))
+				for i := range v {
+					update[i] = v[i] + r*(v[i]-prevV[i])
+				}
+			}
+			prevV = v
+			prevDt = dt
+		}
+
+		x = addScaled(x, update, dt)
+	}
+	return x, nil
+}
+
+// addScaled returns x + scale*v, where v is flattened in x's iteration order
+func addScaled(x [][][]float64, v []float64, scale float64) [][][]float64 {
+	out := make([][][]float64, len(x))
+	idx := 0
+	for b := range x {
+		out[b] = make([][]float64, len(x[b]))
+		for d := range x[b] {
+			row := make([]float64, len(x[b][d]))
+			for t := range x[b][d] {
+				row[t] = x[b][d][t] + scale*v[idx]
+				idx++
+			}
+			out[b][d] = row
+		}
+	}
+	return out
+}
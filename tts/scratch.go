@@ -0,0 +1,130 @@
+package tts
+
+import (
+	"slices"
+	"sync/atomic"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// pooledTensors counts the live tensors parked in workers' scratch pools,
+// which stay live between requests by design
+var pooledTensors atomic.Int64
+
+// tensorSlot is one reusable tensor of an inference. The tensor is reused
+// as is while the shape stays the same; otherwise it is recreated over the
+// same Go buffer when that is large enough, so the steady state allocates
+// neither native tensors nor Go memory
+type tensorSlot struct {
+	tensor *ort.Tensor[float32]
+}
+
+// get returns the slot's tensor reshaped to shape; its contents are undefined
+func (s *tensorSlot) get(shape ort.Shape) (*ort.Tensor[float32], error) {
+	if s.tensor != nil && slices.Equal(s.tensor.GetShape(), shape) {
+		return s.tensor, nil
+	}
+	var buf []float32
+	if s.tensor != nil {
+		buf = s.tensor.GetData()
+		destroyTensor(s.tensor)
+		s.tensor = nil
+	}
+	size := int(shape.FlattenedSize())
+	if cap(buf) >= size {
+		buf = buf[:size]
+	} else {
+		buf = make([]float32, size)
+	}
+	tensor, err := newTensor(shape, buf)
+	if err != nil {
+		return nil, err
+	}
+	s.tensor = tensor
+	return tensor, nil
+}
+
+// inferScratch holds the tensors one inference reuses: the denoising loop's
+// inputs and output, which previously were allocated at every step, and the
+// vocoder input
+type inferScratch struct {
+	noisyLatent tensorSlot
+	latentMask  tensorSlot
+	textMask    tensorSlot
+	currentStep tensorSlot
+	totalStep   tensorSlot
+	denoised    tensorSlot
+	vocoderIn   tensorSlot
+}
+
+// slots returns every slot of the scratch set
+func (s *inferScratch) slots() []*tensorSlot {
+	return []*tensorSlot{&s.noisyLatent, &s.latentMask, &s.textMask, &s.currentStep, &s.totalStep, &s.denoised, &s.vocoderIn}
+}
+
+// live returns how many of the scratch set's tensors exist
+func (s *inferScratch) live() int64 {
+	n := int64(0)
+	for _, slot := range s.slots() {
+		if slot.tensor != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// destroy frees the scratch set's tensors
+func (s *inferScratch) destroy() {
+	for _, slot := range s.slots() {
+		if slot.tensor != nil {
+			destroyTensor(slot.tensor)
+			slot.tensor = nil
+		}
+	}
+}
+
+// acquireScratch takes a scratch set from the worker's pool, or a new one.
+// Concurrent inferences on one worker (--gpu-sessions) each get their own
+func (tts *TextToSpeech) acquireScratch() *inferScratch {
+	tts.scratchMu.Lock()
+	defer tts.scratchMu.Unlock()
+	if n := len(tts.scratch); n > 0 {
+		s := tts.scratch[n-1]
+		tts.scratch = tts.scratch[:n-1]
+		pooledTensors.Add(-s.live())
+		return s
+	}
+	return &inferScratch{}
+}
+
+// releaseScratch returns a scratch set to the worker's pool
+func (tts *TextToSpeech) releaseScratch(s *inferScratch) {
+	tts.scratchMu.Lock()
+	defer tts.scratchMu.Unlock()
+	pooledTensors.Add(s.live())
+	tts.scratch = append(tts.scratch, s)
+}
+
+// destroyScratch frees the tensors of every pooled scratch set
+func (tts *TextToSpeech) destroyScratch() {
+	tts.scratchMu.Lock()
+	defer tts.scratchMu.Unlock()
+	for _, s := range tts.scratch {
+		pooledTensors.Add(-s.live())
+		s.destroy()
+	}
+	tts.scratch = nil
+}
+
+// flattenInto copies a [batch][dim][time] array into a flat tensor buffer
+func flattenInto(dst []float32, array [][][]float64) {
+	idx := 0
+	for b := range array {
+		for d := range array[b] {
+			for t := range array[b][d] {
+				dst[idx] = float32(array[b][d][t])
+				idx++
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package tts
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// SpellAlphabets lists the supported spell-out alphabets
+var SpellAlphabets = []string{"letters", "nato"}
+
+// spellTagPattern matches inline spell-out spans such as <spell>AB12C</spell>
+var spellTagPattern = regexp.MustCompile(`(?s)<spell>(.*?)</spell>`)
+
+// letterNames respells English letter names so the model never reads a lone letter as a word
+var letterNames = map[rune]string{
+	'a': "ay", 'b': "bee", 'c': "see", 'd': "dee", 'e': "ee", 'f': "eff", 'g': "jee",
+	'h': "aitch", 'i': "eye", 'j': "jay", 'k': "kay", 'l': "el", 'm': "em", 'n': "en",
+	'o': "oh", 'p': "pee", 'q': "cue", 'r': "ar", 's': "ess", 't': "tee", 'u': "you",
+	'v': "vee", 'w': "double you", 'x': "ex", 'y': "why", 'z': "zee",
+}
+
+// natoAlphabet holds the NATO phonetic alphabet code words
+var natoAlphabet = map[rune]string{
+	'a': "Alpha", 'b': "Bravo", 'c': "Charlie", 'd': "Delta", 'e': "Echo", 'f': "Foxtrot",
+	'g': "Golf", 'h': "Hotel", 'i': "India", 'j': "Juliett", 'k': "Kilo", 'l': "Lima",
+	'm': "Mike", 'n': "November", 'o': "Oscar", 'p': "Papa", 'q': "Quebec", 'r': "Romeo",
+	's': "Sierra", 't': "Tango", 'u': "Uniform", 'v': "Victor", 'w': "Whiskey", 'x': "X-ray",
+	'y': "Yankee", 'z': "Zulu",
+}
+
+// symbolNames reads the punctuation common in codes and IDs
+var symbolNames = map[rune]string{
+	'-': "dash", '_': "underscore", '.': "dot", '/': "slash", '@': "at", '#': "hash",
+	'+': "plus", '*': "star", '&': "and",
+}
+
+// ParseSpellAlphabet validates a spell-out alphabet name ("" selects letters)
+func ParseSpellAlphabet(name string) (string, error) {
+	if name == "" {
+		return "letters", nil
+	}
+	for _, a := range SpellAlphabets {
+		if a == name {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported spell alphabet: %s. Available: %v", name, SpellAlphabets)
+}
+
+// expandSpellTags spells out every <spell>...</spell> span
+func expandSpellTags(text string, alphabet string) string {
+	return spellTagPattern.ReplaceAllStringFunc(text, func(match string) string {
+		return spellOut(spellTagPattern.FindStringSubmatch(match)[1], alphabet)
+	})
+}
+
+// stripSpellTags removes spell-out tags, leaving their content as written
+func stripSpellTags(text string) string {
+	return spellTagPattern.ReplaceAllString(text, "$1")
+}
+
+// spellOut reads text character by character, one comma-separated item per
+// character so the model leaves a short pause between them
+func spellOut(text string, alphabet string) string {
+	var items []string
+	for _, r := range text {
+		lower := unicode.ToLower(r)
+		switch {
+		case unicode.IsSpace(r):
+			continue
+		case r >= '0' && r <= '9':
+			items = append(items, ones[r-'0'])
+		case letterNames[lower] != "":
+			if alphabet == "nato" {
+				items = append(items, fmt.Sprintf("%s as in %s", letterNames[lower], natoAlphabet[lower]))
+			} else {
+				items = append(items, letterNames[lower])
+			}
+		case symbolNames[r] != "":
+			items = append(items, symbolNames[r])
+		default:
+			items = append(items, string(r))
+		}
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,142 @@
+package tts
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// toneSpec describes a sine tone inserted into the output instead of speech;
+// a zero frequency is exact silence
+type toneSpec struct {
+	FrequencyHz float64
+	Duration    float32 // seconds
+}
+
+// bleepTone is the censor tone rendered for the [bleep] token
+var bleepTone = toneSpec{FrequencyHz: 1000, Duration: 0.4}
+
+// beepTone is the [beep] tone before its frequency and duration overrides
+var beepTone = toneSpec{FrequencyHz: 1000, Duration: 0.2}
+
+// maxTokenDuration bounds the length of a single [pause] or [beep] token, and
+// maxTokensDuration that of all the tokens of one text, in seconds
+const (
+	maxTokenDuration  = 30
+	maxTokensDuration = 600
+)
+
+// BleepToken is the inline token rendered as a censor bleep
+const BleepToken = "[bleep]"
+
+// audioTokenPattern matches inline audio tokens in the input text: [bleep],
+// [pause:800ms] and [beep], [beep:440hz], [beep:300ms] or [beep:440hz:300ms]
+var audioTokenPattern = regexp.MustCompile(`(?i)\[(?:bleep|pause:(\d+(?:\.\d+)?)(ms|s)|beep(?::(\d+)hz)?(?::(\d+(?:\.\d+)?)(ms|s))?)\]`)
+
+// textPart is either plain text or an audio token (Text then holds the token itself)
+type textPart struct {
+	Text string
+	Tone *toneSpec
+}
+
+// splitAudioTokens splits text into plain text parts and audio token parts
+func splitAudioTokens(text string) ([]textPart, error) {
+	var parts []textPart
+	last := 0
+	var total float32
+	for _, loc := range audioTokenPattern.FindAllStringSubmatchIndex(text, -1) {
+		parts = append(parts, textPart{Text: text[last:loc[0]]})
+		group := func(i int) string {
+			if loc[2*i] < 0 {
+				return ""
+			}
+			return text[loc[2*i]:loc[2*i+1]]
+		}
+
+		token := text[loc[0]:loc[1]]
+		var tone toneSpec
+		switch {
+		case strings.EqualFold(token, BleepToken):
+			tone = bleepTone
+		case group(1) != "":
+			tone = toneSpec{Duration: tokenDuration(group(1), group(2))}
+		default:
+			tone = beepTone
+			if group(3) != "" {
+				hz, _ := strconv.Atoi(group(3))
+				if hz < 20 || hz > 20000 {
+					return nil, fmt.Errorf("%s: frequency must be between 20 and 20000 Hz", token)
+				}
+				tone.FrequencyHz = float64(hz)
+			}
+			if group(4) != "" {
+				tone.Duration = tokenDuration(group(4), group(5))
+			}
+		}
+		if tone.Duration <= 0 || tone.Duration > maxTokenDuration {
+			return nil, fmt.Errorf("%s: duration must be above 0 and at most %ds", token, maxTokenDuration)
+		}
+		if total += tone.Duration; total > maxTokensDuration {
+			return nil, fmt.Errorf("pause and beep tokens add up to more than %ds", maxTokensDuration)
+		}
+
+		parts = append(parts, textPart{Text: token, Tone: &tone})
+		last = loc[1]
+	}
+	return append(parts, textPart{Text: text[last:]}), nil
+}
+
+// tokenDuration converts a token's number and unit (ms or s) to seconds
+func tokenDuration(value, unit string) float32 {
+	seconds, _ := strconv.ParseFloat(value, 64)
+	if strings.EqualFold(unit, "ms") {
+		seconds /= 1000
+	}
+	return float32(seconds)
+}
+
+// mapTextParts applies fn to the text between audio tokens, leaving the tokens as written
+func mapTextParts(text string, fn func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range audioTokenPattern.FindAllStringIndex(text, -1) {
+		b.WriteString(fn(text[last:loc[0]]))
+		b.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(fn(text[last:]))
+	return b.String()
+}
+
+// hasSpeakableText reports whether text contains any letter or digit
+func hasSpeakableText(text string) bool {
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// render synthesizes the tone with 5ms fades to avoid clicks
+func (t *toneSpec) render(sampleRate int) []float32 {
+	n := int(t.Duration * float32(sampleRate))
+	fade := sampleRate / 200
+	samples := make([]float32, n)
+	if t.FrequencyHz == 0 {
+		return samples
+	}
+	for i := range samples {
+		gain := 0.3
+		if i < fade {
+			gain *= float64(i) / float64(fade)
+		} else if n-i < fade {
+			gain *= float64(n-i) / float64(fade)
+		}
+		samples[i] = float32(gain * math.Sin(2*math.Pi*t.FrequencyHz*float64(i)/float64(sampleRate)))
+	}
+	return samples
+}
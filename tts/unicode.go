@@ -0,0 +1,121 @@
+package tts
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Unicode policies for characters the model has no embedding for
+const (
+	UnsupportedSkip  = "skip"  // drop them (with a space) and speak the rest
+	UnsupportedError = "error" // fail with the offending offsets
+)
+
+// emojiPattern matches emoji and pictographic symbols, which are never spoken
+var emojiPattern = regexp.MustCompile(`[\x{1F000}-\x{1F2FF}\x{1F300}-\x{1F5FF}\x{1F600}-\x{1F64F}\x{1F680}-\x{1F6FF}\x{1F700}-\x{1F77F}\x{1F780}-\x{1F7FF}\x{1F800}-\x{1F8FF}\x{1F900}-\x{1F9FF}\x{1FA00}-\x{1FA6F}\x{1FA70}-\x{1FAFF}\x{2300}-\x{23FF}\x{2600}-\x{26FF}\x{2700}-\x{27BF}\x{2B00}-\x{2BFF}\x{1F1E6}-\x{1F1FF}]+`)
+
+// invisiblePattern matches invisible format characters: zero-width space and
+// joiners (emoji ZWJ sequences), bidi marks and embeddings (RTL text), word
+// joiners and isolates, the BOM, variation selectors, the combining keycap and
+// emoji tag characters
+var invisiblePattern = regexp.MustCompile(`[\x{200B}-\x{200F}\x{202A}-\x{202E}\x{2060}-\x{2069}\x{FEFF}\x{FE00}-\x{FE0F}\x{20E3}\x{E0020}-\x{E007F}]+`)
+
+// UnsupportedChar is one character of the input the model cannot speak
+type UnsupportedChar struct {
+	Offset int  // character (rune) offset in the input
+	Rune   rune // the character itself
+}
+
+// UnsupportedTextError reports every unsupported character of an input
+type UnsupportedTextError struct {
+	Chars []UnsupportedChar
+}
+
+func (e *UnsupportedTextError) Error() string {
+	const maxListed = 10
+	parts := make([]string, 0, min(len(e.Chars), maxListed))
+	for _, c := range e.Chars[:min(len(e.Chars), maxListed)] {
+		parts = append(parts, fmt.Sprintf("%U %q at %d", c.Rune, c.Rune, c.Offset))
+	}
+	if len(e.Chars) > maxListed {
+		parts = append(parts, fmt.Sprintf("and %d more", len(e.Chars)-maxListed))
+	}
+	return "unsupported characters (character offsets): " + strings.Join(parts, ", ")
+}
+
+// ApplyUnicodePolicy checks text for characters the model cannot speak after
+// normalization. Accented letters whose accent the model lacks are
+// transliterated to the bare letter; anything else unsupported is replaced by a
+// space with UnsupportedSkip, or listed in an *UnsupportedTextError with
+// UnsupportedError
+func (tts *TextToSpeech) ApplyUnicodePolicy(text string, policy string) (string, error) {
+	var unsupported []UnsupportedChar
+	var b strings.Builder
+	offset := 0
+	tokens := audioTokenPattern.FindAllStringIndex(text, -1)
+	for i, r := range text {
+		// Audio tokens are rendered, not spoken, so their brackets need no support
+		for len(tokens) > 0 && tokens[0][1] <= i {
+			tokens = tokens[1:]
+		}
+		if len(tokens) > 0 && tokens[0][0] <= i {
+			b.WriteRune(r)
+		} else if replacement, ok := tts.textProcessor.transliterate(r); ok {
+			b.WriteString(replacement)
+		} else {
+			unsupported = append(unsupported, UnsupportedChar{Offset: offset, Rune: r})
+			b.WriteRune(' ')
+		}
+		offset++
+	}
+
+	if len(unsupported) > 0 && policy == UnsupportedError {
+		return "", &UnsupportedTextError{Chars: unsupported}
+	}
+	return b.String(), nil
+}
+
+// transliterate returns what a character should be given to preprocessing as:
+// itself if it is whitespace, removed or replaced by preprocessText, or
+// decomposes (NFKD) into characters the indexer knows; its decomposition
+// without the combining marks the indexer lacks; or false if a base character
+// is unsupported
+func (up *UnicodeProcessor) transliterate(r rune) (string, bool) {
+	s := string(r)
+	if unicode.IsSpace(r) || emojiPattern.MatchString(s) || invisiblePattern.MatchString(s) {
+		return s, true
+	}
+	if _, ok := symbolReplacements[s]; ok || slices.Contains(specialSymbols, s) {
+		return s, true
+	}
+
+	var b strings.Builder
+	changed := false
+	for _, d := range norm.NFKD.String(s) {
+		switch {
+		case up.supports(d):
+			b.WriteRune(d)
+		case unicode.Is(unicode.Mn, d):
+			changed = true
+		default:
+			return "", false
+		}
+	}
+	if !changed {
+		return s, true
+	}
+	if b.Len() == 0 {
+		return "", true // a lone unsupported combining mark
+	}
+	return b.String(), true
+}
+
+// supports reports whether the indexer has an embedding for a character
+func (up *UnicodeProcessor) supports(r rune) bool {
+	return int(r) < len(up.indexer) && up.indexer[r] >= 0
+}
@@ -0,0 +1,78 @@
+package tts
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// URL handling modes
+const (
+	URLsRead = "read" // "example dot com slash docs"
+	URLsSkip = "skip" // leave links and addresses out of the speech
+)
+
+// URLModes lists the supported URL handling modes
+var URLModes = []string{URLsRead, URLsSkip}
+
+// emailPattern matches e-mail addresses
+var emailPattern = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`)
+
+// urlPattern matches URLs with a scheme, www. hosts and bare domains with a common TLD
+var urlPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+|\bwww\.[^\s<>"]+|\b[a-z0-9-]+(\.[a-z0-9-]+)*\.(com|org|net|io|dev|ai|app|edu|gov|co|uk|de|fr|es|kr|me|info)\b(/[^\s<>"]*)?`)
+
+// schemePattern matches the scheme of a URL, which is not read
+var schemePattern = regexp.MustCompile(`(?i)^https?://`)
+
+// urlSymbols reads the punctuation inside URLs and e-mail addresses
+var urlSymbols = strings.NewReplacer(
+	".", " dot ", "/", " slash ", "-", " dash ", "_", " underscore ",
+	"@", " at ", "~", " tilde ", "+", " plus ", ":", " colon ", "=", " equals ",
+	"&", " and ", "%", " percent ", "#", " hash ",
+)
+
+// ParseURLMode validates a URL handling mode ("" selects read)
+func ParseURLMode(name string) (string, error) {
+	if name == "" {
+		return URLsRead, nil
+	}
+	for _, m := range URLModes {
+		if m == name {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported urls mode: %s. Available: %v", name, URLModes)
+}
+
+// expandURLs verbalizes e-mail addresses and URLs, or removes them with URLsSkip.
+// The scheme, query string and fragment of a URL are not read
+func expandURLs(text string, mode string) string {
+	text = replaceLinks(text, emailPattern, mode, func(address string) string {
+		return verbalizeLink(address)
+	})
+	return replaceLinks(text, urlPattern, mode, func(link string) string {
+		link = schemePattern.ReplaceAllString(link, "")
+		if i := strings.IndexAny(link, "?#"); i >= 0 {
+			link = link[:i]
+		}
+		return verbalizeLink(strings.TrimSuffix(link, "/"))
+	})
+}
+
+// replaceLinks rewrites each match of pattern, keeping sentence punctuation
+// that trails it (a URL at the end of a sentence keeps its full stop)
+func replaceLinks(text string, pattern *regexp.Regexp, mode string, read func(string) string) string {
+	return pattern.ReplaceAllStringFunc(text, func(match string) string {
+		link := strings.TrimRight(match, ".,;:!?)]'\"")
+		trailing := match[len(link):]
+		if mode == URLsSkip {
+			return trailing
+		}
+		return read(link) + trailing
+	})
+}
+
+// verbalizeLink reads the separators of a link as words
+func verbalizeLink(link string) string {
+	return strings.Join(strings.Fields(urlSymbols.Replace(link)), " ")
+}
@@ -2,7 +2,6 @@ package tts
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 )
 
@@ -30,13 +29,26 @@ func GetVoicePath(voiceName string, assetsDir string) (string, error) {
 	}
 
 	path := filepath.Join(assetsDir, "voice_styles", filename)
-	if _, err := os.Stat(path); err != nil {
+	if !AssetExists(path) {
 		return "", fmt.Errorf("voice style file not found for %s at %s", voiceName, path)
 	}
 
 	return path, nil
 }
 
+// GetVoicePathForLanguage returns the voice's style tuned for a language, kept
+// at [assetsDir]/voice_styles/[lang]/[filename] (e.g. Korean styles under
+// voice_styles/ko/), falling back to the voice's default style
+func GetVoicePathForLanguage(voiceName string, assetsDir string, lang string) (string, error) {
+	if filename, exists := VoiceMapping[voiceName]; exists && isValidLang(lang) {
+		path := filepath.Join(assetsDir, "voice_styles", lang, filename)
+		if AssetExists(path) {
+			return path, nil
+		}
+	}
+	return GetVoicePath(voiceName, assetsDir)
+}
+
 // GetAvailableVoices returns list of available voice names
 func GetAvailableVoices() []string {
 	voices := make([]string, 0, len(VoiceMapping))
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-supertonic/tts"
+)
+
+// tuneText is the sentence `supertonic tune` times at each step count
+const tuneText = "Benchmarking this host to pick settings that keep speech fast without giving up more quality than needed."
+
+// tuneTargetRTF is the real-time factor (synthesis time over audio duration)
+// the recommended steps must reach on CPU, leaving headroom for concurrent requests
+const tuneTargetRTF = 0.3
+
+// gpuSessionMB is the VRAM one set of ONNX sessions is assumed to need when
+// sizing --gpu-sessions
+const gpuSessionMB = 1500
+
+// runTune implements `supertonic tune`: benchmark the host (CPU threads,
+// memory, GPUs and synthesis speed per step count) and write the recommended
+// settings to the --config file, keeping the file's other lines
+func runTune(args []string) {
+	fs, opts := newCLIFlagSet("tune")
+	dryRun := fs.Bool("dry-run", false, "Print the recommended settings instead of writing them")
+	fs.Parse(args)
+
+	path := config.ConfigFile
+	if path == "" {
+		path = "supertonic.conf"
+	}
+	if _, err := os.Stat(path); err != nil {
+		config.ConfigFile = "" // the file is created below
+	}
+	cleanup := startCLI(opts)
+	defer cleanup()
+	config.UseGPU, gpuDevices = false, nil // the CPU is benchmarked, GPUs are probed separately
+
+	threads := runtime.NumCPU()
+	memoryMB := availableMemoryMB()
+	log.Printf("Host: %d CPU threads, %d MB memory available", threads, memoryMB)
+
+	var settings []configSetting
+	pack, err := resolveModelPack(config.DefaultModel)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// GPUs that can load the model take the synthesis off the CPU
+	var usable []string
+	minFree := 0
+	if free, err := queryGPUFreeMB(); err == nil {
+		ids := make([]int, 0, len(free))
+		for id := range free {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			if err := tts.ProbeDevice(pack.Dir, id); err != nil {
+				log.Printf("GPU %d: unusable: %v", id, err)
+				continue
+			}
+			log.Printf("GPU %d: %d MB free", id, free[id])
+			usable = append(usable, strconv.Itoa(id))
+			if minFree == 0 || free[id] < minFree {
+				minFree = free[id]
+			}
+		}
+	}
+	if len(usable) > 0 {
+		sessions := min(max(minFree/gpuSessionMB, 1), 4)
+		settings = append(settings,
+			configSetting{"use-gpu", "true", fmt.Sprintf("%d GPU(s) loaded the model", len(usable))},
+			configSetting{"gpu-devices", strings.Join(usable, ","), "GPUs that loaded the model"},
+			configSetting{"gpu-sessions", strconv.Itoa(sessions), fmt.Sprintf("%d MB free on the smallest GPU, about %d MB per session", minFree, gpuSessionMB)},
+			configSetting{"job-workers", strconv.Itoa(sessions * len(usable)), "one async job per GPU session"},
+		)
+	} else {
+		// ONNX Runtime already spreads one synthesis over every core
+		settings = append(settings, configSetting{"use-gpu", "false", "no usable GPU found"},
+			configSetting{"job-workers", "1", fmt.Sprintf("each CPU synthesis uses all %d threads", threads)})
+
+		steps, rtf := tuneSteps(pack.Name)
+		reason := fmt.Sprintf("real-time factor %.2f at %d steps (target %.2f)", rtf, steps, tuneTargetRTF)
+		settings = append(settings, configSetting{"total-step", strconv.Itoa(steps), reason})
+		if steps < config.TotalStep {
+			settings = append(settings, configSetting{"adaptive-steps", "true", "spend the steps saved on short utterances on long sentences"})
+		}
+
+		// Another installed pack (e.g. a quantized export) may be much faster on this CPU
+		if faster, fasterRTF := tuneFastestPack(pack.Name, steps, rtf); faster != pack.Name {
+			settings = append(settings, configSetting{"default-model", faster,
+				fmt.Sprintf("real-time factor %.2f against %.2f for %s at %d steps", fasterRTF, rtf, pack.Name, steps)})
+		}
+	}
+
+	if memoryMB > 0 {
+		cacheMB := min(max(memoryMB/32, 16), 512)
+		settings = append(settings, configSetting{"frontend-cache-mb", strconv.Itoa(cacheMB), fmt.Sprintf("1/32 of the %d MB memory available", memoryMB)})
+	}
+
+	for _, s := range settings {
+		fmt.Fprintf(cliStdout, "%s = %s  # %s\n", s.Name, s.Value, s.Reason)
+	}
+	if *dryRun {
+		return
+	}
+	header := fmt.Sprintf("Recommended by supertonic tune on %s", time.Now().Format("2006-01-02"))
+	if err := updateConfigFile(path, settings, header); err != nil {
+		log.Fatalf("Failed to write %s: %v", path, err)
+	}
+	log.Printf("Wrote %d settings to %s (use with --config %s)", len(settings), path, path)
+}
+
+// tuneSteps times the benchmark sentence from --total-step down to 2 steps and
+// returns the most steps meeting tuneTargetRTF (or the fewest tried), with its
+// real-time factor
+func tuneSteps(model string) (int, float64) {
+	// The first synthesis pays for lazy ONNX initialization
+	if _, err := tuneSynthesis(model, config.TotalStep); err != nil {
+		log.Fatalf("Benchmark synthesis failed: %v", err)
+	}
+	steps, rtf := config.TotalStep, 0.0
+	for steps = config.TotalStep; steps >= 2; steps-- {
+		var err error
+		if rtf, err = tuneSynthesis(model, steps); err != nil {
+			log.Fatalf("Benchmark synthesis failed: %v", err)
+		}
+		log.Printf("%d steps: real-time factor %.2f", steps, rtf)
+		if rtf <= tuneTargetRTF || steps == 2 {
+			break
+		}
+	}
+	return steps, rtf
+}
+
+// tuneFastestPack times the other model packs at steps and returns the one
+// that is at least a quarter faster than current, or current itself
+func tuneFastestPack(current string, steps int, currentRTF float64) (string, float64) {
+	best, bestRTF := current, currentRTF*0.75
+	for name := range modelPacks {
+		if name == current {
+			continue
+		}
+		tuneSynthesis(name, steps) // warm up
+		rtf, err := tuneSynthesis(name, steps)
+		if err != nil {
+			log.Printf("Model pack %s: benchmark failed: %v", name, err)
+			continue
+		}
+		log.Printf("Model pack %s: real-time factor %.2f at %d steps", name, rtf, steps)
+		if rtf < bestRTF {
+			best, bestRTF = name, rtf
+		}
+	}
+	if best == current {
+		return current, currentRTF
+	}
+	return best, bestRTF
+}
+
+// tuneSynthesis synthesizes tuneText and returns its real-time factor
+func tuneSynthesis(model string, steps int) (float64, error) {
+	req := TTSRequest{Input: tuneText, Model: model, Steps: steps, Seed: 1}
+	if err := validateRequest(&req); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	result, _, err := synthesizeSpeech(&req, nil)
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(start).Seconds() / float64(result.Duration), nil
+}
+
+// availableMemoryMB reads MemAvailable from /proc/meminfo, or 0 where there is none
+func availableMemoryMB() int {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "MemAvailable:"); ok {
+			kb, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), " kB"))
+			return kb / 1024
+		}
+	}
+	return 0
+}
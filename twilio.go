@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// twilioFrameBytes is 20 ms of 8 kHz µ-law, the frame size Twilio itself sends
+const twilioFrameBytes = 160
+
+// twilioMessage is a Twilio Media Streams message. "speak" is a server
+// extension that lets the application driving the call queue more prompts
+type twilioMessage struct {
+	Event     string `json:"event"`
+	StreamSid string `json:"streamSid,omitempty"`
+	Start     *struct {
+		StreamSid        string            `json:"streamSid"`
+		CallSid          string            `json:"callSid"`
+		CustomParameters map[string]string `json:"customParameters"`
+	} `json:"start,omitempty"`
+	Speak *TTSRequest `json:"speak,omitempty"`
+}
+
+// twilioMedia is an outbound media or mark message
+type twilioMedia struct {
+	Event     string          `json:"event"`
+	StreamSid string          `json:"streamSid"`
+	Media     *twilioPayload  `json:"media,omitempty"`
+	Mark      *twilioMarkName `json:"mark,omitempty"`
+}
+
+type twilioPayload struct {
+	Payload string `json:"payload"`
+}
+
+type twilioMarkName struct {
+	Name string `json:"name"`
+}
+
+// handleTwilioStream serves a bidirectional Twilio Media Stream
+// (<Connect><Stream url="wss://host/v1/audio/twilio">). The prompt comes from
+// the stream's custom parameters (text, voice, speed, language); later prompts
+// can be sent as {"event":"speak","speak":{...speech request...}}. Each prompt
+// is streamed as 20 ms µ-law frames followed by a mark named after it. With
+// --api-keys the stream URL carries the key (?api_key=), and every prompt is
+// checked against its voices, quota and scheduling like an HTTP request
+func handleTwilioStream(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		sendError(w, "WebSocket upgrade failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Prompts are synthesized in order by one goroutine so reading never stalls;
+	// streamSid is set once before the first prompt is queued. Once the call
+	// ends, ctx is cancelled so queued prompts are dropped unsynthesized, and
+	// the socket is closed only after the goroutine has stopped using it
+	prompts := make(chan TTSRequest, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	spoken := make(chan struct{})
+	defer func() {
+		cancel()
+		close(prompts)
+		<-spoken
+		ws.Close()
+	}()
+	var streamSid string
+
+	go func() {
+		defer close(spoken)
+		count := 0
+		for req := range prompts {
+			if ctx.Err() != nil {
+				continue
+			}
+			count++
+			req.key = requestAPIKey(r)
+			if err := speakToTwilio(ctx, r, ws, streamSid, req, "prompt-"+strconv.Itoa(count)); err != nil && ctx.Err() == nil {
+				log.Printf("Twilio %s: %v", streamSid, err)
+			}
+		}
+	}()
+
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg twilioMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Printf("Twilio: invalid message: %v", err)
+			continue
+		}
+
+		switch msg.Event {
+		case "start":
+			if msg.Start == nil || streamSid != "" {
+				continue
+			}
+			streamSid = msg.Start.StreamSid
+			log.Printf("Twilio stream %s started (call %s)", streamSid, msg.Start.CallSid)
+			if req, ok := twilioPrompt(msg.Start.CustomParameters); ok {
+				prompts <- req
+			}
+		case "speak":
+			if msg.Speak != nil && streamSid != "" {
+				prompts <- *msg.Speak
+			}
+		case "stop":
+			log.Printf("Twilio stream %s stopped", streamSid)
+			return
+		}
+	}
+}
+
+// twilioPrompt builds a speech request from <Stream> custom parameters
+func twilioPrompt(params map[string]string) (TTSRequest, bool) {
+	req := TTSRequest{
+		Input:    params["text"],
+		Voice:    params["voice"],
+		Model:    params["model"],
+		Language: params["language"],
+	}
+	if speed, err := strconv.ParseFloat(params["speed"], 64); err == nil {
+		req.Speed = speed
+	}
+	return req, req.Input != ""
+}
+
+// speakToTwilio synthesizes one prompt as 8 kHz µ-law and streams it in media
+// frames, stopping once ctx is cancelled
+func speakToTwilio(ctx context.Context, r *http.Request, ws *wsConn, streamSid string, req TTSRequest, mark string) error {
+	req.ResponseFormat = formatULaw
+	if err := runPreValidateHooks(r, &req); err != nil {
+		return err
+	}
+	if err := validateRequest(&req); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	audioData, err := generateSpeech(&req)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(audioData); start += twilioFrameBytes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		frame := audioData[start:min(start+twilioFrameBytes, len(audioData))]
+		msg := twilioMedia{
+			Event:     "media",
+			StreamSid: streamSid,
+			Media:     &twilioPayload{Payload: base64.StdEncoding.EncodeToString(frame)},
+		}
+		if err := writeJSONMessage(ws, msg); err != nil {
+			return err
+		}
+	}
+
+	return writeJSONMessage(ws, twilioMedia{Event: "mark", StreamSid: streamSid, Mark: &twilioMarkName{Name: mark}})
+}
+
+// writeJSONMessage sends v as a WebSocket text message
+func writeJSONMessage(ws *wsConn, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.WriteText(data)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Upload limits: a multipart speech request, and a job that may carry a whole book
+const (
+	maxUploadBytes    = 10 << 20
+	maxJobUploadBytes = 50 << 20
+)
+
+// isMultipartRequest reports whether the body is multipart/form-data
+func isMultipartRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "multipart/form-data"
+}
+
+// readUpload reads a multipart request: the document comes from the "file"
+// field and the other options from an optional "request" field holding the
+// usual JSON body, decoded into settings. The document's text is returned split
+// into chapters
+func readUpload(w http.ResponseWriter, r *http.Request, limit int64, settings interface{}) ([]docSection, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	if err := r.ParseMultipartForm(maxUploadBytes); err != nil {
+		return nil, fmt.Errorf("invalid multipart body: %w", err)
+	}
+
+	if field := r.FormValue("request"); field != "" {
+		if err := json.Unmarshal([]byte(field), settings); err != nil {
+			return nil, fmt.Errorf("invalid request field: %w", err)
+		}
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return nil, fmt.Errorf("a file field with the text is required")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	kind := uploadKind(header.Filename, header.Header.Get("Content-Type"))
+	if kind == "" {
+		return nil, fmt.Errorf("file must be plain text (.txt), Markdown (.md), HTML (.html) or PDF (.pdf)")
+	}
+	return extractDocument(kind, data)
+}
+
+// decodeUploadRequest reads a multipart speech request; the document's
+// chapters are read in order with a pause between them
+func decodeUploadRequest(w http.ResponseWriter, r *http.Request) (TTSRequest, error) {
+	var req TTSRequest
+	sections, err := readUpload(w, r, maxUploadBytes, &req)
+	if err != nil {
+		return req, err
+	}
+	req.Input = sectionsInput(sections)
+	return req, nil
+}
+
+// decodeJobUpload reads a multipart job request. A packaged job gets one file
+// per chapter of the document; otherwise the chapters make up a single input
+func decodeJobUpload(w http.ResponseWriter, r *http.Request) (JobRequest, error) {
+	var req JobRequest
+	sections, err := readUpload(w, r, maxJobUploadBytes, &req)
+	if err != nil {
+		return req, err
+	}
+	if req.Input != "" || len(req.Items) > 0 {
+		return req, fmt.Errorf("input and items cannot be combined with an uploaded file")
+	}
+	if req.Package != "" {
+		req.Items = sectionItems(sections)
+		if len(req.Items) == 0 {
+			return req, fmt.Errorf("no text found in file")
+		}
+		return req, nil
+	}
+	req.Input = sectionsInput(sections)
+	return req, nil
+}
+
+// uploadKind classifies an uploaded file as "text", "markdown", "html" or
+// "pdf" from its content type, falling back to the file extension
+func uploadKind(filename, contentType string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/markdown", "text/x-markdown":
+		return "markdown"
+	case "text/html", "application/xhtml+xml":
+		return "html"
+	case "application/pdf":
+		return "pdf"
+	case "text/plain":
+		if ext == ".md" || ext == ".markdown" {
+			return "markdown"
+		}
+		return "text"
+	}
+	switch ext {
+	case ".md", ".markdown":
+		return "markdown"
+	case ".html", ".htm", ".xhtml":
+		return "html"
+	case ".pdf":
+		return "pdf"
+	case ".txt", ".text", "":
+		return "text"
+	}
+	return ""
+}
+
+// Markdown constructs stripped by markdownToText
+var (
+	mdFence      = regexp.MustCompile("(?m)^\\s*(```|~~~).*$")
+	mdImage      = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink       = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	mdRefLink    = regexp.MustCompile(`\[([^\]]+)\]\[[^\]]*\]`)
+	mdRefDef     = regexp.MustCompile(`(?m)^\s*\[[^\]]+\]:\s+\S+.*$`)
+	mdHeading    = regexp.MustCompile(`(?m)^\s{0,3}#{1,6}\s+(.*?)\s*#*\s*$`)
+	mdSetext     = regexp.MustCompile(`(?m)^\s*(=+|-+)\s*$`)
+	mdRule       = regexp.MustCompile(`(?m)^\s*([-*_]\s*){3,}$`)
+	mdQuote      = regexp.MustCompile(`(?m)^\s*>+\s?`)
+	mdListMarker = regexp.MustCompile(`(?m)^\s*([-*+]|\d+[.)])\s+(\[[ xX]\]\s+)?`)
+	mdEmphasis   = regexp.MustCompile(`\*\*([^*\n]+)\*\*|\*([^*\n]+)\*|\b__?([^_\n]+)__?\b|~~([^~\n]+)~~`)
+	mdCode       = regexp.MustCompile("`([^`]*)`")
+	mdHTML       = regexp.MustCompile(`</?[A-Za-z][^>]*>`)
+	mdTableRule  = regexp.MustCompile(`(?m)^\s*\|?(\s*:?-+:?\s*\|)+\s*:?-*:?\s*$`)
+)
+
+// markdownToText reduces Markdown to the text a listener should hear: markup,
+// link targets and images go; headings end with a full stop so they are read
+// as sentences of their own
+func markdownToText(md string) string {
+	text := mdFence.ReplaceAllString(md, "")
+	text = mdRefDef.ReplaceAllString(text, "")
+	text = mdImage.ReplaceAllString(text, "")
+	text = mdLink.ReplaceAllString(text, "$1")
+	text = mdRefLink.ReplaceAllString(text, "$1")
+	text = mdTableRule.ReplaceAllString(text, "")
+	text = mdRule.ReplaceAllString(text, "")
+	text = mdHeading.ReplaceAllStringFunc(text, func(line string) string {
+		return sentence(mdHeading.FindStringSubmatch(line)[1])
+	})
+	text = mdSetext.ReplaceAllString(text, "")
+	text = mdQuote.ReplaceAllString(text, "")
+	text = mdListMarker.ReplaceAllString(text, "")
+	text = mdCode.ReplaceAllString(text, "$1")
+	text = mdEmphasis.ReplaceAllString(text, "$1$2$3$4")
+	text = mdHTML.ReplaceAllString(text, "")
+	text = strings.ReplaceAll(text, "|", " ")
+	return text
+}
+
+// sentence ends a heading or title with a full stop unless it has punctuation
+func sentence(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.ContainsAny(s[len(s)-1:], ".!?:;") {
+		return s
+	}
+	return s + "."
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// usageSaveInterval is how often changed usage is written to --usage-file,
+// or merged with the shared store under --stateless
+const usageSaveInterval = 10 * time.Second
+
+// keyUsage is what an API key has synthesized in the current calendar month (UTC).
+// Keys that share a name share their usage, so a tenant can rotate keys.
+// The reserved amounts belong to syntheses still running and are not saved;
+// the unshared amounts are charged here but not yet added to the shared store
+type keyUsage struct {
+	Period     string  `json:"period"` // e.g. 2026-10
+	Characters int64   `json:"characters"`
+	Seconds    float64 `json:"seconds"`
+
+	reservedChars   int64
+	reservedSeconds float64
+	unsharedChars   int64
+	unsharedSeconds float64
+}
+
+var (
+	usageMu    sync.Mutex
+	usage      = map[string]*keyUsage{}
+	usageDirty bool // usage changed since it was last saved
+)
+
+// quotaError reports a request refused because its key's monthly quota is spent
+type quotaError struct {
+	Resource string // "characters" or "seconds"
+	Used     float64
+	Limit    float64
+	Resets   time.Time
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("monthly %s quota exceeded (%s of %s used); resets %s",
+		e.Resource, strconv.FormatFloat(e.Used, 'f', -1, 64), strconv.FormatFloat(e.Limit, 'f', -1, 64), e.Resets.Format(time.RFC3339))
+}
+
+// usagePeriod names the quota month containing t
+func usagePeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// periodReset returns when the quota month containing t ends
+func periodReset(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// currentUsage returns the key's usage for this month, starting afresh when the
+// month has turned. The caller holds usageMu
+func currentUsage(key *apiKey) *keyUsage {
+	return currentUsageOf(key.Name)
+}
+
+// currentUsageOf is currentUsage by key name. The caller holds usageMu
+func currentUsageOf(name string) *keyUsage {
+	period := usagePeriod(time.Now())
+	u, ok := usage[name]
+	if !ok || u.Period != period {
+		u = &keyUsage{Period: period}
+		usage[name] = u
+	}
+	return u
+}
+
+// checkQuota refuses a request whose input would exceed its key's monthly
+// character quota, or whose key has no audio seconds left. Characters and
+// seconds reserved by running syntheses count as used
+func checkQuota(req *TTSRequest) error {
+	key := req.key
+	if key == nil || (key.MonthlyChars == 0 && key.MonthlySeconds == 0) {
+		return nil
+	}
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	return quotaLeft(key, currentUsage(key), int64(len([]rune(req.Input))), 0)
+}
+
+// quotaLeft reports whether chars more characters and seconds more audio fit
+// the key's quotas. The caller holds usageMu
+func quotaLeft(key *apiKey, u *keyUsage, chars int64, seconds float64) error {
+	resets := periodReset(time.Now())
+	usedChars := u.Characters + u.reservedChars
+	if key.MonthlyChars > 0 && usedChars+chars > key.MonthlyChars {
+		return &quotaError{Resource: "characters", Used: float64(usedChars), Limit: float64(key.MonthlyChars), Resets: resets}
+	}
+	usedSeconds := u.Seconds + u.reservedSeconds
+	if key.MonthlySeconds > 0 && (usedSeconds >= key.MonthlySeconds || usedSeconds+seconds > key.MonthlySeconds) {
+		return &quotaError{Resource: "seconds", Used: usedSeconds, Limit: key.MonthlySeconds, Resets: resets}
+	}
+	return nil
+}
+
+// reserveQuota holds the request's characters and predicted seconds of audio
+// against its key's quotas while it is synthesized, so concurrent requests
+// cannot together overshoot them. The returned func releases the reservation
+// once recordUsage has charged the actual audio
+func reserveQuota(req *TTSRequest, predicted float64) (func(), error) {
+	key := req.key
+	if key == nil || (key.MonthlyChars == 0 && key.MonthlySeconds == 0) {
+		return func() {}, nil
+	}
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	u := currentUsage(key)
+	chars := int64(len([]rune(req.Input)))
+	if err := quotaLeft(key, u, chars, predicted); err != nil {
+		return nil, err
+	}
+	u.reservedChars += chars
+	u.reservedSeconds += predicted
+	return func() {
+		usageMu.Lock()
+		defer usageMu.Unlock()
+		u.reservedChars -= chars
+		u.reservedSeconds -= predicted
+	}, nil
+}
+
+// recordUsage charges a finished synthesis to the request's key. --usage-file
+// and the shared store are written by runUsageSaver rather than on every request
+func recordUsage(req *TTSRequest, seconds float64) {
+	if req.key == nil {
+		return
+	}
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	u := currentUsage(req.key)
+	chars := int64(len([]rune(req.Input)))
+	u.Characters += chars
+	u.Seconds += seconds
+	if config.Stateless {
+		u.unsharedChars += chars
+		u.unsharedSeconds += seconds
+	}
+	usageDirty = true
+}
+
+// runUsageSaver writes changed usage to --usage-file every usageSaveInterval,
+// or under --stateless merges it with what the other replicas charged
+func runUsageSaver() {
+	ticker := time.NewTicker(usageSaveInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if config.Stateless {
+			if err := syncSharedUsage(); err != nil {
+				log.Printf("Failed to sync usage with the shared store: %v", err)
+			}
+			continue
+		}
+
+		usageMu.Lock()
+		if !usageDirty {
+			usageMu.Unlock()
+			continue
+		}
+		data, err := json.Marshal(usage)
+		usageDirty = false
+		usageMu.Unlock()
+
+		if err == nil {
+			err = saveUsage(config.UsageFile, data)
+		}
+		if err != nil {
+			log.Printf("Failed to save usage: %v", err)
+			usageMu.Lock()
+			usageDirty = true
+			usageMu.Unlock()
+		}
+	}
+}
+
+// loadUsage restores usage saved by an earlier run; a missing file is a fresh start
+func loadUsage(file string) error {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read usage file: %w", err)
+	}
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return fmt.Errorf("invalid usage file: %w", err)
+	}
+	return nil
+}
+
+// saveUsage writes marshaled usage through a temporary file so a crash never
+// leaves it half written
+func saveUsage(file string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".usage-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// quotaStatus is one quota in the usage report; Limit and Remaining are
+// omitted for unlimited resources
+type quotaStatus struct {
+	Used      float64  `json:"used"`
+	Limit     *float64 `json:"limit,omitempty"`
+	Remaining *float64 `json:"remaining,omitempty"`
+}
+
+// newQuotaStatus reports used against limit (0 for unlimited)
+func newQuotaStatus(used, limit float64) quotaStatus {
+	status := quotaStatus{Used: used}
+	if limit > 0 {
+		remaining := max(limit-used, 0)
+		status.Limit, status.Remaining = &limit, &remaining
+	}
+	return status
+}
+
+// handleUsage reports the caller's usage and remaining quota for this month
+func handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := requestAPIKey(r)
+	if key == nil {
+		sendError(w, "Usage tracking is disabled (start the server with --api-keys)", http.StatusNotFound)
+		return
+	}
+
+	usageMu.Lock()
+	u := *currentUsage(key)
+	usageMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key":        key.Name,
+		"period":     u.Period,
+		"resets_at":  periodReset(time.Now()),
+		"characters": newQuotaStatus(float64(u.Characters), float64(key.MonthlyChars)),
+		"seconds":    newQuotaStatus(u.Seconds, key.MonthlySeconds),
+	})
+}
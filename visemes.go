@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+
+	"go-supertonic/tts"
+)
+
+// Viseme sets of the visemes request option
+const (
+	visemeSetOculus = "oculus"
+	visemeSetARKit  = "arkit"
+)
+
+// oculusVisemes is the Oculus (Meta) lipsync viseme set, in ID order
+var oculusVisemes = []string{"sil", "PP", "FF", "TH", "DD", "kk", "CH", "SS", "nn", "RR", "aa", "E", "ih", "oh", "ou"}
+
+// oculusLetters maps letters and digraphs to Oculus visemes; like the speech
+// mark visemes they follow the spelling since the model has no phoneme output
+var oculusLetters = map[string]string{
+	"ch": "CH", "sh": "CH", "th": "TH", "ph": "FF", "ng": "kk", "ck": "kk",
+	"b": "PP", "m": "PP", "p": "PP",
+	"f": "FF", "v": "FF",
+	"d": "DD", "t": "DD",
+	"n": "nn", "l": "nn",
+	"g": "kk", "k": "kk", "c": "kk", "q": "kk", "x": "kk", "h": "kk",
+	"j": "CH", "r": "RR", "s": "SS", "z": "SS",
+	"a": "aa", "e": "E", "i": "ih", "y": "ih", "o": "oh", "u": "ou", "w": "ou",
+}
+
+// arkitBlendshapes gives the ARKit face blendshape weights that pose each
+// Oculus viseme; shapes not listed are 0
+var arkitBlendshapes = map[string]map[string]float32{
+	"sil": {},
+	"PP":  {"mouthClose": 0.6, "mouthPressLeft": 0.4, "mouthPressRight": 0.4},
+	"FF":  {"jawOpen": 0.1, "mouthRollLower": 0.5, "mouthUpperUpLeft": 0.3, "mouthUpperUpRight": 0.3},
+	"TH":  {"jawOpen": 0.2, "tongueOut": 0.3},
+	"DD":  {"jawOpen": 0.2},
+	"kk":  {"jawOpen": 0.25},
+	"CH":  {"jawOpen": 0.15, "mouthFunnel": 0.5},
+	"SS":  {"jawOpen": 0.1, "mouthStretchLeft": 0.3, "mouthStretchRight": 0.3},
+	"nn":  {"jawOpen": 0.15},
+	"RR":  {"jawOpen": 0.15, "mouthFunnel": 0.3, "mouthPucker": 0.2},
+	"aa":  {"jawOpen": 0.6},
+	"E":   {"jawOpen": 0.35, "mouthStretchLeft": 0.3, "mouthStretchRight": 0.3},
+	"ih":  {"jawOpen": 0.25, "mouthSmileLeft": 0.3, "mouthSmileRight": 0.3},
+	"oh":  {"jawOpen": 0.4, "mouthFunnel": 0.5},
+	"ou":  {"jawOpen": 0.15, "mouthPucker": 0.7},
+}
+
+// VisemeKey is one entry of a viseme timeline: the viseme held from Time for
+// Duration milliseconds. ID indexes the Oculus set; the ARKit set adds the
+// blendshape weights that pose it
+type VisemeKey struct {
+	Time        int                `json:"time"`
+	Duration    int                `json:"duration"`
+	ID          int                `json:"id"`
+	Viseme      string             `json:"viseme"`
+	Blendshapes map[string]float32 `json:"blendshapes,omitempty"`
+}
+
+// VisemeTimeline is the JSON part returned alongside the audio
+type VisemeTimeline struct {
+	Set      string      `json:"set"`
+	Duration int         `json:"duration"` // ms of audio
+	Visemes  []VisemeKey `json:"visemes"`
+}
+
+// validateVisemes checks the requested viseme set; the timeline is sent in a
+// multipart response with the audio, so other response modes are excluded
+func validateVisemes(req *TTSRequest) error {
+	if req.Visemes == "" {
+		return nil
+	}
+	if req.Visemes != visemeSetOculus && req.Visemes != visemeSetARKit {
+		return fmt.Errorf("visemes must be %q or %q", visemeSetOculus, visemeSetARKit)
+	}
+	if req.Stream || req.Preview || req.ReturnURL || len(req.SpeechMarks) > 0 {
+		return fmt.Errorf("visemes is not supported with stream, preview, return_url or speech_marks")
+	}
+	return nil
+}
+
+// handleVisemeResponse synthesizes the request and responds with a
+// multipart/mixed body: the audio, then its viseme timeline as JSON
+func handleVisemeResponse(w http.ResponseWriter, req *TTSRequest) {
+	result, sampleRate, err := synthesizeSpeech(req, nil)
+	if err != nil {
+		log.Printf("TTS Error: %v", err)
+		sendError(w, "Speech generation failed: "+err.Error(), speechErrorStatus(w, err))
+		return
+	}
+	audioData, err := convertToFormat(result.Wav, sampleRate, req)
+	if err != nil {
+		log.Printf("TTS Error: %v", err)
+		sendError(w, "Speech generation failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	timeline := VisemeTimeline{
+		Set:      req.Visemes,
+		Duration: millis(result.Duration),
+		Visemes:  buildVisemeTimeline(result.Spans, result.Duration, req.Visemes),
+	}
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.Header().Set("X-Supertonic-Chunks", strconv.Itoa(req.chunks))
+	w.Header().Set("X-Supertonic-Truncated", strconv.FormatBool(req.truncated))
+	if err := writeAudioPart(mw, "audio", req.Steps, req.ResponseFormat, audioData); err != nil {
+		log.Printf("Failed to write audio part: %v", err)
+		return
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", "application/json")
+	header.Set("X-Supertonic-Render", "visemes")
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		log.Printf("Failed to write viseme part: %v", err)
+		return
+	}
+	json.NewEncoder(part).Encode(timeline)
+	mw.Close()
+}
+
+// buildVisemeTimeline derives a viseme timeline from the synthesized chunk
+// spans, timing words as the speech marks do and holding silence between
+// chunks and after the last one until the end of the audio
+func buildVisemeTimeline(spans []tts.SpokenSpan, duration float32, set string) []VisemeKey {
+	keys := []VisemeKey{{Viseme: "sil"}}
+	add := func(at float32, viseme string) {
+		last := &keys[len(keys)-1]
+		if last.Viseme == viseme {
+			return
+		}
+		if t := millis(at); t == last.Time {
+			last.Viseme = viseme
+		} else {
+			keys = append(keys, VisemeKey{Time: t, Viseme: viseme})
+		}
+	}
+	for _, span := range spans {
+		for _, w := range spokenWords(span) {
+			values := letterVisemes(w.Text, oculusLetters, "aa")
+			step := (w.End - w.Start) / float32(max(len(values), 1))
+			for i, v := range values {
+				add(w.Start+step*float32(i), v)
+			}
+		}
+		add(span.End, "sil")
+	}
+
+	end := millis(duration)
+	for i := range keys {
+		next := end
+		if i+1 < len(keys) {
+			next = keys[i+1].Time
+		}
+		keys[i].Duration = max(next-keys[i].Time, 0)
+		for id, name := range oculusVisemes {
+			if name == keys[i].Viseme {
+				keys[i].ID = id
+			}
+		}
+		if set == visemeSetARKit {
+			keys[i].Blendshapes = arkitBlendshapes[keys[i].Viseme]
+		}
+	}
+	return keys
+}
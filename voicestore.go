@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"go-supertonic/tts"
+)
+
+// maxVoiceBytes bounds an uploaded voice style file
+const maxVoiceBytes = 5 << 20
+
+// voiceStoreMu serializes uploads so concurrent ones cannot overshoot the quota
+var voiceStoreMu sync.Mutex
+
+// voiceNamePattern restricts custom voice names, and the API key names their
+// directories are named after, to safe path components
+var voiceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// setupVoiceStore validates the custom voice flags. Custom voices live in
+// --voice-dir/<key name>/<voice>.json and are addressed as "<key name>/<voice>",
+// so they need --api-keys to tell tenants apart
+func setupVoiceStore() error {
+	if config.VoiceDir == "" {
+		return nil
+	}
+	if apiKeys == nil {
+		return fmt.Errorf("--voice-dir requires --api-keys")
+	}
+	if config.VoiceQuota < 1 {
+		return fmt.Errorf("--voice-quota must be at least 1")
+	}
+	for _, key := range apiKeys {
+		if !voiceNamePattern.MatchString(key.Name) {
+			return fmt.Errorf("API key name %q cannot name a voice directory (letters, digits, _ and -)", key.Name)
+		}
+	}
+	if err := os.MkdirAll(config.VoiceDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create voice directory: %w", err)
+	}
+	return nil
+}
+
+// splitVoiceNamespace splits "owner/name" into its parts; built-in voices have no owner
+func splitVoiceNamespace(voice string) (owner, name string, namespaced bool) {
+	return strings.Cut(voice, "/")
+}
+
+// voiceStylePath resolves a request's voice to its style file: a built-in
+// voice of the model pack (its style for the request's language if the pack
+// ships one), or a custom voice of the request's own API key.
+// Another tenant's voice is refused without revealing whether it exists
+func voiceStylePath(req *TTSRequest, pack ModelPack) (string, error) {
+	owner, name, namespaced := splitVoiceNamespace(req.Voice)
+	if !namespaced {
+		return tts.GetVoicePathForLanguage(req.Voice, pack.Dir, req.Language)
+	}
+	if config.VoiceDir == "" || !voiceNamePattern.MatchString(name) {
+		return "", fmt.Errorf("unsupported voice: %s", req.Voice)
+	}
+	if req.key == nil || req.key.Name != owner {
+		return "", fmt.Errorf("%w: %s", errVoiceForbidden, req.Voice)
+	}
+
+	path := filepath.Join(config.VoiceDir, owner, name+".json")
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("unsupported voice: %s", req.Voice)
+	}
+	return path, nil
+}
+
+// validateVoiceStyle checks that an upload is a voice style file whose tensors
+// match their declared dimensions
+func validateVoiceStyle(data []byte) error {
+	var style tts.VoiceStyleData
+	if err := json.Unmarshal(data, &style); err != nil {
+		return fmt.Errorf("invalid voice style JSON: %w", err)
+	}
+	tensors := map[string]struct {
+		data [][][]float64
+		dims []int64
+	}{
+		"style_ttl": {style.StyleTTL.Data, style.StyleTTL.Dims},
+		"style_dp":  {style.StyleDP.Data, style.StyleDP.Dims},
+	}
+	for field, t := range tensors {
+		if len(t.dims) != 3 || t.dims[0] != 1 || t.dims[1] < 1 || t.dims[2] < 1 || int64(len(t.data)) != t.dims[0] {
+			return fmt.Errorf("%s must be a 1 x N x M tensor", field)
+		}
+		if int64(len(t.data[0])) != t.dims[1] {
+			return fmt.Errorf("%s does not match its dims", field)
+		}
+		for _, row := range t.data[0] {
+			if int64(len(row)) != t.dims[2] {
+				return fmt.Errorf("%s does not match its dims", field)
+			}
+		}
+	}
+	return nil
+}
+
+// customVoices lists the voice names stored for an API key
+func customVoices(key *apiKey) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(config.VoiceDir, key.Name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".json"); ok && entry.Type().IsRegular() && voiceNamePattern.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// handleVoices lists the voices the caller may use: built-in voices its key
+// allows and its own custom voices
+func handleVoices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := requestAPIKey(r)
+	voices := []string{}
+	for _, voice := range sortedVoices() {
+		if key.allowsVoice(voice) {
+			voices = append(voices, voice)
+		}
+	}
+	custom := []string{}
+	if config.VoiceDir != "" && key != nil {
+		names, err := customVoices(key)
+		if err != nil {
+			sendError(w, "Failed to list voices: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, name := range names {
+			custom = append(custom, key.Name+"/"+name)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"voices": voices,
+		"custom": custom,
+		"quota":  config.VoiceQuota,
+	})
+}
+
+// handleCustomVoice stores (PUT, body is a voice style JSON) or deletes a
+// custom voice in the caller's namespace. Uploads beyond --voice-quota are
+// refused; replacing an existing voice does not count against it
+func handleCustomVoice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := requestAPIKey(r)
+	if config.VoiceDir == "" || key == nil {
+		sendError(w, "Custom voices are disabled (start the server with --voice-dir and --api-keys)", http.StatusNotFound)
+		return
+	}
+
+	// A namespaced name may only be the caller's own
+	name := r.PathValue("name")
+	if owner, rest, namespaced := splitVoiceNamespace(name); namespaced {
+		if owner != key.Name {
+			sendError(w, "Voices can only be managed in your own namespace", http.StatusForbidden)
+			return
+		}
+		name = rest
+	}
+	if !voiceNamePattern.MatchString(name) {
+		sendError(w, "Voice names are 1-64 letters, digits, _ or -", http.StatusBadRequest)
+		return
+	}
+	dir := filepath.Join(config.VoiceDir, key.Name)
+	path := filepath.Join(dir, name+".json")
+
+	if r.Method == http.MethodDelete {
+		if err := os.Remove(path); err != nil {
+			sendError(w, "Voice not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxVoiceBytes))
+	if err != nil {
+		sendError(w, "Failed to read voice style: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateVoiceStyle(data); err != nil {
+		sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	voiceStoreMu.Lock()
+	defer voiceStoreMu.Unlock()
+	_, statErr := os.Stat(path)
+	replacing := statErr == nil
+	if !replacing {
+		existing, err := customVoices(key)
+		if err != nil {
+			sendError(w, "Failed to list voices: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(existing) >= config.VoiceQuota {
+			sendError(w, fmt.Sprintf("Voice quota of %d reached; delete a voice first", config.VoiceQuota), http.StatusForbidden)
+			return
+		}
+	}
+
+	// Write through a temporary file so a running synthesis never reads half a style
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		sendError(w, "Failed to store voice: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err == nil {
+		_, err = tmp.Write(data)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}
+	if err != nil {
+		sendError(w, "Failed to store voice: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusCreated
+	if replacing {
+		status = http.StatusOK
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"voice": key.Name + "/" + name})
+}
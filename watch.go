@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// clipboardCommands lists the clipboard readers tried per platform, in order.
+// The "primary" selection (X11/Wayland) holds the currently selected text
+var clipboardCommands = map[string]map[string][][]string{
+	"clipboard": {
+		"darwin":  {{"pbpaste"}},
+		"windows": {{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"}},
+		"linux":   {{"wl-paste", "--no-newline"}, {"xclip", "-o", "-selection", "clipboard"}, {"xsel", "--clipboard", "--output"}},
+	},
+	"primary": {
+		"linux": {{"wl-paste", "--primary", "--no-newline"}, {"xclip", "-o", "-selection", "primary"}, {"xsel", "--primary", "--output"}},
+	},
+}
+
+// findClipboardCommand returns the command that prints the given selection
+func findClipboardCommand(selection string) ([]string, error) {
+	platforms, ok := clipboardCommands[selection]
+	if !ok {
+		return nil, fmt.Errorf("unsupported selection: %s (use clipboard or primary)", selection)
+	}
+	for _, candidate := range platforms[runtime.GOOS] {
+		if _, err := exec.LookPath(candidate[0]); err == nil {
+			return candidate, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s reader found for %s (tried %v)", selection, runtime.GOOS, platforms[runtime.GOOS])
+}
+
+// runWatch implements `supertonic watch`: read aloud whatever new text appears
+// on the clipboard (or selection), or is appended to a file
+func runWatch(args []string) {
+	fs, opts := newCLIFlagSet("watch")
+	file := fs.String("file", "", "Watch this file and read text appended to it (clipboard is watched if empty)")
+	selection := fs.String("selection", "clipboard", "Selection to watch: clipboard, or primary for selected text (X11/Wayland)")
+	interval := fs.Duration("interval", 500*time.Millisecond, "Polling interval")
+	player := fs.String("player", os.Getenv("SUPERTONIC_PLAYER"), "Audio player command (auto-detected if empty)")
+	fs.Parse(args)
+
+	var next func() (string, error)
+	if *file != "" {
+		next = fileWatcher(*file)
+	} else {
+		command, err := findClipboardCommand(*selection)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		next = clipboardWatcher(command)
+	}
+
+	cleanup := startCLI(opts)
+	defer cleanup()
+
+	log.Printf("Watching for new text (Ctrl+C to stop)")
+	for {
+		text, err := next()
+		if err != nil {
+			log.Printf("Watch: %v", err)
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			if audioData, err := synthesizeCLI(opts, text, formatWAV); err != nil {
+				log.Printf("Speech generation failed: %v", err)
+			} else if err := playAudio(audioData, *player); err != nil {
+				log.Fatalf("%v", err)
+			}
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// clipboardWatcher returns a poll function yielding the clipboard whenever it changes.
+// Text already on the clipboard at startup is not read
+func clipboardWatcher(command []string) func() (string, error) {
+	read := func() (string, error) {
+		out, err := exec.Command(command[0], command[1:]...).Output()
+		return string(out), err
+	}
+	last, _ := read()
+
+	return func() (string, error) {
+		current, err := read()
+		if err != nil || current == last {
+			return "", err
+		}
+		last = current
+		return current, nil
+	}
+}
+
+// fileWatcher returns a poll function yielding text appended to a file since
+// the last poll. A file that shrinks (truncated or replaced) is read from the start
+func fileWatcher(path string) func() (string, error) {
+	var offset int64
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+
+	return func() (string, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			return "", err
+		}
+		if info.Size() < offset {
+			offset = 0
+		}
+		if info.Size() == offset {
+			return "", nil
+		}
+
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return "", err
+		}
+		data, err := io.ReadAll(io.LimitReader(f, 1<<20))
+		if err != nil {
+			return "", err
+		}
+		offset += int64(len(data))
+		return string(data), nil
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+
+	"go-supertonic/tts"
+)
+
+// wyomingChunkBytes is the PCM payload size of one audio-chunk event
+const wyomingChunkBytes = 4096
+
+// wyomingMaxEvent bounds each part of a client event: the header line, its
+// data and its payload
+const wyomingMaxEvent = 1 << 20
+
+// wyomingEvent is one Wyoming protocol event: a JSON header line, optionally
+// followed by data_length bytes of extra JSON data and payload_length bytes of payload
+type wyomingEvent struct {
+	Type          string                 `json:"type"`
+	Data          map[string]interface{} `json:"data,omitempty"`
+	DataLength    int                    `json:"data_length,omitempty"`
+	PayloadLength int                    `json:"payload_length,omitempty"`
+
+	payload []byte
+}
+
+// wyomingSynthesize is the data of a synthesize event
+type wyomingSynthesize struct {
+	Text  string `json:"text"`
+	Voice struct {
+		Name     string `json:"name"`
+		Language string `json:"language"`
+	} `json:"voice"`
+}
+
+// serveWyoming accepts Wyoming TTS clients (e.g. Home Assistant's Wyoming
+// integration) on addr
+func serveWyoming(addr string) {
+	listener, err := listen(sdWyomingSocket, addr)
+	if err != nil {
+		log.Fatalf("Failed to start Wyoming server: %v", err)
+	}
+	fmt.Printf("Wyoming TTS server listening on tcp://%s\n", listener.Addr())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("Wyoming: accept failed: %v", err)
+			continue
+		}
+		go handleWyomingConn(conn)
+	}
+}
+
+// handleWyomingConn answers describe and synthesize events until the client disconnects
+func handleWyomingConn(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		// Each event must arrive within --read-timeout of the last
+		conn.SetReadDeadline(frameDeadline(config.ReadTimeout))
+		event, err := readWyomingEvent(reader)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Wyoming %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		switch event.Type {
+		case "describe":
+			err = writeWyomingEvent(conn, "info", wyomingInfo(), nil)
+		case "synthesize":
+			err = wyomingSynthesizeEvent(conn, event)
+		}
+		if err != nil {
+			log.Printf("Wyoming %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// readWyomingEvent reads one event with its data and payload
+func readWyomingEvent(reader *bufio.Reader) (*wyomingEvent, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > wyomingMaxEvent {
+			return nil, fmt.Errorf("event header longer than %d bytes", wyomingMaxEvent)
+		}
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return nil, err
+		}
+	}
+	var event wyomingEvent
+	if err := json.Unmarshal(line, &event); err != nil {
+		return nil, fmt.Errorf("invalid event header: %w", err)
+	}
+	if event.DataLength > wyomingMaxEvent || event.PayloadLength > wyomingMaxEvent {
+		return nil, fmt.Errorf("event data or payload longer than %d bytes", wyomingMaxEvent)
+	}
+
+	if event.DataLength > 0 {
+		data := make([]byte, event.DataLength)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		if event.Data == nil {
+			event.Data = map[string]interface{}{}
+		}
+		if err := json.Unmarshal(data, &event.Data); err != nil {
+			return nil, fmt.Errorf("invalid event data: %w", err)
+		}
+	}
+	if event.PayloadLength > 0 {
+		event.payload = make([]byte, event.PayloadLength)
+		if _, err := io.ReadFull(reader, event.payload); err != nil {
+			return nil, err
+		}
+	}
+	return &event, nil
+}
+
+// writeWyomingEvent sends one event, within --stream-write-timeout on a connection
+func writeWyomingEvent(w io.Writer, eventType string, data interface{}, payload []byte) error {
+	if conn, ok := w.(net.Conn); ok {
+		conn.SetWriteDeadline(frameDeadline(config.StreamWriteTimeout))
+	}
+	header := map[string]interface{}{"type": eventType}
+	var encoded []byte
+	if data != nil {
+		var err error
+		if encoded, err = json.Marshal(data); err != nil {
+			return err
+		}
+		header["data_length"] = len(encoded)
+	}
+	if len(payload) > 0 {
+		header["payload_length"] = len(payload)
+	}
+
+	line, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	message := append(append(line, '\n'), encoded...)
+	_, err = w.Write(append(message, payload...))
+	return err
+}
+
+// wyomingInfo describes the server's voices for the describe event
+func wyomingInfo() map[string]interface{} {
+	attribution := map[string]string{"name": "Supertone", "url": "https://github.com/supertone-inc/supertonic"}
+
+	names := sortedVoices()
+	voices := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		voices = append(voices, map[string]interface{}{
+			"name":        name,
+			"description": "Supertonic voice " + name,
+			"attribution": attribution,
+			"installed":   true,
+			"languages":   tts.AvailableLangs,
+		})
+	}
+
+	return map[string]interface{}{
+		"tts": []map[string]interface{}{{
+			"name":        "supertonic",
+			"description": "Supertonic on-device TTS",
+			"attribution": attribution,
+			"installed":   true,
+			"voices":      voices,
+		}},
+	}
+}
+
+// wyomingSynthesizeEvent renders a synthesize event as audio-start, audio-chunk... and audio-stop
+func wyomingSynthesizeEvent(conn net.Conn, event *wyomingEvent) error {
+	encoded, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	var synth wyomingSynthesize
+	if err := json.Unmarshal(encoded, &synth); err != nil {
+		return fmt.Errorf("invalid synthesize data: %w", err)
+	}
+
+	req := TTSRequest{
+		Input:          synth.Text,
+		Voice:          synth.Voice.Name,
+		Language:       wyomingLanguage(synth.Voice.Language),
+		ResponseFormat: formatWAV,
+		SampleFormat:   sampleFormatS16,
+	}
+	if err := validateRequest(&req); err != nil {
+		return writeWyomingEvent(conn, "error", map[string]string{"text": err.Error(), "code": "invalid-request"}, nil)
+	}
+
+	log.Printf("Wyoming: voice=%s, text=\"%.50s\"", req.Voice, req.Input)
+	audioData, err := generateSpeech(&req)
+	if err != nil {
+		return writeWyomingEvent(conn, "error", map[string]string{"text": err.Error(), "code": "synthesis-failed"}, nil)
+	}
+	rate, pcm, err := wavPCM(audioData)
+	if err != nil {
+		return err
+	}
+
+	format := map[string]int{"rate": rate, "width": 2, "channels": 1}
+	if err := writeWyomingEvent(conn, "audio-start", format, nil); err != nil {
+		return err
+	}
+	for start := 0; start < len(pcm); start += wyomingChunkBytes {
+		chunk := pcm[start:min(start+wyomingChunkBytes, len(pcm))]
+		if err := writeWyomingEvent(conn, "audio-chunk", format, chunk); err != nil {
+			return err
+		}
+	}
+	return writeWyomingEvent(conn, "audio-stop", map[string]int{}, nil)
+}
+
+// wyomingLanguage reduces a locale such as "en_US" to the model's language code
+func wyomingLanguage(locale string) string {
+	lang, _, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+	return strings.ToLower(lang)
+}
+
+// wavPCM returns the sample rate and data chunk of a WAV file
+func wavPCM(data []byte) (int, []byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return 0, nil, fmt.Errorf("not a WAV file")
+	}
+
+	rate := 0
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8 : min(pos+8+size, len(data))]
+		switch id {
+		case "fmt ":
+			if len(body) >= 8 {
+				rate = int(binary.LittleEndian.Uint32(body[4:8]))
+			}
+		case "data":
+			if rate == 0 {
+				return 0, nil, fmt.Errorf("WAV data before fmt chunk")
+			}
+			return rate, body, nil
+		}
+		pos += 8 + size + size%2
+	}
+	return 0, nil, fmt.Errorf("WAV file has no data chunk")
+}